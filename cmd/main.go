@@ -4,21 +4,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
 	"github.com/Br0ce/opera/pkg/api"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/engine/loop"
 	"github.com/Br0ce/opera/pkg/monitor"
 )
 
 func main() {
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, stop := shutdownContext()
 	defer stop()
 
 	if err := start(ctx); err != nil {
@@ -28,26 +33,34 @@ func main() {
 	}
 }
 
-// start inits tracing and logging for the service and starts serving opera.
+// start inits tracing and logging for the service and starts serving opera. If
+// MCP_STDIO is true, opera serves a MCP client over stdin and stdout instead of the api,
+// and writes its output to stderr.
 func start(ctx context.Context) error {
+	mcpStdio := os.Getenv("MCP_STDIO") == "true"
+	var out io.Writer = os.Stdout
+	if mcpStdio {
+		out = os.Stderr
+	}
+
 	err := godotenv.Load("config/.env")
 	if err != nil {
-		fmt.Printf("load ./config/.env file: %s\n", err.Error())
+		fmt.Fprintf(out, "load ./config/.env file: %s\n", err.Error())
 	}
 
 	addr, ok := os.LookupEnv("ADDR")
 	if !ok {
 		addr = ":8080"
-		fmt.Printf("cannot read environment variable ADDR, use %s\n", addr)
+		fmt.Fprintf(out, "cannot read environment variable ADDR, use %s\n", addr)
 	}
 	traceAddr, ok := os.LookupEnv("TRACE_ADDR")
 	if !ok {
 		traceAddr = "tracing:4318"
-		fmt.Printf("cannot read environment variable TRACE_ADDR, use %s\n", traceAddr)
+		fmt.Fprintf(out, "cannot read environment variable TRACE_ADDR, use %s\n", traceAddr)
 	}
 	debugFlag, ok := os.LookupEnv("DEBUG_LOGGER")
 	if !ok {
-		fmt.Printf("cannot read environment variable DEBUG_LOGGER, using prod logger\n")
+		fmt.Fprintf(out, "cannot read environment variable DEBUG_LOGGER, using prod logger\n")
 	}
 	var debug bool
 	if debugFlag == "true" {
@@ -56,7 +69,7 @@ func start(ctx context.Context) error {
 
 	readTimeout, ok := os.LookupEnv("READ_TIMEOUT")
 	if !ok {
-		fmt.Printf("cannot read environment variable READ_TIMEOUT, using prod logger\n")
+		fmt.Fprintf(out, "cannot read environment variable READ_TIMEOUT, using prod logger\n")
 	}
 	readTmt, err := time.ParseDuration(readTimeout)
 	if err != nil {
@@ -65,14 +78,171 @@ func start(ctx context.Context) error {
 
 	writeTimeout, ok := os.LookupEnv("WRITE_TIMEOUT")
 	if !ok {
-		fmt.Printf("cannot read environment variable DEBUG_LOGGER, using prod logger\n")
+		fmt.Fprintf(out, "cannot read environment variable DEBUG_LOGGER, using prod logger\n")
 	}
 	writeTmt, err := time.ParseDuration(writeTimeout)
 	if err != nil {
 		return fmt.Errorf("parse write timeout %s: %s", writeTimeout, err.Error())
 	}
 
-	log := monitor.NewLogger(debug)
+	var apiOpts []api.Option
+	if agentsFile, ok := os.LookupEnv("AGENTS_FILE"); ok && agentsFile != "" {
+		apiOpts = append(apiOpts, api.WithAgentsFile(agentsFile, os.Getenv("OPENAI_TOKEN")))
+	}
+
+	jobWorkers := 4
+	if workers, ok := os.LookupEnv("JOB_WORKERS"); ok {
+		jobWorkers, err = strconv.Atoi(workers)
+		if err != nil || jobWorkers < 1 {
+			return fmt.Errorf("parse job workers %s: invalid number of workers", workers)
+		}
+	}
+	jobTmt := time.Hour
+	if jobTTL, ok := os.LookupEnv("JOB_TTL"); ok {
+		jobTmt, err = time.ParseDuration(jobTTL)
+		if err != nil {
+			return fmt.Errorf("parse job ttl %s: %s", jobTTL, err.Error())
+		}
+	}
+	apiOpts = append(apiOpts, api.WithJobs(jobWorkers, jobTmt))
+
+	maxIter := 10
+	if iter, ok := os.LookupEnv("MAX_ITER"); ok {
+		maxIter, err = strconv.Atoi(iter)
+		if err != nil || maxIter < 1 {
+			return fmt.Errorf("parse max iter %s: invalid number of iterations", iter)
+		}
+	}
+	exhaustion := loop.ExhaustError
+	if policy, ok := os.LookupEnv("EXHAUSTION_POLICY"); ok {
+		exhaustion = loop.Exhaustion(policy)
+		if !exhaustion.Valid() {
+			return fmt.Errorf("exhaustion policy %s invalid", policy)
+		}
+	}
+	apiOpts = append(apiOpts, api.WithMaxIter(maxIter, exhaustion))
+
+	cacheTTL := time.Minute
+	if ttl, ok := os.LookupEnv("TOOL_CACHE_TTL"); ok {
+		cacheTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			return fmt.Errorf("parse tool cache ttl %s: %s", ttl, err.Error())
+		}
+	}
+	cacheSize := 1000
+	if size, ok := os.LookupEnv("TOOL_CACHE_SIZE"); ok {
+		cacheSize, err = strconv.Atoi(size)
+		if err != nil || cacheSize < 0 {
+			return fmt.Errorf("parse tool cache size %s: invalid size", size)
+		}
+	}
+	apiOpts = append(apiOpts, api.WithToolCache(cacheTTL, cacheSize))
+
+	concurrency := 16
+	if limit, ok := os.LookupEnv("TOOL_CONCURRENCY"); ok {
+		concurrency, err = strconv.Atoi(limit)
+		if err != nil || concurrency < 0 {
+			return fmt.Errorf("parse tool concurrency %s: invalid limit", limit)
+		}
+	}
+	queueTimeout := 30 * time.Second
+	if timeout, ok := os.LookupEnv("TOOL_QUEUE_TIMEOUT"); ok {
+		queueTimeout, err = time.ParseDuration(timeout)
+		if err != nil || queueTimeout < 0 {
+			return fmt.Errorf("parse tool queue timeout %s: invalid duration", timeout)
+		}
+	}
+	apiOpts = append(apiOpts, api.WithToolLimits(concurrency, queueTimeout))
+
+	if timeout, ok := os.LookupEnv("TOOL_TIMEOUT"); ok {
+		toolTimeout, err := time.ParseDuration(timeout)
+		if err != nil || toolTimeout <= 0 {
+			return fmt.Errorf("parse tool timeout %s: invalid duration", timeout)
+		}
+		apiOpts = append(apiOpts, api.WithToolTimeout(toolTimeout))
+	}
+
+	threshold := 5
+	if limit, ok := os.LookupEnv("TOOL_BREAKER_THRESHOLD"); ok {
+		threshold, err = strconv.Atoi(limit)
+		if err != nil || threshold < 0 {
+			return fmt.Errorf("parse tool breaker threshold %s: invalid number of failures", limit)
+		}
+	}
+	cooldown := 30 * time.Second
+	if timeout, ok := os.LookupEnv("TOOL_BREAKER_COOLDOWN"); ok {
+		cooldown, err = time.ParseDuration(timeout)
+		if err != nil || cooldown < 0 {
+			return fmt.Errorf("parse tool breaker cooldown %s: invalid duration", timeout)
+		}
+	}
+	apiOpts = append(apiOpts, api.WithToolBreakers(threshold, cooldown))
+
+	if docker, ok := os.LookupEnv("DOCKER_DISCOVERY"); ok {
+		enabled, err := strconv.ParseBool(docker)
+		if err != nil {
+			return fmt.Errorf("parse docker discovery %s: %s", docker, err.Error())
+		}
+		apiOpts = append(apiOpts, api.WithDockerDiscovery(enabled))
+	}
+
+	if kind, ok := os.LookupEnv("KUBERNETES_DISCOVERY"); ok && kind != "" {
+		apiOpts = append(apiOpts, api.WithKubernetesDiscovery(kind, os.Getenv("KUBERNETES_NAMESPACE"), os.Getenv("KUBERNETES_KUBECONFIG")))
+	}
+
+	if sources, ok := os.LookupEnv("OPENAPI_SOURCES"); ok && sources != "" {
+		apiOpts = append(apiOpts, api.WithOpenAPIDiscovery(
+			strings.Split(sources, ","),
+			os.Getenv("OPENAPI_SERVER"),
+			splitList(os.Getenv("OPENAPI_INCLUDE_TAGS")),
+			splitList(os.Getenv("OPENAPI_EXCLUDE_TAGS"))),
+			api.WithOpenAPIOperations(
+				splitList(os.Getenv("OPENAPI_INCLUDE_OPERATIONS")),
+				splitList(os.Getenv("OPENAPI_EXCLUDE_OPERATIONS"))))
+	}
+
+	if mcpFile, ok := os.LookupEnv("MCP_SERVERS_FILE"); ok && mcpFile != "" {
+		apiOpts = append(apiOpts, api.WithMCPDiscovery(mcpFile))
+	}
+
+	if credsFile, ok := os.LookupEnv("CREDENTIALS_FILE"); ok && credsFile != "" {
+		apiOpts = append(apiOpts, api.WithCredentials(credsFile))
+	}
+
+	if detect, ok := os.LookupEnv("LOOP_DETECTION"); ok {
+		detectLoops, err := strconv.ParseBool(detect)
+		if err != nil {
+			return fmt.Errorf("parse loop detection %s: %s", detect, err.Error())
+		}
+		apiOpts = append(apiOpts, api.WithLoopDetection(detectLoops))
+	}
+
+	if hooks, ok := os.LookupEnv("HOOKS"); ok && hooks != "" {
+		apiOpts = append(apiOpts, api.WithHooks(strings.Split(hooks, ",")...))
+	}
+
+	if guardFile, ok := os.LookupEnv("GUARDRAILS_FILE"); ok && guardFile != "" {
+		apiOpts = append(apiOpts, api.WithGuardrails(guardFile, os.Getenv("OPENAI_TOKEN")))
+	}
+
+	fanoutTimeout := time.Minute
+	if timeout, ok := os.LookupEnv("FANOUT_TIMEOUT"); ok {
+		fanoutTimeout, err = time.ParseDuration(timeout)
+		if err != nil || fanoutTimeout <= 0 {
+			return fmt.Errorf("parse fanout timeout %s: invalid duration", timeout)
+		}
+	}
+	apiOpts = append(apiOpts, api.WithFanout(fanoutTimeout, os.Getenv("FANOUT_JUDGE_MODEL"), os.Getenv("OPENAI_TOKEN")))
+
+	if graphFile, ok := os.LookupEnv("GRAPH_FILE"); ok && graphFile != "" {
+		apiOpts = append(apiOpts, api.WithGraph(graphFile))
+	}
+
+	if dir, ok := os.LookupEnv("CHECKPOINT_DIR"); ok && dir != "" {
+		apiOpts = append(apiOpts, api.WithCheckpoints(dir, os.Getenv("CHECKPOINT_RESUME") == "auto"))
+	}
+
+	log := monitor.NewLoggerTo(out, debug)
 	tpShutdown, err := monitor.StartTracing(ctx, traceAddr)
 	if err != nil {
 		return fmt.Errorf("init tracing: %w", err)
@@ -81,16 +251,21 @@ func start(ctx context.Context) error {
 		log.Info("shutdown open telemetry stack", "method", "start")
 		err := tpShutdown(context.Background())
 		if err != nil {
-			fmt.Printf("shut down open telemetry: %s\n", err)
+			fmt.Fprintf(out, "shut down open telemetry: %s\n", err)
 		}
 	}()
 
-	api, apiShutdown, err := api.NewHTTP(ctx, log)
+	api, apiShutdown, err := api.NewHTTP(ctx, log, apiOpts...)
 	if err != nil {
 		return fmt.Errorf("new http api: %w", err)
 	}
 	defer apiShutdown()
 
+	if mcpStdio {
+		log.Info("serve mcp over stdio", "method", "start")
+		return api.ServeMCP(ctx, os.Stdin, os.Stdout)
+	}
+
 	srv := &http.Server{
 		Addr:         addr,
 		BaseContext:  func(_ net.Listener) context.Context { return ctx },
@@ -119,3 +294,30 @@ func start(ctx context.Context) error {
 		return srv.Shutdown(context.Background())
 	}
 }
+
+// shutdownContext returns a context which is canceled with engine.ErrShutdown on an
+// interrupt, so that the checkpoints of the interrupted queries are kept.
+func shutdownContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		select {
+		case <-sig:
+			cancel(engine.ErrShutdown)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sig)
+		cancel(nil)
+	}
+}
+
+// splitList returns the comma separated values of s, or nil if s is empty.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
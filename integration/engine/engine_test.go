@@ -65,7 +65,7 @@ func TestEngine_Query(t *testing.T) {
 
 	reasoner := openai.NewReasoner(token, "gpt-4o", log)
 	sysPrompt := "You are an intelligent assistant that always explains your thought process before taking action."
-	agent := function.NewAgent(sysPrompt, discovery, reasoner, log)
+	agent := function.NewAgent(sysPrompt, discovery, reasoner, log).NewThread("integration")
 	transporter := transport.NewHTTP(time.Second * 30)
 	actor := action.NewActor(discovery, transporter, log)
 
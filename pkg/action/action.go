@@ -1,6 +1,10 @@
 package action
 
-import "github.com/Br0ce/opera/pkg/tool"
+import (
+	"encoding/json"
+
+	"github.com/Br0ce/opera/pkg/tool"
+)
 
 // Action is a type to hold the content needed for an upcoming action.
 // An Action can be of type 'tool' or 'user', e.q. it is meant to be
@@ -48,3 +52,32 @@ func (a Action) Reason() (reason string, ok bool) {
 	}
 	return a.reason, true
 }
+
+type actionJSON struct {
+	User   string      `json:"user,omitempty"`
+	Reason string      `json:"reason,omitempty"`
+	Tool   []tool.Call `json:"tool,omitempty"`
+}
+
+// MarshalJSON encodes the action, e.g. to persist it in a checkpoint.
+func (a Action) MarshalJSON() ([]byte, error) {
+	return json.Marshal(actionJSON{
+		User:   a.user,
+		Reason: a.reason,
+		Tool:   a.tool,
+	})
+}
+
+func (a *Action) UnmarshalJSON(data []byte) error {
+	var aj actionJSON
+	err := json.Unmarshal(data, &aj)
+	if err != nil {
+		return err
+	}
+	*a = Action{
+		user:   aj.User,
+		reason: aj.Reason,
+		tool:   aj.Tool,
+	}
+	return nil
+}
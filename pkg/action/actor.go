@@ -1,43 +1,116 @@
 package action
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 
+	"github.com/Br0ce/opera/pkg/auth"
 	"github.com/Br0ce/opera/pkg/monitor"
 	"github.com/Br0ce/opera/pkg/percept"
 	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/transport"
 )
 
 type Transporter interface {
-	Post(ctx context.Context, addr string, header map[string][]string, body io.Reader) ([]byte, error)
+	Do(ctx context.Context, method string, addr string, header map[string][]string, body io.Reader) ([]byte, error)
 }
 
 type Actor struct {
-	discovery tool.Discovery
-	transport Transporter
-	tr        trace.Tracer
-	log       *slog.Logger
+	discovery   tool.Discovery
+	transport   Transporter
+	schemes     map[string]Transporter
+	cache       *Cache
+	limiter     *Limiter
+	breakers    *Breakers
+	credentials *auth.Credentials
+	timeout     time.Duration
+	tr          trace.Tracer
+	log         *slog.Logger
 }
 
-func NewActor(discovery tool.Discovery, transport Transporter, log *slog.Logger) *Actor {
-	return &Actor{
+type Option func(ac *Actor)
+
+// WithCache answers calls to cacheable tools from the given cache, if the tool has
+// been called with the same arguments before.
+func WithCache(cache *Cache) Option {
+	return func(ac *Actor) {
+		ac.cache = cache
+	}
+}
+
+// WithLimiter bounds the calls running at once and the rate of calls to each tool.
+// Calls are queued per agent, see ContextWithAgent.
+func WithLimiter(limiter *Limiter) Option {
+	return func(ac *Actor) {
+		ac.limiter = limiter
+	}
+}
+
+// WithBreakers rejects calls to tools whose breaker is open, so that agents do not wait
+// for tool services which are down.
+func WithBreakers(breakers *Breakers) Option {
+	return func(ac *Actor) {
+		ac.breakers = breakers
+	}
+}
+
+// WithCredentials authenticates the calls to tools with a credential.
+func WithCredentials(credentials *auth.Credentials) Option {
+	return func(ac *Actor) {
+		ac.credentials = credentials
+	}
+}
+
+// WithTransport calls the tools whose addr has the given scheme, e.g. mcp, with the
+// transport instead of the default transport of the actor.
+func WithTransport(scheme string, transport Transporter) Option {
+	return func(ac *Actor) {
+		if ac.schemes == nil {
+			ac.schemes = make(map[string]Transporter)
+		}
+		ac.schemes[scheme] = transport
+	}
+}
+
+// WithTimeout limits each attempt to call a tool without a timeout of its own.
+func WithTimeout(timeout time.Duration) Option {
+	return func(ac *Actor) {
+		ac.timeout = timeout
+	}
+}
+
+func NewActor(discovery tool.Discovery, transport Transporter, log *slog.Logger, options ...Option) *Actor {
+	ac := &Actor{
 		discovery: discovery,
 		transport: transport,
 		tr:        monitor.Tracer("Actor"),
 		log:       log,
 	}
+	for _, opt := range options {
+		opt(ac)
+	}
+	return ac
 }
 
 // Act executes all given tool calls concurrently and returns their results as a slice
-// of perceptions.
+// of perceptions in the order of the calls. A failed call results in a tool percept
+// describing the failure, so that the agent can react to it. An error is only returned
+// if the action is not of type tool or the context is done.
 func (ac *Actor) Act(ctx context.Context, action Action) ([]percept.Percept, error) {
 	ctx, span := ac.tr.Start(ctx, "Act on calls")
 	defer span.End()
@@ -47,47 +120,48 @@ func (ac *Actor) Act(ctx context.Context, action Action) ([]percept.Percept, err
 		return nil, fmt.Errorf("action is not of type tool")
 	}
 
-	callNum := len(calls)
-	results := make([]percept.Percept, 0, callNum)
-	resultChan := make(chan percept.Percept, callNum)
-	errChan := make(chan error, callNum)
-	defer func() {
-		close(resultChan)
-		close(errChan)
-	}()
-
+	results := make([]percept.Percept, len(calls))
+	var wg sync.WaitGroup
 	for i, call := range calls {
 		ac.log.Debug("iterate tool calls", "method", "Act", "num", i, "traceID", monitor.TraceID(span))
 
-		go func(ctx context.Context, call tool.Call) {
-			percept, err := ac.act(ctx, call)
-			if err != nil {
-				errChan <- fmt.Errorf("act on tool call %s: %w", call.Name, err)
-			}
-			resultChan <- percept
-		}(ctx, call)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = ac.act(ctx, call)
+		}()
 	}
+	wg.Wait()
 
-	// Collect all results or errors from the act goroutines.
-	var err error
-	for range callNum {
-		select {
-		case result := <-resultChan:
-			results = append(results, result)
-		case callErr := <-errChan:
-			err = errors.Join(err, callErr)
-		}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("call tool services: %w", err)
 	}
 
+	return results, nil
+}
+
+// NeedsApproval reports if the given call targets a tool that requires a human
+// approval. Unknown tools do not require an approval, the call fails when acted upon.
+func (ac *Actor) NeedsApproval(ctx context.Context, call tool.Call) bool {
+	tool, err := ac.discovery.Get(ctx, call.Name)
 	if err != nil {
-		return nil, fmt.Errorf("call tool services: %w", err)
+		return false
 	}
+	return tool.Approval()
+}
 
-	return results, nil
+// Idempotent reports if the given call targets a tool which can safely be called again
+// with the same arguments. Unknown tools are not idempotent.
+func (ac *Actor) Idempotent(ctx context.Context, call tool.Call) bool {
+	to, err := ac.discovery.Get(ctx, call.Name)
+	if err != nil {
+		return false
+	}
+	return to.Idempotent()
 }
 
 // act execute the call to the tool service and returns the result as a perception.
-func (ac *Actor) act(ctx context.Context, call tool.Call) (percept.Percept, error) {
+func (ac *Actor) act(ctx context.Context, call tool.Call) percept.Percept {
 	ctx, span := ac.tr.Start(ctx, "execute call")
 	defer span.End()
 	ac.log.Debug("execute call to the tool service",
@@ -95,21 +169,280 @@ func (ac *Actor) act(ctx context.Context, call tool.Call) (percept.Percept, erro
 		"toolName", call.Name,
 		"traceID", monitor.TraceID(span))
 
-	tool, err := ac.discovery.Get(ctx, call.Name)
+	to, err := ac.discovery.Get(ctx, call.Name)
 	if err != nil {
-		return percept.Percept{}, fmt.Errorf("get tool: %w", err)
+		return ac.fail(span, call, &tool.Error{
+			Kind:    tool.ErrNotFound,
+			Message: fmt.Sprintf("tool %s not found", call.Name),
+		})
 	}
 
-	addr := tool.Addr()
+	if toolErr := validArguments(to, call.Arguments); toolErr != nil {
+		return ac.fail(span, call, toolErr)
+	}
+
+	addr := to.Addr()
 	attr := attribute.String("tool.addr", addr.String())
 	span.SetAttributes(attr)
 
-	header := make(map[string][]string)
-	header["content-type"] = []string{"application/json"}
-	resp, err := ac.transport.Post(ctx, addr.String(), header, strings.NewReader(call.Arguments))
+	cacheable := ac.cache != nil && to.Cacheable()
+	if cacheable {
+		content, hit := ac.cache.Get(call.Name, call.Arguments)
+		span.SetAttributes(attribute.Bool("tool.cache.hit", hit))
+		if hit {
+			ac.log.Debug("cache hit", "method", "act", "toolName", call.Name, "traceID", monitor.TraceID(span))
+			return percept.MakeTool(call.ID, content)
+		}
+	}
+
+	if ac.limiter != nil {
+		start := time.Now()
+		release, err := ac.limiter.Acquire(ctx, agentFromContext(ctx), to)
+		span.SetAttributes(attribute.Int64("tool.queue.ms", time.Since(start).Milliseconds()))
+		if errors.Is(err, ErrLimitTimeout) {
+			return ac.fail(span, call, &tool.Error{
+				Kind:    tool.ErrLimited,
+				Message: "the tool service is busy, the call was not executed",
+			})
+		}
+		if err != nil {
+			return ac.fail(span, call, toolError(err))
+		}
+		defer release()
+	}
+
+	if ac.breakers != nil {
+		err := ac.breakers.Allow(call.Name)
+		span.SetAttributes(attribute.String("tool.breaker", string(ac.breakers.State(call.Name))))
+		if err != nil {
+			return ac.fail(span, call, &tool.Error{
+				Kind:    tool.ErrUnavailable,
+				Message: "the tool service failed repeatedly and is unavailable for now, use another tool or try again later",
+			})
+		}
+	}
+
+	resp, toolErr := ac.post(ctx, span, to, call)
+	ac.record(ctx, call.Name, toolErr)
+	if toolErr != nil {
+		return ac.fail(span, call, toolErr)
+	}
+
+	if cacheable {
+		ac.cache.Set(call.Name, call.Arguments, string(resp), to.CacheTTL())
+	}
+	return percept.MakeTool(call.ID, string(resp))
+}
+
+// post sends the call to the tool service and returns the response body. Each attempt
+// is limited to the timeout of the tool, failed attempts are retried according to the
+// retry policy of the tool. If the tool service rejects a credential obtained from an
+// issuer, the credential is obtained again once.
+func (ac *Actor) post(ctx context.Context, span trace.Span, to tool.Tool, call tool.Call) ([]byte, *tool.Error) {
+	req, err := to.Request().Build(to.Addr(), call.Arguments)
 	if err != nil {
-		return percept.Percept{}, fmt.Errorf("transport: %w", err)
+		return nil, &tool.Error{
+			Kind:    tool.ErrInvalidArguments,
+			Message: fmt.Sprintf("arguments do not match the request of the tool: %s", err.Error()),
+		}
 	}
+	span.SetAttributes(attribute.String("http.request.method", req.Method))
+	policy := to.Retry()
+	timeout := to.Timeout()
+	if timeout == 0 {
+		timeout = ac.timeout
+	}
+	cred, hasCred := ac.credentials.Get(call.Name)
+	span.SetAttributes(attribute.Bool("tool.auth", hasCred))
+	reauth := hasCred
+
+	for retry := 0; ; retry++ {
+		span.SetAttributes(attribute.Int("tool.attempts", retry+1))
+		resp, err := ac.attempt(ctx, timeout, req, cred)
+		if err == nil {
+			return resp, nil
+		}
 
-	return percept.MakeTool(call.ID, string(resp)), nil
+		toolErr := toolError(err)
+		if inv, ok := cred.(auth.Invalidator); ok && toolErr.Status == http.StatusUnauthorized {
+			inv.Invalidate()
+			if reauth && ctx.Err() == nil {
+				reauth = false
+				retry--
+				span.AddEvent("credential rejected")
+				continue
+			}
+		}
+		if retry >= policy.MaxRetries || ctx.Err() != nil || !retryable(toolErr, policy, to.Idempotent()) {
+			return nil, toolErr
+		}
+		delay := policy.Delay(retry)
+		ac.log.Debug("retry call",
+			"method", "post",
+			"toolName", call.Name,
+			"retry", retry+1,
+			"delay", delay,
+			"error", toolErr.Error(),
+			"traceID", monitor.TraceID(span))
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("tool.retry", retry+1),
+			attribute.String("tool.error", toolErr.Error()),
+		))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, toolErr
+		}
+	}
+}
+
+// record records the outcome of the call to the tool with the given name at the
+// breakers, if set.
+func (ac *Actor) record(ctx context.Context, name string, toolErr *tool.Error) {
+	if ac.breakers == nil {
+		return
+	}
+	if toolErr != nil && ctx.Err() != nil {
+		// The call was canceled, the tool service is not to blame.
+		ac.breakers.Abort(name)
+		return
+	}
+	ac.breakers.Record(name, toolErr != nil && breakerFailure(toolErr))
+}
+
+// attempt sends the request to the tool service within the timeout, if set,
+// authenticated with the credential, if set.
+func (ac *Actor) attempt(ctx context.Context, timeout time.Duration, req tool.HTTPRequest, cred auth.Credential) ([]byte, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	header := maps.Clone(req.Header)
+	if cred != nil {
+		err := cred.Apply(ctx, header)
+		if err != nil {
+			return nil, &credentialError{err: err}
+		}
+	}
+	var body io.Reader
+	if req.Body != nil {
+		body = bytes.NewReader(req.Body)
+	}
+	transport := ac.transport
+	if t, ok := ac.schemes[req.URL.Scheme]; ok {
+		transport = t
+	}
+	return transport.Do(ctx, req.Method, req.URL.String(), header, body)
+}
+
+// credentialError is returned if the credential of a tool could not be applied.
+type credentialError struct {
+	err error
+}
+
+func (e *credentialError) Error() string {
+	return fmt.Sprintf("apply credential: %s", e.err.Error())
+}
+
+func (e *credentialError) Unwrap() error {
+	return e.err
+}
+
+// unprocessedStatusCodes tell that the tool service did not process a call.
+var unprocessedStatusCodes = []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+
+// retryable reports whether a call failed with toolErr is retried under the policy.
+// Calls which timed out, failed in transport or were answered with a status other than
+// the unprocessedStatusCodes may have been executed, they are only retried for
+// idempotent tools.
+func retryable(toolErr *tool.Error, policy tool.RetryPolicy, idempotent bool) bool {
+	switch toolErr.Kind {
+	case tool.ErrStatus:
+		if !idempotent && !slices.Contains(unprocessedStatusCodes, toolErr.Status) {
+			return false
+		}
+		return policy.Retryable(toolErr.Status)
+	case tool.ErrTimeout, tool.ErrTransport:
+		return idempotent && policy.Retryable(0)
+	default:
+		return false
+	}
+}
+
+// fail records the failed call and returns its error percept.
+func (ac *Actor) fail(span trace.Span, call tool.Call, toolErr *tool.Error) percept.Percept {
+	span.SetStatus(codes.Error, toolErr.Error())
+	span.SetAttributes(attribute.String("tool.error", string(toolErr.Kind)))
+	ac.log.Info("tool call failed",
+		"method", "act",
+		"toolName", call.Name,
+		"error", toolErr.Error(),
+		"traceID", monitor.TraceID(span))
+	return percept.MakeToolError(call.ID, toolErr)
+}
+
+// validArguments validates the arguments against the parameters of the tool. Empty
+// arguments are an empty object. The returned error lists all violations, so that the
+// agent can correct the call.
+func validArguments(to tool.Tool, arguments string) *tool.Error {
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+	err := to.ValidateArguments([]byte(arguments))
+	if err != nil {
+		return &tool.Error{
+			Kind:    tool.ErrInvalidArguments,
+			Message: fmt.Sprintf("arguments do not match the parameters of the tool: %s", err.Error()),
+		}
+	}
+	return nil
+}
+
+// toolError classifies the given transport error.
+func toolError(err error) *tool.Error {
+	var credErr *credentialError
+	if errors.As(err, &credErr) {
+		return &tool.Error{
+			Kind:    tool.ErrAuth,
+			Message: fmt.Sprintf("the credentials of the tool could not be obtained: %s", credErr.err.Error()),
+		}
+	}
+
+	var statusErr *transport.StatusError
+	if errors.As(err, &statusErr) {
+		msg := strings.TrimSpace(statusErr.Body)
+		if msg == "" {
+			msg = statusErr.Status
+		}
+		return &tool.Error{
+			Kind:    tool.ErrStatus,
+			Status:  statusErr.Code,
+			Message: msg,
+		}
+	}
+
+	var callErr *transport.CallError
+	if errors.As(err, &callErr) {
+		return &tool.Error{
+			Kind:    tool.ErrFailed,
+			Message: callErr.Message,
+		}
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &tool.Error{
+			Kind:    tool.ErrTimeout,
+			Message: "the tool service did not answer in time",
+		}
+	}
+
+	return &tool.Error{
+		Kind:    tool.ErrTransport,
+		Message: err.Error(),
+	}
 }
@@ -0,0 +1,767 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/auth"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	toolMock "github.com/Br0ce/opera/pkg/tool/mock"
+	"github.com/Br0ce/opera/pkg/transport"
+	transportMock "github.com/Br0ce/opera/pkg/transport/mock"
+)
+
+// poster is a Transporter answering every request with fn, regardless of its method.
+type poster struct {
+	fn func(ctx context.Context, addr string, header map[string][]string, body io.Reader) ([]byte, error)
+}
+
+func (p poster) Do(ctx context.Context, _ string, addr string, header map[string][]string, body io.Reader) ([]byte, error) {
+	return p.fn(ctx, addr, header, body)
+}
+
+func (p poster) Post(ctx context.Context, addr string, header map[string][]string, body io.Reader) ([]byte, error) {
+	return p.fn(ctx, addr, header, body)
+}
+
+func TestActor_Act(t *testing.T) {
+	t.Parallel()
+
+	discovery := &toolMock.Discovery{
+		GetFn: func(_ context.Context, name string) (tool.Tool, error) {
+			for _, to := range tool.TestTools() {
+				if to.Name() == name {
+					return to, nil
+				}
+			}
+			return tool.Tool{}, errors.New("not found")
+		},
+	}
+	nameA := tool.TestToolA().Name()
+	nameB := tool.TestToolB().Name()
+
+	tests := []struct {
+		name     string
+		calls    []tool.Call
+		post     func(ctx context.Context, addr string, header map[string][]string, body io.Reader) ([]byte, error)
+		want     []string
+		wantKind []tool.ErrorKind
+	}{
+		{
+			name: "order of calls",
+			calls: []tool.Call{
+				{ID: "1", Name: nameA, Arguments: `{"location":"slow"}`},
+				{ID: "2", Name: nameB, Arguments: `{"location":"fast"}`},
+			},
+			post: func(_ context.Context, _ string, _ map[string][]string, body io.Reader) ([]byte, error) {
+				bb, _ := io.ReadAll(body)
+				if strings.Contains(string(bb), "slow") {
+					time.Sleep(20 * time.Millisecond)
+					return []byte("slow"), nil
+				}
+				return []byte("fast"), nil
+			},
+			want:     []string{"slow", "fast"},
+			wantKind: []tool.ErrorKind{"", ""},
+		},
+		{
+			name: "failures",
+			calls: []tool.Call{
+				{ID: "1", Name: "unknown", Arguments: "{}"},
+				{ID: "2", Name: nameA, Arguments: "not json"},
+				{ID: "3", Name: nameA, Arguments: `{"location":"status"}`},
+				{ID: "4", Name: nameB, Arguments: `{"location":"timeout"}`},
+				{ID: "5", Name: nameB, Arguments: `{"location":"Sydney"}`},
+				{ID: "6", Name: nameB, Arguments: `{"location":42}`},
+				{ID: "7", Name: nameB, Arguments: ""},
+			},
+			post: func(_ context.Context, _ string, _ map[string][]string, body io.Reader) ([]byte, error) {
+				bb, _ := io.ReadAll(body)
+				switch {
+				case strings.Contains(string(bb), "status"):
+					return nil, &transport.StatusError{Code: 400, Status: "400 Bad Request", Body: "city unknown"}
+				case strings.Contains(string(bb), "timeout"):
+					return nil, context.DeadlineExceeded
+				default:
+					return []byte("ok"), nil
+				}
+			},
+			want: []string{"", "", "", "", "ok", "", ""},
+			wantKind: []tool.ErrorKind{
+				tool.ErrNotFound,
+				tool.ErrInvalidArguments,
+				tool.ErrStatus,
+				tool.ErrTimeout,
+				"",
+				tool.ErrInvalidArguments,
+				tool.ErrInvalidArguments,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actor := NewActor(discovery, poster{fn: test.post}, monitor.NewTestLogger(false))
+
+			got, err := actor.Act(context.TODO(), MakeTool(test.calls, ""))
+			if err != nil {
+				t.Fatalf("Actor.Act() error = %v", err)
+			}
+			if len(got) != len(test.calls) {
+				t.Fatalf("Actor.Act() len = %v, want %v", len(got), len(test.calls))
+			}
+			for i, p := range got {
+				resp, ok := p.Tool()
+				if !ok {
+					t.Fatalf("Actor.Act() percept %d is not of type tool", i)
+				}
+				if resp.ID != test.calls[i].ID {
+					t.Errorf("Actor.Act() percept %d id = %v, want %v", i, resp.ID, test.calls[i].ID)
+				}
+				var kind tool.ErrorKind
+				if resp.Err != nil {
+					kind = resp.Err.Kind
+				}
+				if kind != test.wantKind[i] {
+					t.Errorf("Actor.Act() percept %d kind = %v, want %v", i, kind, test.wantKind[i])
+				}
+				if resp.Err == nil && resp.Content != test.want[i] {
+					t.Errorf("Actor.Act() percept %d content = %v, want %v", i, resp.Content, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestActor_ActCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	discovery := &toolMock.Discovery{
+		GetFn: func(_ context.Context, _ string) (tool.Tool, error) {
+			return tool.TestToolA(), nil
+		},
+	}
+	post := poster{fn: func(ctx context.Context, _ string, _ map[string][]string, _ io.Reader) ([]byte, error) {
+		cancel()
+		return nil, ctx.Err()
+	}}
+	actor := NewActor(discovery, post, monitor.NewTestLogger(false))
+
+	calls := []tool.Call{{ID: "1", Name: tool.TestToolA().Name(), Arguments: `{"location":"Sydney"}`}}
+	_, err := actor.Act(ctx, MakeTool(calls, ""))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Actor.Act() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestActor_ActCache(t *testing.T) {
+	t.Parallel()
+
+	readOnly, err := tool.MakeTool(
+		tool.WithName("get_names"),
+		tool.WithDescription("Get all names from my db for the given location."),
+		tool.WithAddr(url.URL{Host: "mySvc"}),
+		tool.WithParameters(map[string]any{}, nil),
+		tool.WithReadOnly(true),
+	)
+	if err != nil {
+		t.Fatalf("make tool: %s", err.Error())
+	}
+	mutating, err := tool.MakeTool(
+		tool.WithName("set_names"),
+		tool.WithDescription("Set the names for the given location."),
+		tool.WithAddr(url.URL{Host: "mySvc"}),
+		tool.WithParameters(map[string]any{}, nil),
+		tool.WithNoCache(true),
+	)
+	if err != nil {
+		t.Fatalf("make tool: %s", err.Error())
+	}
+
+	tests := []struct {
+		name      string
+		tool      tool.Tool
+		cache     *Cache
+		wantPosts int
+	}{
+		{
+			name:      "cached",
+			tool:      readOnly,
+			cache:     NewCache(time.Minute, 10),
+			wantPosts: 1,
+		},
+		{
+			name:      "no cache",
+			tool:      readOnly,
+			wantPosts: 2,
+		},
+		{
+			name:      "not read-only tool",
+			tool:      tool.TestToolA(),
+			cache:     NewCache(time.Minute, 10),
+			wantPosts: 2,
+		},
+		{
+			name:      "mutating tool",
+			tool:      mutating,
+			cache:     NewCache(time.Minute, 10),
+			wantPosts: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			discovery := &toolMock.Discovery{
+				GetFn: func(_ context.Context, _ string) (tool.Tool, error) {
+					return test.tool, nil
+				},
+			}
+			var posts atomic.Int32
+			trans := poster{fn: func(_ context.Context, _ string, _ map[string][]string, _ io.Reader) ([]byte, error) {
+				posts.Add(1)
+				return []byte("names"), nil
+			}}
+			var opts []Option
+			if test.cache != nil {
+				opts = append(opts, WithCache(test.cache))
+			}
+			ac := NewActor(discovery, trans, monitor.NewTestLogger(false), opts...)
+
+			for _, args := range []string{`{"location":"Sydney","limit":3}`, `{"limit":3,"location":"Sydney"}`} {
+				got, err := ac.Act(context.TODO(), MakeTool([]tool.Call{{ID: "1", Name: test.tool.Name(), Arguments: args}}, ""))
+				if err != nil {
+					t.Fatalf("Actor.Act() error = %v", err)
+				}
+				resp, _ := got[0].Tool()
+				if resp.Content != "names" {
+					t.Errorf("Actor.Act() content = %v, want %v", resp.Content, "names")
+				}
+			}
+			if int(posts.Load()) != test.wantPosts {
+				t.Errorf("Actor.Act() posts = %v, want %v", posts.Load(), test.wantPosts)
+			}
+		})
+	}
+}
+
+func TestActor_ActLimited(t *testing.T) {
+	t.Parallel()
+
+	discovery := &toolMock.Discovery{
+		GetFn: func(_ context.Context, _ string) (tool.Tool, error) {
+			return tool.TestToolA(), nil
+		},
+	}
+	var posts atomic.Int32
+	trans := poster{fn: func(_ context.Context, _ string, _ map[string][]string, _ io.Reader) ([]byte, error) {
+		posts.Add(1)
+		return []byte("names"), nil
+	}}
+	limiter := NewLimiter(1, 20*time.Millisecond)
+	ac := NewActor(discovery, trans, monitor.NewTestLogger(false), WithLimiter(limiter))
+
+	// Another agent holds the only slot.
+	release, err := limiter.Acquire(context.TODO(), "other", tool.TestToolA())
+	if err != nil {
+		t.Fatalf("Limiter.Acquire() error = %v", err)
+	}
+	ctx := ContextWithAgent(context.TODO(), "agent")
+	got, err := ac.Act(ctx, MakeTool([]tool.Call{{ID: "1", Name: tool.TestToolA().Name(), Arguments: `{"location":"Sydney"}`}}, ""))
+	if err != nil {
+		t.Fatalf("Actor.Act() error = %v", err)
+	}
+	resp, _ := got[0].Tool()
+	if resp.Err == nil || resp.Err.Kind != tool.ErrLimited {
+		t.Errorf("Actor.Act() error = %v, want kind %v", resp.Err, tool.ErrLimited)
+	}
+
+	release()
+	got, err = ac.Act(ctx, MakeTool([]tool.Call{{ID: "2", Name: tool.TestToolA().Name(), Arguments: `{"location":"Sydney"}`}}, ""))
+	if err != nil {
+		t.Fatalf("Actor.Act() error = %v", err)
+	}
+	resp, _ = got[0].Tool()
+	if resp.Err != nil || resp.Content != "names" {
+		t.Errorf("Actor.Act() = %v, want %v", resp, "names")
+	}
+	if posts.Load() != 1 {
+		t.Errorf("Actor.Act() posts = %v, want 1", posts.Load())
+	}
+}
+
+func TestActor_ActBreaker(t *testing.T) {
+	t.Parallel()
+
+	discovery := &toolMock.Discovery{
+		GetFn: func(_ context.Context, _ string) (tool.Tool, error) {
+			return tool.TestToolA(), nil
+		},
+	}
+	var posts atomic.Int32
+	var down atomic.Bool
+	down.Store(true)
+	trans := poster{fn: func(_ context.Context, _ string, _ map[string][]string, _ io.Reader) ([]byte, error) {
+		posts.Add(1)
+		if down.Load() {
+			return nil, &transport.StatusError{Code: 502, Status: "502 Bad Gateway"}
+		}
+		return []byte("names"), nil
+	}}
+	breakers := NewBreakers(2, time.Hour)
+	now := time.Now()
+	breakers.now = func() time.Time { return now }
+	ac := NewActor(discovery, trans, monitor.NewTestLogger(false), WithBreakers(breakers))
+
+	act := func(wantKind tool.ErrorKind) {
+		t.Helper()
+		got, err := ac.Act(context.TODO(), MakeTool([]tool.Call{{ID: "1", Name: tool.TestToolA().Name(), Arguments: `{"location":"Sydney"}`}}, ""))
+		if err != nil {
+			t.Fatalf("Actor.Act() error = %v", err)
+		}
+		resp, _ := got[0].Tool()
+		var kind tool.ErrorKind
+		if resp.Err != nil {
+			kind = resp.Err.Kind
+		}
+		if kind != wantKind {
+			t.Fatalf("Actor.Act() error = %v, want kind %v", resp.Err, wantKind)
+		}
+	}
+
+	act(tool.ErrStatus)
+	act(tool.ErrStatus)
+	act(tool.ErrUnavailable)
+	if posts.Load() != 2 {
+		t.Errorf("Actor.Act() posts = %v, want 2", posts.Load())
+	}
+
+	down.Store(false)
+	now = now.Add(time.Hour)
+	act("")
+	if got := breakers.State(tool.TestToolA().Name()); got != BreakerClosed {
+		t.Errorf("Breakers.State() = %v, want %v", got, BreakerClosed)
+	}
+}
+
+func TestActor_ActRetry(t *testing.T) {
+	t.Parallel()
+
+	unavailable := &transport.StatusError{Code: 503, Status: "503 Service Unavailable"}
+	badRequest := &transport.StatusError{Code: 400, Status: "400 Bad Request"}
+	badGateway := &transport.StatusError{Code: 502, Status: "502 Bad Gateway"}
+
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		idempotent bool
+		retry      tool.RetryPolicy
+		failures   []error
+		block      bool
+		wantPosts  int
+		wantKind   tool.ErrorKind
+	}{
+		{
+			name:      "no retry",
+			failures:  []error{unavailable},
+			wantPosts: 1,
+			wantKind:  tool.ErrStatus,
+		},
+		{
+			name:       "retried",
+			idempotent: true,
+			retry:      tool.RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond},
+			failures:   []error{unavailable, errors.New("connection reset")},
+			wantPosts:  3,
+		},
+		{
+			name:      "transport not retried if not idempotent",
+			retry:     tool.RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond},
+			failures:  []error{errors.New("connection reset")},
+			wantPosts: 1,
+			wantKind:  tool.ErrTransport,
+		},
+		{
+			name:      "retries exhausted",
+			retry:     tool.RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond},
+			failures:  []error{unavailable, unavailable, unavailable},
+			wantPosts: 3,
+			wantKind:  tool.ErrStatus,
+		},
+		{
+			name:      "status not retried",
+			retry:     tool.RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond},
+			failures:  []error{badRequest},
+			wantPosts: 1,
+			wantKind:  tool.ErrStatus,
+		},
+		{
+			name:       "declared status retried",
+			idempotent: true,
+			retry:      tool.RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond, StatusCodes: []int{400}},
+			failures:   []error{badRequest},
+			wantPosts:  2,
+		},
+		{
+			name:       "bad gateway retried",
+			idempotent: true,
+			retry:      tool.RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond},
+			failures:   []error{badGateway},
+			wantPosts:  2,
+		},
+		{
+			name:      "bad gateway not retried if not idempotent",
+			retry:     tool.RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond},
+			failures:  []error{badGateway},
+			wantPosts: 1,
+			wantKind:  tool.ErrStatus,
+		},
+		{
+			name:       "tool timeout",
+			timeout:    10 * time.Millisecond,
+			idempotent: true,
+			retry:      tool.RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond},
+			block:      true,
+			wantPosts:  2,
+			wantKind:   tool.ErrTimeout,
+		},
+		{
+			name:      "timeout not retried if not idempotent",
+			timeout:   10 * time.Millisecond,
+			retry:     tool.RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond},
+			block:     true,
+			wantPosts: 1,
+			wantKind:  tool.ErrTimeout,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			to, err := tool.MakeTool(
+				tool.WithName("get_names"),
+				tool.WithDescription("Get the names for the given location."),
+				tool.WithAddr(url.URL{Host: "mySvc"}),
+				tool.WithParameters(map[string]any{}, nil),
+				tool.WithTimeout(test.timeout),
+				tool.WithIdempotent(test.idempotent),
+				tool.WithRetry(test.retry),
+			)
+			if err != nil {
+				t.Fatalf("make tool: %s", err.Error())
+			}
+			discovery := &toolMock.Discovery{
+				GetFn: func(_ context.Context, _ string) (tool.Tool, error) {
+					return to, nil
+				},
+			}
+			var posts atomic.Int32
+			trans := poster{fn: func(ctx context.Context, _ string, _ map[string][]string, _ io.Reader) ([]byte, error) {
+				n := int(posts.Add(1))
+				if test.block {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+				if n <= len(test.failures) {
+					return nil, test.failures[n-1]
+				}
+				return []byte("names"), nil
+			}}
+			// The default timeout of the actor must not apply to tools with their own.
+			ac := NewActor(discovery, trans, monitor.NewTestLogger(false), WithTimeout(time.Hour))
+
+			got, err := ac.Act(context.TODO(), MakeTool([]tool.Call{{ID: "1", Name: to.Name(), Arguments: "{}"}}, ""))
+			if err != nil {
+				t.Fatalf("Actor.Act() error = %v", err)
+			}
+			resp, _ := got[0].Tool()
+			var kind tool.ErrorKind
+			if resp.Err != nil {
+				kind = resp.Err.Kind
+			}
+			if kind != test.wantKind {
+				t.Errorf("Actor.Act() error = %v, want kind %v", resp.Err, test.wantKind)
+			}
+			if test.wantKind == "" && resp.Content != "names" {
+				t.Errorf("Actor.Act() content = %v, want %v", resp.Content, "names")
+			}
+			if int(posts.Load()) != test.wantPosts {
+				t.Errorf("Actor.Act() posts = %v, want %v", posts.Load(), test.wantPosts)
+			}
+		})
+	}
+}
+
+func Test_validArguments(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		arguments string
+		want      string
+	}{
+		{
+			name:      "valid",
+			arguments: `{"location":"Sydney"}`,
+		},
+		{
+			name:      "no json",
+			arguments: "location=Sydney",
+			want:      "invalid_arguments: arguments do not match the parameters of the tool: $: invalid JSON: invalid character 'l' looking for beginning of value",
+		},
+		{
+			name:      "empty",
+			arguments: " ",
+			want:      `invalid_arguments: arguments do not match the parameters of the tool: $: missing required property "location"`,
+		},
+		{
+			name:      "wrong type",
+			arguments: `{"location":["Sydney"]}`,
+			want:      "invalid_arguments: arguments do not match the parameters of the tool: $.location: must be of type string, got array",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := validArguments(tool.TestToolA(), test.arguments)
+			if test.want == "" {
+				if got != nil {
+					t.Errorf("validArguments() = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil || got.Error() != test.want {
+				t.Errorf("validArguments() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestActor_ActCredentials(t *testing.T) {
+	t.Parallel()
+
+	discovery := &toolMock.Discovery{
+		GetFn: func(_ context.Context, name string) (tool.Tool, error) {
+			for _, to := range tool.TestTools() {
+				if to.Name() == name {
+					return to, nil
+				}
+			}
+			return tool.Tool{}, errors.New("not found")
+		},
+	}
+
+	tests := []struct {
+		name string
+		tool string
+		// token answers the token requests of client credentials of the tool B, if set.
+		token      func(n int32) ([]byte, error)
+		wantAuth   []string
+		wantKind   tool.ErrorKind
+		wantTokens int32
+	}{
+		{
+			name:     "static",
+			tool:     tool.TestToolA().Name(),
+			wantAuth: []string{"Bearer static"},
+		},
+		{
+			name:     "no credential",
+			tool:     tool.TestToolB().Name(),
+			wantAuth: []string{""},
+		},
+		{
+			name: "rejected token fetched again",
+			tool: tool.TestToolB().Name(),
+			token: func(n int32) ([]byte, error) {
+				return fmt.Appendf(nil, `{"access_token":"token-%d","expires_in":3600}`, n), nil
+			},
+			wantAuth:   []string{"Bearer token-1", "Bearer token-2"},
+			wantTokens: 2,
+		},
+		{
+			name: "token endpoint down",
+			tool: tool.TestToolB().Name(),
+			token: func(int32) ([]byte, error) {
+				return nil, &transport.StatusError{Code: 503, Status: "503 Service Unavailable"}
+			},
+			wantKind:   tool.ErrAuth,
+			wantTokens: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var tokens atomic.Int32
+			var mu sync.Mutex
+			var gotAuth []string
+			trans := poster{fn: func(_ context.Context, addr string, header map[string][]string, _ io.Reader) ([]byte, error) {
+				if addr == "http://auth/token" {
+					return test.token(tokens.Add(1))
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				var authz string
+				if v := header["Authorization"]; len(v) > 0 {
+					authz = v[0]
+				}
+				gotAuth = append(gotAuth, authz)
+				if authz == "Bearer token-1" {
+					return nil, &transport.StatusError{Code: 401, Status: "401 Unauthorized"}
+				}
+				return []byte("names"), nil
+			}}
+			credentials := map[string]auth.Credential{tool.TestToolA().Name(): auth.NewBearer("static")}
+			if test.token != nil {
+				credentials[tool.TestToolB().Name()] = auth.NewClientCredentials("http://auth/token", "client", "secret", nil, trans)
+			}
+			ac := NewActor(discovery, trans, monitor.NewTestLogger(false), WithCredentials(auth.NewCredentials(credentials)))
+
+			got, err := ac.Act(context.TODO(), MakeTool([]tool.Call{{ID: "1", Name: test.tool, Arguments: `{"location":"Sydney"}`}}, ""))
+			if err != nil {
+				t.Fatalf("Actor.Act() error = %v", err)
+			}
+			resp, _ := got[0].Tool()
+			var kind tool.ErrorKind
+			if resp.Err != nil {
+				kind = resp.Err.Kind
+			}
+			if kind != test.wantKind {
+				t.Errorf("Actor.Act() error = %v, want kind %v", resp.Err, test.wantKind)
+			}
+			if !slices.Equal(gotAuth, test.wantAuth) {
+				t.Errorf("Actor.Act() authorization = %v, want %v", gotAuth, test.wantAuth)
+			}
+			if tokens.Load() != test.wantTokens {
+				t.Errorf("Actor.Act() token fetches = %v, want %v", tokens.Load(), test.wantTokens)
+			}
+		})
+	}
+}
+
+func TestActor_ActRequest(t *testing.T) {
+	t.Parallel()
+
+	to, err := tool.MakeTool(
+		tool.WithName("get_user"),
+		tool.WithDescription("Get the user with the given id."),
+		tool.WithAddr(url.URL{Scheme: "http", Host: "users"}),
+		tool.WithParameters(map[string]any{
+			"id":     map[string]any{"type": "string"},
+			"fields": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"tenant": map[string]any{"type": "string"},
+		}, []string{"id"}),
+		tool.WithRequest(tool.Request{
+			Method: "GET",
+			Path:   "/users/{id}",
+			Header: map[string]string{"X-Tenant": "tenant"},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("make tool: %s", err.Error())
+	}
+	discovery := &toolMock.Discovery{
+		GetFn: func(_ context.Context, _ string) (tool.Tool, error) {
+			return to, nil
+		},
+	}
+	trans := &transportMock.Transporter{
+		DoFn: func(_ context.Context, method string, addr string, header map[string][]string, body io.Reader) ([]byte, error) {
+			if method != "GET" || body != nil {
+				return nil, fmt.Errorf("unexpected method %s with body %v", method, body)
+			}
+			return fmt.Appendf(nil, "%s %v %v", addr, header["X-Tenant"], header["Authorization"]), nil
+		},
+	}
+	credentials := auth.NewCredentials(map[string]auth.Credential{"get_user": auth.NewBearer("token")})
+	ac := NewActor(discovery, trans, monitor.NewTestLogger(false), WithCredentials(credentials))
+
+	got, err := ac.Act(context.TODO(), MakeTool([]tool.Call{{ID: "1", Name: "get_user", Arguments: `{"id":"4 2","fields":["name","mail"],"tenant":"acme"}`}}, ""))
+	if err != nil {
+		t.Fatalf("Actor.Act() error = %v", err)
+	}
+	resp, _ := got[0].Tool()
+	want := "http://users/users/4%202?fields=name&fields=mail [acme] [Bearer token]"
+	if resp.Err != nil || resp.Content != want {
+		t.Errorf("Actor.Act() = %v, %v, want %v", resp.Content, resp.Err, want)
+	}
+}
+
+func TestActor_ActTransport(t *testing.T) {
+	t.Parallel()
+
+	to, err := tool.MakeTool(
+		tool.WithName("search"),
+		tool.WithDescription("Search the web."),
+		tool.WithAddr(url.URL{Scheme: "mcp", Host: "web", Path: "/search"}),
+		tool.WithParameters(map[string]any{"q": map[string]any{"type": "string"}}, []string{"q"}),
+	)
+	if err != nil {
+		t.Fatalf("make tool: %s", err.Error())
+	}
+	discovery := &toolMock.Discovery{
+		GetFn: func(_ context.Context, _ string) (tool.Tool, error) {
+			return to, nil
+		},
+	}
+	trans := &transportMock.Transporter{
+		DoFn: func(_ context.Context, _ string, _ string, _ map[string][]string, _ io.Reader) ([]byte, error) {
+			return nil, fmt.Errorf("default transport used")
+		},
+	}
+	var calls int
+	mcpTrans := &transportMock.Transporter{
+		DoFn: func(_ context.Context, method string, addr string, _ map[string][]string, body io.Reader) ([]byte, error) {
+			calls++
+			if addr == "mcp://web/fail" {
+				return nil, &transport.CallError{Message: "quota exceeded"}
+			}
+			bb, err := io.ReadAll(body)
+			if err != nil {
+				return nil, err
+			}
+			return fmt.Appendf(nil, "%s %s %s", method, addr, bb), nil
+		},
+	}
+	ac := NewActor(discovery, trans, monitor.NewTestLogger(false), WithTransport("mcp", mcpTrans))
+
+	got, err := ac.Act(context.TODO(), MakeTool([]tool.Call{{ID: "1", Name: "search", Arguments: `{"q":"opera"}`}}, ""))
+	if err != nil {
+		t.Fatalf("Actor.Act() error = %v", err)
+	}
+	resp, _ := got[0].Tool()
+	want := `POST mcp://web/search {"q":"opera"}`
+	if resp.Err != nil || resp.Content != want {
+		t.Errorf("Actor.Act() = %v, %v, want %v", resp.Content, resp.Err, want)
+	}
+
+	to, _ = tool.MakeTool(
+		tool.WithName("fail"),
+		tool.WithDescription("Fail."),
+		tool.WithAddr(url.URL{Scheme: "mcp", Host: "web", Path: "/fail"}),
+		tool.WithParameters(map[string]any{}, nil),
+		tool.WithIdempotent(true),
+	)
+	got, err = ac.Act(context.TODO(), MakeTool([]tool.Call{{ID: "2", Name: "fail", Arguments: `{}`}}, ""))
+	if err != nil {
+		t.Fatalf("Actor.Act() error = %v", err)
+	}
+	resp, _ = got[0].Tool()
+	if resp.Err == nil || resp.Err.Kind != tool.ErrFailed || resp.Err.Message != "quota exceeded" {
+		t.Errorf("Actor.Act() error = %v, want kind %s", resp.Err, tool.ErrFailed)
+	}
+	// A failed call is not retried.
+	if calls != 2 {
+		t.Errorf("Transporter.Do() invoked %v times, want 2", calls)
+	}
+}
@@ -0,0 +1,191 @@
+package action
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+// ErrBreakerOpen is returned if the breaker of a tool rejects a call.
+var ErrBreakerOpen = errors.New("breaker open")
+
+// BreakerState is the state of the circuit breaker of a tool.
+type BreakerState string
+
+const (
+	// BreakerClosed lets all calls pass.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen rejects all calls until the cooldown has passed.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a single trial call pass. If it succeeds the breaker closes,
+	// otherwise it opens again.
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// BreakerStatus describes the breaker of a tool.
+type BreakerStatus struct {
+	Tool     string
+	State    BreakerState
+	Failures int
+	// Opened is the time the breaker opened last.
+	Opened time.Time
+}
+
+// Breakers holds a circuit breaker per tool. A breaker opens after threshold
+// consecutive failed calls to its tool and rejects calls for the cooldown, so that
+// agents do not wait for a tool service which is down.
+type Breakers struct {
+	threshold int
+	cooldown  time.Duration
+	breakers  map[string]*breaker
+	mu        sync.Mutex
+	now       func() time.Time
+}
+
+type breaker struct {
+	failures int
+	opened   time.Time
+	// trial is set while the trial call of the half open breaker runs.
+	trial bool
+}
+
+// NewBreakers returns Breakers opening after threshold consecutive failures for the
+// given cooldown. A threshold of zero disables the breakers.
+func NewBreakers(threshold int, cooldown time.Duration) *Breakers {
+	return &Breakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		breakers:  make(map[string]*breaker),
+		now:       time.Now,
+	}
+}
+
+// Allow reports whether a call to the tool with the given name may pass. If the breaker
+// of the tool is open, or its trial call is running, ErrBreakerOpen is returned. The
+// outcome of an allowed call must be recorded with Record or Abort.
+func (b *Breakers) Allow(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br, ok := b.breakers[name]
+	if !ok {
+		return nil
+	}
+	switch b.state(br) {
+	case BreakerOpen:
+		return ErrBreakerOpen
+	case BreakerHalfOpen:
+		if br.trial {
+			return ErrBreakerOpen
+		}
+		br.trial = true
+	}
+	return nil
+}
+
+// Record records the outcome of an allowed call to the tool with the given name.
+func (b *Breakers) Record(name string, failed bool) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br, ok := b.breakers[name]
+	if !ok {
+		if !failed {
+			return
+		}
+		br = &breaker{}
+		b.breakers[name] = br
+	}
+	trial := br.trial
+	br.trial = false
+	if !failed {
+		delete(b.breakers, name)
+		return
+	}
+	br.failures++
+	if trial || br.failures >= b.threshold {
+		br.opened = b.now()
+	}
+}
+
+// Abort ends an allowed call to the tool with the given name which was not executed
+// or whose outcome tells nothing about the tool service, e.g. because it was canceled.
+func (b *Breakers) Abort(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if br, ok := b.breakers[name]; ok {
+		br.trial = false
+	}
+}
+
+// Open reports whether the breaker of the tool with the given name rejects calls.
+func (b *Breakers) Open(name string) bool {
+	return b.State(name) == BreakerOpen
+}
+
+// State returns the state of the breaker of the tool with the given name.
+func (b *Breakers) State(name string) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br, ok := b.breakers[name]
+	if !ok {
+		return BreakerClosed
+	}
+	return b.state(br)
+}
+
+// Statuses returns the status of all breakers which are not closed or have recorded
+// failures, ordered by the name of the tool.
+func (b *Breakers) Statuses() []BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	statuses := make([]BreakerStatus, 0, len(b.breakers))
+	for name, br := range b.breakers {
+		statuses = append(statuses, BreakerStatus{
+			Tool:     name,
+			State:    b.state(br),
+			Failures: br.failures,
+			Opened:   br.opened,
+		})
+	}
+	slices.SortFunc(statuses, func(a, b BreakerStatus) int {
+		return strings.Compare(a.Tool, b.Tool)
+	})
+	return statuses
+}
+
+// state returns the state of the breaker. The caller must hold the lock.
+func (b *Breakers) state(br *breaker) BreakerState {
+	switch {
+	case br.opened.IsZero():
+		return BreakerClosed
+	case b.now().Sub(br.opened) < b.cooldown:
+		return BreakerOpen
+	default:
+		return BreakerHalfOpen
+	}
+}
+
+// breakerFailure reports whether the failed call hints at a tool service which is down.
+// Calls the tool service rejected, e.g. for invalid arguments, do not count.
+func breakerFailure(toolErr *tool.Error) bool {
+	switch toolErr.Kind {
+	case tool.ErrTimeout, tool.ErrTransport:
+		return true
+	case tool.ErrStatus:
+		return toolErr.Status >= http.StatusInternalServerError || toolErr.Status == http.StatusTooManyRequests
+	default:
+		return false
+	}
+}
@@ -0,0 +1,115 @@
+package action
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+func TestBreakers(t *testing.T) {
+	t.Parallel()
+
+	b := NewBreakers(2, time.Minute)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	name := tool.TestToolA().Name()
+
+	call := func(failed bool) {
+		t.Helper()
+		if err := b.Allow(name); err != nil {
+			t.Fatalf("Breakers.Allow() error = %v", err)
+		}
+		b.Record(name, failed)
+	}
+	wantState := func(want BreakerState) {
+		t.Helper()
+		if got := b.State(name); got != want {
+			t.Fatalf("Breakers.State() = %v, want %v", got, want)
+		}
+	}
+
+	call(true)
+	wantState(BreakerClosed)
+	call(false)
+	call(true)
+	wantState(BreakerClosed)
+	call(true)
+	wantState(BreakerOpen)
+	if err := b.Allow(name); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("Breakers.Allow() error = %v, want %v", err, ErrBreakerOpen)
+	}
+	if got := b.State(tool.TestToolB().Name()); got != BreakerClosed {
+		t.Fatalf("Breakers.State() of other tool = %v, want %v", got, BreakerClosed)
+	}
+
+	// A failed trial opens the breaker again.
+	now = now.Add(time.Minute)
+	wantState(BreakerHalfOpen)
+	if err := b.Allow(name); err != nil {
+		t.Fatalf("Breakers.Allow() trial error = %v", err)
+	}
+	if err := b.Allow(name); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("Breakers.Allow() during trial error = %v, want %v", err, ErrBreakerOpen)
+	}
+	b.Record(name, true)
+	wantState(BreakerOpen)
+
+	// An aborted trial lets the next call try.
+	now = now.Add(time.Minute)
+	if err := b.Allow(name); err != nil {
+		t.Fatalf("Breakers.Allow() trial error = %v", err)
+	}
+	b.Abort(name)
+	wantState(BreakerHalfOpen)
+
+	// A successful trial closes the breaker.
+	call(false)
+	wantState(BreakerClosed)
+	if got := b.Statuses(); len(got) != 0 {
+		t.Errorf("Breakers.Statuses() = %v, want none", got)
+	}
+}
+
+func TestBreakers_Disabled(t *testing.T) {
+	t.Parallel()
+
+	b := NewBreakers(0, time.Minute)
+	name := tool.TestToolA().Name()
+	for range 10 {
+		if err := b.Allow(name); err != nil {
+			t.Fatalf("Breakers.Allow() error = %v", err)
+		}
+		b.Record(name, true)
+	}
+	if got := b.State(name); got != BreakerClosed {
+		t.Errorf("Breakers.State() = %v, want %v", got, BreakerClosed)
+	}
+}
+
+func Test_breakerFailure(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  *tool.Error
+		want bool
+	}{
+		{name: "timeout", err: &tool.Error{Kind: tool.ErrTimeout}, want: true},
+		{name: "transport", err: &tool.Error{Kind: tool.ErrTransport}, want: true},
+		{name: "server error", err: &tool.Error{Kind: tool.ErrStatus, Status: 503}, want: true},
+		{name: "too many requests", err: &tool.Error{Kind: tool.ErrStatus, Status: 429}, want: true},
+		{name: "bad request", err: &tool.Error{Kind: tool.ErrStatus, Status: 400}, want: false},
+		{name: "invalid arguments", err: &tool.Error{Kind: tool.ErrInvalidArguments}, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := breakerFailure(test.err); got != test.want {
+				t.Errorf("breakerFailure() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
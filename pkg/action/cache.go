@@ -0,0 +1,176 @@
+package action
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+// Cache holds the results of tool calls, keyed by tool name and canonical arguments, so
+// that identical calls within the ttl are not sent to the tool again.
+type Cache struct {
+	ttl     time.Duration
+	size    int
+	entries map[cacheKey]cacheEntry
+	mu      sync.Mutex
+	now     func() time.Time
+}
+
+type cacheKey struct {
+	tool      string
+	arguments string
+}
+
+type cacheEntry struct {
+	content string
+	expires time.Time
+	hits    int
+}
+
+// CacheEntry describes a cached result.
+type CacheEntry struct {
+	Tool      string
+	Arguments string
+	Expires   time.Time
+	Hits      int
+}
+
+// NewCache returns a Cache holding at most size results. Results of tools without a ttl
+// of their own are cached for the given ttl.
+func NewCache(ttl time.Duration, size int) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[cacheKey]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// Get returns the cached content for the call of the tool with the given arguments.
+func (c *Cache) Get(tool, arguments string) (string, bool) {
+	key, err := makeCacheKey(tool, arguments)
+	if err != nil {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return "", false
+	}
+	entry.hits++
+	c.entries[key] = entry
+	return entry.content, true
+}
+
+// Set caches the content for the call of the tool with the given arguments. A zero ttl
+// means the default ttl of the cache applies. If the cache is full, expired results and
+// then the results expiring first are evicted.
+func (c *Cache) Set(tool, arguments, content string, ttl time.Duration) {
+	if ttl == 0 {
+		ttl = c.ttl
+	}
+	if ttl <= 0 || c.size < 1 {
+		return
+	}
+	key, err := makeCacheKey(tool, arguments)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		c.evict()
+	}
+	c.entries[key] = cacheEntry{
+		content: content,
+		expires: c.now().Add(ttl),
+	}
+}
+
+// Entries returns all unexpired results, ordered by tool and arguments.
+func (c *Cache) Entries() []CacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	entries := make([]CacheEntry, 0, len(c.entries))
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			continue
+		}
+		entries = append(entries, CacheEntry{
+			Tool:      key.tool,
+			Arguments: key.arguments,
+			Expires:   entry.expires,
+			Hits:      entry.hits,
+		})
+	}
+	slices.SortFunc(entries, func(a, b CacheEntry) int {
+		if n := strings.Compare(a.Tool, b.Tool); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Arguments, b.Arguments)
+	})
+	return entries
+}
+
+// Flush removes the results of the tool with the given name, or all results if name is
+// empty, and returns the number of removed results.
+func (c *Cache) Flush(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int
+	for key := range c.entries {
+		if name == "" || key.tool == name {
+			delete(c.entries, key)
+			n++
+		}
+	}
+	return n
+}
+
+// evict removes all expired results, or the result expiring first if none expired.
+// The caller must hold the lock.
+func (c *Cache) evict() {
+	now := c.now()
+	var first cacheKey
+	var firstExpires time.Time
+	var expired bool
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+			expired = true
+			continue
+		}
+		if firstExpires.IsZero() || entry.expires.Before(firstExpires) {
+			first = key
+			firstExpires = entry.expires
+		}
+	}
+	if !expired && !firstExpires.IsZero() {
+		delete(c.entries, first)
+	}
+}
+
+// makeCacheKey returns the key for the call of the tool with the given arguments. The
+// arguments are canonicalized, so that the order of keys and whitespace do not matter.
+func makeCacheKey(name, arguments string) (cacheKey, error) {
+	args, err := tool.Call{Name: name, Arguments: arguments}.CanonicalArguments()
+	if err != nil {
+		return cacheKey{}, err
+	}
+	return cacheKey{tool: name, arguments: args}, nil
+}
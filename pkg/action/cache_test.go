@@ -0,0 +1,170 @@
+package action
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_Get(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		setTool   string
+		setArgs   string
+		ttl       time.Duration
+		getTool   string
+		getArgs   string
+		elapsed   time.Duration
+		wantHit   bool
+		wantEntry int
+	}{
+		{
+			name:      "hit",
+			setTool:   "get_weather",
+			setArgs:   `{"location":"Sydney","unit":"C"}`,
+			getTool:   "get_weather",
+			getArgs:   `{"unit": "C", "location": "Sydney"}`,
+			wantHit:   true,
+			wantEntry: 1,
+		},
+		{
+			name:      "empty arguments",
+			setTool:   "get_weather",
+			setArgs:   "",
+			getTool:   "get_weather",
+			getArgs:   "{}",
+			wantHit:   true,
+			wantEntry: 1,
+		},
+		{
+			name:      "other arguments",
+			setTool:   "get_weather",
+			setArgs:   `{"location":"Sydney"}`,
+			getTool:   "get_weather",
+			getArgs:   `{"location":"Perth"}`,
+			wantEntry: 1,
+		},
+		{
+			name:      "other tool",
+			setTool:   "get_weather",
+			setArgs:   `{"location":"Sydney"}`,
+			getTool:   "get_shark_warning",
+			getArgs:   `{"location":"Sydney"}`,
+			wantEntry: 1,
+		},
+		{
+			name:    "expired",
+			setTool: "get_weather",
+			setArgs: `{"location":"Sydney"}`,
+			getTool: "get_weather",
+			getArgs: `{"location":"Sydney"}`,
+			elapsed: 2 * time.Minute,
+		},
+		{
+			name:      "tool ttl",
+			setTool:   "get_weather",
+			setArgs:   `{"location":"Sydney"}`,
+			ttl:       time.Hour,
+			getTool:   "get_weather",
+			getArgs:   `{"location":"Sydney"}`,
+			elapsed:   2 * time.Minute,
+			wantHit:   true,
+			wantEntry: 1,
+		},
+		{
+			name:    "invalid arguments",
+			setTool: "get_weather",
+			setArgs: "not json",
+			getTool: "get_weather",
+			getArgs: "not json",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := time.Now()
+			c := NewCache(time.Minute, 10)
+			c.now = func() time.Time { return now }
+
+			c.Set(test.setTool, test.setArgs, "content", test.ttl)
+			now = now.Add(test.elapsed)
+
+			got, hit := c.Get(test.getTool, test.getArgs)
+			if hit != test.wantHit {
+				t.Fatalf("Cache.Get() hit = %v, want %v", hit, test.wantHit)
+			}
+			if hit && got != "content" {
+				t.Errorf("Cache.Get() = %v, want %v", got, "content")
+			}
+			if n := len(c.Entries()); n != test.wantEntry {
+				t.Errorf("Cache.Entries() len = %v, want %v", n, test.wantEntry)
+			}
+		})
+	}
+}
+
+func TestCache_Flush(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		tool      string
+		want      int
+		wantEntry int
+	}{
+		{
+			name:      "tool",
+			tool:      "get_weather",
+			want:      2,
+			wantEntry: 1,
+		},
+		{
+			name: "all",
+			tool: "",
+			want: 3,
+		},
+		{
+			name:      "unknown tool",
+			tool:      "unknown",
+			want:      0,
+			wantEntry: 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewCache(time.Minute, 10)
+			c.Set("get_weather", `{"location":"Sydney"}`, "sunny", 0)
+			c.Set("get_weather", `{"location":"Perth"}`, "rainy", 0)
+			c.Set("get_shark_warning", `{"location":"Perth"}`, "low", 0)
+
+			got := c.Flush(test.tool)
+			if got != test.want {
+				t.Errorf("Cache.Flush() = %v, want %v", got, test.want)
+			}
+			if n := len(c.Entries()); n != test.wantEntry {
+				t.Errorf("Cache.Entries() len = %v, want %v", n, test.wantEntry)
+			}
+		})
+	}
+}
+
+func TestCache_SetFull(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	c := NewCache(time.Minute, 2)
+	c.now = func() time.Time { return now }
+
+	c.Set("get_weather", `{"location":"Sydney"}`, "sunny", 0)
+	c.Set("get_weather", `{"location":"Perth"}`, "rainy", time.Hour)
+	c.Set("get_weather", `{"location":"Darwin"}`, "hot", 0)
+
+	if _, hit := c.Get("get_weather", `{"location":"Sydney"}`); hit {
+		t.Error("Cache.Set() entry expiring first not evicted")
+	}
+	for _, args := range []string{`{"location":"Perth"}`, `{"location":"Darwin"}`} {
+		if _, hit := c.Get("get_weather", args); !hit {
+			t.Errorf("Cache.Set() entry %s evicted", args)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+// ErrLimitTimeout is returned if a call waited longer than the timeout of the Limiter.
+var ErrLimitTimeout = errors.New("limit timeout")
+
+// Limiter bounds the number of tool calls running at once and the rate of calls to
+// each tool. Calls waiting for a free slot are queued per agent and the agents take
+// turns, so that an agent emitting many calls does not starve the others.
+type Limiter struct {
+	// slots is the number of calls running at once. Zero means unlimited.
+	slots   int
+	timeout time.Duration
+	running int
+	// queues holds the waiting calls per agent, turns the agents with waiting calls in
+	// the order of their turns.
+	queues  map[string][]*waiter
+	turns   []string
+	buckets map[string]*bucket
+	mu      sync.Mutex
+	now     func() time.Time
+}
+
+// waiter is a call waiting for a slot. ready is closed once the slot is handed over.
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// bucket is the token bucket limiting the rate of calls to a tool.
+type bucket struct {
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter running at most concurrency calls at once. Calls waiting
+// longer than timeout for a slot or the rate limit of their tool fail. A concurrency or
+// timeout of zero means unlimited.
+func NewLimiter(concurrency int, timeout time.Duration) *Limiter {
+	return &Limiter{
+		slots:   concurrency,
+		timeout: timeout,
+		queues:  make(map[string][]*waiter),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Acquire waits until the call of the agent to the tool may run. The returned release
+// must be called once the call is done. If the call waited longer than the timeout of
+// the Limiter, ErrLimitTimeout is returned. If ctx is done, its error is returned.
+func (l *Limiter) Acquire(ctx context.Context, agentID string, to tool.Tool) (func(), error) {
+	waitCtx := ctx
+	if l.timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, l.timeout)
+		defer cancel()
+	}
+
+	err := l.wait(waitCtx, to)
+	if err == nil {
+		err = l.slot(waitCtx, agentID)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, ErrLimitTimeout
+	}
+	return sync.OnceFunc(l.release), nil
+}
+
+// wait takes a token from the bucket of the tool, waiting until one is available.
+func (l *Limiter) wait(ctx context.Context, to tool.Tool) error {
+	rate, burst := to.RateLimit()
+	if rate <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	b, ok := l.buckets[to.Name()]
+	if !ok || b.rate != rate || b.burst != burst {
+		b = &bucket{rate: rate, burst: burst, tokens: float64(burst), last: now}
+		l.buckets[to.Name()] = b
+	}
+	b.tokens = min(float64(b.burst), b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Return the token, the call is not made.
+		l.mu.Lock()
+		b.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// slot takes a slot for a running call, waiting in the queue of the agent until one is
+// free.
+func (l *Limiter) slot(ctx context.Context, agentID string) error {
+	l.mu.Lock()
+	if l.slots <= 0 || (l.running < l.slots && len(l.turns) == 0) {
+		l.running++
+		l.mu.Unlock()
+		return nil
+	}
+	w := &waiter{ready: make(chan struct{})}
+	if len(l.queues[agentID]) == 0 {
+		l.turns = append(l.turns, agentID)
+	}
+	l.queues[agentID] = append(l.queues[agentID], w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if w.granted {
+			// The slot was handed over concurrently, pass it on.
+			l.running--
+			l.next()
+			return ctx.Err()
+		}
+		l.remove(agentID, w)
+		return ctx.Err()
+	}
+}
+
+// release frees the slot of a finished call.
+func (l *Limiter) release() {
+	if l.slots <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	l.next()
+}
+
+// next hands free slots to the first waiting call of the agent whose turn it is. The
+// agent then moves to the end of the turns. The caller must hold the lock.
+func (l *Limiter) next() {
+	for l.running < l.slots && len(l.turns) > 0 {
+		agentID := l.turns[0]
+		l.turns = l.turns[1:]
+		queue := l.queues[agentID]
+		w := queue[0]
+		if len(queue) > 1 {
+			l.queues[agentID] = queue[1:]
+			l.turns = append(l.turns, agentID)
+		} else {
+			delete(l.queues, agentID)
+		}
+		w.granted = true
+		l.running++
+		close(w.ready)
+	}
+}
+
+// remove removes the waiting call of the agent from its queue. The caller must hold the
+// lock.
+func (l *Limiter) remove(agentID string, w *waiter) {
+	queue := slices.DeleteFunc(l.queues[agentID], func(other *waiter) bool {
+		return other == w
+	})
+	if len(queue) > 0 {
+		l.queues[agentID] = queue
+		return
+	}
+	delete(l.queues, agentID)
+	l.turns = slices.DeleteFunc(l.turns, func(id string) bool {
+		return id == agentID
+	})
+}
+
+// agentKey is the context key of the agent calling tools.
+type agentKey struct{}
+
+// ContextWithAgent returns a context for the tool calls of the agent with the given id.
+// The Limiter queues the calls of each agent separately.
+func ContextWithAgent(ctx context.Context, agentID string) context.Context {
+	return context.WithValue(ctx, agentKey{}, agentID)
+}
+
+// agentFromContext returns the id of the agent set with ContextWithAgent.
+func agentFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(agentKey{}).(string)
+	return id
+}
@@ -0,0 +1,183 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+// queued returns the number of calls waiting in the queues of the limiter.
+func queued(l *Limiter) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var n int
+	for _, q := range l.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// waitQueued waits until n calls wait in the queues of the limiter.
+func waitQueued(t *testing.T, l *Limiter, n int) {
+	t.Helper()
+	for range 200 {
+		if queued(l) == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("queued = %v, want %v", queued(l), n)
+}
+
+func TestLimiter_AcquireFair(t *testing.T) {
+	t.Parallel()
+
+	l := NewLimiter(1, 0)
+	release, err := l.Acquire(context.TODO(), "a", tool.TestToolA())
+	if err != nil {
+		t.Fatalf("Limiter.Acquire() error = %v", err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(agentID, name string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.Acquire(context.TODO(), agentID, tool.TestToolA())
+			if err != nil {
+				t.Errorf("Limiter.Acquire() error = %v", err)
+				return
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			release()
+		}()
+	}
+	// Agent a floods the queue before agent b calls once.
+	enqueue("a", "a1")
+	waitQueued(t, l, 1)
+	enqueue("a", "a2")
+	waitQueued(t, l, 2)
+	enqueue("a", "a3")
+	waitQueued(t, l, 3)
+	enqueue("b", "b1")
+	waitQueued(t, l, 4)
+
+	release()
+	// Releasing twice must not free a second slot.
+	release()
+	wg.Wait()
+
+	want := []string{"a1", "b1", "a2", "a3"}
+	if !slices.Equal(order, want) {
+		t.Errorf("Limiter.Acquire() order = %v, want %v", order, want)
+	}
+	if l.running != 0 {
+		t.Errorf("Limiter.Acquire() running = %v, want 0", l.running)
+	}
+}
+
+func TestLimiter_AcquireTimeout(t *testing.T) {
+	t.Parallel()
+
+	rated, err := tool.MakeTool(
+		tool.WithName("rated"),
+		tool.WithDescription("A tool accepting one call every ten seconds."),
+		tool.WithAddr(url.URL{Host: "mySvc"}),
+		tool.WithParameters(map[string]any{}, nil),
+		tool.WithRateLimit(0.1, 1),
+	)
+	if err != nil {
+		t.Fatalf("make tool: %s", err.Error())
+	}
+
+	tests := []struct {
+		name     string
+		slots    int
+		tool     tool.Tool
+		canceled bool
+		wantErr  error
+	}{
+		{
+			name:    "no slot",
+			slots:   1,
+			tool:    tool.TestToolA(),
+			wantErr: ErrLimitTimeout,
+		},
+		{
+			name:    "rate limit",
+			tool:    rated,
+			wantErr: ErrLimitTimeout,
+		},
+		{
+			name:     "canceled",
+			slots:    1,
+			tool:     tool.TestToolA(),
+			canceled: true,
+			wantErr:  context.Canceled,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			l := NewLimiter(test.slots, 20*time.Millisecond)
+			release, err := l.Acquire(context.TODO(), "a", test.tool)
+			if err != nil {
+				t.Fatalf("Limiter.Acquire() first error = %v", err)
+			}
+			defer release()
+
+			ctx, cancel := context.WithCancel(context.TODO())
+			defer cancel()
+			if test.canceled {
+				cancel()
+			}
+			_, err = l.Acquire(ctx, "b", test.tool)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Limiter.Acquire() error = %v, want %v", err, test.wantErr)
+			}
+			if n := queued(l); n != 0 || len(l.turns) != 0 {
+				t.Errorf("Limiter.Acquire() queued = %v, turns = %v, want none", n, l.turns)
+			}
+		})
+	}
+}
+
+func TestLimiter_AcquireRate(t *testing.T) {
+	t.Parallel()
+
+	rated, err := tool.MakeTool(
+		tool.WithName("rated"),
+		tool.WithDescription("A tool accepting twenty calls per second."),
+		tool.WithAddr(url.URL{Host: "mySvc"}),
+		tool.WithParameters(map[string]any{}, nil),
+		tool.WithRateLimit(20, 2),
+	)
+	if err != nil {
+		t.Fatalf("make tool: %s", err.Error())
+	}
+
+	l := NewLimiter(0, time.Second)
+	start := time.Now()
+	for range 4 {
+		release, err := l.Acquire(context.TODO(), "a", rated)
+		if err != nil {
+			t.Fatalf("Limiter.Acquire() error = %v", err)
+		}
+		release()
+	}
+	// The burst passes at once, the other two calls wait 50ms each.
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("Limiter.Acquire() took %v, want at least 100ms", d)
+	}
+}
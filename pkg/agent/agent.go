@@ -2,11 +2,59 @@ package agent
 
 import (
 	"context"
+	"time"
 
 	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/history"
 	"github.com/Br0ce/opera/pkg/percept"
 )
 
 type Agent interface {
 	Action(ctx context.Context, percepts []percept.Percept) (action.Action, error)
 }
+
+// Answerer is an Agent which can be asked for an answer without calling any tools,
+// e.g. when the engine runs out of iterations.
+type Answerer interface {
+	Answer(ctx context.Context, percepts []percept.Percept) (action.Action, error)
+}
+
+// Definition is a reusable agent configuration, e.g. the system prompt and the reasoner.
+// Every conversation with the agent runs in its own Thread.
+type Definition interface {
+	NewThread(id string) Thread
+}
+
+// Restorer is a Definition which can restore a thread, e.g. from a checkpoint after a
+// restart.
+type Restorer interface {
+	RestoreThread(id string, created time.Time, hist history.History) Thread
+}
+
+// Reviser is a Thread whose last answer can be revised, e.g. if the guardrails rewrite
+// or withhold it after it has been added to the history.
+type Reviser interface {
+	ReviseAnswer(content string)
+}
+
+// Recorder is a Thread to which percepts can be added without asking the agent, e.g.
+// the responses to the calls of a query which was abandoned.
+type Recorder interface {
+	Record(percepts []percept.Percept)
+}
+
+// Thread is a conversation with an agent with its own history.
+// Queries on a thread must be serialized with Lock and Unlock.
+type Thread interface {
+	Agent
+	// Lock waits until the thread is unlocked and locks it for a query. If the ctx is
+	// done first, the error of the ctx is returned and the thread is not locked.
+	Lock(ctx context.Context) error
+	Unlock()
+	ID() string
+	Created() time.Time
+	History() history.History
+	// MaxIter returns the iteration limit of queries on the thread. Zero means the
+	// limit of the engine applies.
+	MaxIter() int
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/agent/function"
+	"github.com/Br0ce/opera/pkg/engine/hook"
+	"github.com/Br0ce/opera/pkg/reason/openai"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/tool/discovery/scope"
+)
+
+const providerOpenAI = "openai"
+
+type Items struct {
+	Agents []Item `json:"agents" yaml:"agents"`
+}
+
+// Item declares an agent. The ID is stable, the agent can be queried with it across
+// restarts.
+type Item struct {
+	ID           string   `json:"ID" yaml:"ID"`
+	Model        string   `json:"Model" yaml:"Model"`
+	Provider     string   `json:"Provider" yaml:"Provider"`
+	SystemPrompt string   `json:"SystemPrompt" yaml:"SystemPrompt"`
+	Settings     Settings `json:"Settings" yaml:"Settings"`
+	// Tools limits the tools the agent can use to the given names. If empty, the agent
+	// can use all discovered tools.
+	Tools []string `json:"Tools" yaml:"Tools"`
+	// MaxIter limits the iterations of a query to the agent. If unset, the limit of the
+	// engine applies.
+	MaxIter *int `json:"MaxIter" yaml:"MaxIter"`
+	// Hooks are the names of built-in hooks intercepting the steps of queries to the
+	// agent, e.g. log, redact or clock.
+	Hooks []string `json:"Hooks" yaml:"Hooks"`
+}
+
+// Settings are the generation settings of the model. Unset values use the provider default.
+type Settings struct {
+	Temperature *float64 `json:"Temperature" yaml:"Temperature"`
+	TopP        *float64 `json:"TopP" yaml:"TopP"`
+	MaxTokens   *int64   `json:"MaxTokens" yaml:"MaxTokens"`
+}
+
+// Validate reports an error if the item is incomplete or names an unknown provider.
+// An empty provider defaults to openai.
+func (i Item) Validate() error {
+	if i.ID == "" {
+		return fmt.Errorf("ID invalid")
+	}
+	if i.Model == "" {
+		return fmt.Errorf("Model invalid")
+	}
+	if i.MaxIter != nil && *i.MaxIter < 1 {
+		return fmt.Errorf("MaxIter invalid")
+	}
+	switch i.Provider {
+	case "", providerOpenAI:
+	default:
+		return fmt.Errorf("provider %s not supported", i.Provider)
+	}
+	_, err := hook.Builtins(i.Hooks, nil)
+	if err != nil {
+		return fmt.Errorf("Hooks invalid: %w", err)
+	}
+	return nil
+}
+
+// Decode returns the agent declared by the item. The agent sees the tools of the given
+// discovery limited to the tool scope of the item.
+func (i Item) Decode(token string, discovery tool.Discovery, log *slog.Logger) (agent.Definition, error) {
+	err := i.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("validate: %w", err)
+	}
+
+	reasoner := openai.NewReasoner(token, i.Model, log, i.Settings.options()...)
+	var opts []function.Option
+	if i.MaxIter != nil {
+		opts = append(opts, function.WithMaxIter(*i.MaxIter))
+	}
+	if len(i.Hooks) > 0 {
+		hooks, err := hook.Builtins(i.Hooks, log)
+		if err != nil {
+			return nil, fmt.Errorf("hooks: %w", err)
+		}
+		opts = append(opts, function.WithHooks(hooks...))
+	}
+	return function.NewAgent(i.SystemPrompt, scope.NewDiscovery(discovery, i.Tools), reasoner, log, opts...), nil
+}
+
+func (s Settings) options() []openai.Option {
+	var opts []openai.Option
+	if s.Temperature != nil {
+		opts = append(opts, openai.WithTemperature(*s.Temperature))
+	}
+	if s.TopP != nil {
+		opts = append(opts, openai.WithTopP(*s.TopP))
+	}
+	if s.MaxTokens != nil {
+		opts = append(opts, openai.WithMaxTokens(*s.MaxTokens))
+	}
+	return opts
+}
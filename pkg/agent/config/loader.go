@@ -0,0 +1,205 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+// Loader reads declared agents from a JSON or YAML file and reconciles them with an
+// agent db. Agents not declared in the file, e.g. created through the api, are not touched.
+// The threads of removed agents are deleted. The threads of redefined agents are kept and
+// continue with the definition they were created with.
+type Loader struct {
+	path      string
+	token     string
+	db        db.Agent
+	threads   db.Thread
+	discovery tool.Discovery
+	// items holds the currently applied items by ID.
+	items   map[string]Item
+	modTime time.Time
+	mu      sync.Mutex
+	tr      trace.Tracer
+	log     *slog.Logger
+}
+
+// NewLoader returns a Loader for the agents file at path. The token is used to
+// authenticate the reasoners of the declared agents.
+func NewLoader(path string, token string, db db.Agent, threads db.Thread, discovery tool.Discovery, log *slog.Logger) *Loader {
+	return &Loader{
+		path:      path,
+		token:     token,
+		db:        db,
+		threads:   threads,
+		discovery: discovery,
+		items:     make(map[string]Item),
+		tr:        monitor.Tracer("AgentLoader"),
+		log:       log,
+	}
+}
+
+// Reconcile reads the agents file and applies it to the db. New and changed agents are
+// set, agents removed from the file are deleted together with their threads. Unchanged
+// agents keep their state.
+// If the file is invalid, nothing is applied.
+func (lo *Loader) Reconcile(ctx context.Context) error {
+	_, span := lo.tr.Start(ctx, "reconcile agents")
+	defer span.End()
+	lo.log.Debug("reconcile agents", "method", "Reconcile", "path", lo.path, "traceID", monitor.TraceID(span))
+
+	lo.mu.Lock()
+	defer lo.mu.Unlock()
+
+	info, err := os.Stat(lo.path)
+	if err != nil {
+		return fmt.Errorf("stat file %s: %w", lo.path, err)
+	}
+	items, err := readItems(lo.path)
+	if err != nil {
+		return fmt.Errorf("read agents: %w", err)
+	}
+
+	// Decode all changed items first, so that an invalid file is not applied partially.
+	next := make(map[string]Item, len(items))
+	changed := make(map[string]agent.Definition)
+	for _, item := range items {
+		if _, ok := next[item.ID]; ok {
+			return fmt.Errorf("agent %s declared twice", item.ID)
+		}
+		next[item.ID] = item
+
+		if prev, ok := lo.items[item.ID]; ok && reflect.DeepEqual(prev, item) {
+			continue
+		}
+		a, err := item.Decode(lo.token, lo.discovery, lo.log)
+		if err != nil {
+			return fmt.Errorf("decode agent %s: %w", item.ID, err)
+		}
+		changed[item.ID] = a
+	}
+
+	// Set all changed agents or none, so that a failed set does not apply the file
+	// partially.
+	prev := make(map[string]agent.Definition, len(changed))
+	for id, a := range changed {
+		p, err := lo.db.Get(id)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			lo.restore(prev)
+			return fmt.Errorf("get agent %s: %w", id, err)
+		}
+		err = lo.db.Set(id, a)
+		if err != nil {
+			lo.restore(prev)
+			return fmt.Errorf("set agent %s: %w", id, err)
+		}
+		prev[id] = p
+		lo.log.Info("set declared agent", "method", "Reconcile", "id", id)
+	}
+	for id := range lo.items {
+		if _, ok := next[id]; ok {
+			continue
+		}
+		err := lo.db.Delete(id)
+		if err != nil {
+			lo.log.Error("delete declared agent", "method", "Reconcile", "id", id, "error", err.Error())
+			continue
+		}
+		lo.threads.DeleteAll(id)
+		lo.log.Info("delete declared agent", "method", "Reconcile", "id", id)
+	}
+
+	lo.items = next
+	lo.modTime = info.ModTime()
+	return nil
+}
+
+// restore sets the given previous agents again. Agents without a previous definition
+// are deleted.
+func (lo *Loader) restore(prev map[string]agent.Definition) {
+	for id, p := range prev {
+		var err error
+		if p == nil {
+			err = lo.db.Delete(id)
+		} else {
+			err = lo.db.Set(id, p)
+		}
+		if err != nil {
+			lo.log.Error("restore agent", "method", "restore", "id", id, "error", err.Error())
+		}
+	}
+}
+
+// Watch checks the agents file for changes at the given rate and reconciles it if it
+// was modified. Watch blocks until the ctx is done.
+func (lo *Loader) Watch(ctx context.Context, rate time.Duration) {
+	tick := time.NewTicker(rate)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+
+		if !lo.modified() {
+			continue
+		}
+		lo.log.Debug("agents file modified", "method", "Watch", "path", lo.path)
+		err := lo.Reconcile(ctx)
+		if err != nil {
+			lo.log.Error("reconcile agents", "method", "Watch", "error", err.Error())
+		}
+	}
+}
+
+// modified reports if the agents file changed since the last reconcile.
+func (lo *Loader) modified() bool {
+	info, err := os.Stat(lo.path)
+	if err != nil {
+		lo.log.Error("stat agents file", "method", "modified", "error", err.Error())
+		return false
+	}
+
+	lo.mu.Lock()
+	defer lo.mu.Unlock()
+
+	return !info.ModTime().Equal(lo.modTime)
+}
+
+// readItems reads the items of the given file. Files with a .yaml or .yml extension are
+// decoded as YAML, all other files as JSON.
+func readItems(filename string) ([]Item, error) {
+	bb, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read file %s: %w", filename, err)
+	}
+
+	var items Items
+	switch filepath.Ext(filename) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(bb, &items)
+	default:
+		err = json.Unmarshal(bb, &items)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal items: %w", err)
+	}
+
+	return items.Agents, nil
+}
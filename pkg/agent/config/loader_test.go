@@ -0,0 +1,258 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/db/inmem"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/tool/mock"
+)
+
+func testDiscovery() tool.Discovery {
+	return &mock.Discovery{
+		AllFn: func(_ context.Context) []tool.Tool {
+			return tool.TestTools()
+		},
+	}
+}
+
+func TestLoader_Reconcile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		filename string
+		first    string
+		second   string
+		wantIDs  []string
+		goneIDs  []string
+		wantErr  bool
+	}{
+		{
+			name:     "json add and remove",
+			filename: "agents.json",
+			first:    `{"agents":[{"ID":"a","Model":"gpt-4o"},{"ID":"b","Model":"gpt-4o"}]}`,
+			second:   `{"agents":[{"ID":"a","Model":"gpt-4o"}]}`,
+			wantIDs:  []string{"a"},
+			goneIDs:  []string{"b"},
+		},
+		{
+			name:     "yaml",
+			filename: "agents.yaml",
+			first:    "agents:\n  - ID: a\n    Model: gpt-4o\n",
+			second:   "agents:\n  - ID: a\n    Model: gpt-4o\n    Settings:\n      Temperature: 0.1\n  - ID: c\n    Model: gpt-4o\n    Tools: [get_names]\n",
+			wantIDs:  []string{"a", "c"},
+		},
+		{
+			name:     "invalid keeps state",
+			filename: "agents.json",
+			first:    `{"agents":[{"ID":"a","Model":"gpt-4o"}]}`,
+			second:   `{"agents":[{"ID":"b","Model":"gpt-4o","Provider":"unknown"}]}`,
+			wantIDs:  []string{"a"},
+			goneIDs:  []string{"b"},
+			wantErr:  true,
+		},
+		{
+			name:     "duplicate id",
+			filename: "agents.json",
+			first:    `{"agents":[{"ID":"a","Model":"gpt-4o"}]}`,
+			second:   `{"agents":[{"ID":"a","Model":"gpt-4o"},{"ID":"a","Model":"gpt-4"}]}`,
+			wantIDs:  []string{"a"},
+			wantErr:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), test.filename)
+			err := os.WriteFile(path, []byte(test.first), 0o600)
+			if err != nil {
+				t.Fatalf("write file: %s", err.Error())
+			}
+
+			agents := inmem.NewAgentDB()
+			threads := inmem.NewThreadDB()
+			lo := NewLoader(path, "token", agents, threads, testDiscovery(), monitor.NewTestLogger(false))
+			err = lo.Reconcile(context.TODO())
+			if err != nil {
+				t.Fatalf("Loader.Reconcile() first error = %v", err)
+			}
+			first, err := agents.Get("a")
+			if err != nil {
+				t.Fatalf("Loader.Reconcile() get first agent: %s", err.Error())
+			}
+			for _, id := range test.goneIDs {
+				if def, err := agents.Get(id); err == nil {
+					if err := threads.Add(id, def.NewThread("thread-"+id)); err != nil {
+						t.Fatalf("add thread: %s", err.Error())
+					}
+				}
+			}
+
+			err = os.WriteFile(path, []byte(test.second), 0o600)
+			if err != nil {
+				t.Fatalf("write file: %s", err.Error())
+			}
+			err = lo.Reconcile(context.TODO())
+			if (err != nil) != test.wantErr {
+				t.Errorf("Loader.Reconcile() error = %v, wantErr %v", err, test.wantErr)
+			}
+
+			for _, id := range test.wantIDs {
+				if _, err := agents.Get(id); err != nil {
+					t.Errorf("Loader.Reconcile() get agent %s: %s", id, err.Error())
+				}
+			}
+			for _, id := range test.goneIDs {
+				if _, err := agents.Get(id); !errors.Is(err, db.ErrNotFound) {
+					t.Errorf("Loader.Reconcile() get agent %s error = %v, want %v", id, err, db.ErrNotFound)
+				}
+				for thread := range threads.All(id) {
+					t.Errorf("Loader.Reconcile() kept thread %s of agent %s", thread.ID(), id)
+				}
+			}
+			if test.wantErr {
+				got, _ := agents.Get("a")
+				if got != first {
+					t.Error("Loader.Reconcile() invalid file replaced agent")
+				}
+			}
+		})
+	}
+}
+
+func TestLoader_ReconcileKeepsUnchanged(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "agents.json")
+	err := os.WriteFile(path, []byte(`{"agents":[{"ID":"a","Model":"gpt-4o"},{"ID":"b","Model":"gpt-4o"}]}`), 0o600)
+	if err != nil {
+		t.Fatalf("write file: %s", err.Error())
+	}
+
+	agents := inmem.NewAgentDB()
+	lo := NewLoader(path, "token", agents, inmem.NewThreadDB(), testDiscovery(), monitor.NewTestLogger(false))
+	err = lo.Reconcile(context.TODO())
+	if err != nil {
+		t.Fatalf("Loader.Reconcile() error = %v", err)
+	}
+	a, _ := agents.Get("a")
+	b, _ := agents.Get("b")
+
+	err = os.WriteFile(path, []byte(`{"agents":[{"ID":"a","Model":"gpt-4o"},{"ID":"b","Model":"gpt-4"}]}`), 0o600)
+	if err != nil {
+		t.Fatalf("write file: %s", err.Error())
+	}
+	err = lo.Reconcile(context.TODO())
+	if err != nil {
+		t.Fatalf("Loader.Reconcile() error = %v", err)
+	}
+
+	if got, _ := agents.Get("a"); got != a {
+		t.Error("Loader.Reconcile() unchanged agent replaced")
+	}
+	if got, _ := agents.Get("b"); got == b {
+		t.Error("Loader.Reconcile() changed agent not replaced")
+	}
+}
+
+// failingAgents is an agent db failing to set the agent with the id fail.
+type failingAgents struct {
+	*inmem.Agent
+	fail string
+}
+
+func (fa failingAgents) Set(id string, a agent.Definition) error {
+	if id == fa.fail {
+		return db.ErrInternal
+	}
+	return fa.Agent.Set(id, a)
+}
+
+func TestLoader_ReconcileSetFails(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "agents.json")
+	err := os.WriteFile(path, []byte(`{"agents":[{"ID":"a","Model":"gpt-4o"}]}`), 0o600)
+	if err != nil {
+		t.Fatalf("write file: %s", err.Error())
+	}
+
+	agents := failingAgents{Agent: inmem.NewAgentDB(), fail: "c"}
+	lo := NewLoader(path, "token", agents, inmem.NewThreadDB(), testDiscovery(), monitor.NewTestLogger(false))
+	err = lo.Reconcile(context.TODO())
+	if err != nil {
+		t.Fatalf("Loader.Reconcile() error = %v", err)
+	}
+	a, _ := agents.Get("a")
+
+	err = os.WriteFile(path, []byte(`{"agents":[{"ID":"a","Model":"gpt-4"},{"ID":"b","Model":"gpt-4o"},{"ID":"c","Model":"gpt-4o"}]}`), 0o600)
+	if err != nil {
+		t.Fatalf("write file: %s", err.Error())
+	}
+	err = lo.Reconcile(context.TODO())
+	if !errors.Is(err, db.ErrInternal) {
+		t.Fatalf("Loader.Reconcile() error = %v, want %v", err, db.ErrInternal)
+	}
+
+	if got, _ := agents.Get("a"); got != a {
+		t.Error("Loader.Reconcile() failed reconcile replaced agent a")
+	}
+	if _, err := agents.Get("b"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("Loader.Reconcile() get agent b error = %v, want %v", err, db.ErrNotFound)
+	}
+}
+
+func TestLoader_Watch(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "agents.json")
+	err := os.WriteFile(path, []byte(`{"agents":[{"ID":"a","Model":"gpt-4o"}]}`), 0o600)
+	if err != nil {
+		t.Fatalf("write file: %s", err.Error())
+	}
+
+	agents := inmem.NewAgentDB()
+	lo := NewLoader(path, "token", agents, inmem.NewThreadDB(), testDiscovery(), monitor.NewTestLogger(false))
+	err = lo.Reconcile(context.TODO())
+	if err != nil {
+		t.Fatalf("Loader.Reconcile() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go lo.Watch(ctx, 10*time.Millisecond)
+
+	err = os.WriteFile(path, []byte(`{"agents":[{"ID":"b","Model":"gpt-4o"}]}`), 0o600)
+	if err != nil {
+		t.Fatalf("write file: %s", err.Error())
+	}
+	// Make sure the modification time differs on file systems with a coarse resolution.
+	later := time.Now().Add(time.Second)
+	err = os.Chtimes(path, later, later)
+	if err != nil {
+		t.Fatalf("change file times: %s", err.Error())
+	}
+
+	// The reconcile adds agent b before it deletes agent a, wait for both.
+	deadline := time.After(2 * time.Second)
+	for {
+		_, errB := agents.Get("b")
+		_, errA := agents.Get("a")
+		if errB == nil && errors.Is(errA, db.ErrNotFound) {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("Loader.Watch() get agent b error = %v, get agent a error = %v, want nil and %v", errB, errA, db.ErrNotFound)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
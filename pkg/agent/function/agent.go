@@ -4,55 +4,208 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sync"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/engine"
 	"github.com/Br0ce/opera/pkg/history"
 	"github.com/Br0ce/opera/pkg/monitor"
 	"github.com/Br0ce/opera/pkg/percept"
 	"github.com/Br0ce/opera/pkg/tool"
 )
 
+var (
+	_ agent.Definition = (*Agent)(nil)
+	_ agent.Restorer   = (*Agent)(nil)
+	_ agent.Thread     = (*Thread)(nil)
+	_ agent.Answerer   = (*Thread)(nil)
+	_ agent.Reviser    = (*Thread)(nil)
+	_ engine.Hooked    = (*Thread)(nil)
+)
+
 type Reasoner interface {
 	Reason(ctx context.Context, hist history.History, tools []tool.Tool) (action.Action, error)
 }
 
+// Agent is the definition of a function calling agent. Conversations with the agent
+// run in threads.
 type Agent struct {
+	sysPrompt string
 	reasoner  Reasoner
-	history   history.History
 	discovery tool.Discovery
+	maxIter   int
+	hooks     []engine.Hook
 	tr        trace.Tracer
 	log       *slog.Logger
 }
 
-func NewAgent(sysPrompt string, discovery tool.Discovery, reasoner Reasoner, log *slog.Logger) *Agent {
-	hist := history.History{}
-	hist.AddSystem(sysPrompt)
-	return &Agent{
+type Option func(ag *Agent)
+
+// WithMaxIter limits the iterations of queries to the agent. It overrides the limit of
+// the engine.
+func WithMaxIter(maxIter int) Option {
+	return func(ag *Agent) {
+		ag.maxIter = maxIter
+	}
+}
+
+// WithHooks adds hooks intercepting the steps of queries to the agent. They run after
+// the hooks of the engine.
+func WithHooks(hooks ...engine.Hook) Option {
+	return func(ag *Agent) {
+		ag.hooks = append(ag.hooks, hooks...)
+	}
+}
+
+func NewAgent(sysPrompt string, discovery tool.Discovery, reasoner Reasoner, log *slog.Logger, options ...Option) *Agent {
+	ag := &Agent{
+		sysPrompt: sysPrompt,
 		reasoner:  reasoner,
-		history:   hist,
 		discovery: discovery,
 		tr:        monitor.Tracer("Agent"),
 		log:       log,
 	}
+	for _, opt := range options {
+		opt(ag)
+	}
+	return ag
+}
+
+// NewThread returns a new Thread with the given id whose history starts with the
+// system prompt of the agent.
+func (ag *Agent) NewThread(id string) agent.Thread {
+	hist := history.History{}
+	hist.AddSystem(ag.sysPrompt)
+	return &Thread{
+		agent:   ag,
+		id:      id,
+		created: time.Now().UTC(),
+		history: hist,
+		mu:      make(chan struct{}, 1),
+	}
+}
+
+// RestoreThread returns the Thread with the given id, creation time and history.
+func (ag *Agent) RestoreThread(id string, created time.Time, hist history.History) agent.Thread {
+	return &Thread{
+		agent:   ag,
+		id:      id,
+		created: created,
+		history: hist.Clone(),
+		mu:      make(chan struct{}, 1),
+	}
+}
+
+// Thread is a conversation with an Agent.
+type Thread struct {
+	agent   *Agent
+	id      string
+	created time.Time
+	history history.History
+	// mu serializes the queries on the thread. It is a semaphore, so that waiting for
+	// it can be canceled.
+	mu chan struct{}
+	// histMu guards the history, so that it can be read while a query runs.
+	histMu sync.RWMutex
+}
+
+func (th *Thread) ID() string {
+	return th.id
+}
+
+func (th *Thread) Created() time.Time {
+	return th.created
+}
+
+func (th *Thread) MaxIter() int {
+	return th.agent.maxIter
+}
+
+// Hooks returns the hooks of the agent.
+func (th *Thread) Hooks() []engine.Hook {
+	return th.agent.hooks
+}
+
+// Lock locks the thread for a query, unless the ctx is done first.
+func (th *Thread) Lock(ctx context.Context) error {
+	select {
+	case th.mu <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Unlock unlocks the thread after a query.
+func (th *Thread) Unlock() {
+	<-th.mu
+}
+
+// History returns a copy of the thread history.
+func (th *Thread) History() history.History {
+	th.histMu.RLock()
+	defer th.histMu.RUnlock()
+
+	return th.history.Clone()
+}
+
+// ReviseAnswer replaces the last answer in the thread history with content.
+func (th *Thread) ReviseAnswer(content string) {
+	th.histMu.Lock()
+	defer th.histMu.Unlock()
+
+	th.history.ReviseAnswer(content)
+}
+
+// Record adds the percepts to the thread history.
+func (th *Thread) Record(percepts []percept.Percept) {
+	th.histMu.Lock()
+	defer th.histMu.Unlock()
+
+	th.history.AddPercepts(percepts)
 }
 
 // Action returns, based on the given perceptions and the history of prior perceptions an
 // action which can be executed.
-func (ag *Agent) Action(ctx context.Context, percepts []percept.Percept) (action.Action, error) {
-	ctx, span := ag.tr.Start(ctx, "Action")
+func (th *Thread) Action(ctx context.Context, percepts []percept.Percept) (action.Action, error) {
+	ctx, span := th.agent.tr.Start(ctx, "Action")
 	defer span.End()
+	span.SetAttributes(attribute.String("thread.id", th.id))
+
+	return th.reason(ctx, percepts, th.agent.discovery.All(ctx))
+}
+
+// Answer returns, based on the given perceptions and the history of prior perceptions,
+// an action without offering any tools to the reasoner.
+func (th *Thread) Answer(ctx context.Context, percepts []percept.Percept) (action.Action, error) {
+	ctx, span := th.agent.tr.Start(ctx, "Answer")
+	defer span.End()
+	span.SetAttributes(attribute.String("thread.id", th.id))
+
+	return th.reason(ctx, percepts, nil)
+}
 
-	ag.history.AddPercepts(percepts)
+// reason adds the percepts to the history and reasons about it with the given tools.
+// The resulting action is added to the history.
+func (th *Thread) reason(ctx context.Context, percepts []percept.Percept, tools []tool.Tool) (action.Action, error) {
+	th.histMu.Lock()
+	th.history.AddPercepts(percepts)
+	hist := th.history.Clone()
+	th.histMu.Unlock()
 
-	tools := ag.discovery.All(ctx)
-	next, err := ag.reasoner.Reason(ctx, ag.history, tools)
+	next, err := th.agent.reasoner.Reason(ctx, hist, tools)
 	if err != nil {
 		return action.Action{}, fmt.Errorf("chat: %w", err)
 	}
 
-	ag.history.AddAction(next)
+	th.histMu.Lock()
+	th.history.AddAction(next)
+	th.histMu.Unlock()
 
 	return next, nil
 }
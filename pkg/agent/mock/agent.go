@@ -0,0 +1,55 @@
+package mock
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/percept"
+)
+
+var (
+	_ agent.Agent    = (*Agent)(nil)
+	_ agent.Recorder = (*Agent)(nil)
+)
+
+type Agent struct {
+	ActionFn      func(ctx context.Context, percepts []percept.Percept) (action.Action, error)
+	ActionInvoked int
+	// Recorded are the percepts passed to Record.
+	Recorded []percept.Percept
+	mu       sync.Mutex
+}
+
+func (ag *Agent) Action(ctx context.Context, percepts []percept.Percept) (action.Action, error) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+
+	ag.ActionInvoked++
+	return ag.ActionFn(ctx, percepts)
+}
+
+func (ag *Agent) Record(percepts []percept.Percept) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+
+	ag.Recorded = append(ag.Recorded, percepts...)
+}
+
+var _ agent.Answerer = (*Answerer)(nil)
+
+// Answerer is an Agent which can answer without tools.
+type Answerer struct {
+	Agent
+	AnswerFn      func(ctx context.Context, percepts []percept.Percept) (action.Action, error)
+	AnswerInvoked int
+}
+
+func (ag *Answerer) Answer(ctx context.Context, percepts []percept.Percept) (action.Action, error) {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+
+	ag.AnswerInvoked++
+	return ag.AnswerFn(ctx, percepts)
+}
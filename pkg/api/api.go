@@ -3,43 +3,424 @@ package api
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/agent/config"
 	"github.com/Br0ce/opera/pkg/api/handler"
+	"github.com/Br0ce/opera/pkg/auth"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/db/file"
 	"github.com/Br0ce/opera/pkg/db/inmem"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/engine/fanout"
+	"github.com/Br0ce/opera/pkg/engine/graph"
+	"github.com/Br0ce/opera/pkg/engine/hook"
 	"github.com/Br0ce/opera/pkg/engine/loop"
+	"github.com/Br0ce/opera/pkg/guard"
+	"github.com/Br0ce/opera/pkg/job/pool"
+	"github.com/Br0ce/opera/pkg/reason/openai"
 	"github.com/Br0ce/opera/pkg/tool"
 	"github.com/Br0ce/opera/pkg/tool/discovery/docker"
+	"github.com/Br0ce/opera/pkg/tool/discovery/health"
+	"github.com/Br0ce/opera/pkg/tool/discovery/kubernetes"
+	mcpDiscovery "github.com/Br0ce/opera/pkg/tool/discovery/mcp"
+	"github.com/Br0ce/opera/pkg/tool/discovery/multi"
+	"github.com/Br0ce/opera/pkg/tool/discovery/openapi"
 	"github.com/Br0ce/opera/pkg/transport"
 )
 
 type API struct {
 	mux http.Handler
+	mcp *handler.MCP
 	log *slog.Logger
 }
 
-func NewHTTP(ctx context.Context, log *slog.Logger) (*API, context.CancelFunc, error) {
+type options struct {
+	agentsPath  string
+	agentsToken string
+	agentsRate  time.Duration
+	jobWorkers  int
+	jobQueue    int
+	jobTTL      time.Duration
+	maxIter     int
+	exhaustion  loop.Exhaustion
+	checkpoints string
+	autoResume  bool
+	graphPath   string
+	cacheTTL    time.Duration
+	cacheSize   int
+	detectLoops bool
+	hooks       []string
+	guardPath   string
+	guardToken  string
+	fanTimeout  time.Duration
+	concurrency int
+	callTimeout time.Duration
+	toolTimeout time.Duration
+	threshold   int
+	credsPath   string
+	cooldown    time.Duration
+	judgeModel  string
+	judgeToken  string
+	docker      bool
+	openAPI     []string
+	openServer  string
+	openInclude []string
+	openExclude []string
+	openIncOps  []string
+	openExcOps  []string
+	mcpPath     string
+	kubeKind    string
+	kubeNS      string
+	kubeconfig  string
+}
+
+type Option func(o *options)
+
+// WithAgentsFile declares agents in the JSON or YAML file at path. The file is loaded on
+// start and reloaded whenever it changes. The token authenticates the reasoners of the
+// declared agents.
+func WithAgentsFile(path string, token string) Option {
+	return func(o *options) {
+		o.agentsPath = path
+		o.agentsToken = token
+	}
+}
+
+// WithJobs sets the number of workers running asynchronous query jobs and the ttl for
+// which finished jobs are retained.
+func WithJobs(workers int, ttl time.Duration) Option {
+	return func(o *options) {
+		o.jobWorkers = workers
+		o.jobTTL = ttl
+	}
+}
+
+// WithMaxIter sets the iteration limit of queries and the policy for queries reaching it.
+// Agents and queries can lower or raise the limit.
+func WithMaxIter(maxIter int, exhaustion loop.Exhaustion) Option {
+	return func(o *options) {
+		o.maxIter = maxIter
+		o.exhaustion = exhaustion
+	}
+}
+
+// WithCheckpoints persists a checkpoint of every unfinished query in the directory dir.
+// Interrupted queries are resumed through the API, or on start if autoResume is set.
+func WithCheckpoints(dir string, autoResume bool) Option {
+	return func(o *options) {
+		o.checkpoints = dir
+		o.autoResume = autoResume
+	}
+}
+
+// WithGraph executes the workflow declared in the JSON or YAML file at path for every
+// query instead of the reason-act loop. Agent nodes of the workflow run the loop.
+func WithGraph(path string) Option {
+	return func(o *options) {
+		o.graphPath = path
+	}
+}
+
+// WithToolCache sets the default ttl for which tool results are cached and the maximal
+// number of cached results. Tools can set their own ttl or opt out of caching.
+func WithToolCache(ttl time.Duration, size int) Option {
+	return func(o *options) {
+		o.cacheTTL = ttl
+		o.cacheSize = size
+	}
+}
+
+// WithToolLimits sets the number of tool calls running at once and the time a call
+// waits for a free slot or the rate limit of its tool. Zero means unlimited.
+func WithToolLimits(concurrency int, timeout time.Duration) Option {
+	return func(o *options) {
+		o.concurrency = concurrency
+		o.callTimeout = timeout
+	}
+}
+
+// WithToolTimeout limits each attempt to call a tool which declares no timeout of its
+// own.
+func WithToolTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.toolTimeout = timeout
+	}
+}
+
+// WithToolBreakers opens the breaker of a tool after threshold consecutive failed calls.
+// Tools with an open breaker are hidden from the agents and their calls are rejected for
+// the cooldown. A threshold of zero disables the breakers.
+func WithToolBreakers(threshold int, cooldown time.Duration) Option {
+	return func(o *options) {
+		o.threshold = threshold
+		o.cooldown = cooldown
+	}
+}
+
+// WithCredentials authenticates the calls to the tools with the credentials declared in
+// the JSON or YAML file at path.
+func WithCredentials(path string) Option {
+	return func(o *options) {
+		o.credsPath = path
+	}
+}
+
+// WithLoopDetection enables or disables the detection of agents repeating themselves.
+// Loop detection is enabled by default.
+func WithLoopDetection(detect bool) Option {
+	return func(o *options) {
+		o.detectLoops = detect
+	}
+}
+
+// WithHooks adds the built-in hooks with the given names to every query, e.g. log,
+// redact or clock.
+func WithHooks(names ...string) Option {
+	return func(o *options) {
+		o.hooks = append(o.hooks, names...)
+	}
+}
+
+// WithGuardrails checks queries and answers against the guardrails declared in the JSON
+// or YAML file at path. The token authenticates the reasoners of classifier guardrails.
+func WithGuardrails(path string, token string) Option {
+	return func(o *options) {
+		o.guardPath = path
+		o.guardToken = token
+	}
+}
+
+// WithFanout sets the time each agent of a fan-out query has to answer and the model
+// judging the answers for the judge strategy. Without a model, the judge strategy is not
+// available. The token authenticates the judge.
+func WithFanout(timeout time.Duration, judgeModel string, token string) Option {
+	return func(o *options) {
+		o.fanTimeout = timeout
+		o.judgeModel = judgeModel
+		o.judgeToken = token
+	}
+}
+
+// WithDockerDiscovery enables or disables the discovery of tools from the labels of
+// docker containers. Docker discovery is enabled by default.
+func WithDockerDiscovery(enabled bool) Option {
+	return func(o *options) {
+		o.docker = enabled
+	}
+}
+
+// WithOpenAPIDiscovery discovers a tool for every operation of the OpenAPI documents at
+// the sources, which are http(s) URLs or file paths. The server is the URL against which
+// relative server URLs are resolved. Operations are selected by their tags, if include
+// tags are given, and dropped if they have any of the exclude tags.
+func WithOpenAPIDiscovery(sources []string, server string, includeTags []string, excludeTags []string) Option {
+	return func(o *options) {
+		o.openAPI = sources
+		o.openServer = server
+		o.openInclude = includeTags
+		o.openExclude = excludeTags
+	}
+}
+
+// WithOpenAPIOperations selects the operations of the OpenAPI discovery by their
+// operationIds, if include operations are given, and drops the operations with any of
+// the exclude operationIds.
+func WithOpenAPIOperations(includeOperations []string, excludeOperations []string) Option {
+	return func(o *options) {
+		o.openIncOps = includeOperations
+		o.openExcOps = excludeOperations
+	}
+}
+
+// WithMCPDiscovery discovers the tools of the MCP servers declared in the JSON or YAML
+// file at path. The tools are called through the MCP sessions of the discovery.
+func WithMCPDiscovery(path string) Option {
+	return func(o *options) {
+		o.mcpPath = path
+	}
+}
+
+// WithKubernetesDiscovery discovers the tools declared by the annotations of the objects
+// of the given kind, services or pods, in the namespace. An empty namespace means all
+// namespaces. The kubeconfig at path authenticates with the cluster, if set, otherwise
+// the service account or the default kubeconfig is used.
+func WithKubernetesDiscovery(kind string, namespace string, kubeconfig string) Option {
+	return func(o *options) {
+		o.kubeKind = kind
+		o.kubeNS = namespace
+		o.kubeconfig = kubeconfig
+	}
+}
+
+func NewHTTP(ctx context.Context, log *slog.Logger, opts ...Option) (*API, context.CancelFunc, error) {
+	o := options{
+		agentsRate:  5 * time.Second,
+		jobWorkers:  4,
+		jobQueue:    100,
+		jobTTL:      time.Hour,
+		maxIter:     10,
+		exhaustion:  loop.ExhaustError,
+		cacheTTL:    time.Minute,
+		cacheSize:   1000,
+		detectLoops: true,
+		fanTimeout:  time.Minute,
+		concurrency: 16,
+		callTimeout: 30 * time.Second,
+		toolTimeout: 30 * time.Second,
+		threshold:   5,
+		cooldown:    30 * time.Second,
+		docker:      true,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	mux := http.NewServeMux()
 	transDisc := transport.NewHTTP(time.Second * 5)
-	discovery, err := docker.NewDiscovery(ctx, inmem.NewToolDB(), transDisc, log)
+	sources, closeSources, err := newDiscoveries(ctx, o, transDisc, log)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The sources are closed if the api is not created.
+	created := false
+	defer func() {
+		if !created {
+			closeSources()
+		}
+	}()
+	breakers := action.NewBreakers(o.threshold, o.cooldown)
+	discovery := health.NewDiscovery(sources.Discovery, transDisc, log.With("name", "HealthDiscovery"), health.WithBreakers(breakers))
+	err = discovery.Refresh(ctx)
 	if err != nil {
-		return nil, nil, fmt.Errorf("new docker discovery: %w", err)
+		return nil, nil, fmt.Errorf("refresh discovery: %w", err)
 	}
 
-	transEng := transport.NewHTTP(time.Second * 30)
-	actor := action.NewActor(discovery, transEng, log.With("name", "Actor"))
-	engine := loop.NewEngine(actor, 10, log.With("name", "Engine"))
-	agentHandler := handler.NewAgent(engine, inmem.NewAgentDB(), discovery, log.With("name", "AgentHandler"))
+	// The timeouts of tool calls are set per tool by the actor.
+	transEng := transport.NewHTTP(0)
+	cache := action.NewCache(o.cacheTTL, o.cacheSize)
+	limiter := action.NewLimiter(o.concurrency, o.callTimeout)
+	actOpts := []action.Option{
+		action.WithCache(cache),
+		action.WithLimiter(limiter),
+		action.WithBreakers(breakers),
+		action.WithTimeout(o.toolTimeout),
+	}
+	if sources.mcp != nil {
+		actOpts = append(actOpts, action.WithTransport(transport.SchemeMCP, transport.NewMCP(sources.mcp)))
+	}
+	if o.credsPath != "" {
+		cfg, err := auth.ReadFile(o.credsPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read credentials: %w", err)
+		}
+		creds, err := cfg.Decode(transDisc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decode credentials: %w", err)
+		}
+		actOpts = append(actOpts, action.WithCredentials(creds))
+	}
+	actor := action.NewActor(discovery, transEng, log.With("name", "Actor"), actOpts...)
+	hooks, err := hook.Builtins(o.hooks, log.With("name", "Hook"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("hooks: %w", err)
+	}
+	approvals := inmem.NewApprovalDB()
+	var checkpoints db.Checkpoint = inmem.NewCheckpointDB()
+	engOpts := []loop.Option{
+		loop.WithApprovals(approvals),
+		loop.WithExhaustion(o.exhaustion),
+		loop.WithLoopDetection(o.detectLoops),
+		loop.WithHooks(hooks...),
+	}
+	if o.checkpoints != "" {
+		checkpoints, err = file.NewCheckpointDB(o.checkpoints, log.With("name", "CheckpointDB"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("new checkpoint db: %w", err)
+		}
+		engOpts = append(engOpts, loop.WithCheckpoints(checkpoints))
+	}
+	if o.guardPath != "" {
+		cfg, err := guard.ReadFile(o.guardPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read guardrails: %w", err)
+		}
+		g, err := cfg.Decode(o.guardToken, log.With("name", "Guard"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("decode guardrails: %w", err)
+		}
+		engOpts = append(engOpts, loop.WithGuard(g))
+	}
+	loopEngine := loop.NewEngine(actor, o.maxIter, log.With("name", "Engine"), engOpts...)
+	agents := inmem.NewAgentDB()
+	threads := inmem.NewThreadDB()
+	if o.agentsPath != "" {
+		loader := config.NewLoader(o.agentsPath, o.agentsToken, agents, threads, discovery, log.With("name", "AgentLoader"))
+		err := loader.Reconcile(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("load agents: %w", err)
+		}
+		go loader.Watch(ctx, o.agentsRate)
+	}
+	var queryEngine engine.Engine = loopEngine
+	if o.graphPath != "" {
+		g, err := graph.ReadFile(o.graphPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read graph: %w", err)
+		}
+		queryEngine, err = graph.NewEngine(g, loopEngine, actor, log.With("name", "GraphEngine"), graph.WithAgents(agents), graph.WithApprovals(approvals))
+		if err != nil {
+			return nil, nil, fmt.Errorf("new graph engine: %w", err)
+		}
+	}
+	fanOpts := []fanout.Option{fanout.WithTimeout(o.fanTimeout), fanout.WithApprovals(approvals)}
+	if o.judgeModel != "" {
+		fanOpts = append(fanOpts, fanout.WithJudge(openai.NewReasoner(o.judgeToken, o.judgeModel, log.With("name", "Judge"))))
+	}
+	fanoutEngine := fanout.NewEngine(loopEngine, log.With("name", "FanoutEngine"), fanOpts...)
+	jobs := pool.NewPool(inmem.NewJobDB(), o.jobWorkers, o.jobQueue, o.jobTTL, log.With("name", "JobPool"))
+	jobs.Start(ctx)
+	agentHandler := handler.NewAgent(queryEngine, agents, threads, discovery, jobs, log.With("name", "AgentHandler"))
+	approvalHandler := handler.NewApproval(loopEngine, threads, approvals, log.With("name", "ApprovalHandler"))
+	jobHandler := handler.NewJob(jobs, log.With("name", "JobHandler"))
+	fanoutHandler := handler.NewFanout(fanoutEngine, agents, threads, log.With("name", "FanoutHandler"))
+	cacheHandler := handler.NewCache(cache, log.With("name", "CacheHandler"))
+	toolHandler := handler.NewTool(sources, discovery, breakers, log.With("name", "ToolHandler"))
+	mcpHandler := handler.NewMCP(discovery, actor, queryEngine, agents, threads, log.With("name", "MCPHandler"))
+	mcpHandler.Sync(ctx)
+	checkpointHandler := handler.NewCheckpoint(loopEngine, checkpoints, agents, threads, discovery, jobs, log.With("name", "CheckpointHandler"))
+	if o.autoResume {
+		checkpointHandler.ResumeAll(ctx)
+	}
 
 	mux.HandleFunc("POST /v1/agents", agentHandler.Create)
 	mux.HandleFunc(fmt.Sprintf("POST /v1/agents/{%s}", handler.AgentID), agentHandler.Query)
 	mux.HandleFunc(fmt.Sprintf("DELETE /v1/agents/{%s}", handler.AgentID), agentHandler.Delete)
+	mux.HandleFunc(fmt.Sprintf("POST /v1/agents/{%s}/threads", handler.AgentID), agentHandler.CreateThread)
+	mux.HandleFunc(fmt.Sprintf("GET /v1/agents/{%s}/threads", handler.AgentID), agentHandler.ListThreads)
+	mux.HandleFunc(fmt.Sprintf("GET /v1/agents/{%s}/threads/{%s}", handler.AgentID, handler.ThreadID), agentHandler.GetThread)
+	mux.HandleFunc(fmt.Sprintf("POST /v1/agents/{%s}/threads/{%s}", handler.AgentID, handler.ThreadID), agentHandler.QueryThread)
+	mux.HandleFunc(fmt.Sprintf("DELETE /v1/agents/{%s}/threads/{%s}", handler.AgentID, handler.ThreadID), agentHandler.DeleteThread)
+	mux.HandleFunc(fmt.Sprintf("GET /v1/agents/{%s}/threads/{%s}/approvals/{%s}", handler.AgentID, handler.ThreadID, handler.ApprovalID), approvalHandler.Get)
+	mux.HandleFunc(fmt.Sprintf("POST /v1/agents/{%s}/threads/{%s}/approvals/{%s}/calls/{%s}", handler.AgentID, handler.ThreadID, handler.ApprovalID, handler.CallID), approvalHandler.Decide)
+	mux.HandleFunc("POST /v1/fanout", fanoutHandler.Query)
+	mux.HandleFunc(fmt.Sprintf("GET /v1/jobs/{%s}", handler.JobID), jobHandler.Get)
+	mux.HandleFunc(fmt.Sprintf("DELETE /v1/jobs/{%s}", handler.JobID), jobHandler.Cancel)
+	mux.HandleFunc("GET /v1/tools", toolHandler.List)
+	mux.HandleFunc("GET /v1/cache", cacheHandler.List)
+	mux.HandleFunc("DELETE /v1/cache", cacheHandler.Flush)
+	mux.HandleFunc("GET /v1/checkpoints", checkpointHandler.List)
+	mux.HandleFunc(fmt.Sprintf("POST /v1/checkpoints/{%s}", handler.CheckpointID), checkpointHandler.Resume)
+	mux.HandleFunc(fmt.Sprintf("DELETE /v1/checkpoints/{%s}", handler.CheckpointID), checkpointHandler.Delete)
+	mux.Handle("/v1/mcp", mcpHandler)
 
 	api := &API{
 		mux: mux,
+		mcp: mcpHandler,
 		log: log,
 	}
 
@@ -47,8 +428,11 @@ func NewHTTP(ctx context.Context, log *slog.Logger) (*API, context.CancelFunc, e
 
 	cancel := func() {
 		log.Info("cancel api", "method", "NewHTTP")
+		mcpHandler.Close()
+		closeSources()
 	}
 
+	created = true
 	return api, cancel, nil
 }
 
@@ -56,6 +440,14 @@ func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.mux.ServeHTTP(w, r)
 }
 
+// ServeMCP serves a MCP client over r and w, e.g. stdin and stdout, until r ends or ctx
+// is done.
+func (a *API) ServeMCP(ctx context.Context, r io.Reader, w io.Writer) error {
+	return a.mcp.ServeStdio(ctx, r, w)
+}
+
+// refresh refreshes the discovery at the given rate and notifies the MCP clients if the
+// offered tools changed.
 func (a *API) refresh(ctx context.Context, discovery tool.Discovery, rate time.Duration) {
 	tick := time.Tick(rate)
 	for range tick {
@@ -64,5 +456,82 @@ func (a *API) refresh(ctx context.Context, discovery tool.Discovery, rate time.D
 		if err != nil {
 			a.log.Error("refresh tool discovery", "method", "refreshDiscovery", "error", err.Error())
 		}
+		a.mcp.Sync(ctx)
 	}
 }
+
+// discoveries are the tool discoveries of the api combined in order of precedence.
+type discoveries struct {
+	*multi.Discovery
+	mcp *mcpDiscovery.Discovery
+}
+
+// newDiscoveries returns the enabled tool discoveries combined and a function closing
+// the discoveries which keep connections open.
+func newDiscoveries(ctx context.Context, o options, trans *transport.HTTPTransporter, log *slog.Logger) (discoveries, func(), error) {
+	var all []tool.Discovery
+	var closers []func()
+	closeAll := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+	fail := func(err error) (discoveries, func(), error) {
+		closeAll()
+		return discoveries{}, nil, err
+	}
+
+	if o.docker {
+		d, err := docker.NewDiscovery(ctx, inmem.NewToolDB(), trans, log.With("name", "DockerDiscovery"))
+		if err != nil {
+			return fail(fmt.Errorf("new docker discovery: %w", err))
+		}
+		all = append(all, d)
+	}
+	if o.kubeKind != "" {
+		d, err := kubernetes.NewDiscovery(ctx, inmem.NewToolDB(), trans, log.With("name", "KubernetesDiscovery"),
+			kubernetes.WithKind(kubernetes.Kind(o.kubeKind)),
+			kubernetes.WithNamespace(o.kubeNS),
+			kubernetes.WithKubeconfig(o.kubeconfig))
+		if err != nil {
+			return fail(fmt.Errorf("new kubernetes discovery: %w", err))
+		}
+		all = append(all, d)
+		closers = append(closers, d.Close)
+	}
+	if len(o.openAPI) > 0 {
+		d, err := openapi.NewDiscovery(ctx, o.openAPI, inmem.NewToolDB(), trans, log.With("name", "OpenAPIDiscovery"),
+			openapi.WithServer(o.openServer),
+			openapi.WithIncludeTags(o.openInclude...),
+			openapi.WithExcludeTags(o.openExclude...),
+			openapi.WithIncludeOperations(o.openIncOps...),
+			openapi.WithExcludeOperations(o.openExcOps...))
+		if err != nil {
+			return fail(fmt.Errorf("new openapi discovery: %w", err))
+		}
+		all = append(all, d)
+	}
+	var mcpDisc *mcpDiscovery.Discovery
+	if o.mcpPath != "" {
+		cfg, err := mcpDiscovery.ReadFile(o.mcpPath)
+		if err != nil {
+			return fail(fmt.Errorf("read mcp servers: %w", err))
+		}
+		mcpDisc, err = mcpDiscovery.NewDiscovery(ctx, cfg.Servers, inmem.NewToolDB(), log.With("name", "MCPDiscovery"))
+		if err != nil {
+			return fail(fmt.Errorf("new mcp discovery: %w", err))
+		}
+		all = append(all, mcpDisc)
+		closers = append(closers, func() {
+			err := mcpDisc.Close(context.Background())
+			if err != nil {
+				log.Error("close mcp discovery", "method", "newDiscoveries", "error", err.Error())
+			}
+		})
+	}
+
+	return discoveries{
+		Discovery: multi.NewDiscovery(log.With("name", "MultiDiscovery"), all...),
+		mcp:       mcpDisc,
+	}, closeAll, nil
+}
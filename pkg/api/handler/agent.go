@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,34 +9,48 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
+	"time"
 
 	"go.opentelemetry.io/otel/trace"
 
+	"github.com/Br0ce/opera/pkg/agent"
 	"github.com/Br0ce/opera/pkg/agent/function"
 	"github.com/Br0ce/opera/pkg/db"
 	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/guard"
+	"github.com/Br0ce/opera/pkg/ids"
+	"github.com/Br0ce/opera/pkg/job"
+	"github.com/Br0ce/opera/pkg/job/pool"
 	"github.com/Br0ce/opera/pkg/monitor"
 	"github.com/Br0ce/opera/pkg/reason/openai"
 	"github.com/Br0ce/opera/pkg/tool"
 	"github.com/Br0ce/opera/pkg/user"
 )
 
-const AgentID = "agentID"
+const (
+	AgentID  = "agentID"
+	ThreadID = "threadID"
+)
 
 type Agent struct {
 	engine    engine.Engine
 	db        db.Agent
+	threads   db.Thread
 	discovery tool.Discovery
+	jobs      *pool.Pool
 	tr        trace.Tracer
 	// pr        propagation.TextMapPropagator
 	log *slog.Logger
 }
 
-func NewAgent(engine engine.Engine, db db.Agent, discovery tool.Discovery, log *slog.Logger) *Agent {
+func NewAgent(engine engine.Engine, db db.Agent, threads db.Thread, discovery tool.Discovery, jobs *pool.Pool, log *slog.Logger) *Agent {
 	return &Agent{
 		engine:    engine,
 		db:        db,
+		threads:   threads,
 		discovery: discovery,
+		jobs:      jobs,
 		tr:        monitor.Tracer("AgentHandler"),
 		log:       log,
 	}
@@ -97,6 +112,8 @@ func (ag *Agent) Create(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Query starts a new thread of the agent and queries it with the form value text.
+// The thread can be continued under /v1/agents/{agentID}/threads/{threadID}.
 func (ag *Agent) Query(w http.ResponseWriter, r *http.Request) {
 	ctx, span := ag.tr.Start(r.Context(), "Query agent")
 	defer span.End()
@@ -125,36 +142,131 @@ func (ag *Agent) Query(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := ag.engine.Query(ctx, user.Query{Text: text}, a)
+	thread := a.NewThread(ids.UniqueThread())
+	err = ag.threads.Add(id, thread)
 	if err != nil {
-		// TODO status
-		http.Error(w, fmt.Sprintf("query: %s", err.Error()), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("add thread: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
 
-	err = ag.db.Update(id, a)
+	ag.query(ctx, w, r, id, thread, text)
+}
+
+// query runs the query with the given text on the thread and writes the answer.
+// Queries on the same thread are serialized.
+// If the client accepts text/event-stream, the steps of the query are streamed as
+// server-sent events instead, ending with the answer, pending or error event.
+// If the form value async is true, the query is run as job and the job is returned.
+// The optional form value max-iter limits the iterations of the query, the optional form
+// value timeout, e.g. 30s, sets its deadline. A client disconnect cancels the query.
+func (ag *Agent) query(ctx context.Context, w http.ResponseWriter, r *http.Request, agentID string, thread agent.Thread, text string) {
+	opts := []engine.Option{engine.WithAgentID(agentID)}
+	if maxIter := r.FormValue("max-iter"); maxIter != "" {
+		n, err := strconv.Atoi(maxIter)
+		if err != nil || n < 1 {
+			http.Error(w, fmt.Sprintf("max-iter %q invalid", maxIter), http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, engine.WithMaxIter(n))
+	}
+	if timeout := r.FormValue("timeout"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("timeout %q invalid", timeout), http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, engine.WithDeadline(time.Now().Add(d)))
+	}
+
+	if r.FormValue("async") == "true" {
+		ag.submit(ctx, w, agentID, thread, text, opts)
+		return
+	}
+
+	err := thread.Lock(ctx)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("update agent: %s", err.Error()), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("lock thread: %s", err.Error()), http.StatusServiceUnavailable)
 		return
 	}
+	defer thread.Unlock()
 
-	ans := map[string]string{
-		"object": "answer",
-		"text":   res,
+	if wantsStream(r) {
+		ag.stream(ctx, w, agentID, thread, text, opts)
+		return
 	}
-	bb, err := json.Marshal(ans)
+
+	res, err := ag.engine.Query(ctx, user.Query{Text: text}, thread, opts...)
+	writeResult(w, agentID, thread.ID(), res, err)
+}
+
+// submit queues the query with the given text on the thread as job and writes the
+// queued job. The job is polled and canceled under /v1/jobs/{jobID}.
+func (ag *Agent) submit(ctx context.Context, w http.ResponseWriter, agentID string, thread agent.Thread, text string, opts []engine.Option) {
+	fn := func(ctx context.Context) (string, error) {
+		err := thread.Lock(ctx)
+		if err != nil {
+			return "", fmt.Errorf("lock thread: %w", err)
+		}
+		defer thread.Unlock()
+		return ag.engine.Query(ctx, user.Query{Text: text}, thread, opts...)
+	}
+
+	id, err := ag.jobs.Submit(ctx, job.MakeJob(agentID, thread.ID()), fn)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		if errors.Is(err, pool.ErrQueueFull) {
+			http.Error(w, fmt.Sprintf("submit job: %s", err.Error()), http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, fmt.Sprintf("submit job: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
-	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
-		w.Header().Set("Location", path.Join(u.Path, id))
+	j, err := ag.jobs.Get(id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("get job: %s", err.Error()), http.StatusInternalServerError)
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(bb)
+
+	w.Header().Set("Location", jobPath(id))
+	writeJSON(w, http.StatusAccepted, makeJobInfo(j))
+}
+
+// stream runs the query with the given text on the thread and writes its events as
+// server-sent events. A suspended query ends with a pending event holding the approval
+// request, an exhausted query with a partial event holding the findings, a query stuck
+// in a loop with a loop event holding the diagnostic and a blocked query with a guardrail
+// event holding the violations.
+func (ag *Agent) stream(ctx context.Context, w http.ResponseWriter, agentID string, thread agent.Thread, text string, opts []engine.Option) {
+	w.Header().Set("Location", threadPath(agentID, thread.ID()))
+	sse, err := newSSEWriter(w, ag.log)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	opts = append(opts, engine.WithSubscriber(sse))
+	_, err = ag.engine.Query(ctx, user.Query{Text: text}, thread, opts...)
+	var pendingErr *engine.PendingError
+	if errors.As(err, &pendingErr) {
+		sse.write("pending", makePending(pendingErr.Request))
+		return
+	}
+	var partialErr *engine.PartialError
+	if errors.As(err, &partialErr) {
+		sse.write("partial", makePartial(thread.ID(), partialErr))
+		return
+	}
+	var loopErr *engine.LoopError
+	if errors.As(err, &loopErr) {
+		sse.write("loop", makeLoop(thread.ID(), loopErr))
+		return
+	}
+	var guardErr *guard.Error
+	if errors.As(err, &guardErr) {
+		sse.write("guardrail", makeGuardrail(thread.ID(), guardErr))
+		return
+	}
+	if err != nil {
+		ag.log.Debug("stream query", "method", "stream", "threadID", thread.ID(), "error", err)
 	}
 }
 
@@ -174,6 +286,7 @@ func (ag *Agent) Delete(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("delete agent: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
+	ag.threads.DeleteAll(id)
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/approval"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/monitor"
+)
+
+const (
+	ApprovalID = "approvalID"
+	CallID     = "callID"
+)
+
+type Approval struct {
+	resumer   engine.Resumer
+	threads   db.Thread
+	approvals db.Approval
+	tr        trace.Tracer
+	log       *slog.Logger
+}
+
+func NewApproval(resumer engine.Resumer, threads db.Thread, approvals db.Approval, log *slog.Logger) *Approval {
+	return &Approval{
+		resumer:   resumer,
+		threads:   threads,
+		approvals: approvals,
+		tr:        monitor.Tracer("ApprovalHandler"),
+		log:       log,
+	}
+}
+
+// Get returns the approval request with all calls and their decisions.
+// Requests of other threads are not found.
+func (ap *Approval) Get(w http.ResponseWriter, r *http.Request) {
+	_, span := ap.tr.Start(r.Context(), "get approval")
+	defer span.End()
+
+	agentID := r.PathValue(AgentID)
+	threadID := r.PathValue(ThreadID)
+	id := r.PathValue(ApprovalID)
+	ap.log.Info("get approval", "method", "Get",
+		"agentID", agentID,
+		"threadID", threadID,
+		"id", id,
+		"traceID", monitor.TraceID(span))
+
+	req, ok := ap.get(w, agentID, threadID, id)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, makePending(req))
+}
+
+// Decide approves, edits or rejects a single call of an approval request.
+// The form value decision must be one of approve, edit or reject. An edit requires the
+// form value arguments, a rejection takes an optional comment.
+// Once all calls are decided the suspended query is resumed with its original limits and
+// its result is returned. Requests of other threads are not found.
+func (ap *Approval) Decide(w http.ResponseWriter, r *http.Request) {
+	ctx, span := ap.tr.Start(r.Context(), "decide approval")
+	defer span.End()
+
+	agentID := r.PathValue(AgentID)
+	threadID := r.PathValue(ThreadID)
+	id := r.PathValue(ApprovalID)
+	callID := r.PathValue(CallID)
+	ap.log.Info("decide approval", "method", "Decide",
+		"agentID", agentID,
+		"threadID", threadID,
+		"id", id,
+		"callID", callID,
+		"traceID", monitor.TraceID(span))
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	thread, err := ap.threads.Get(agentID, threadID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("get thread %s: %s", threadID, err.Error()), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("get thread %s: %s", threadID, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	// Hold the thread lock, so that decisions and the resumed query are serialized.
+	err = thread.Lock(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("lock thread: %s", err.Error()), http.StatusServiceUnavailable)
+		return
+	}
+	defer thread.Unlock()
+
+	req, ok := ap.get(w, agentID, threadID, id)
+	if !ok {
+		return
+	}
+
+	switch decision := r.FormValue("decision"); decision {
+	case "approve":
+		err = req.Approve(callID)
+	case "edit":
+		arguments := r.FormValue("arguments")
+		if arguments == "" {
+			http.Error(w, "arguments is empty", http.StatusBadRequest)
+			return
+		}
+		err = req.Edit(callID, arguments)
+	case "reject":
+		err = req.Reject(callID, r.FormValue("comment"))
+	default:
+		http.Error(w, fmt.Sprintf("decision %q invalid", decision), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, approval.ErrCallNotFound) {
+			http.Error(w, fmt.Sprintf("decide: %s", err.Error()), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("decide: %s", err.Error()), http.StatusConflict)
+		return
+	}
+
+	err = ap.approvals.Update(id, req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("update approval: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	if !req.Decided() {
+		writeJSON(w, http.StatusOK, makePending(req))
+		return
+	}
+
+	opts := []engine.Option{engine.WithAgentID(agentID)}
+	if req.MaxIter > 0 {
+		opts = append(opts, engine.WithMaxIter(req.MaxIter))
+	}
+	// The wait for the decision does not count against the deadline of the query.
+	if deadline := req.ResumeDeadline(time.Now()); !deadline.IsZero() {
+		opts = append(opts, engine.WithDeadline(deadline))
+	}
+	res, err := ap.resumer.Resume(ctx, id, thread, opts...)
+	writeResult(w, agentID, threadID, res, err)
+}
+
+// get returns the approval request with the given id if it belongs to the thread with
+// the given threadID of the agent with the given agentID. Otherwise an error is written
+// and false is returned.
+func (ap *Approval) get(w http.ResponseWriter, agentID string, threadID string, id string) (approval.Request, bool) {
+	req, err := ap.approvals.Get(id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("get approval %s: %s", id, err.Error()), http.StatusNotFound)
+			return approval.Request{}, false
+		}
+		http.Error(w, fmt.Sprintf("get approval %s: %s", id, err.Error()), http.StatusBadRequest)
+		return approval.Request{}, false
+	}
+	if !req.BelongsTo(agentID, threadID) {
+		http.Error(w, fmt.Sprintf("get approval %s: %s", id, db.ErrNotFound.Error()), http.StatusNotFound)
+		return approval.Request{}, false
+	}
+	return req, true
+}
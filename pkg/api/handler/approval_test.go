@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/agent/function"
+	"github.com/Br0ce/opera/pkg/approval"
+	"github.com/Br0ce/opera/pkg/db/inmem"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+type testResumer struct {
+	invoked int
+}
+
+func (rs *testResumer) Resume(_ context.Context, _ string, _ agent.Agent, _ ...engine.Option) (string, error) {
+	rs.invoked++
+	return "done", nil
+}
+
+func TestApproval_otherThread(t *testing.T) {
+	t.Parallel()
+
+	log := monitor.NewTestLogger(false)
+	threads := inmem.NewThreadDB()
+	def := function.NewAgent("", nil, nil, log)
+	for _, id := range []string{"thread-1", "thread-2"} {
+		if err := threads.Add("agent-1", def.NewThread(id)); err != nil {
+			t.Fatalf("add thread: %s", err.Error())
+		}
+	}
+	approvals := inmem.NewApprovalDB()
+	req := approval.MakeRequest([]tool.Call{{ID: "1", Name: "delete_user"}}, "", 0, func(tool.Call) bool {
+		return true
+	})
+	req.AgentID = "agent-1"
+	req.ThreadID = "thread-1"
+	id, err := approvals.Add(req)
+	if err != nil {
+		t.Fatalf("add approval: %s", err.Error())
+	}
+	resumer := &testResumer{}
+	ap := NewApproval(resumer, threads, approvals, log)
+
+	tests := []struct {
+		name     string
+		agentID  string
+		threadID string
+		wantCode int
+	}{
+		{
+			name:     "other thread",
+			agentID:  "agent-1",
+			threadID: "thread-2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "other agent",
+			agentID:  "agent-2",
+			threadID: "thread-1",
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, approvalPath(test.agentID, test.threadID, id), nil)
+			r.SetPathValue(AgentID, test.agentID)
+			r.SetPathValue(ThreadID, test.threadID)
+			r.SetPathValue(ApprovalID, id)
+			w := httptest.NewRecorder()
+			ap.Get(w, r)
+			if w.Code != test.wantCode {
+				t.Errorf("Approval.Get() code = %v, want %v", w.Code, test.wantCode)
+			}
+
+			form := url.Values{"decision": {"approve"}}
+			r = httptest.NewRequest(http.MethodPost, approvalPath(test.agentID, test.threadID, id)+"/calls/1", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.SetPathValue(AgentID, test.agentID)
+			r.SetPathValue(ThreadID, test.threadID)
+			r.SetPathValue(ApprovalID, id)
+			r.SetPathValue(CallID, "1")
+			w = httptest.NewRecorder()
+			ap.Decide(w, r)
+			if w.Code != test.wantCode {
+				t.Errorf("Approval.Decide() code = %v, want %v", w.Code, test.wantCode)
+			}
+		})
+	}
+
+	got, err := approvals.Get(id)
+	if err != nil {
+		t.Fatalf("get approval: %s", err.Error())
+	}
+	if got.Decided() {
+		t.Error("Approval.Decide() decided the request of another thread")
+	}
+	if resumer.invoked != 0 {
+		t.Errorf("Approval.Decide() resumeInvoked = %v, want %v", resumer.invoked, 0)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, approvalPath("agent-1", "thread-1", id), nil)
+	r.SetPathValue(AgentID, "agent-1")
+	r.SetPathValue(ThreadID, "thread-1")
+	r.SetPathValue(ApprovalID, id)
+	w := httptest.NewRecorder()
+	ap.Get(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Approval.Get() code = %v, want %v", w.Code, http.StatusOK)
+	}
+}
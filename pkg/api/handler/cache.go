@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/monitor"
+)
+
+type Cache struct {
+	cache *action.Cache
+	tr    trace.Tracer
+	log   *slog.Logger
+}
+
+func NewCache(cache *action.Cache, log *slog.Logger) *Cache {
+	return &Cache{
+		cache: cache,
+		tr:    monitor.Tracer("CacheHandler"),
+		log:   log,
+	}
+}
+
+type cacheEntryInfo struct {
+	Object    string    `json:"object"`
+	Tool      string    `json:"tool"`
+	Arguments string    `json:"arguments"`
+	Expires   time.Time `json:"expires"`
+	Hits      int       `json:"hits"`
+}
+
+// List returns all cached tool results. The query parameter tool limits the results to
+// the given tool.
+func (ca *Cache) List(w http.ResponseWriter, r *http.Request) {
+	_, span := ca.tr.Start(r.Context(), "list cache")
+	defer span.End()
+	ca.log.Info("list cache", "method", "List", "traceID", monitor.TraceID(span))
+
+	name := r.URL.Query().Get("tool")
+	entries := make([]cacheEntryInfo, 0)
+	for _, entry := range ca.cache.Entries() {
+		if name != "" && entry.Tool != name {
+			continue
+		}
+		entries = append(entries, cacheEntryInfo{
+			Object:    "cache.entry",
+			Tool:      entry.Tool,
+			Arguments: entry.Arguments,
+			Expires:   entry.Expires,
+			Hits:      entry.Hits,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object": "list",
+		"data":   entries,
+	})
+}
+
+// Flush removes the cached tool results. The query parameter tool limits the flush to
+// the results of the given tool.
+func (ca *Cache) Flush(w http.ResponseWriter, r *http.Request) {
+	_, span := ca.tr.Start(r.Context(), "flush cache")
+	defer span.End()
+
+	name := r.URL.Query().Get("tool")
+	n := ca.cache.Flush(name)
+	ca.log.Info("flush cache", "method", "Flush", "tool", name, "flushed", n, "traceID", monitor.TraceID(span))
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object":  "cache.flush",
+		"flushed": n,
+	})
+}
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/checkpoint"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/job"
+	"github.com/Br0ce/opera/pkg/job/pool"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+const CheckpointID = "checkpointID"
+
+type Checkpoint struct {
+	recoverer   engine.Recoverer
+	checkpoints db.Checkpoint
+	agents      db.Agent
+	threads     db.Thread
+	discovery   tool.Discovery
+	jobs        *pool.Pool
+	tr          trace.Tracer
+	log         *slog.Logger
+}
+
+func NewCheckpoint(recoverer engine.Recoverer, checkpoints db.Checkpoint, agents db.Agent, threads db.Thread, discovery tool.Discovery, jobs *pool.Pool, log *slog.Logger) *Checkpoint {
+	return &Checkpoint{
+		recoverer:   recoverer,
+		checkpoints: checkpoints,
+		agents:      agents,
+		threads:     threads,
+		discovery:   discovery,
+		jobs:        jobs,
+		tr:          monitor.Tracer("CheckpointHandler"),
+		log:         log,
+	}
+}
+
+// List returns all checkpoints of unfinished queries. Calls to tools which are not
+// idempotent and whose execution was interrupted are flagged.
+func (ch *Checkpoint) List(w http.ResponseWriter, r *http.Request) {
+	ctx, span := ch.tr.Start(r.Context(), "list checkpoints")
+	defer span.End()
+	ch.log.Info("list checkpoints", "method", "List", "traceID", monitor.TraceID(span))
+
+	var cps []checkpointInfo
+	for cp := range ch.checkpoints.All() {
+		cps = append(cps, ch.makeInfo(ctx, cp))
+	}
+	slices.SortFunc(cps, func(a, b checkpointInfo) int {
+		return a.Updated.Compare(b.Updated)
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object": "list",
+		"data":   cps,
+	})
+}
+
+// Resume recovers the query of the checkpoint as job. The job is polled under
+// /v1/jobs/{jobID}.
+func (ch *Checkpoint) Resume(w http.ResponseWriter, r *http.Request) {
+	ctx, span := ch.tr.Start(r.Context(), "resume checkpoint")
+	defer span.End()
+
+	id := r.PathValue(CheckpointID)
+	ch.log.Info("resume checkpoint", "method", "Resume", "id", id, "traceID", monitor.TraceID(span))
+
+	cp, err := ch.checkpoints.Get(id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("get checkpoint %s: %s", id, err.Error()), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("get checkpoint %s: %s", id, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	j, err := ch.resume(ctx, cp)
+	if err != nil {
+		if errors.Is(err, pool.ErrQueueFull) {
+			http.Error(w, fmt.Sprintf("resume checkpoint: %s", err.Error()), http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, fmt.Sprintf("resume checkpoint: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Location", jobPath(j.ID))
+	writeJSON(w, http.StatusAccepted, makeJobInfo(j))
+}
+
+// Delete discards the checkpoint, the query is not resumed.
+func (ch *Checkpoint) Delete(w http.ResponseWriter, r *http.Request) {
+	_, span := ch.tr.Start(r.Context(), "delete checkpoint")
+	defer span.End()
+
+	id := r.PathValue(CheckpointID)
+	ch.log.Info("delete checkpoint", "method", "Delete", "id", id, "traceID", monitor.TraceID(span))
+
+	err := ch.checkpoints.Delete(id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("delete checkpoint: %s", err.Error()), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("delete checkpoint: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ResumeAll recovers the queries of all checkpoints as jobs, e.g. on startup.
+// Checkpoints which cannot be resumed are logged and kept.
+func (ch *Checkpoint) ResumeAll(ctx context.Context) {
+	for cp := range ch.checkpoints.All() {
+		j, err := ch.resume(ctx, cp)
+		if err != nil {
+			ch.log.Error("resume checkpoint", "method", "ResumeAll", "id", cp.ID, "error", err)
+			continue
+		}
+		ch.log.Info("resume checkpoint", "method", "ResumeAll", "id", cp.ID, "jobID", j.ID)
+	}
+}
+
+// resume restores the thread of the checkpoint and submits the recovery of the query
+// as job.
+func (ch *Checkpoint) resume(ctx context.Context, cp checkpoint.Checkpoint) (job.Job, error) {
+	thread, err := ch.thread(cp)
+	if err != nil {
+		return job.Job{}, err
+	}
+
+	fn := func(ctx context.Context) (string, error) {
+		err := thread.Lock(ctx)
+		if err != nil {
+			return "", fmt.Errorf("lock thread: %w", err)
+		}
+		defer thread.Unlock()
+		return ch.recoverer.Recover(ctx, cp.ID, thread, engine.WithAgentID(cp.AgentID))
+	}
+	id, err := ch.jobs.Submit(ctx, job.MakeJob(cp.AgentID, thread.ID()), fn)
+	if err != nil {
+		return job.Job{}, fmt.Errorf("submit job: %w", err)
+	}
+	return ch.jobs.Get(id)
+}
+
+// thread returns the thread of the checkpoint. If the thread is unknown, e.g. after a
+// restart, it is restored from the checkpoint.
+func (ch *Checkpoint) thread(cp checkpoint.Checkpoint) (agent.Thread, error) {
+	thread, err := ch.threads.Get(cp.AgentID, cp.ThreadID)
+	if err == nil {
+		return thread, nil
+	}
+	if !errors.Is(err, db.ErrNotFound) {
+		return nil, fmt.Errorf("get thread %s: %w", cp.ThreadID, err)
+	}
+
+	def, err := ch.agents.Get(cp.AgentID)
+	if err != nil {
+		return nil, fmt.Errorf("get agent %s: %w", cp.AgentID, err)
+	}
+	restorer, ok := def.(agent.Restorer)
+	if !ok {
+		return nil, fmt.Errorf("agent %s cannot restore threads", cp.AgentID)
+	}
+	thread = restorer.RestoreThread(cp.ThreadID, cp.ThreadCreated, cp.History)
+	err = ch.threads.Add(cp.AgentID, thread)
+	if err != nil {
+		return nil, fmt.Errorf("add thread: %w", err)
+	}
+	return thread, nil
+}
+
+func (ch *Checkpoint) makeInfo(ctx context.Context, cp checkpoint.Checkpoint) checkpointInfo {
+	idempotent := func(call tool.Call) bool {
+		to, err := ch.discovery.Get(ctx, call.Name)
+		return err == nil && to.Idempotent()
+	}
+	interrupted := make([]callInfo, 0)
+	for _, call := range cp.Interrupted(idempotent) {
+		interrupted = append(interrupted, callInfo{ID: call.ID, Name: call.Name, Arguments: call.Arguments})
+	}
+	return checkpointInfo{
+		Object:      "checkpoint",
+		ID:          cp.ID,
+		Agent:       cp.AgentID,
+		Thread:      cp.ThreadID,
+		Iter:        cp.Iter,
+		Phase:       strings.ToLower(string(cp.Phase)),
+		Interrupted: interrupted,
+		Updated:     cp.Updated,
+	}
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/engine/fanout"
+	"github.com/Br0ce/opera/pkg/ids"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/user"
+)
+
+type Fanout struct {
+	engine  *fanout.Engine
+	agents  db.Agent
+	threads db.Thread
+	tr      trace.Tracer
+	log     *slog.Logger
+}
+
+func NewFanout(engine *fanout.Engine, agents db.Agent, threads db.Thread, log *slog.Logger) *Fanout {
+	return &Fanout{
+		engine:  engine,
+		agents:  agents,
+		threads: threads,
+		tr:      monitor.Tracer("FanoutHandler"),
+		log:     log,
+	}
+}
+
+type fanoutResult struct {
+	Object   string         `json:"object"`
+	Strategy string         `json:"strategy"`
+	Text     string         `json:"text"`
+	Answers  []fanoutAnswer `json:"answers"`
+}
+
+type fanoutAnswer struct {
+	Agent    string `json:"agent"`
+	Thread   string `json:"thread"`
+	Text     string `json:"text,omitempty"`
+	Partial  bool   `json:"partial"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+func makeFanoutResult(res fanout.Result) fanoutResult {
+	answers := make([]fanoutAnswer, 0, len(res.Answers))
+	for _, a := range res.Answers {
+		answer := fanoutAnswer{
+			Agent:    a.AgentID,
+			Thread:   a.ThreadID,
+			Text:     a.Text,
+			Partial:  a.Partial,
+			Duration: a.Duration.Round(time.Millisecond).String(),
+		}
+		if a.Err != nil {
+			answer.Error = a.Err.Error()
+		}
+		answers = append(answers, answer)
+	}
+	return fanoutResult{
+		Object:   "fanout",
+		Strategy: string(res.Strategy),
+		Text:     res.Text,
+		Answers:  answers,
+	}
+}
+
+// Query asks the agents given by the form values agent, repeated or comma separated, the
+// form value text in parallel, each on a new thread. The answers are aggregated with the
+// form value strategy, majority, judge or concat, which defaults to majority. The
+// optional form value timeout, e.g. 30s, limits the time each agent has to answer.
+// The response holds the aggregated answer and the answers of all agents, whose threads
+// can be continued.
+func (fa *Fanout) Query(w http.ResponseWriter, r *http.Request) {
+	ctx, span := fa.tr.Start(r.Context(), "Query fanout")
+	defer span.End()
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	text := r.FormValue("text")
+	if text == "" {
+		http.Error(w, "text is empty", http.StatusBadRequest)
+		return
+	}
+	var agentIDs []string
+	for _, v := range r.Form["agent"] {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				agentIDs = append(agentIDs, id)
+			}
+		}
+	}
+	if len(agentIDs) < 2 {
+		http.Error(w, "at least two agents needed", http.StatusBadRequest)
+		return
+	}
+	strategy := fanout.StrategyMajority
+	if s := r.FormValue("strategy"); s != "" {
+		strategy = fanout.Strategy(s)
+	}
+	if !strategy.Valid() {
+		http.Error(w, fmt.Sprintf("strategy %q invalid", strategy), http.StatusBadRequest)
+		return
+	}
+	var timeout time.Duration
+	if t := r.FormValue("timeout"); t != "" {
+		timeout, err = time.ParseDuration(t)
+		if err != nil || timeout <= 0 {
+			http.Error(w, fmt.Sprintf("timeout %q invalid", t), http.StatusBadRequest)
+			return
+		}
+	}
+	fa.log.Info("query fanout",
+		"method", "Query",
+		"agents", agentIDs,
+		"strategy", strategy,
+		"traceID", monitor.TraceID(span))
+
+	members := make([]fanout.Member, 0, len(agentIDs))
+	for _, id := range agentIDs {
+		def, err := fa.agents.Get(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("get agent %s: %s", id, err.Error()), http.StatusBadRequest)
+			return
+		}
+		thread := def.NewThread(ids.UniqueThread())
+		err = fa.threads.Add(id, thread)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("add thread: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+		members = append(members, fanout.Member{AgentID: id, Thread: thread})
+	}
+
+	res, err := fa.engine.Query(ctx, user.Query{Text: text}, members, strategy, timeout)
+	if errors.Is(err, fanout.ErrNoAnswer) {
+		writeJSON(w, http.StatusBadGateway, makeFanoutResult(res))
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("query fanout: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, makeFanoutResult(res))
+}
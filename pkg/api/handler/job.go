@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/job"
+	"github.com/Br0ce/opera/pkg/job/pool"
+	"github.com/Br0ce/opera/pkg/monitor"
+)
+
+const JobID = "jobID"
+
+type Job struct {
+	jobs *pool.Pool
+	tr   trace.Tracer
+	log  *slog.Logger
+}
+
+func NewJob(jobs *pool.Pool, log *slog.Logger) *Job {
+	return &Job{
+		jobs: jobs,
+		tr:   monitor.Tracer("JobHandler"),
+		log:  log,
+	}
+}
+
+// Get returns the status of the job and, once it is done, its result.
+// A pending job links to the approval request it waits for.
+func (jo *Job) Get(w http.ResponseWriter, r *http.Request) {
+	_, span := jo.tr.Start(r.Context(), "get job")
+	defer span.End()
+
+	id := r.PathValue(JobID)
+	jo.log.Info("get job", "method", "Get", "id", id, "traceID", monitor.TraceID(span))
+
+	j, err := jo.jobs.Get(id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("get job %s: %s", id, err.Error()), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("get job %s: %s", id, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	if j.Status == job.Pending {
+		w.Header().Set("Location", approvalPath(j.AgentID, j.ThreadID, j.ApprovalID))
+	}
+	writeJSON(w, http.StatusOK, makeJobInfo(j))
+}
+
+// Cancel cancels a queued or running job.
+func (jo *Job) Cancel(w http.ResponseWriter, r *http.Request) {
+	_, span := jo.tr.Start(r.Context(), "cancel job")
+	defer span.End()
+
+	id := r.PathValue(JobID)
+	jo.log.Info("cancel job", "method", "Cancel", "id", id, "traceID", monitor.TraceID(span))
+
+	j, err := jo.jobs.Cancel(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrNotFound):
+			http.Error(w, fmt.Sprintf("cancel job %s: %s", id, err.Error()), http.StatusNotFound)
+		case errors.Is(err, pool.ErrDone):
+			http.Error(w, fmt.Sprintf("cancel job %s: %s", id, err.Error()), http.StatusConflict)
+		default:
+			http.Error(w, fmt.Sprintf("cancel job %s: %s", id, err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, makeJobInfo(j))
+}
+
+func jobPath(id string) string {
+	return path.Join("/v1/jobs", id)
+}
@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/ids"
+	"github.com/Br0ce/opera/pkg/mcp"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/user"
+)
+
+var _ mcp.ToolSet = (*MCP)(nil)
+
+// askPrefix prefixes the names of the tools asking an agent.
+const askPrefix = "ask_"
+
+// invalidToolChars are the characters not allowed in the names of MCP tools.
+var invalidToolChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// MCP offers the discovered tools and the agents to MCP clients. Calls to tools are
+// acted upon by the actor, every agent is offered as tool ask_<agentID> answering a
+// question with a query on a new thread. Tools requiring a human approval are not
+// offered, MCP clients cannot approve calls.
+type MCP struct {
+	discovery tool.Discovery
+	actor     *action.Actor
+	engine    engine.Engine
+	agents    db.Agent
+	threads   db.Thread
+	server    *mcp.Server
+	mu        sync.Mutex
+	// listed is the list of tools last synced, to notify clients only of changes.
+	listed []byte
+	tr     trace.Tracer
+	log    *slog.Logger
+}
+
+func NewMCP(discovery tool.Discovery, actor *action.Actor, engine engine.Engine, agents db.Agent, threads db.Thread, log *slog.Logger) *MCP {
+	h := &MCP{
+		discovery: discovery,
+		actor:     actor,
+		engine:    engine,
+		agents:    agents,
+		threads:   threads,
+		tr:        monitor.Tracer("MCPHandler"),
+		log:       log,
+	}
+	h.server = mcp.NewServer(h, mcp.Implementation{Name: "opera", Version: "1.0.0"}, log)
+	return h
+}
+
+// ServeHTTP serves the streamable HTTP transport of MCP.
+func (h *MCP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.server.ServeHTTP(w, r)
+}
+
+// ServeStdio serves a MCP client over r and w until r ends or ctx is done.
+func (h *MCP) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	return h.server.ServeStdio(ctx, r, w)
+}
+
+// Sync notifies the clients if the offered tools changed since the last sync, e.g.
+// after the discovery was refreshed or agents were declared.
+func (h *MCP) Sync(ctx context.Context) {
+	tools, err := h.ListTools(ctx)
+	if err != nil {
+		h.log.Error("list tools", "method", "Sync", "error", err.Error())
+		return
+	}
+	bb, err := json.Marshal(tools)
+	if err != nil {
+		h.log.Error("encode tools", "method", "Sync", "error", err.Error())
+		return
+	}
+
+	h.mu.Lock()
+	changed := h.listed != nil && !slices.Equal(h.listed, bb)
+	h.listed = bb
+	h.mu.Unlock()
+	if changed {
+		h.log.Info("notify tools changed", "method", "Sync", "tools", len(tools))
+		h.server.NotifyToolsChanged()
+	}
+}
+
+// Close ends the sessions of all MCP clients.
+func (h *MCP) Close() {
+	h.server.Close()
+}
+
+// ListTools returns the discovered tools not requiring an approval, followed by a tool
+// for each agent. Discovered tools named like the tool of an agent are not offered.
+func (h *MCP) ListTools(ctx context.Context) ([]mcp.Tool, error) {
+	ctx, span := h.tr.Start(ctx, "list mcp tools")
+	defer span.End()
+	h.log.Debug("list mcp tools", "method", "ListTools", "traceID", monitor.TraceID(span))
+
+	asks := h.askTools()
+	var tools []mcp.Tool
+	for _, t := range h.discovery.All(ctx) {
+		if agentID, ok := asks[t.Name()]; ok {
+			h.log.Warn("tool shadowed by ask tool", "method", "ListTools",
+				"toolName", t.Name(),
+				"agentID", agentID,
+				"traceID", monitor.TraceID(span))
+			continue
+		}
+		if t.Approval() {
+			continue
+		}
+		tools = append(tools, mcp.Tool{
+			Name:        t.Name(),
+			Description: t.Description(),
+			InputSchema: t.Parameters().Schema(),
+			Annotations: &mcp.Annotations{
+				ReadOnlyHint:   ptr(t.ReadOnly()),
+				IdempotentHint: ptr(t.Idempotent()),
+			},
+		})
+	}
+	slices.SortFunc(tools, func(a, b mcp.Tool) int { return strings.Compare(a.Name, b.Name) })
+
+	for _, name := range slices.Sorted(maps.Keys(asks)) {
+		tools = append(tools, mcp.Tool{
+			Name:        name,
+			Description: fmt.Sprintf("Ask the agent %s a question. The agent answers using its own tools.", asks[name]),
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"question": map[string]any{"type": "string", "description": "The question to the agent."},
+				},
+				"required": []string{"question"},
+			},
+			Annotations: &mcp.Annotations{OpenWorldHint: ptr(true)},
+		})
+	}
+	span.SetAttributes(attribute.Int("tool.count", len(tools)))
+	return tools, nil
+}
+
+// CallTool asks the agent of an ask tool or acts upon the call of the discovered tool.
+func (h *MCP) CallTool(ctx context.Context, name string, arguments json.RawMessage) (mcp.CallToolResult, error) {
+	ctx, span := h.tr.Start(ctx, "call mcp tool")
+	defer span.End()
+	span.SetAttributes(attribute.String("tool.name", name))
+	h.log.Info("call mcp tool", "method", "CallTool", "name", name, "traceID", monitor.TraceID(span))
+
+	if agentID, ok := h.askTools()[name]; ok {
+		return h.ask(ctx, agentID, arguments)
+	}
+
+	t, err := h.discovery.Get(ctx, name)
+	if err != nil || t.Approval() {
+		return mcp.CallToolResult{}, &mcp.Error{Code: mcp.CodeInvalidParams, Message: fmt.Sprintf("tool %s not found", name)}
+	}
+	call := tool.Call{ID: "mcp", Name: name, Arguments: string(arguments)}
+	percepts, err := h.actor.Act(ctx, action.MakeTool([]tool.Call{call}, ""))
+	if err != nil {
+		return mcp.CallToolResult{}, err
+	}
+	resp, ok := percepts[0].Tool()
+	if !ok {
+		return mcp.CallToolResult{}, fmt.Errorf("no response to call of tool %s", name)
+	}
+	if resp.Err != nil {
+		return textResult(resp.Err.Error(), true), nil
+	}
+	return textResult(resp.Content, false), nil
+}
+
+// ask answers the question of the arguments with a query to the agent on a new thread.
+// The thread is deleted after the query, unless the query is suspended for a human
+// approval. The thread of a suspended query is kept until it is deleted, so that the
+// approval can be decided at the reported path.
+func (h *MCP) ask(ctx context.Context, agentID string, arguments json.RawMessage) (mcp.CallToolResult, error) {
+	var args struct {
+		Question string `json:"question"`
+	}
+	err := json.Unmarshal(arguments, &args)
+	if err != nil || args.Question == "" {
+		return mcp.CallToolResult{}, &mcp.Error{Code: mcp.CodeInvalidParams, Message: "argument question missing"}
+	}
+
+	a, err := h.agents.Get(agentID)
+	if err != nil {
+		return mcp.CallToolResult{}, fmt.Errorf("get agent %s: %w", agentID, err)
+	}
+	thread := a.NewThread(ids.UniqueThread())
+	err = h.threads.Add(agentID, thread)
+	if err != nil {
+		return mcp.CallToolResult{}, fmt.Errorf("add thread: %w", err)
+	}
+
+	err = thread.Lock(ctx)
+	if err != nil {
+		return mcp.CallToolResult{}, fmt.Errorf("lock thread: %w", err)
+	}
+	defer thread.Unlock()
+	answer, err := h.engine.Query(ctx, user.Query{Text: args.Question}, thread, engine.WithAgentID(agentID))
+	var pendingErr *engine.PendingError
+	if errors.As(err, &pendingErr) {
+		path := approvalPath(agentID, thread.ID(), pendingErr.Request.ID)
+		return textResult(fmt.Sprintf("The query awaits a human approval, decide it at %s.", path), true), nil
+	}
+	if delErr := h.threads.Delete(agentID, thread.ID()); delErr != nil {
+		h.log.Error("delete thread", "method", "ask", "agentID", agentID, "threadID", thread.ID(), "error", delErr.Error())
+	}
+	if ctx.Err() != nil {
+		return mcp.CallToolResult{}, ctx.Err()
+	}
+	if err != nil {
+		return textResult(err.Error(), true), nil
+	}
+	return textResult(answer, false), nil
+}
+
+// askTools returns the agent ids by the names of their ask tools. Agents whose ids
+// map to the same tool name are not offered, a call could not tell them apart.
+func (h *MCP) askTools() map[string]string {
+	agents := make(map[string][]string)
+	for id := range h.agents.All() {
+		name := askPrefix + invalidToolChars.ReplaceAllString(id, "_")
+		agents[name] = append(agents[name], id)
+	}
+	tools := make(map[string]string, len(agents))
+	for name, ids := range agents {
+		if len(ids) > 1 {
+			slices.Sort(ids)
+			h.log.Warn("skip agents with colliding tool name", "method", "askTools", "name", name, "agentIDs", ids)
+			continue
+		}
+		tools[name] = ids[0]
+	}
+	return tools
+}
+
+func textResult(text string, isError bool) mcp.CallToolResult {
+	return mcp.CallToolResult{
+		Content: []mcp.Content{{Type: "text", Text: text}},
+		IsError: isError,
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
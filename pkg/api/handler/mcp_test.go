@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/agent/function"
+	"github.com/Br0ce/opera/pkg/db/inmem"
+	loopEngine "github.com/Br0ce/opera/pkg/engine/loop"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	toolMock "github.com/Br0ce/opera/pkg/tool/mock"
+)
+
+func TestMCP_askTools(t *testing.T) {
+	t.Parallel()
+
+	log := monitor.NewTestLogger(false)
+	discovery := &toolMock.Discovery{
+		AllFn: func(_ context.Context) []tool.Tool { return nil },
+	}
+	actor := action.NewActor(discovery, nil, log)
+	eg := loopEngine.NewEngine(actor, 3, log)
+
+	agents := inmem.NewAgentDB()
+	def := function.NewAgent("", discovery, testReasoner{answer: "42"}, log)
+	for _, id := range []string{"support", "sales/eu", "sales eu"} {
+		if err := agents.Set(id, def); err != nil {
+			t.Fatalf("set agent: %s", err.Error())
+		}
+	}
+	threads := inmem.NewThreadDB()
+	h := NewMCP(discovery, actor, eg, agents, threads, log)
+
+	tools, err := h.ListTools(context.TODO())
+	if err != nil {
+		t.Fatalf("MCP.ListTools() error = %v", err)
+	}
+	var names []string
+	for _, to := range tools {
+		names = append(names, to.Name)
+	}
+	want := []string{"ask_support"}
+	if !slices.Equal(names, want) {
+		t.Errorf("MCP.ListTools() = %v, want %v", names, want)
+	}
+
+	args, err := json.Marshal(map[string]string{"question": "what is the answer?"})
+	if err != nil {
+		t.Fatalf("encode arguments: %s", err.Error())
+	}
+	res, err := h.CallTool(context.TODO(), "ask_support", args)
+	if err != nil {
+		t.Fatalf("MCP.CallTool() error = %v", err)
+	}
+	if res.IsError || len(res.Content) != 1 || res.Content[0].Text != "42" {
+		t.Errorf("MCP.CallTool() = %v, want answer %q", res, "42")
+	}
+	for thread := range threads.All("support") {
+		t.Errorf("MCP.CallTool() kept thread %s", thread.ID())
+	}
+}
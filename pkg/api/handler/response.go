@@ -0,0 +1,338 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/approval"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/guard"
+	"github.com/Br0ce/opera/pkg/history"
+	"github.com/Br0ce/opera/pkg/job"
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+type callInfo struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Decision  string `json:"decision,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+type pending struct {
+	Object string     `json:"object"`
+	ID     string     `json:"id"`
+	Reason string     `json:"reason,omitempty"`
+	Calls  []callInfo `json:"calls"`
+}
+
+// makePending returns the response body for an approval request.
+func makePending(req approval.Request) pending {
+	calls := make([]callInfo, 0, len(req.Calls))
+	for _, c := range req.Calls {
+		calls = append(calls, callInfo{
+			ID:        c.Call.ID,
+			Name:      c.Call.Name,
+			Arguments: c.Call.Arguments,
+			Decision:  string(c.Decision),
+			Comment:   c.Comment,
+		})
+	}
+	return pending{
+		Object: "pending",
+		ID:     req.ID,
+		Reason: req.Reason,
+		Calls:  calls,
+	}
+}
+
+type finding struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+}
+
+type partial struct {
+	Object   string    `json:"object"`
+	Text     string    `json:"text,omitempty"`
+	Thread   string    `json:"thread"`
+	Partial  bool      `json:"partial"`
+	Reason   string    `json:"reason"`
+	MaxIter  int       `json:"maxIter"`
+	Findings []finding `json:"findings"`
+}
+
+// makePartial returns the response body for a query which reached its iteration limit
+// or its deadline. If the agent gave a final answer, the object is an answer.
+func makePartial(threadID string, err *engine.PartialError) partial {
+	object := "partial"
+	if err.Text != "" {
+		object = "answer"
+	}
+	return partial{
+		Object:   object,
+		Text:     err.Text,
+		Thread:   threadID,
+		Partial:  true,
+		Reason:   string(err.Reason),
+		MaxIter:  err.MaxIter,
+		Findings: makeFindings(err.Findings),
+	}
+}
+
+func makeFindings(responses []tool.Response) []finding {
+	ff := make([]finding, 0, len(responses))
+	for _, resp := range responses {
+		ff = append(ff, finding{ID: resp.ID, Content: resp.Content})
+	}
+	return ff
+}
+
+type loop struct {
+	Object     string     `json:"object"`
+	Thread     string     `json:"thread"`
+	Pattern    string     `json:"pattern"`
+	Iter       int        `json:"iter"`
+	Calls      []callInfo `json:"calls"`
+	Diagnostic string     `json:"diagnostic"`
+}
+
+// makeLoop returns the response body for a query stopped because the agent was stuck in
+// a loop.
+func makeLoop(threadID string, err *engine.LoopError) loop {
+	calls := make([]callInfo, 0, len(err.Calls))
+	for _, c := range err.Calls {
+		calls = append(calls, callInfo{ID: c.ID, Name: c.Name, Arguments: c.Arguments})
+	}
+	return loop{
+		Object:     "loop",
+		Thread:     threadID,
+		Pattern:    string(err.Pattern),
+		Iter:       err.Iter,
+		Calls:      calls,
+		Diagnostic: err.Diagnostic,
+	}
+}
+
+type guardrail struct {
+	Object     string      `json:"object"`
+	Thread     string      `json:"thread"`
+	Direction  string      `json:"direction"`
+	Violations []violation `json:"violations"`
+}
+
+type violation struct {
+	Check  string `json:"check"`
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// makeGuardrail returns the response body for a query blocked by a guardrail.
+func makeGuardrail(threadID string, err *guard.Error) guardrail {
+	violations := make([]violation, 0, len(err.Violations))
+	for _, v := range err.Violations {
+		violations = append(violations, violation{Check: v.Check, Action: string(v.Action), Reason: v.Reason})
+	}
+	return guardrail{
+		Object:     "guardrail",
+		Thread:     threadID,
+		Direction:  string(err.Direction),
+		Violations: violations,
+	}
+}
+
+type threadInfo struct {
+	Object   string    `json:"object"`
+	ID       string    `json:"id"`
+	Created  time.Time `json:"created"`
+	Messages int       `json:"messages"`
+}
+
+type threadDetail struct {
+	threadInfo
+	History []message `json:"history"`
+}
+
+type message struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content,omitempty"`
+	Image     string     `json:"image,omitempty"`
+	ToolCalls []callInfo `json:"toolCalls,omitempty"`
+	CallID    string     `json:"callID,omitempty"`
+	Created   time.Time  `json:"created"`
+}
+
+func makeThreadInfo(thread agent.Thread) threadInfo {
+	hist := thread.History()
+	return threadInfo{
+		Object:   "thread",
+		ID:       thread.ID(),
+		Created:  thread.Created(),
+		Messages: hist.Len(),
+	}
+}
+
+func makeThreadDetail(thread agent.Thread) threadDetail {
+	hist := thread.History()
+	return threadDetail{
+		threadInfo: makeThreadInfo(thread),
+		History:    makeMessages(hist),
+	}
+}
+
+// makeMessages returns the events of the history as messages.
+func makeMessages(hist history.History) []message {
+	mm := make([]message, 0, hist.Len())
+	for _, event := range hist.All() {
+		switch subject := event.(type) {
+		case history.System:
+			mm = append(mm, message{Role: "system", Content: subject.Content, Created: subject.Created})
+		case history.User:
+			mm = append(mm, message{
+				Role:    "user",
+				Content: subject.Content.Text,
+				Image:   subject.Content.Image,
+				Created: subject.Created,
+			})
+		case history.Assistant:
+			mm = append(mm, message{Role: "assistant", Content: subject.Content, Created: subject.Created})
+		case history.ToolCalls:
+			calls := make([]callInfo, 0, len(subject.Content))
+			for _, c := range subject.Content {
+				calls = append(calls, callInfo{ID: c.ID, Name: c.Name, Arguments: c.Arguments})
+			}
+			mm = append(mm, message{Role: "assistant", ToolCalls: calls, Created: subject.Created})
+		case history.ToolResponse:
+			mm = append(mm, message{
+				Role:    "tool",
+				Content: subject.Content.Content,
+				CallID:  subject.Content.ID,
+				Created: subject.Created,
+			})
+		}
+	}
+	return mm
+}
+
+type jobInfo struct {
+	Object   string     `json:"object"`
+	ID       string     `json:"id"`
+	Agent    string     `json:"agent"`
+	Thread   string     `json:"thread"`
+	Status   string     `json:"status"`
+	Result   string     `json:"result,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Approval string     `json:"approval,omitempty"`
+	Findings []finding  `json:"findings,omitempty"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+func makeJobInfo(j job.Job) jobInfo {
+	info := jobInfo{
+		Object:   "job",
+		ID:       j.ID,
+		Agent:    j.AgentID,
+		Thread:   j.ThreadID,
+		Status:   string(j.Status),
+		Result:   j.Result,
+		Error:    j.Err,
+		Approval: j.ApprovalID,
+		Created:  j.Created,
+	}
+	if j.Status == job.Partial {
+		info.Findings = makeFindings(j.Findings)
+	}
+	if !j.Started.IsZero() {
+		info.Started = &j.Started
+	}
+	if !j.Finished.IsZero() {
+		info.Finished = &j.Finished
+	}
+	return info
+}
+
+type checkpointInfo struct {
+	Object string `json:"object"`
+	ID     string `json:"id"`
+	Agent  string `json:"agent"`
+	Thread string `json:"thread"`
+	Iter   int    `json:"iter"`
+	Phase  string `json:"phase"`
+	// Interrupted are the calls which may or may not have been executed and are not
+	// repeated on resume.
+	Interrupted []callInfo `json:"interrupted"`
+	Updated     time.Time  `json:"updated"`
+}
+
+// writeResult writes the result of a query on the thread with the given threadID.
+// A suspended query is written as pending approval request, an exhausted query as
+// partial result.
+func writeResult(w http.ResponseWriter, agentID string, threadID string, res string, err error) {
+	var pendingErr *engine.PendingError
+	if errors.As(err, &pendingErr) {
+		w.Header().Set("Location", approvalPath(agentID, threadID, pendingErr.Request.ID))
+		writeJSON(w, http.StatusAccepted, makePending(pendingErr.Request))
+		return
+	}
+	var partialErr *engine.PartialError
+	if errors.As(err, &partialErr) {
+		w.Header().Set("Location", threadPath(agentID, threadID))
+		writeJSON(w, http.StatusOK, makePartial(threadID, partialErr))
+		return
+	}
+	var loopErr *engine.LoopError
+	if errors.As(err, &loopErr) {
+		w.Header().Set("Location", threadPath(agentID, threadID))
+		writeJSON(w, http.StatusUnprocessableEntity, makeLoop(threadID, loopErr))
+		return
+	}
+	var guardErr *guard.Error
+	if errors.As(err, &guardErr) {
+		w.Header().Set("Location", threadPath(agentID, threadID))
+		writeJSON(w, http.StatusUnprocessableEntity, makeGuardrail(threadID, guardErr))
+		return
+	}
+	if errors.Is(err, engine.ErrAwaitsApproval) {
+		http.Error(w, fmt.Sprintf("query: %s", err.Error()), http.StatusConflict)
+		return
+	}
+	var abortErr *engine.AbortError
+	if errors.As(err, &abortErr) {
+		http.Error(w, fmt.Sprintf("query: %s", err.Error()), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		// TODO status
+		http.Error(w, fmt.Sprintf("query: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Location", threadPath(agentID, threadID))
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object":  "answer",
+		"text":    res,
+		"thread":  threadID,
+		"partial": false,
+	})
+}
+
+// writeJSON writes v as json response body with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	bb, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(bb)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
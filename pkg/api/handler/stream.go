@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/engine"
+)
+
+const eventStream = "text/event-stream"
+
+// wantsStream reports whether the client asked for the events of a query as server-sent
+// events.
+func wantsStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), eventStream)
+}
+
+type eventInfo struct {
+	Type   string    `json:"type"`
+	Step   int       `json:"step"`
+	Time   time.Time `json:"time"`
+	Text   string    `json:"text,omitempty"`
+	Call   *callInfo `json:"call,omitempty"`
+	Result *result   `json:"result,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type result struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+}
+
+func makeEventInfo(event engine.Event) eventInfo {
+	info := eventInfo{
+		Type: string(event.Type),
+		Step: event.Step,
+		Time: event.Time,
+		Text: event.Text,
+	}
+	switch event.Type {
+	case engine.EventToolCall:
+		info.Call = &callInfo{
+			ID:        event.Call.ID,
+			Name:      event.Call.Name,
+			Arguments: event.Call.Arguments,
+		}
+	case engine.EventToolResult, engine.EventToolError:
+		info.Result = &result{
+			ID:      event.Result.ID,
+			Content: event.Result.Content,
+		}
+	}
+	if event.Err != nil {
+		info.Error = event.Err.Error()
+	}
+	return info
+}
+
+// sseWriter is an engine.Subscriber writing the events of a query as server-sent events
+// to the client, flushing after every event.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	mu      sync.Mutex
+	log     *slog.Logger
+}
+
+// newSSEWriter writes the stream headers and returns a sseWriter. An error is returned
+// if w does not support flushing.
+func newSSEWriter(w http.ResponseWriter, log *slog.Logger) (*sseWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming not supported")
+	}
+
+	w.Header().Set("Content-Type", eventStream)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &sseWriter{
+		w:       w,
+		flusher: flusher,
+		log:     log,
+	}, nil
+}
+
+func (s *sseWriter) Publish(event engine.Event) {
+	s.write(string(event.Type), makeEventInfo(event))
+}
+
+// write sends v as data of an event with the given name.
+func (s *sseWriter) write(name string, v any) {
+	bb, err := json.Marshal(v)
+	if err != nil {
+		s.log.Error("marshal event", "method", "write", "event", name, "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", name, bb)
+	if err != nil {
+		s.log.Debug("write event", "method", "write", "event", name, "error", err)
+		return
+	}
+	s.flusher.Flush()
+}
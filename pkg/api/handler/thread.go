@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/ids"
+	"github.com/Br0ce/opera/pkg/monitor"
+)
+
+// CreateThread starts a new, empty thread of the agent.
+func (ag *Agent) CreateThread(w http.ResponseWriter, r *http.Request) {
+	_, span := ag.tr.Start(r.Context(), "create thread")
+	defer span.End()
+
+	agentID := r.PathValue(AgentID)
+	ag.log.Info("create thread", "method", "CreateThread", "agentID", agentID, "traceID", monitor.TraceID(span))
+
+	a, err := ag.db.Get(agentID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("get agent %s: %s", agentID, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	thread := a.NewThread(ids.UniqueThread())
+	err = ag.threads.Add(agentID, thread)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("add thread: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", threadPath(agentID, thread.ID()))
+	writeJSON(w, http.StatusCreated, map[string]string{
+		"object": "created",
+		"id":     thread.ID(),
+	})
+}
+
+// ListThreads returns all threads of the agent, oldest first.
+func (ag *Agent) ListThreads(w http.ResponseWriter, r *http.Request) {
+	_, span := ag.tr.Start(r.Context(), "list threads")
+	defer span.End()
+
+	agentID := r.PathValue(AgentID)
+	ag.log.Info("list threads", "method", "ListThreads", "agentID", agentID, "traceID", monitor.TraceID(span))
+
+	if _, err := ag.db.Get(agentID); err != nil {
+		http.Error(w, fmt.Sprintf("get agent %s: %s", agentID, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	list := make([]threadInfo, 0)
+	for thread := range ag.threads.All(agentID) {
+		list = append(list, makeThreadInfo(thread))
+	}
+	slices.SortFunc(list, func(a, b threadInfo) int {
+		if c := a.Created.Compare(b.Created); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object":  "list",
+		"threads": list,
+	})
+}
+
+// GetThread returns the thread with its history.
+func (ag *Agent) GetThread(w http.ResponseWriter, r *http.Request) {
+	_, span := ag.tr.Start(r.Context(), "get thread")
+	defer span.End()
+
+	agentID := r.PathValue(AgentID)
+	id := r.PathValue(ThreadID)
+	ag.log.Info("get thread", "method", "GetThread", "agentID", agentID, "id", id, "traceID", monitor.TraceID(span))
+
+	thread, err := ag.threads.Get(agentID, id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("get thread %s: %s", id, err.Error()), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("get thread %s: %s", id, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, makeThreadDetail(thread))
+}
+
+// QueryThread queries the thread with the form value text. The query continues the
+// conversation of the thread.
+func (ag *Agent) QueryThread(w http.ResponseWriter, r *http.Request) {
+	ctx, span := ag.tr.Start(r.Context(), "query thread")
+	defer span.End()
+
+	agentID := r.PathValue(AgentID)
+	id := r.PathValue(ThreadID)
+	ag.log.Info("query thread", "method", "QueryThread", "agentID", agentID, "id", id, "traceID", monitor.TraceID(span))
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	text := r.FormValue("text")
+	if text == "" {
+		http.Error(w, "text is empty", http.StatusBadRequest)
+		return
+	}
+
+	thread, err := ag.threads.Get(agentID, id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("get thread %s: %s", id, err.Error()), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("get thread %s: %s", id, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	ag.query(ctx, w, r, agentID, thread, text)
+}
+
+// DeleteThread deletes the thread of the agent.
+func (ag *Agent) DeleteThread(w http.ResponseWriter, r *http.Request) {
+	_, span := ag.tr.Start(r.Context(), "delete thread")
+	defer span.End()
+
+	agentID := r.PathValue(AgentID)
+	id := r.PathValue(ThreadID)
+	ag.log.Info("delete thread", "method", "DeleteThread", "agentID", agentID, "id", id, "traceID", monitor.TraceID(span))
+
+	err := ag.threads.Delete(agentID, id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("delete thread: %s", err.Error()), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("delete thread: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func threadPath(agentID string, threadID string) string {
+	return path.Join("/v1/agents", agentID, "threads", threadID)
+}
+
+func approvalPath(agentID string, threadID string, approvalID string) string {
+	return path.Join(threadPath(agentID, threadID), "approvals", approvalID)
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/agent/function"
+	"github.com/Br0ce/opera/pkg/db/inmem"
+	loopEngine "github.com/Br0ce/opera/pkg/engine/loop"
+	"github.com/Br0ce/opera/pkg/guard"
+	"github.com/Br0ce/opera/pkg/history"
+	"github.com/Br0ce/opera/pkg/job"
+	"github.com/Br0ce/opera/pkg/job/pool"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	toolMock "github.com/Br0ce/opera/pkg/tool/mock"
+)
+
+type testReasoner struct {
+	answer string
+}
+
+func (re testReasoner) Reason(_ context.Context, _ history.History, _ []tool.Tool) (action.Action, error) {
+	return action.MakeUser(re.answer), nil
+}
+
+func TestAgent_GetThreadGuarded(t *testing.T) {
+	t.Parallel()
+
+	emails := guard.NewPattern("emails", regexp.MustCompile(`[a-z]+@example\.com`))
+
+	tests := []struct {
+		name     string
+		action   guard.Action
+		wantCode int
+		want     string
+	}{
+		{
+			name:     "blocked",
+			action:   guard.Block,
+			wantCode: http.StatusUnprocessableEntity,
+			want:     "The answer was withheld.",
+		},
+		{
+			name:     "rewritten",
+			action:   guard.Rewrite,
+			wantCode: http.StatusOK,
+			want:     "write to [removed]",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			log := monitor.NewTestLogger(false)
+			g := guard.NewGuard(log, guard.WithOutput(guard.Rule{Check: emails, Action: test.action}))
+			discovery := &toolMock.Discovery{
+				AllFn: func(_ context.Context) []tool.Tool { return nil },
+			}
+			actor := action.NewActor(discovery, nil, log)
+			eg := loopEngine.NewEngine(actor, 3, log, loopEngine.WithGuard(g))
+
+			agents := inmem.NewAgentDB()
+			agentID, err := agents.Add(function.NewAgent("", discovery, testReasoner{answer: "write to jane@example.com"}, log))
+			if err != nil {
+				t.Fatalf("add agent: %s", err.Error())
+			}
+			threads := inmem.NewThreadDB()
+			ag := NewAgent(eg, agents, threads, discovery, nil, log)
+
+			form := url.Values{"text": {"whom do I write to?"}}
+			r := httptest.NewRequest(http.MethodPost, "/v1/agents/"+agentID, strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.SetPathValue(AgentID, agentID)
+			w := httptest.NewRecorder()
+			ag.Query(w, r)
+			if w.Code != test.wantCode {
+				t.Fatalf("Agent.Query() code = %v, want %v, body %s", w.Code, test.wantCode, w.Body.String())
+			}
+
+			var threadID string
+			for thread := range threads.All(agentID) {
+				threadID = thread.ID()
+			}
+			r = httptest.NewRequest(http.MethodGet, threadPath(agentID, threadID), nil)
+			r.SetPathValue(AgentID, agentID)
+			r.SetPathValue(ThreadID, threadID)
+			w = httptest.NewRecorder()
+			ag.GetThread(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Agent.GetThread() code = %v, want %v", w.Code, http.StatusOK)
+			}
+			if strings.Contains(w.Body.String(), "jane@example.com") {
+				t.Errorf("Agent.GetThread() = %s, contains guarded content", w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), test.want) {
+				t.Errorf("Agent.GetThread() = %s, want answer %q", w.Body.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestAgent_QueryThreadCancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	log := monitor.NewTestLogger(false)
+	discovery := &toolMock.Discovery{
+		AllFn: func(_ context.Context) []tool.Tool { return nil },
+	}
+	eg := loopEngine.NewEngine(action.NewActor(discovery, nil, log), 3, log)
+	agents := inmem.NewAgentDB()
+	def := function.NewAgent("", discovery, testReasoner{answer: "42"}, log)
+	agentID, err := agents.Add(def)
+	if err != nil {
+		t.Fatalf("add agent: %s", err.Error())
+	}
+	threads := inmem.NewThreadDB()
+	thread := def.NewThread("thread-1")
+	if err := threads.Add(agentID, thread); err != nil {
+		t.Fatalf("add thread: %s", err.Error())
+	}
+	jobs := pool.NewPool(inmem.NewJobDB(), 1, 1, time.Hour, log)
+	jobs.Start(ctx)
+	ag := NewAgent(eg, agents, threads, discovery, jobs, log)
+
+	// A running query holds the thread.
+	if err := thread.Lock(ctx); err != nil {
+		t.Fatalf("lock thread: %s", err.Error())
+	}
+	defer thread.Unlock()
+
+	form := url.Values{"text": {"what is the answer?"}, "async": {"true"}}
+	r := httptest.NewRequest(http.MethodPost, threadPath(agentID, thread.ID()), strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetPathValue(AgentID, agentID)
+	r.SetPathValue(ThreadID, thread.ID())
+	w := httptest.NewRecorder()
+	ag.QueryThread(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Agent.QueryThread() code = %v, want %v", w.Code, http.StatusAccepted)
+	}
+	id := path.Base(w.Header().Get("Location"))
+
+	waitStatus := func(id string, want job.Status) {
+		t.Helper()
+		var j job.Job
+		for range 100 {
+			j, err = jobs.Get(id)
+			if err == nil && j.Status == want {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("job %s status = %v, want %v", id, j.Status, want)
+	}
+	waitStatus(id, job.Running)
+	if _, err := jobs.Cancel(id); err != nil {
+		t.Fatalf("Pool.Cancel() error = %v", err)
+	}
+	waitStatus(id, job.Canceled)
+
+	// The worker is free again.
+	next, err := jobs.Submit(ctx, job.MakeJob(agentID, thread.ID()), func(context.Context) (string, error) {
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatalf("Pool.Submit() error = %v", err)
+	}
+	waitStatus(next, job.Succeeded)
+}
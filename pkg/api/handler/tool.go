@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/tool/discovery/health"
+)
+
+type Tool struct {
+	discovery tool.Discovery
+	health    *health.Discovery
+	breakers  *action.Breakers
+	tr        trace.Tracer
+	log       *slog.Logger
+}
+
+// NewTool returns a Tool handler listing the tools of the discovery with their health
+// and the state of their breaker.
+func NewTool(discovery tool.Discovery, health *health.Discovery, breakers *action.Breakers, log *slog.Logger) *Tool {
+	return &Tool{
+		discovery: discovery,
+		health:    health,
+		breakers:  breakers,
+		tr:        monitor.Tracer("ToolHandler"),
+		log:       log,
+	}
+}
+
+type toolInfo struct {
+	Object      string `json:"object"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Addr        string `json:"addr"`
+	// Available is false if the tool is hidden from the agents.
+	Available bool        `json:"available"`
+	Health    toolHealth  `json:"health"`
+	Breaker   toolBreaker `json:"breaker"`
+}
+
+type toolHealth struct {
+	Healthy bool       `json:"healthy"`
+	Error   string     `json:"error,omitempty"`
+	Checked *time.Time `json:"checked,omitempty"`
+}
+
+type toolBreaker struct {
+	State    action.BreakerState `json:"state"`
+	Failures int                 `json:"failures"`
+	Opened   *time.Time          `json:"opened,omitempty"`
+}
+
+// List returns all discovered tools with their health and the state of their breaker.
+func (to *Tool) List(w http.ResponseWriter, r *http.Request) {
+	ctx, span := to.tr.Start(r.Context(), "list tools")
+	defer span.End()
+	to.log.Info("list tools", "method", "List", "traceID", monitor.TraceID(span))
+
+	statuses := to.health.Statuses()
+	breakers := make(map[string]action.BreakerStatus)
+	for _, status := range to.breakers.Statuses() {
+		breakers[status.Tool] = status
+	}
+
+	tools := make([]toolInfo, 0)
+	for _, t := range to.discovery.All(ctx) {
+		addr := t.Addr()
+		info := toolInfo{
+			Object:      "tool",
+			Name:        t.Name(),
+			Description: t.Description(),
+			Addr:        addr.String(),
+			Health:      toolHealth{Healthy: true},
+			Breaker:     toolBreaker{State: action.BreakerClosed},
+		}
+		if status, ok := statuses[t.Name()]; ok {
+			info.Health = toolHealth{
+				Healthy: status.Healthy,
+				Error:   status.Error,
+				Checked: &status.Checked,
+			}
+		}
+		if status, ok := breakers[t.Name()]; ok {
+			info.Breaker = toolBreaker{
+				State:    status.State,
+				Failures: status.Failures,
+			}
+			if !status.Opened.IsZero() {
+				info.Breaker.Opened = &status.Opened
+			}
+		}
+		info.Available = info.Health.Healthy && info.Breaker.State != action.BreakerOpen
+		tools = append(tools, info)
+	}
+	slices.SortFunc(tools, func(a, b toolInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object": "list",
+		"data":   tools,
+	})
+}
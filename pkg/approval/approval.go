@@ -0,0 +1,160 @@
+package approval
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+var (
+	ErrCallNotFound   = errors.New("call not found")
+	ErrAlreadyDecided = errors.New("call already decided")
+)
+
+// Decision is the verdict of a human on a pending tool call.
+type Decision string
+
+const (
+	Pending  Decision = "pending"
+	Approved Decision = "approved"
+	Edited   Decision = "edited"
+	Rejected Decision = "rejected"
+)
+
+// Call is a tool call together with the human decision about it.
+type Call struct {
+	Call     tool.Call
+	Decision Decision
+	// Comment is an optional note of the reviewer, e.g. the reason for a rejection.
+	Comment string
+}
+
+// Request holds a suspended tool action which waits for human approval.
+// The iteration is the engine iteration in which the query was suspended.
+type Request struct {
+	ID     string
+	Calls  []Call
+	Reason string
+	Iter   int
+	// AgentID and ThreadID identify the thread of the suspended query. The request can
+	// only be decided on this thread.
+	AgentID  string
+	ThreadID string
+	// MaxIter and Deadline are the limits of the suspended query, which also apply once
+	// it is resumed, see ResumeDeadline. Zero values mean no limit was set.
+	MaxIter  int
+	Deadline time.Time
+	// Blocked are the responses to the calls of the step which the hooks blocked before
+	// the approval was requested.
+	Blocked []tool.Response
+	Created time.Time
+}
+
+// BelongsTo reports whether the request was created by a query on the thread with the
+// given threadID of the agent with the given agentID.
+func (r Request) BelongsTo(agentID string, threadID string) bool {
+	return r.AgentID == agentID && r.ThreadID == threadID
+}
+
+// ResumeDeadline returns the deadline of the query resumed at now. The time the request
+// waited for its decision does not count against the deadline, the resumed query has the
+// time that was left when it was suspended. The zero time means no deadline.
+func (r Request) ResumeDeadline(now time.Time) time.Time {
+	if r.Deadline.IsZero() {
+		return time.Time{}
+	}
+	return now.Add(r.Deadline.Sub(r.Created))
+}
+
+// MakeRequest returns a Request for the given calls. Calls for which needsApproval
+// reports false are approved right away.
+func MakeRequest(calls []tool.Call, reason string, iter int, needsApproval func(call tool.Call) bool) Request {
+	cc := make([]Call, 0, len(calls))
+	for _, call := range calls {
+		decision := Approved
+		if needsApproval(call) {
+			decision = Pending
+		}
+		cc = append(cc, Call{
+			Call:     call,
+			Decision: decision,
+		})
+	}
+	return Request{
+		Calls:   cc,
+		Reason:  reason,
+		Iter:    iter,
+		Created: time.Now().UTC(),
+	}
+}
+
+// Approve approves the call with the given callID.
+func (r *Request) Approve(callID string) error {
+	return r.decide(callID, func(c *Call) {
+		c.Decision = Approved
+	})
+}
+
+// Edit approves the call with the given callID but replaces its arguments.
+func (r *Request) Edit(callID string, arguments string) error {
+	return r.decide(callID, func(c *Call) {
+		c.Call.Arguments = arguments
+		c.Decision = Edited
+	})
+}
+
+// Reject rejects the call with the given callID. The comment is passed on to the model.
+func (r *Request) Reject(callID string, comment string) error {
+	return r.decide(callID, func(c *Call) {
+		c.Comment = comment
+		c.Decision = Rejected
+	})
+}
+
+// Decided reports if all calls of the request have been decided.
+func (r Request) Decided() bool {
+	for _, c := range r.Calls {
+		if c.Decision == Pending {
+			return false
+		}
+	}
+	return true
+}
+
+// Accepted returns all calls which are approved or edited.
+func (r Request) Accepted() []tool.Call {
+	var cc []tool.Call
+	for _, c := range r.Calls {
+		if c.Decision == Approved || c.Decision == Edited {
+			cc = append(cc, c.Call)
+		}
+	}
+	return cc
+}
+
+// Rejected returns all rejected calls.
+func (r Request) Rejected() []Call {
+	var cc []Call
+	for _, c := range r.Calls {
+		if c.Decision == Rejected {
+			cc = append(cc, c)
+		}
+	}
+	return cc
+}
+
+func (r *Request) decide(callID string, fn func(c *Call)) error {
+	for i := range r.Calls {
+		if r.Calls[i].Call.ID != callID {
+			continue
+		}
+		if r.Calls[i].Decision != Pending {
+			return fmt.Errorf("call %s: %w", callID, ErrAlreadyDecided)
+		}
+		fn(&r.Calls[i])
+		return nil
+	}
+	return fmt.Errorf("call %s: %w", callID, ErrCallNotFound)
+}
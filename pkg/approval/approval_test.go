@@ -0,0 +1,162 @@
+package approval
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+func TestMakeRequest(t *testing.T) {
+	t.Parallel()
+
+	calls := []tool.Call{
+		{ID: "1", Name: "delete_user", Arguments: `{"id":"42"}`},
+		{ID: "2", Name: "get_weather", Arguments: `{"location":"Sydney"}`},
+	}
+	needsApproval := func(call tool.Call) bool {
+		return call.Name == "delete_user"
+	}
+
+	got := MakeRequest(calls, "my reason", 3, needsApproval)
+	want := []Call{
+		{Call: calls[0], Decision: Pending},
+		{Call: calls[1], Decision: Approved},
+	}
+	if !reflect.DeepEqual(got.Calls, want) {
+		t.Errorf("MakeRequest() calls = %v, want %v", got.Calls, want)
+	}
+	if got.Reason != "my reason" {
+		t.Errorf("MakeRequest() reason = %v, want %v", got.Reason, "my reason")
+	}
+	if got.Iter != 3 {
+		t.Errorf("MakeRequest() iter = %v, want %v", got.Iter, 3)
+	}
+	if got.Decided() {
+		t.Errorf("MakeRequest() decided = %v, want %v", got.Decided(), false)
+	}
+}
+
+func TestRequest_decide(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		decide       func(r *Request) error
+		wantErr      error
+		wantDecided  bool
+		wantAccepted []tool.Call
+		wantRejected []Call
+	}{
+		{
+			name: "approve",
+			decide: func(r *Request) error {
+				return r.Approve("1")
+			},
+			wantDecided: true,
+			wantAccepted: []tool.Call{
+				{ID: "1", Name: "delete_user", Arguments: `{"id":"42"}`},
+				{ID: "2", Name: "get_weather", Arguments: `{"location":"Sydney"}`},
+			},
+		},
+		{
+			name: "edit",
+			decide: func(r *Request) error {
+				return r.Edit("1", `{"id":"43"}`)
+			},
+			wantDecided: true,
+			wantAccepted: []tool.Call{
+				{ID: "1", Name: "delete_user", Arguments: `{"id":"43"}`},
+				{ID: "2", Name: "get_weather", Arguments: `{"location":"Sydney"}`},
+			},
+		},
+		{
+			name: "reject",
+			decide: func(r *Request) error {
+				return r.Reject("1", "not allowed")
+			},
+			wantDecided: true,
+			wantAccepted: []tool.Call{
+				{ID: "2", Name: "get_weather", Arguments: `{"location":"Sydney"}`},
+			},
+			wantRejected: []Call{{
+				Call:     tool.Call{ID: "1", Name: "delete_user", Arguments: `{"id":"42"}`},
+				Decision: Rejected,
+				Comment:  "not allowed",
+			}},
+		},
+		{
+			name: "already decided",
+			decide: func(r *Request) error {
+				return r.Approve("2")
+			},
+			wantErr: ErrAlreadyDecided,
+		},
+		{
+			name: "not found",
+			decide: func(r *Request) error {
+				return r.Approve("3")
+			},
+			wantErr: ErrCallNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := MakeRequest([]tool.Call{
+				{ID: "1", Name: "delete_user", Arguments: `{"id":"42"}`},
+				{ID: "2", Name: "get_weather", Arguments: `{"location":"Sydney"}`},
+			}, "", 0, func(call tool.Call) bool {
+				return call.Name == "delete_user"
+			})
+
+			err := test.decide(&r)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Request.decide() error = %v, wantErr %v", err, test.wantErr)
+				return
+			}
+			if test.wantErr != nil {
+				return
+			}
+			if r.Decided() != test.wantDecided {
+				t.Errorf("Request.Decided() = %v, want %v", r.Decided(), test.wantDecided)
+			}
+			if !reflect.DeepEqual(r.Accepted(), test.wantAccepted) {
+				t.Errorf("Request.Accepted() = %v, want %v", r.Accepted(), test.wantAccepted)
+			}
+			if !reflect.DeepEqual(r.Rejected(), test.wantRejected) {
+				t.Errorf("Request.Rejected() = %v, want %v", r.Rejected(), test.wantRejected)
+			}
+		})
+	}
+}
+
+func TestRequest_ResumeDeadline(t *testing.T) {
+	t.Parallel()
+
+	created := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := created.Add(time.Hour)
+	tests := []struct {
+		name     string
+		deadline time.Time
+		want     time.Time
+	}{
+		{
+			name:     "time left",
+			deadline: created.Add(time.Minute),
+			want:     now.Add(time.Minute),
+		},
+		{
+			name: "no deadline",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := Request{Deadline: test.deadline, Created: created}
+			if got := r.ResumeDeadline(now); !got.Equal(test.want) {
+				t.Errorf("Request.ResumeDeadline() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+// Package auth provides the credentials the actor injects into the calls to tool
+// services requiring authentication.
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+)
+
+// Secret is a credential which must never be logged. Formatting, logging or encoding a
+// Secret yields a placeholder.
+type Secret string
+
+const redacted = "[redacted]"
+
+func (s Secret) String() string {
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return redacted
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// Credential authenticates requests to a tool service.
+type Credential interface {
+	// Apply adds the credential to the header of a request.
+	Apply(ctx context.Context, header map[string][]string) error
+}
+
+// Invalidator is implemented by credentials which are obtained from an issuer, so that
+// they can be discarded once the tool service rejects them.
+type Invalidator interface {
+	Invalidate()
+}
+
+// Bearer authenticates with a static bearer token.
+type Bearer struct {
+	token Secret
+}
+
+func NewBearer(token Secret) *Bearer {
+	return &Bearer{token: token}
+}
+
+func (b *Bearer) Apply(_ context.Context, header map[string][]string) error {
+	setHeader(header, "Authorization", "Bearer "+string(b.token))
+	return nil
+}
+
+// APIKey authenticates with a key in a header, e.g. X-API-Key.
+type APIKey struct {
+	header string
+	key    Secret
+}
+
+func NewAPIKey(header string, key Secret) *APIKey {
+	return &APIKey{header: header, key: key}
+}
+
+func (a *APIKey) Apply(_ context.Context, header map[string][]string) error {
+	setHeader(header, a.header, string(a.key))
+	return nil
+}
+
+// Basic authenticates with a username and password.
+type Basic struct {
+	username string
+	password Secret
+}
+
+func NewBasic(username string, password Secret) *Basic {
+	return &Basic{username: username, password: password}
+}
+
+func (b *Basic) Apply(_ context.Context, header map[string][]string) error {
+	setHeader(header, "Authorization", "Basic "+basic(b.username, string(b.password)))
+	return nil
+}
+
+// Credentials holds the credentials of the tools by tool name.
+type Credentials struct {
+	credentials map[string]Credential
+}
+
+// NewCredentials returns Credentials holding the given credentials by tool name.
+func NewCredentials(credentials map[string]Credential) *Credentials {
+	return &Credentials{credentials: credentials}
+}
+
+// Get returns the credential of the tool with the given name, if it has one.
+func (c *Credentials) Get(name string) (Credential, bool) {
+	if c == nil {
+		return nil, false
+	}
+	cred, ok := c.credentials[name]
+	return cred, ok
+}
+
+// setHeader sets the canonical key of the header to value.
+func setHeader(header map[string][]string, key string, value string) {
+	header[http.CanonicalHeaderKey(key)] = []string{value}
+}
+
+func basic(username string, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
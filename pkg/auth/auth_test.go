@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/transport/mock"
+)
+
+func TestSecret(t *testing.T) {
+	t.Parallel()
+
+	s := Secret("s3cr3t")
+
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+	log.Info("credential", "secret", s, "item", Item{Token: s, ClientSecret: s}, "struct", struct{ S Secret }{S: s})
+	bb, err := json.Marshal(struct{ S Secret }{S: s})
+	if err != nil {
+		t.Fatalf("marshal secret: %s", err.Error())
+	}
+
+	for _, out := range []string{
+		fmt.Sprint(s),
+		fmt.Sprintf("%v %s %+v %#v", s, s, s, s),
+		buf.String(),
+		fmt.Sprintf("%+v", Item{Password: s}),
+		string(bb),
+	} {
+		if strings.Contains(out, "s3cr3t") {
+			t.Errorf("secret leaked: %s", out)
+		}
+	}
+}
+
+func TestCredential_Apply(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cred Credential
+		want map[string][]string
+	}{
+		{
+			name: "bearer",
+			cred: NewBearer("token"),
+			want: map[string][]string{"Authorization": {"Bearer token"}},
+		},
+		{
+			name: "api key",
+			cred: NewAPIKey("x-api-key", "key"),
+			want: map[string][]string{"X-Api-Key": {"key"}},
+		},
+		{
+			name: "basic",
+			cred: NewBasic("user", "pass"),
+			want: map[string][]string{"Authorization": {"Basic dXNlcjpwYXNz"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			header := make(map[string][]string)
+			err := test.cred.Apply(context.TODO(), header)
+			if err != nil {
+				t.Fatalf("Credential.Apply() error = %v", err)
+			}
+			if !reflect.DeepEqual(header, test.want) {
+				t.Errorf("Credential.Apply() header = %v, want %v", header, test.want)
+			}
+		})
+	}
+}
+
+func TestClientCredentials_Token(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var fetches int
+	var form url.Values
+	var header map[string][]string
+	trans := &mock.Transporter{
+		PostFn: func(_ context.Context, addr string, h map[string][]string, body io.Reader) ([]byte, error) {
+			if addr != "http://auth/token" {
+				return nil, fmt.Errorf("unexpected addr %s", addr)
+			}
+			bb, _ := io.ReadAll(body)
+			mu.Lock()
+			defer mu.Unlock()
+			fetches++
+			form, _ = url.ParseQuery(string(bb))
+			header = h
+			return fmt.Appendf(nil, `{"access_token":"token-%d","token_type":"Bearer","expires_in":3600}`, fetches), nil
+		},
+	}
+	cc := NewClientCredentials("http://auth/token", "client", "secret", []string{"read", "write"}, trans)
+	now := time.Now()
+	cc.now = func() time.Time { return now }
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := cc.Token(context.TODO())
+			if err != nil || got != "token-1" {
+				t.Errorf("ClientCredentials.Token() = %v, %v, want token-1", string(got), err)
+			}
+		}()
+	}
+	wg.Wait()
+	if fetches != 1 {
+		t.Errorf("ClientCredentials.Token() fetches = %v, want 1", fetches)
+	}
+	if form.Get("grant_type") != "client_credentials" || form.Get("scope") != "read write" {
+		t.Errorf("ClientCredentials.Token() form = %v", form)
+	}
+	if got := header["Authorization"]; !reflect.DeepEqual(got, []string{"Basic Y2xpZW50OnNlY3JldA=="}) {
+		t.Errorf("ClientCredentials.Token() authorization = %v", got)
+	}
+
+	// The token is fetched again shortly before it expires.
+	now = now.Add(time.Hour - expiryDelta)
+	h := make(map[string][]string)
+	err := cc.Apply(context.TODO(), h)
+	if err != nil {
+		t.Fatalf("ClientCredentials.Apply() error = %v", err)
+	}
+	if got := h["Authorization"]; !reflect.DeepEqual(got, []string{"Bearer token-2"}) {
+		t.Errorf("ClientCredentials.Apply() authorization = %v, want Bearer token-2", got)
+	}
+
+	cc.Invalidate()
+	got, err := cc.Token(context.TODO())
+	if err != nil || got != "token-3" {
+		t.Errorf("ClientCredentials.Token() after invalidate = %v, %v, want token-3", string(got), err)
+	}
+}
+
+func TestClientCredentials_TokenFailed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		resp string
+		err  error
+	}{
+		{name: "transport", err: errors.New("connection refused")},
+		{name: "no json", resp: "token"},
+		{name: "no token", resp: `{"token_type":"Bearer"}`},
+		{name: "token type", resp: `{"access_token":"token","token_type":"mac"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			trans := &mock.Transporter{
+				PostFn: func(_ context.Context, _ string, _ map[string][]string, _ io.Reader) ([]byte, error) {
+					return []byte(test.resp), test.err
+				},
+			}
+			cc := NewClientCredentials("http://auth/token", "client", "secret", nil, trans)
+			err := cc.Apply(context.TODO(), make(map[string][]string))
+			if err == nil {
+				t.Fatalf("ClientCredentials.Apply() error = nil, want error")
+			}
+			if strings.Contains(err.Error(), "secret") {
+				t.Errorf("ClientCredentials.Apply() error leaks secret: %v", err)
+			}
+		})
+	}
+}
+
+func TestConfig_Decode(t *testing.T) {
+	t.Setenv("TEST_AUTH_KEY", "env-key")
+
+	tests := []struct {
+		name       string
+		items      []Item
+		tool       string
+		wantHeader map[string][]string
+		wantErr    bool
+	}{
+		{
+			name:       "api key from env",
+			items:      []Item{{Tool: "get_weather", Kind: KindAPIKey, Key: "${TEST_AUTH_KEY}"}},
+			tool:       "get_weather",
+			wantHeader: map[string][]string{"X-Api-Key": {"env-key"}},
+		},
+		{
+			name:       "bearer",
+			items:      []Item{{Tool: "get_weather", Kind: KindBearer, Token: "token"}},
+			tool:       "get_weather",
+			wantHeader: map[string][]string{"Authorization": {"Bearer token"}},
+		},
+		{
+			name:       "basic",
+			items:      []Item{{Tool: "get_weather", Kind: KindBasic, Username: "user", Password: "pass"}},
+			tool:       "get_weather",
+			wantHeader: map[string][]string{"Authorization": {"Basic dXNlcjpwYXNz"}},
+		},
+		{
+			name:  "client credentials",
+			items: []Item{{Tool: "get_weather", Kind: KindClientCredentials, TokenURL: "http://auth/token", ClientID: "client"}},
+			tool:  "get_weather",
+		},
+		{
+			name:  "no credential",
+			items: []Item{{Tool: "get_weather", Kind: KindBearer, Token: "token"}},
+			tool:  "get_shark_warning",
+		},
+		{
+			name:    "empty secret",
+			items:   []Item{{Tool: "get_weather", Kind: KindBearer, Token: "${TEST_AUTH_UNSET}"}},
+			wantErr: true,
+		},
+		{
+			name:    "no tool",
+			items:   []Item{{Kind: KindBearer, Token: "token"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown kind",
+			items:   []Item{{Tool: "get_weather", Kind: "digest"}},
+			wantErr: true,
+		},
+		{
+			name:    "no token url",
+			items:   []Item{{Tool: "get_weather", Kind: KindClientCredentials, ClientID: "client"}},
+			wantErr: true,
+		},
+		{
+			name: "duplicate tool",
+			items: []Item{
+				{Tool: "get_weather", Kind: KindBearer, Token: "token"},
+				{Tool: "get_weather", Kind: KindBasic, Username: "user"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			creds, err := Config{Credentials: test.items}.Decode(&mock.Transporter{})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Config.Decode() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			cred, ok := creds.Get(test.tool)
+			if ok != (test.tool == test.items[0].Tool) {
+				t.Fatalf("Credentials.Get() ok = %v", ok)
+			}
+			if !ok || test.wantHeader == nil {
+				return
+			}
+			header := make(map[string][]string)
+			err = cred.Apply(context.TODO(), header)
+			if err != nil {
+				t.Fatalf("Credential.Apply() error = %v", err)
+			}
+			if !reflect.DeepEqual(header, test.wantHeader) {
+				t.Errorf("Credential.Apply() header = %v, want %v", header, test.wantHeader)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+
+	c, err := ReadFile("../../data/credentials/credentials.yaml")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if len(c.Credentials) != 2 || string(c.Credentials[0].Key) != "${WEATHER_API_KEY}" || c.Credentials[1].Kind != KindClientCredentials {
+		t.Errorf("ReadFile() = %v", c)
+	}
+}
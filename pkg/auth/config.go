@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kind is the kind of a configured credential.
+type Kind string
+
+const (
+	KindBearer            Kind = "bearer"
+	KindAPIKey            Kind = "api_key"
+	KindBasic             Kind = "basic"
+	KindClientCredentials Kind = "client_credentials"
+)
+
+// Config declares the credentials of the tools.
+type Config struct {
+	Credentials []Item `json:"Credentials" yaml:"Credentials"`
+}
+
+// Item declares the credential of the tool with the given name. Which fields are used
+// depends on the Kind. Secrets can reference environment variables, e.g. ${API_KEY}, so
+// that they need not be stored in the file.
+type Item struct {
+	Tool string `json:"Tool" yaml:"Tool"`
+	Kind Kind   `json:"Kind" yaml:"Kind"`
+	// Token is the token of a bearer credential.
+	Token Secret `json:"Token" yaml:"Token"`
+	// Header and Key configure an api key credential. Header defaults to X-API-Key.
+	Header string `json:"Header" yaml:"Header"`
+	Key    Secret `json:"Key" yaml:"Key"`
+	// Username and Password configure a basic credential.
+	Username string `json:"Username" yaml:"Username"`
+	Password Secret `json:"Password" yaml:"Password"`
+	// TokenURL, ClientID, ClientSecret and Scopes configure a client credentials
+	// credential.
+	TokenURL     string   `json:"TokenURL" yaml:"TokenURL"`
+	ClientID     string   `json:"ClientID" yaml:"ClientID"`
+	ClientSecret Secret   `json:"ClientSecret" yaml:"ClientSecret"`
+	Scopes       []string `json:"Scopes" yaml:"Scopes"`
+}
+
+// ReadFile reads the config of the given file. Files with a .yaml or .yml extension are
+// decoded as YAML, all other files as JSON.
+func ReadFile(filename string) (Config, error) {
+	bb, err := os.ReadFile(filename)
+	if err != nil {
+		return Config{}, fmt.Errorf("read file %s: %w", filename, err)
+	}
+
+	var c Config
+	switch filepath.Ext(filename) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(bb, &c)
+	default:
+		err = json.Unmarshal(bb, &c)
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("unmarshal config: %w", err)
+	}
+	return c, nil
+}
+
+// Decode returns the Credentials declared by the config. Client credentials fetch their
+// tokens with the transport.
+func (c Config) Decode(transport Transporter) (*Credentials, error) {
+	credentials := make(map[string]Credential, len(c.Credentials))
+	for i, item := range c.Credentials {
+		if _, ok := credentials[item.Tool]; ok {
+			return nil, fmt.Errorf("item %v: tool %s has more than one credential", i, item.Tool)
+		}
+		cred, err := item.Decode(transport)
+		if err != nil {
+			return nil, fmt.Errorf("item %v: %w", i, err)
+		}
+		credentials[item.Tool] = cred
+	}
+	return NewCredentials(credentials), nil
+}
+
+// Decode returns the credential declared by the item.
+func (i Item) Decode(transport Transporter) (Credential, error) {
+	if i.Tool == "" {
+		return nil, fmt.Errorf("Tool invalid")
+	}
+
+	switch i.Kind {
+	case KindBearer:
+		token := secret(i.Token)
+		if token == "" {
+			return nil, fmt.Errorf("Token invalid")
+		}
+		return NewBearer(token), nil
+	case KindAPIKey:
+		key := secret(i.Key)
+		if key == "" {
+			return nil, fmt.Errorf("Key invalid")
+		}
+		header := i.Header
+		if header == "" {
+			header = "X-API-Key"
+		}
+		return NewAPIKey(header, key), nil
+	case KindBasic:
+		if i.Username == "" {
+			return nil, fmt.Errorf("Username invalid")
+		}
+		return NewBasic(os.ExpandEnv(i.Username), secret(i.Password)), nil
+	case KindClientCredentials:
+		if i.TokenURL == "" {
+			return nil, fmt.Errorf("TokenURL invalid")
+		}
+		clientID := os.ExpandEnv(i.ClientID)
+		if clientID == "" {
+			return nil, fmt.Errorf("ClientID invalid")
+		}
+		return NewClientCredentials(i.TokenURL, clientID, secret(i.ClientSecret), i.Scopes, transport), nil
+	default:
+		return nil, fmt.Errorf("kind %s not supported", i.Kind)
+	}
+}
+
+// secret returns s with references to environment variables replaced by their values.
+func secret(s Secret) Secret {
+	return Secret(os.ExpandEnv(string(s)))
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// expiryDelta is the time before its expiry at which a token is fetched again, so that
+// it does not expire while a request is underway.
+const expiryDelta = 30 * time.Second
+
+type Transporter interface {
+	Post(ctx context.Context, addr string, header map[string][]string, body io.Reader) ([]byte, error)
+}
+
+// ClientCredentials authenticates with a bearer token fetched with the OAuth2 client
+// credentials grant. The token is cached until shortly before it expires.
+type ClientCredentials struct {
+	tokenURL     string
+	clientID     string
+	clientSecret Secret
+	scopes       []string
+	transport    Transporter
+	token        Secret
+	expiry       time.Time
+	mu           sync.Mutex
+	now          func() time.Time
+}
+
+// NewClientCredentials returns a ClientCredentials fetching tokens from the token
+// endpoint at tokenURL with the transport.
+func NewClientCredentials(tokenURL string, clientID string, clientSecret Secret, scopes []string, transport Transporter) *ClientCredentials {
+	return &ClientCredentials{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+		transport:    transport,
+		now:          time.Now,
+	}
+}
+
+func (c *ClientCredentials) Apply(ctx context.Context, header map[string][]string) error {
+	token, err := c.Token(ctx)
+	if err != nil {
+		return err
+	}
+	setHeader(header, "Authorization", "Bearer "+string(token))
+	return nil
+}
+
+// Token returns the cached token, or fetches a new one if none is cached or the cached
+// one is about to expire. Concurrent callers wait for a single fetch.
+func (c *ClientCredentials) Token(ctx context.Context) (Secret, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && (c.expiry.IsZero() || c.now().Before(c.expiry.Add(-expiryDelta))) {
+		return c.token, nil
+	}
+	token, expiry, err := c.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token = token
+	c.expiry = expiry
+	return token, nil
+}
+
+// Invalidate discards the cached token.
+func (c *ClientCredentials) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = ""
+	c.expiry = time.Time{}
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// fetch requests a token from the token endpoint. A token without expires_in does not
+// expire.
+func (c *ClientCredentials) fetch(ctx context.Context) (Secret, time.Time, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.scopes) > 0 {
+		form.Set("scope", strings.Join(c.scopes, " "))
+	}
+	header := map[string][]string{
+		"Content-Type": {"application/x-www-form-urlencoded"},
+		"Accept":       {"application/json"},
+		// The client id and secret are form encoded before basic encoding, see RFC 6749
+		// section 2.3.1.
+		"Authorization": {"Basic " + basic(url.QueryEscape(c.clientID), url.QueryEscape(string(c.clientSecret)))},
+	}
+
+	start := c.now()
+	bb, err := c.transport.Post(ctx, c.tokenURL, header, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("fetch token: %w", err)
+	}
+	var resp tokenResponse
+	err = json.Unmarshal(bb, &resp)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("decode token response: %w", err)
+	}
+	if resp.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("token response without access_token")
+	}
+	if resp.TokenType != "" && !strings.EqualFold(resp.TokenType, "bearer") {
+		return "", time.Time{}, fmt.Errorf("token type %s not supported", resp.TokenType)
+	}
+
+	var expiry time.Time
+	if resp.ExpiresIn > 0 {
+		expiry = start.Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return Secret(resp.AccessToken), expiry, nil
+}
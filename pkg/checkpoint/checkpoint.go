@@ -0,0 +1,59 @@
+package checkpoint
+
+import (
+	"time"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/history"
+	"github.com/Br0ce/opera/pkg/percept"
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+// Phase tells where in an iteration a query was checkpointed.
+type Phase string
+
+const (
+	// Acting means the tool calls of the action have been dispatched, but their results
+	// are unknown.
+	Acting Phase = "acting"
+	// Acted means the results of the tool calls are in the percepts and the next
+	// iteration can start.
+	Acted Phase = "acted"
+)
+
+// Checkpoint is the persisted state of an unfinished query, from which the query can
+// be resumed, e.g. after a restart.
+type Checkpoint struct {
+	ID       string `json:"id"`
+	AgentID  string `json:"agentID"`
+	ThreadID string `json:"threadID"`
+	// Iter is the iteration in which the checkpoint was taken.
+	Iter   int           `json:"iter"`
+	Phase  Phase         `json:"phase"`
+	Action action.Action `json:"action"`
+	// Percepts are the results of the tool calls once acted. While acting, they answer
+	// the calls blocked by the hooks, which are not part of the action.
+	Percepts []percept.Percept `json:"percepts,omitempty"`
+	// History is the history of the thread, needed to restore the thread.
+	History       history.History `json:"history"`
+	ThreadCreated time.Time       `json:"threadCreated"`
+	MaxIter       int             `json:"maxIter,omitempty"`
+	Updated       time.Time       `json:"updated"`
+}
+
+// Interrupted returns the calls of an acting checkpoint for which idempotent reports
+// false. It is unknown whether these calls have been executed, so they must not be
+// repeated blindly.
+func (c Checkpoint) Interrupted(idempotent func(call tool.Call) bool) []tool.Call {
+	if c.Phase != Acting {
+		return nil
+	}
+	calls, _ := c.Action.Tool()
+	var interrupted []tool.Call
+	for _, call := range calls {
+		if !idempotent(call) {
+			interrupted = append(interrupted, call)
+		}
+	}
+	return interrupted
+}
@@ -1,10 +1,16 @@
 package db
 
-import "github.com/Br0ce/opera/pkg/agent"
+import (
+	"iter"
+
+	"github.com/Br0ce/opera/pkg/agent"
+)
 
 type Agent interface {
-	Add(agent agent.Agent) (string, error)
-	Get(id string) (agent.Agent, error)
-	Update(id string, agent agent.Agent) error
+	Add(agent agent.Definition) (string, error)
+	Get(id string) (agent.Definition, error)
+	Update(id string, agent agent.Definition) error
+	Set(id string, agent agent.Definition) error
 	Delete(id string) error
+	All() iter.Seq2[string, agent.Definition]
 }
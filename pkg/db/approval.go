@@ -0,0 +1,11 @@
+package db
+
+import "github.com/Br0ce/opera/pkg/approval"
+
+type Approval interface {
+	Add(request approval.Request) (string, error)
+	Get(id string) (approval.Request, error)
+	GetByThread(agentID string, threadID string) (approval.Request, error)
+	Update(id string, request approval.Request) error
+	Delete(id string) error
+}
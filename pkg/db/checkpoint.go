@@ -0,0 +1,15 @@
+package db
+
+import (
+	"iter"
+
+	"github.com/Br0ce/opera/pkg/checkpoint"
+)
+
+type Checkpoint interface {
+	// Set stores the checkpoint under its ID, replacing a prior one.
+	Set(cp checkpoint.Checkpoint) error
+	Get(id string) (checkpoint.Checkpoint, error)
+	All() iter.Seq[checkpoint.Checkpoint]
+	Delete(id string) error
+}
@@ -0,0 +1,184 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Br0ce/opera/pkg/checkpoint"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/ids"
+)
+
+var _ db.Checkpoint = (*Checkpoint)(nil)
+
+const ext = ".json"
+
+// Checkpoint stores every checkpoint as json file in a directory, so that checkpoints
+// survive a restart.
+type Checkpoint struct {
+	dir string
+	mu  sync.RWMutex
+	log *slog.Logger
+}
+
+// NewCheckpointDB returns a Checkpoint store in the given directory, which is created if
+// it does not exist.
+func NewCheckpointDB(dir string, log *slog.Logger) (*Checkpoint, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, fmt.Errorf("create dir %s: %w", dir, err)
+	}
+	return &Checkpoint{
+		dir: dir,
+		log: log,
+	}, nil
+}
+
+// Set stores the checkpoint.Checkpoint under its ID, replacing a prior one.
+// The file is synced and replaced atomically, so that a crash never leaves a partial
+// checkpoint.
+func (ch *Checkpoint) Set(cp checkpoint.Checkpoint) error {
+	if !ids.Valid(cp.ID) {
+		return db.ErrInvalidID
+	}
+	bb, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("marshal checkpoint: %w", err)
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	tmp, err := os.CreateTemp(ch.dir, cp.ID+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(bb)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync checkpoint: %w", err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("close checkpoint: %w", err)
+	}
+	err = os.Rename(tmp.Name(), ch.path(cp.ID))
+	if err != nil {
+		return fmt.Errorf("rename checkpoint: %w", err)
+	}
+	return ch.syncDir()
+}
+
+// syncDir syncs the directory, so that a renamed checkpoint survives a crash.
+func (ch *Checkpoint) syncDir() error {
+	dir, err := os.Open(ch.dir)
+	if err != nil {
+		return fmt.Errorf("open dir: %w", err)
+	}
+	defer dir.Close()
+	err = dir.Sync()
+	if err != nil {
+		return fmt.Errorf("sync dir: %w", err)
+	}
+	return nil
+}
+
+// Get returns the checkpoint.Checkpoint stored for the given id.
+// If no checkpoint is found for the given id, a db.ErrNotFound is returned.
+func (ch *Checkpoint) Get(id string) (checkpoint.Checkpoint, error) {
+	if !ids.Valid(id) {
+		return checkpoint.Checkpoint{}, db.ErrInvalidID
+	}
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	return ch.read(ch.path(id))
+}
+
+// All returns an iterator over all stored checkpoints. Unreadable files are skipped.
+func (ch *Checkpoint) All() iter.Seq[checkpoint.Checkpoint] {
+	return func(yield func(checkpoint.Checkpoint) bool) {
+		ch.mu.RLock()
+		entries, err := os.ReadDir(ch.dir)
+		if err != nil {
+			ch.mu.RUnlock()
+			ch.log.Error("read checkpoint dir", "method", "All", "dir", ch.dir, "error", err)
+			return
+		}
+		var cps []checkpoint.Checkpoint
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ext) {
+				continue
+			}
+			cp, err := ch.read(filepath.Join(ch.dir, entry.Name()))
+			if err != nil {
+				ch.log.Error("read checkpoint", "method", "All", "file", entry.Name(), "error", err)
+				continue
+			}
+			cps = append(cps, cp)
+		}
+		ch.mu.RUnlock()
+
+		for _, cp := range cps {
+			if !yield(cp) {
+				return
+			}
+		}
+	}
+}
+
+// Delete deletes the checkpoint.Checkpoint stored for the given id.
+func (ch *Checkpoint) Delete(id string) error {
+	if !ids.Valid(id) {
+		return db.ErrInvalidID
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	err := os.Remove(ch.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return db.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("remove checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (ch *Checkpoint) path(id string) string {
+	return filepath.Join(ch.dir, id+ext)
+}
+
+func (ch *Checkpoint) read(path string) (checkpoint.Checkpoint, error) {
+	bb, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return checkpoint.Checkpoint{}, db.ErrNotFound
+	}
+	if err != nil {
+		return checkpoint.Checkpoint{}, fmt.Errorf("read checkpoint: %w", err)
+	}
+
+	var cp checkpoint.Checkpoint
+	err = json.Unmarshal(bb, &cp)
+	if err != nil {
+		return checkpoint.Checkpoint{}, fmt.Errorf("unmarshal checkpoint: %w", err)
+	}
+	return cp, nil
+}
@@ -0,0 +1,109 @@
+package file
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/checkpoint"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/history"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/percept"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/user"
+)
+
+func TestCheckpoint_SetGet(t *testing.T) {
+	t.Parallel()
+
+	calls := []tool.Call{{ID: "1", Name: "get_user", Arguments: `{"id":"42"}`}}
+	var hist history.History
+	hist.AddSystem("prompt")
+	hist.AddPercepts([]percept.Percept{percept.MakeUser(user.Query{Text: "question"})})
+	hist.AddAction(action.MakeTool(calls, "need the user"))
+	hist.AddPercepts([]percept.Percept{percept.MakeToolError("1", &tool.Error{Kind: tool.ErrTimeout, Message: "too slow"})})
+
+	tests := []struct {
+		name    string
+		cp      checkpoint.Checkpoint
+		wantErr error
+	}{
+		{
+			name: "acting",
+			cp: checkpoint.Checkpoint{
+				ID:            "chk-crc8a9q3fbbc73aqm6ig",
+				AgentID:       "age-1",
+				ThreadID:      "thr-1",
+				Iter:          2,
+				Phase:         checkpoint.Acting,
+				Action:        action.MakeTool(calls, "need the user"),
+				History:       hist,
+				ThreadCreated: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				MaxIter:       5,
+				Updated:       time.Date(2025, 1, 1, 0, 1, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "acted",
+			cp: checkpoint.Checkpoint{
+				ID:       "chk-crc8a9q3fbbc73aqm6ig",
+				AgentID:  "age-1",
+				ThreadID: "thr-1",
+				Iter:     2,
+				Phase:    checkpoint.Acted,
+				Action:   action.MakeTool(calls, ""),
+				Percepts: []percept.Percept{percept.MakeTool("1", "user 42")},
+				History:  hist,
+			},
+		},
+		{
+			name:    "invalid id",
+			cp:      checkpoint.Checkpoint{ID: "../chk-1"},
+			wantErr: db.ErrInvalidID,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ch, err := NewCheckpointDB(t.TempDir(), monitor.NewTestLogger(false))
+			if err != nil {
+				t.Fatalf("NewCheckpointDB() error = %v", err)
+			}
+
+			err = ch.Set(test.cp)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Checkpoint.Set() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr != nil {
+				return
+			}
+
+			got, err := ch.Get(test.cp.ID)
+			if err != nil {
+				t.Fatalf("Checkpoint.Get() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.cp) {
+				t.Errorf("Checkpoint.Get() = %+v, want %+v", got, test.cp)
+			}
+
+			var n int
+			for range ch.All() {
+				n++
+			}
+			if n != 1 {
+				t.Errorf("Checkpoint.All() len = %v, want %v", n, 1)
+			}
+
+			err = ch.Delete(test.cp.ID)
+			if err != nil {
+				t.Fatalf("Checkpoint.Delete() error = %v", err)
+			}
+			_, err = ch.Get(test.cp.ID)
+			if !errors.Is(err, db.ErrNotFound) {
+				t.Errorf("Checkpoint.Get() error = %v, want %v", err, db.ErrNotFound)
+			}
+		})
+	}
+}
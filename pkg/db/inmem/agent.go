@@ -1,6 +1,7 @@
 package inmem
 
 import (
+	"iter"
 	"sync"
 
 	"github.com/Br0ce/opera/pkg/agent"
@@ -19,7 +20,7 @@ func NewAgentDB() *Agent {
 }
 
 // Add stores the Agent and returns the id for which the Agent can be retrieved.
-func (ag *Agent) Add(agent agent.Agent) (string, error) {
+func (ag *Agent) Add(agent agent.Definition) (string, error) {
 	id := ids.UniqueAgent()
 	_, ok := ag.agents.LoadOrStore(id, agent)
 	if ok {
@@ -31,7 +32,7 @@ func (ag *Agent) Add(agent agent.Agent) (string, error) {
 
 // Get returns the Agent stored for the given id.
 // If no Agent is found for the given id, a db.ErrNotFound is returned.
-func (ag *Agent) Get(id string) (agent.Agent, error) {
+func (ag *Agent) Get(id string) (agent.Definition, error) {
 	if id == "" {
 		return nil, db.ErrInvalidID
 	}
@@ -40,7 +41,7 @@ func (ag *Agent) Get(id string) (agent.Agent, error) {
 		return nil, db.ErrNotFound
 	}
 
-	a, ok := v.(agent.Agent)
+	a, ok := v.(agent.Definition)
 	if !ok {
 		// This should not happen.
 		return nil, db.ErrInternal
@@ -48,7 +49,7 @@ func (ag *Agent) Get(id string) (agent.Agent, error) {
 	return a, nil
 }
 
-func (ag *Agent) Update(id string, agent agent.Agent) error {
+func (ag *Agent) Update(id string, agent agent.Definition) error {
 	_, ok := ag.agents.LoadOrStore(id, agent)
 	if !ok {
 		return db.ErrNotFound
@@ -56,6 +57,15 @@ func (ag *Agent) Update(id string, agent agent.Agent) error {
 	return nil
 }
 
+// Set stores the Agent for the given id, replacing any Agent stored for it before.
+func (ag *Agent) Set(id string, agent agent.Definition) error {
+	if id == "" {
+		return db.ErrInvalidID
+	}
+	ag.agents.Store(id, agent)
+	return nil
+}
+
 // Delete deletes the Agent stored for the given id.
 func (ag *Agent) Delete(id string) error {
 	_, ok := ag.agents.Load(id)
@@ -65,3 +75,20 @@ func (ag *Agent) Delete(id string) error {
 	ag.agents.Delete(id)
 	return nil
 }
+
+// All returns the ids and Agents of all stored Agents, in no particular order.
+func (ag *Agent) All() iter.Seq2[string, agent.Definition] {
+	return func(yield func(string, agent.Definition) bool) {
+		ag.agents.Range(func(k, v any) bool {
+			id, ok := k.(string)
+			if !ok {
+				return true
+			}
+			a, ok := v.(agent.Definition)
+			if !ok {
+				return true
+			}
+			return yield(id, a)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package inmem
+
+import (
+	"sync"
+
+	"github.com/Br0ce/opera/pkg/approval"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/ids"
+)
+
+var _ db.Approval = (*Approval)(nil)
+
+type Approval struct {
+	requests sync.Map
+}
+
+func NewApprovalDB() *Approval {
+	return &Approval{}
+}
+
+// Add stores the approval.Request and returns the id for which it can be retrieved.
+// The ID field of the stored request is set to the returned id.
+func (ap *Approval) Add(request approval.Request) (string, error) {
+	id := ids.UniqueApproval()
+	request.ID = id
+	_, ok := ap.requests.LoadOrStore(id, request)
+	if ok {
+		return "", db.ErrAlreadyExists
+	}
+	return id, nil
+}
+
+// Get returns the approval.Request stored for the given id.
+// If no request is found for the given id, a db.ErrNotFound is returned.
+func (ap *Approval) Get(id string) (approval.Request, error) {
+	if id == "" {
+		return approval.Request{}, db.ErrInvalidID
+	}
+	v, ok := ap.requests.Load(id)
+	if !ok {
+		return approval.Request{}, db.ErrNotFound
+	}
+
+	r, ok := v.(approval.Request)
+	if !ok {
+		// This should not happen.
+		return approval.Request{}, db.ErrInternal
+	}
+	return r, nil
+}
+
+// GetByThread returns the approval.Request of the suspended query on the thread with the
+// given threadID of the agent with the given agentID.
+// If the thread has no request, a db.ErrNotFound is returned.
+func (ap *Approval) GetByThread(agentID string, threadID string) (approval.Request, error) {
+	var req approval.Request
+	found := false
+	ap.requests.Range(func(_, v any) bool {
+		r, ok := v.(approval.Request)
+		if ok && r.BelongsTo(agentID, threadID) {
+			req = r
+			found = true
+			return false
+		}
+		return true
+	})
+	if !found {
+		return approval.Request{}, db.ErrNotFound
+	}
+	return req, nil
+}
+
+// Update replaces the approval.Request stored for the given id.
+// If no request is found for the given id, a db.ErrNotFound is returned.
+func (ap *Approval) Update(id string, request approval.Request) error {
+	_, ok := ap.requests.Load(id)
+	if !ok {
+		return db.ErrNotFound
+	}
+	ap.requests.Store(id, request)
+	return nil
+}
+
+// Delete deletes the approval.Request stored for the given id.
+func (ap *Approval) Delete(id string) error {
+	_, ok := ap.requests.LoadAndDelete(id)
+	if !ok {
+		return db.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package inmem
+
+import (
+	"iter"
+	"sync"
+
+	"github.com/Br0ce/opera/pkg/checkpoint"
+	"github.com/Br0ce/opera/pkg/db"
+)
+
+var _ db.Checkpoint = (*Checkpoint)(nil)
+
+type Checkpoint struct {
+	checkpoints sync.Map
+}
+
+func NewCheckpointDB() *Checkpoint {
+	return &Checkpoint{}
+}
+
+// Set stores the checkpoint.Checkpoint under its ID, replacing a prior one.
+func (ch *Checkpoint) Set(cp checkpoint.Checkpoint) error {
+	if cp.ID == "" {
+		return db.ErrInvalidID
+	}
+	ch.checkpoints.Store(cp.ID, cp)
+	return nil
+}
+
+// Get returns the checkpoint.Checkpoint stored for the given id.
+// If no checkpoint is found for the given id, a db.ErrNotFound is returned.
+func (ch *Checkpoint) Get(id string) (checkpoint.Checkpoint, error) {
+	if id == "" {
+		return checkpoint.Checkpoint{}, db.ErrInvalidID
+	}
+	v, ok := ch.checkpoints.Load(id)
+	if !ok {
+		return checkpoint.Checkpoint{}, db.ErrNotFound
+	}
+
+	cp, ok := v.(checkpoint.Checkpoint)
+	if !ok {
+		// This should not happen.
+		return checkpoint.Checkpoint{}, db.ErrInternal
+	}
+	return cp, nil
+}
+
+// All returns an iterator over all stored checkpoints.
+func (ch *Checkpoint) All() iter.Seq[checkpoint.Checkpoint] {
+	return func(yield func(checkpoint.Checkpoint) bool) {
+		ch.checkpoints.Range(func(_, value any) bool {
+			cp, ok := value.(checkpoint.Checkpoint)
+			if !ok {
+				return true
+			}
+			return yield(cp)
+		})
+	}
+}
+
+// Delete deletes the checkpoint.Checkpoint stored for the given id.
+func (ch *Checkpoint) Delete(id string) error {
+	_, ok := ch.checkpoints.LoadAndDelete(id)
+	if !ok {
+		return db.ErrNotFound
+	}
+	return nil
+}
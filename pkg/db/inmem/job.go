@@ -0,0 +1,84 @@
+package inmem
+
+import (
+	"iter"
+	"sync"
+
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/ids"
+	"github.com/Br0ce/opera/pkg/job"
+)
+
+var _ db.Job = (*Job)(nil)
+
+type Job struct {
+	jobs sync.Map
+}
+
+func NewJobDB() *Job {
+	return &Job{}
+}
+
+// Add stores the job.Job and returns the id for which it can be retrieved.
+// The ID field of the stored job is set to the returned id.
+func (jo *Job) Add(j job.Job) (string, error) {
+	id := ids.UniqueJob()
+	j.ID = id
+	_, ok := jo.jobs.LoadOrStore(id, j)
+	if ok {
+		return "", db.ErrAlreadyExists
+	}
+	return id, nil
+}
+
+// Get returns the job.Job stored for the given id.
+// If no job is found for the given id, a db.ErrNotFound is returned.
+func (jo *Job) Get(id string) (job.Job, error) {
+	if id == "" {
+		return job.Job{}, db.ErrInvalidID
+	}
+	v, ok := jo.jobs.Load(id)
+	if !ok {
+		return job.Job{}, db.ErrNotFound
+	}
+
+	j, ok := v.(job.Job)
+	if !ok {
+		// This should not happen.
+		return job.Job{}, db.ErrInternal
+	}
+	return j, nil
+}
+
+// Update replaces the job.Job stored for the given id.
+// If no job is found for the given id, a db.ErrNotFound is returned.
+func (jo *Job) Update(id string, j job.Job) error {
+	_, ok := jo.jobs.Load(id)
+	if !ok {
+		return db.ErrNotFound
+	}
+	jo.jobs.Store(id, j)
+	return nil
+}
+
+// All returns an iterator over all stored jobs.
+func (jo *Job) All() iter.Seq[job.Job] {
+	return func(yield func(job.Job) bool) {
+		jo.jobs.Range(func(_, value any) bool {
+			j, ok := value.(job.Job)
+			if !ok {
+				return true
+			}
+			return yield(j)
+		})
+	}
+}
+
+// Delete deletes the job.Job stored for the given id.
+func (jo *Job) Delete(id string) error {
+	_, ok := jo.jobs.LoadAndDelete(id)
+	if !ok {
+		return db.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package inmem
+
+import (
+	"iter"
+	"sync"
+
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/db"
+)
+
+var _ db.Thread = (*Thread)(nil)
+
+type threadKey struct {
+	agentID string
+	id      string
+}
+
+type Thread struct {
+	threads sync.Map
+}
+
+func NewThreadDB() *Thread {
+	return &Thread{}
+}
+
+// Add stores the thread of the agent with the given agentID.
+// If a thread with the same id is already stored for the agent, a db.ErrAlreadyExists is returned.
+func (th *Thread) Add(agentID string, thread agent.Thread) error {
+	if agentID == "" || thread.ID() == "" {
+		return db.ErrInvalidID
+	}
+	_, ok := th.threads.LoadOrStore(threadKey{agentID: agentID, id: thread.ID()}, thread)
+	if ok {
+		return db.ErrAlreadyExists
+	}
+	return nil
+}
+
+// Get returns the thread with the given id of the agent with the given agentID.
+// If no thread is found, a db.ErrNotFound is returned.
+func (th *Thread) Get(agentID string, id string) (agent.Thread, error) {
+	if agentID == "" || id == "" {
+		return nil, db.ErrInvalidID
+	}
+	v, ok := th.threads.Load(threadKey{agentID: agentID, id: id})
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+
+	t, ok := v.(agent.Thread)
+	if !ok {
+		// This should not happen.
+		return nil, db.ErrInternal
+	}
+	return t, nil
+}
+
+// All returns an iterator over all threads of the agent with the given agentID.
+func (th *Thread) All(agentID string) iter.Seq[agent.Thread] {
+	return func(yield func(agent.Thread) bool) {
+		th.threads.Range(func(key, value any) bool {
+			k, ok := key.(threadKey)
+			if !ok || k.agentID != agentID {
+				return true
+			}
+			if t, ok := value.(agent.Thread); ok {
+				return yield(t)
+			}
+			return true
+		})
+	}
+}
+
+// Delete deletes the thread with the given id of the agent with the given agentID.
+func (th *Thread) Delete(agentID string, id string) error {
+	_, ok := th.threads.LoadAndDelete(threadKey{agentID: agentID, id: id})
+	if !ok {
+		return db.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteAll deletes all threads of the agent with the given agentID.
+func (th *Thread) DeleteAll(agentID string) {
+	th.threads.Range(func(key, _ any) bool {
+		if k, ok := key.(threadKey); ok && k.agentID == agentID {
+			th.threads.Delete(key)
+		}
+		return true
+	})
+}
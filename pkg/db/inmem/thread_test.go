@@ -0,0 +1,121 @@
+package inmem
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/agent/function"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/monitor"
+)
+
+func testThread(id string) agent.Thread {
+	return function.NewAgent("prompt", nil, nil, monitor.NewTestLogger(false)).NewThread(id)
+}
+
+func TestThread_Add(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		agentID string
+		threads []agent.Thread
+		wantErr error
+	}{
+		{
+			name:    "pass",
+			agentID: "age-1",
+			threads: []agent.Thread{testThread("thr-1"), testThread("thr-2")},
+		},
+		{
+			name:    "already exists",
+			agentID: "age-1",
+			threads: []agent.Thread{testThread("thr-1"), testThread("thr-1")},
+			wantErr: db.ErrAlreadyExists,
+		},
+		{
+			name:    "invalid agent id",
+			agentID: "",
+			threads: []agent.Thread{testThread("thr-1")},
+			wantErr: db.ErrInvalidID,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th := NewThreadDB()
+			var wg sync.WaitGroup
+			errs := make([]error, len(test.threads))
+			for i, thread := range test.threads {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs[i] = th.Add(test.agentID, thread)
+				}()
+			}
+			wg.Wait()
+
+			err := errors.Join(errs...)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Thread.Add() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestThread_GetAllDelete(t *testing.T) {
+	t.Parallel()
+
+	th := NewThreadDB()
+	for _, add := range []struct {
+		agentID string
+		thread  agent.Thread
+	}{
+		{"age-1", testThread("thr-1")},
+		{"age-1", testThread("thr-2")},
+		{"age-2", testThread("thr-3")},
+	} {
+		err := th.Add(add.agentID, add.thread)
+		if err != nil {
+			t.Fatalf("Thread.Add() error = %v", err)
+		}
+	}
+
+	got, err := th.Get("age-1", "thr-2")
+	if err != nil {
+		t.Fatalf("Thread.Get() error = %v", err)
+	}
+	if got.ID() != "thr-2" {
+		t.Errorf("Thread.Get() id = %v, want %v", got.ID(), "thr-2")
+	}
+	if _, err := th.Get("age-2", "thr-1"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("Thread.Get() other agent error = %v, want %v", err, db.ErrNotFound)
+	}
+
+	var ids []string
+	for thread := range th.All("age-1") {
+		ids = append(ids, thread.ID())
+	}
+	slices.Sort(ids)
+	if !slices.Equal(ids, []string{"thr-1", "thr-2"}) {
+		t.Errorf("Thread.All() = %v, want %v", ids, []string{"thr-1", "thr-2"})
+	}
+
+	err = th.Delete("age-1", "thr-1")
+	if err != nil {
+		t.Errorf("Thread.Delete() error = %v", err)
+	}
+	if err := th.Delete("age-1", "thr-1"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("Thread.Delete() twice error = %v, want %v", err, db.ErrNotFound)
+	}
+
+	th.DeleteAll("age-1")
+	for thread := range th.All("age-1") {
+		t.Errorf("Thread.DeleteAll() found thread %v", thread.ID())
+	}
+	if _, err := th.Get("age-2", "thr-3"); err != nil {
+		t.Errorf("Thread.DeleteAll() deleted thread of other agent: %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+package db
+
+import (
+	"iter"
+
+	"github.com/Br0ce/opera/pkg/job"
+)
+
+type Job interface {
+	Add(job job.Job) (string, error)
+	Get(id string) (job.Job, error)
+	Update(id string, job job.Job) error
+	All() iter.Seq[job.Job]
+	Delete(id string) error
+}
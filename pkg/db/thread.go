@@ -0,0 +1,15 @@
+package db
+
+import (
+	"iter"
+
+	"github.com/Br0ce/opera/pkg/agent"
+)
+
+type Thread interface {
+	Add(agentID string, thread agent.Thread) error
+	Get(agentID string, id string) (agent.Thread, error)
+	All(agentID string) iter.Seq[agent.Thread]
+	Delete(agentID string, id string) error
+	DeleteAll(agentID string)
+}
@@ -2,11 +2,167 @@ package engine
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/approval"
+	"github.com/Br0ce/opera/pkg/tool"
 	"github.com/Br0ce/opera/pkg/user"
 )
 
+// ErrShutdown is the cancel cause of the context of queries interrupted by a shutdown
+// of the server. Their checkpoints are kept, so that they can be recovered.
+var ErrShutdown = errors.New("server shut down")
+
+// ErrAwaitsApproval is returned for queries on a thread whose last query waits for a
+// human approval. The thread can be queried again once that query is resumed.
+var ErrAwaitsApproval = errors.New("thread awaits approval")
+
 type Engine interface {
-	Query(ctx context.Context, query user.Query, agent agent.Agent) (string, error)
+	Query(ctx context.Context, query user.Query, agent agent.Agent, opts ...Option) (string, error)
+}
+
+// Resumer continues a query that has been suspended for human approval.
+type Resumer interface {
+	Resume(ctx context.Context, approvalID string, agent agent.Agent, opts ...Option) (string, error)
+}
+
+// Recoverer resumes a query from its last checkpoint, e.g. after a restart.
+type Recoverer interface {
+	Recover(ctx context.Context, checkpointID string, agent agent.Agent, opts ...Option) (string, error)
+}
+
+// Options are the per query settings of an Engine.
+type Options struct {
+	// Subscriber receives the events of the query, if set.
+	Subscriber Subscriber
+	// MaxIter overrides the iteration limit of the engine, if greater zero.
+	MaxIter int
+	// Deadline limits the duration of the query, if set.
+	Deadline time.Time
+	// AgentID identifies the agent of the query in its checkpoints. Queries without
+	// an AgentID are not checkpointed.
+	AgentID string
+	// Hooks intercept the steps of the query after the hooks of the engine and the
+	// agent.
+	Hooks Hooks
+}
+
+type Option func(o *Options)
+
+// WithSubscriber sets a Subscriber for the events of the query.
+func WithSubscriber(subscriber Subscriber) Option {
+	return func(o *Options) {
+		o.Subscriber = subscriber
+	}
+}
+
+// WithMaxIter limits the iterations of the query.
+func WithMaxIter(maxIter int) Option {
+	return func(o *Options) {
+		o.MaxIter = maxIter
+	}
+}
+
+// WithDeadline sets a deadline for the query. The engine stops calling tools in time to
+// answer before the deadline.
+func WithDeadline(deadline time.Time) Option {
+	return func(o *Options) {
+		o.Deadline = deadline
+	}
+}
+
+// WithAgentID sets the id of the queried agent, which enables checkpoints for the query.
+func WithAgentID(agentID string) Option {
+	return func(o *Options) {
+		o.AgentID = agentID
+	}
+}
+
+// WithHooks adds hooks intercepting the steps of the query.
+func WithHooks(hooks ...Hook) Option {
+	return func(o *Options) {
+		o.Hooks = append(o.Hooks, hooks...)
+	}
+}
+
+// MakeOptions returns the Options with all given opts applied.
+func MakeOptions(opts ...Option) Options {
+	var o Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Publish passes the event to the subscriber, if one is set.
+func (o Options) Publish(event Event) {
+	if o.Subscriber != nil {
+		o.Subscriber.Publish(event)
+	}
+}
+
+// PendingError is returned if a query is suspended because tool calls wait for a
+// human approval. The query can be continued with Resumer.Resume once all calls are
+// decided.
+type PendingError struct {
+	Request approval.Request
+}
+
+func (e *PendingError) Error() string {
+	return fmt.Sprintf("approval %s pending", e.Request.ID)
+}
+
+// PartialReason names why a query ended before the agent answered on its own.
+type PartialReason string
+
+const (
+	ReasonMaxIter  PartialReason = "max_iterations"
+	ReasonDeadline PartialReason = "deadline"
+)
+
+// PartialError is returned if a query reached its iteration limit or its deadline
+// before the agent answered on its own. It holds the final answer of the agent, if it
+// was asked for one, and the tool responses the query gathered so far.
+type PartialError struct {
+	Reason   PartialReason
+	MaxIter  int
+	Text     string
+	Findings []tool.Response
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("partial result, %s reached with %v findings", e.Reason, len(e.Findings))
+}
+
+// LoopPattern names how an agent repeats itself.
+type LoopPattern string
+
+const (
+	// PatternRepeat is a step calling the same tools with the same arguments as the
+	// step before.
+	PatternRepeat LoopPattern = "repeat"
+	// PatternOscillation is a step returning to the calls of an earlier step after a
+	// different step in between.
+	PatternOscillation LoopPattern = "oscillation"
+	// PatternNoProgress is a step whose tool results have all been seen before.
+	PatternNoProgress LoopPattern = "no_progress"
+)
+
+// LoopError is returned if an agent keeps repeating itself after it has been told that
+// it is stuck in a loop.
+type LoopError struct {
+	Pattern LoopPattern
+	// Iter is the iteration in which the query was stopped.
+	Iter int
+	// Calls are the calls of the stopped step.
+	Calls []tool.Call
+	// Diagnostic describes the loop.
+	Diagnostic string
+}
+
+func (e *LoopError) Error() string {
+	return fmt.Sprintf("agent stuck in loop, %s", e.Diagnostic)
 }
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+// EventType names the kind of step progress an Event reports.
+type EventType string
+
+const (
+	EventStepStarted EventType = "step.started"
+	EventReasoning   EventType = "reasoning"
+	EventToolCall    EventType = "tool.call"
+	EventToolResult  EventType = "tool.result"
+	EventToolError   EventType = "tool.error"
+	EventPending     EventType = "approval.pending"
+	EventLoop        EventType = "loop.detected"
+	EventGuard       EventType = "guard.violation"
+	EventAnswer      EventType = "answer"
+	EventError       EventType = "error"
+)
+
+// Event reports the progress of a query. Which fields are set depends on the type:
+// reasoning, loop, guard and answer events hold the Text, tool call events the Call, tool result
+// events the Result and error events the Err.
+type Event struct {
+	Type   EventType
+	Step   int
+	Time   time.Time
+	Text   string
+	Call   tool.Call
+	Result tool.Response
+	Err    error
+}
+
+// MakeEvent returns an Event of the given type for the given step stamped with the
+// current time.
+func MakeEvent(eventType EventType, step int) Event {
+	return Event{
+		Type: eventType,
+		Step: step,
+		Time: time.Now().UTC(),
+	}
+}
+
+// Subscriber receives the events of a query. Publish is called synchronously by the
+// engine and should return quickly.
+type Subscriber interface {
+	Publish(event Event)
+}
+
+// SubscriberFunc is an adapter to use an ordinary function as Subscriber.
+type SubscriberFunc func(event Event)
+
+func (f SubscriberFunc) Publish(event Event) {
+	f(event)
+}
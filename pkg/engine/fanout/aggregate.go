@@ -0,0 +1,111 @@
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Br0ce/opera/pkg/history"
+	"github.com/Br0ce/opera/pkg/percept"
+	"github.com/Br0ce/opera/pkg/user"
+)
+
+// Strategy is the way the answers of the agents are aggregated.
+type Strategy string
+
+const (
+	// StrategyMajority returns the answer given by most agents. Answers are compared
+	// regardless of case, whitespace and trailing punctuation. Ties go to the agent
+	// listed first.
+	StrategyMajority Strategy = "majority"
+	// StrategyJudge asks the judge reasoner to pick the best answer or merge them.
+	StrategyJudge Strategy = "judge"
+	// StrategyConcat concatenates all answers, each attributed to its agent.
+	StrategyConcat Strategy = "concat"
+)
+
+const judgePrompt = "You are a judge. Several assistants answered the question of the user. " +
+	"Pick the most accurate and helpful answer, or merge the answers if they complement each " +
+	"other, and correct obvious mistakes. Reply only with the final answer to the user, " +
+	"without mentioning the assistants."
+
+// Valid reports whether s is a known strategy.
+func (s Strategy) Valid() bool {
+	switch s {
+	case StrategyMajority, StrategyJudge, StrategyConcat:
+		return true
+	default:
+		return false
+	}
+}
+
+// aggregate returns the aggregated text of the given answers, which are all successful.
+func (eg *Engine) aggregate(ctx context.Context, query user.Query, answers []Answer, strategy Strategy) (string, error) {
+	switch strategy {
+	case StrategyMajority:
+		return majority(answers), nil
+	case StrategyJudge:
+		return eg.judgeAnswers(ctx, query, answers)
+	case StrategyConcat:
+		return concat(answers), nil
+	default:
+		return "", fmt.Errorf("strategy %s not supported", strategy)
+	}
+}
+
+// majority returns the answer given by most agents. Of equally frequent answers, the
+// one given first wins.
+func majority(answers []Answer) string {
+	votes := make(map[string]int, len(answers))
+	var most int
+	for _, a := range answers {
+		key := normalize(a.Text)
+		votes[key]++
+		most = max(most, votes[key])
+	}
+	for _, a := range answers {
+		if votes[normalize(a.Text)] == most {
+			return a.Text
+		}
+	}
+	return ""
+}
+
+// normalize returns the text in lower case with collapsed whitespace and without
+// trailing punctuation.
+func normalize(text string) string {
+	text = strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	return strings.TrimRightFunc(text, unicode.IsPunct)
+}
+
+// judgeAnswers asks the judge for the final answer.
+func (eg *Engine) judgeAnswers(ctx context.Context, query user.Query, answers []Answer) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Question: %s\n", query.Text)
+	for i, a := range answers {
+		fmt.Fprintf(&b, "\nAnswer %v:\n%s\n", i+1, a.Text)
+	}
+
+	var hist history.History
+	hist.AddSystem(judgePrompt)
+	hist.AddPercepts([]percept.Percept{percept.MakeUser(user.Query{Text: b.String()})})
+	next, err := eg.judge.Reason(ctx, hist, nil)
+	if err != nil {
+		return "", fmt.Errorf("judge: %w", err)
+	}
+	text, ok := next.User()
+	if !ok {
+		return "", fmt.Errorf("judge: no answer")
+	}
+	return text, nil
+}
+
+// concat returns all answers, each headed by the id of its agent.
+func concat(answers []Answer) string {
+	parts := make([]string, 0, len(answers))
+	for _, a := range answers {
+		parts = append(parts, fmt.Sprintf("[%s]\n%s", a.AgentID, a.Text))
+	}
+	return strings.Join(parts, "\n\n")
+}
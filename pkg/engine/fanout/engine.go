@@ -0,0 +1,261 @@
+// Package fanout queries several agents with the same query in parallel and aggregates
+// their answers into one.
+package fanout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/approval"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/history"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/percept"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/user"
+)
+
+// ErrNoAnswer is returned if no agent answered.
+var ErrNoAnswer = errors.New("no agent answered")
+
+// Reasoner is the model judging the answers for the judge strategy.
+type Reasoner interface {
+	Reason(ctx context.Context, hist history.History, tools []tool.Tool) (action.Action, error)
+}
+
+// Member is an agent taking part in a fan-out query, queried on its Thread.
+type Member struct {
+	AgentID string
+	Thread  agent.Thread
+}
+
+// Answer is the answer of a single agent. Err is set if the agent failed or did not
+// answer in time.
+type Answer struct {
+	AgentID  string
+	ThreadID string
+	Text     string
+	// Partial reports that the agent answered with a partial result, e.g. because it
+	// reached its timeout.
+	Partial  bool
+	Err      error
+	Duration time.Duration
+}
+
+// Result is the aggregated answer of a fan-out query together with the answers of all
+// agents in the order of the members.
+type Result struct {
+	Text     string
+	Strategy Strategy
+	Answers  []Answer
+}
+
+// Engine queries several agents through an inner engine, e.g. a loop.Engine, and
+// aggregates their answers.
+type Engine struct {
+	inner engine.Engine
+	judge Reasoner
+	// approvals is the store of the approval requests of the inner engine.
+	approvals db.Approval
+	timeout   time.Duration
+	tr        trace.Tracer
+	log       *slog.Logger
+}
+
+type Option func(eg *Engine)
+
+// WithJudge sets the reasoner for the judge strategy. Without a judge, queries with the
+// judge strategy fail.
+func WithJudge(judge Reasoner) Option {
+	return func(eg *Engine) {
+		eg.judge = judge
+	}
+}
+
+// WithApprovals sets the store of the approval requests of the inner engine. Requests
+// of the agents are deleted, since approvals are not supported in fan-out queries.
+func WithApprovals(approvals db.Approval) Option {
+	return func(eg *Engine) {
+		eg.approvals = approvals
+	}
+}
+
+// WithTimeout sets the default time each agent has to answer. The default is one minute.
+func WithTimeout(timeout time.Duration) Option {
+	return func(eg *Engine) {
+		eg.timeout = timeout
+	}
+}
+
+func NewEngine(inner engine.Engine, log *slog.Logger, options ...Option) *Engine {
+	eg := &Engine{
+		inner:   inner,
+		timeout: time.Minute,
+		tr:      monitor.Tracer("FanoutEngine"),
+		log:     log,
+	}
+	for _, opt := range options {
+		opt(eg)
+	}
+	return eg
+}
+
+// Query asks all members the query in parallel and aggregates the answers with the
+// given strategy. Each agent has the given timeout to answer, or the timeout of the
+// engine if zero. Agents which fail are left out of the aggregation. If no agent
+// answers, ErrNoAnswer is returned together with the failed answers.
+func (eg *Engine) Query(ctx context.Context, query user.Query, members []Member, strategy Strategy, timeout time.Duration) (Result, error) {
+	ctx, span := eg.tr.Start(ctx, "Query fanout")
+	defer span.End()
+	span.SetAttributes(
+		attribute.Int("fanout.agents", len(members)),
+		attribute.String("fanout.strategy", string(strategy)),
+	)
+
+	if len(members) == 0 {
+		return Result{}, fmt.Errorf("no agents")
+	}
+	if !strategy.Valid() {
+		return Result{}, fmt.Errorf("strategy %s not supported", strategy)
+	}
+	if strategy == StrategyJudge && eg.judge == nil {
+		return Result{}, fmt.Errorf("no judge")
+	}
+	if timeout <= 0 {
+		timeout = eg.timeout
+	}
+	eg.log.Info("query fanout",
+		"method", "Query",
+		"agents", len(members),
+		"strategy", strategy,
+		"timeout", timeout,
+		"traceID", monitor.TraceID(span))
+
+	answers := make([]Answer, len(members))
+	var wg sync.WaitGroup
+	for i, m := range members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			answers[i] = eg.ask(ctx, query, m, timeout)
+		}()
+	}
+	wg.Wait()
+
+	res := Result{Strategy: strategy, Answers: answers}
+	var answered []Answer
+	for _, a := range answers {
+		if a.Err == nil {
+			answered = append(answered, a)
+		}
+	}
+	span.SetAttributes(attribute.Int("fanout.answers", len(answered)))
+	if len(answered) == 0 {
+		span.SetStatus(codes.Error, ErrNoAnswer.Error())
+		return res, ErrNoAnswer
+	}
+
+	text, err := eg.aggregate(ctx, query, answered, strategy)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return res, fmt.Errorf("aggregate %s: %w", strategy, err)
+	}
+	res.Text = text
+	return res, nil
+}
+
+// ask queries the member within the timeout.
+func (eg *Engine) ask(ctx context.Context, query user.Query, m Member, timeout time.Duration) Answer {
+	ctx, span := eg.tr.Start(ctx, "ask "+m.AgentID)
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("agent.id", m.AgentID),
+		attribute.String("thread.id", m.Thread.ID()),
+	)
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	text, err := eg.query(ctx, query, m, deadline)
+	a := Answer{
+		AgentID:  m.AgentID,
+		ThreadID: m.Thread.ID(),
+		Text:     text,
+		Duration: time.Since(start),
+	}
+	var partialErr *engine.PartialError
+	var pendingErr *engine.PendingError
+	switch {
+	case errors.As(err, &partialErr) && partialErr.Text != "":
+		a.Text = partialErr.Text
+		a.Partial = true
+	case errors.As(err, &pendingErr):
+		a.Err = fmt.Errorf("approvals not supported in fanout queries")
+	case err != nil:
+		a.Err = err
+	}
+
+	if a.Err != nil {
+		span.SetStatus(codes.Error, a.Err.Error())
+		eg.log.Info("agent failed", "method", "ask", "agentID", m.AgentID, "error", a.Err)
+	}
+	span.SetAttributes(attribute.Bool("fanout.partial", a.Partial))
+	return a
+}
+
+// abandon deletes the approval request of a suspended agent query and answers its calls
+// on the thread of the agent, so that the thread can be queried again.
+func (eg *Engine) abandon(ag agent.Agent, req approval.Request) {
+	if eg.approvals != nil {
+		if err := eg.approvals.Delete(req.ID); err != nil {
+			eg.log.Error("delete approval", "method", "abandon", "approvalID", req.ID, "error", err.Error())
+		}
+	}
+
+	recorder, ok := ag.(agent.Recorder)
+	if !ok {
+		return
+	}
+	percepts := make([]percept.Percept, 0, len(req.Calls)+len(req.Blocked))
+	for _, c := range req.Calls {
+		percepts = append(percepts, percept.MakeToolError(c.Call.ID, &tool.Error{
+			Kind:    tool.ErrBlocked,
+			Message: "The call was not executed, approvals are not supported in fan-out queries.",
+		}))
+	}
+	for _, resp := range req.Blocked {
+		percepts = append(percepts, percept.MakeToolResponse(resp))
+	}
+	recorder.Record(percepts)
+}
+
+// query queries the thread of the member, once it is not locked by another query.
+// Waiting for the thread counts against the deadline. A query suspended for approval
+// is abandoned before the thread is unlocked.
+func (eg *Engine) query(ctx context.Context, query user.Query, m Member, deadline time.Time) (string, error) {
+	err := m.Thread.Lock(ctx)
+	if err != nil {
+		return "", fmt.Errorf("lock thread: %w", err)
+	}
+	defer m.Thread.Unlock()
+
+	res, err := eg.inner.Query(ctx, query, m.Thread, engine.WithAgentID(m.AgentID), engine.WithDeadline(deadline))
+	var pendingErr *engine.PendingError
+	if errors.As(err, &pendingErr) {
+		eg.abandon(m.Thread, pendingErr.Request)
+	}
+	return res, err
+}
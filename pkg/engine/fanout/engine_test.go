@@ -0,0 +1,300 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/approval"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/db/inmem"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/history"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/percept"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/user"
+)
+
+// testThread is an agent.Thread answered by the testEngine.
+type testThread struct {
+	mu       sync.Mutex
+	id       string
+	recorded []percept.Percept
+}
+
+func (th *testThread) Lock(context.Context) error {
+	th.mu.Lock()
+	return nil
+}
+func (th *testThread) Unlock() { th.mu.Unlock() }
+
+func (th *testThread) Action(context.Context, []percept.Percept) (action.Action, error) {
+	return action.Action{}, errors.New("not implemented")
+}
+func (th *testThread) Record(percepts []percept.Percept) {
+	th.recorded = append(th.recorded, percepts...)
+}
+func (th *testThread) ID() string               { return th.id }
+func (th *testThread) Created() time.Time       { return time.Time{} }
+func (th *testThread) History() history.History { return history.History{} }
+func (th *testThread) MaxIter() int             { return 0 }
+
+// testEngine answers queries on a thread with the reply for the id of the thread.
+type testEngine struct {
+	replies map[string]reply
+}
+
+type reply struct {
+	text string
+	err  error
+	// block makes the query wait until its context is done.
+	block bool
+}
+
+func (eg testEngine) Query(ctx context.Context, _ user.Query, ag agent.Agent, _ ...engine.Option) (string, error) {
+	r := eg.replies[ag.(agent.Thread).ID()]
+	if r.block {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return r.text, r.err
+}
+
+// reasonerFunc is a Reasoner answering with the returned content.
+type reasonerFunc func(hist history.History) (string, error)
+
+func (f reasonerFunc) Reason(_ context.Context, hist history.History, _ []tool.Tool) (action.Action, error) {
+	content, err := f(hist)
+	if err != nil {
+		return action.Action{}, err
+	}
+	return action.MakeUser(content), nil
+}
+
+func TestEngine_Query(t *testing.T) {
+	t.Parallel()
+
+	judge := reasonerFunc(func(hist history.History) (string, error) {
+		var question string
+		for _, e := range hist.All() {
+			if u, ok := e.(history.User); ok {
+				question = u.Content.Text
+			}
+		}
+		if !strings.Contains(question, "Answer 2:") {
+			return "", errors.New("answers missing")
+		}
+		return "judged", nil
+	})
+
+	tests := []struct {
+		name        string
+		replies     map[string]reply
+		strategy    Strategy
+		judge       Reasoner
+		want        string
+		wantFailed  int
+		wantPartial int
+		wantErr     error
+	}{
+		{
+			name: "majority",
+			replies: map[string]reply{
+				"a": {text: "Paris"},
+				"b": {text: "Lyon"},
+				"c": {text: "paris."},
+			},
+			strategy: StrategyMajority,
+			want:     "Paris",
+		},
+		{
+			name: "majority tie",
+			replies: map[string]reply{
+				"a": {text: "Lyon"},
+				"b": {text: "Paris"},
+				"c": {err: errors.New("failed")},
+			},
+			strategy:   StrategyMajority,
+			want:       "Lyon",
+			wantFailed: 1,
+		},
+		{
+			name: "concat",
+			replies: map[string]reply{
+				"a": {text: "Paris"},
+				"b": {text: "Lyon"},
+				"c": {text: "Nice"},
+			},
+			strategy: StrategyConcat,
+			want:     "[agent-a]\nParis\n\n[agent-b]\nLyon\n\n[agent-c]\nNice",
+		},
+		{
+			name: "judge",
+			replies: map[string]reply{
+				"a": {text: "Paris"},
+				"b": {text: "Lyon"},
+				"c": {text: "Nice"},
+			},
+			strategy: StrategyJudge,
+			judge:    judge,
+			want:     "judged",
+		},
+		{
+			name: "timeout and partial",
+			replies: map[string]reply{
+				"a": {block: true},
+				"b": {err: &engine.PartialError{Reason: engine.ReasonDeadline, Text: "Lyon"}},
+				"c": {text: "Nice"},
+			},
+			strategy:    StrategyConcat,
+			want:        "[agent-b]\nLyon\n\n[agent-c]\nNice",
+			wantFailed:  1,
+			wantPartial: 1,
+		},
+		{
+			name: "no answer",
+			replies: map[string]reply{
+				"a": {block: true},
+				"b": {err: errors.New("failed")},
+				"c": {err: &engine.PendingError{}},
+			},
+			strategy:   StrategyMajority,
+			wantFailed: 3,
+			wantErr:    ErrNoAnswer,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := []Option{WithTimeout(time.Hour)}
+			if test.judge != nil {
+				opts = append(opts, WithJudge(test.judge))
+			}
+			eg := NewEngine(testEngine{replies: test.replies}, monitor.NewTestLogger(false), opts...)
+			members := []Member{
+				{AgentID: "agent-a", Thread: &testThread{id: "a"}},
+				{AgentID: "agent-b", Thread: &testThread{id: "b"}},
+				{AgentID: "agent-c", Thread: &testThread{id: "c"}},
+			}
+
+			got, err := eg.Query(context.TODO(), user.Query{Text: "Which city?"}, members, test.strategy, 50*time.Millisecond)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Engine.Query() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got.Text != test.want {
+				t.Errorf("Engine.Query() = %q, want %q", got.Text, test.want)
+			}
+			if len(got.Answers) != len(members) {
+				t.Fatalf("Engine.Query() answers = %v, want %v", len(got.Answers), len(members))
+			}
+			var failed, partial int
+			for i, a := range got.Answers {
+				if a.AgentID != members[i].AgentID || a.ThreadID != members[i].Thread.ID() {
+					t.Errorf("Engine.Query() answer %v of %s on %s", i, a.AgentID, a.ThreadID)
+				}
+				if a.Err != nil {
+					failed++
+				}
+				if a.Partial {
+					partial++
+				}
+			}
+			if failed != test.wantFailed {
+				t.Errorf("Engine.Query() failed = %v, want %v", failed, test.wantFailed)
+			}
+			if partial != test.wantPartial {
+				t.Errorf("Engine.Query() partial = %v, want %v", partial, test.wantPartial)
+			}
+		})
+	}
+}
+
+func TestEngine_QueryPending(t *testing.T) {
+	t.Parallel()
+
+	approvals := inmem.NewApprovalDB()
+	calls := []tool.Call{{ID: "1", Name: "delete_user", Arguments: `{"id":"42"}`}}
+	req := approval.MakeRequest(calls, "", 0, func(tool.Call) bool { return true })
+	req.Blocked = []tool.Response{{ID: "2", Err: &tool.Error{Kind: tool.ErrBlocked, Message: "not allowed"}}}
+	id, err := approvals.Add(req)
+	if err != nil {
+		t.Fatalf("add approval: %s", err.Error())
+	}
+	req.ID = id
+
+	replies := map[string]reply{
+		"a": {text: "Paris"},
+		"b": {err: &engine.PendingError{Request: req}},
+	}
+	eg := NewEngine(testEngine{replies: replies}, monitor.NewTestLogger(false), WithApprovals(approvals))
+	thread := &testThread{id: "b"}
+	members := []Member{
+		{AgentID: "agent-a", Thread: &testThread{id: "a"}},
+		{AgentID: "agent-b", Thread: thread},
+	}
+
+	got, err := eg.Query(context.TODO(), user.Query{Text: "Which city?"}, members, StrategyConcat, time.Second)
+	if err != nil {
+		t.Fatalf("Engine.Query() error = %v", err)
+	}
+	if got.Answers[1].Err == nil {
+		t.Error("Engine.Query() pending agent without error")
+	}
+	if _, err := approvals.Get(id); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("Engine.Query() approval error = %v, want %v", err, db.ErrNotFound)
+	}
+	var ids []string
+	for _, p := range thread.recorded {
+		if resp, ok := p.Tool(); ok && resp.Err != nil && resp.Err.Kind == tool.ErrBlocked {
+			ids = append(ids, resp.ID)
+		}
+	}
+	if want := []string{"1", "2"}; !slices.Equal(ids, want) {
+		t.Errorf("Engine.Query() recorded = %v, want %v", ids, want)
+	}
+}
+
+func TestEngine_QueryInvalid(t *testing.T) {
+	t.Parallel()
+
+	members := []Member{{AgentID: "agent-a", Thread: &testThread{id: "a"}}}
+	tests := []struct {
+		name     string
+		members  []Member
+		strategy Strategy
+	}{
+		{
+			name:     "no members",
+			strategy: StrategyMajority,
+		},
+		{
+			name:     "unknown strategy",
+			members:  members,
+			strategy: "random",
+		},
+		{
+			name:     "judge without reasoner",
+			members:  members,
+			strategy: StrategyJudge,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			eg := NewEngine(testEngine{}, monitor.NewTestLogger(false))
+			_, err := eg.Query(context.TODO(), user.Query{Text: "Which city?"}, test.members, test.strategy, 0)
+			if err == nil {
+				t.Error("Engine.Query() error = nil, want error")
+			}
+		})
+	}
+}
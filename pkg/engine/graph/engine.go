@@ -0,0 +1,388 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/approval"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/ids"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/percept"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/user"
+)
+
+var _ engine.Engine = (*Engine)(nil)
+
+// Engine executes a declared Graph for every query. Agent nodes are queried through an
+// inner engine, e.g. a loop.Engine, tool nodes are called directly.
+type Engine struct {
+	graph  Graph
+	inner  engine.Engine
+	actor  *action.Actor
+	agents db.Agent
+	// approvals is the store of the approval requests of the inner engine.
+	approvals db.Approval
+	tr        trace.Tracer
+	log       *slog.Logger
+}
+
+type Option func(eg *Engine)
+
+// WithAgents sets the store of the agents named by agent nodes. Without a store, agent
+// nodes can only query the agent of the query.
+func WithAgents(agents db.Agent) Option {
+	return func(eg *Engine) {
+		eg.agents = agents
+	}
+}
+
+// WithApprovals sets the store of the approval requests of the inner engine. Requests
+// of agent nodes are deleted, since approvals are not supported in graphs.
+func WithApprovals(approvals db.Approval) Option {
+	return func(eg *Engine) {
+		eg.approvals = approvals
+	}
+}
+
+// NewEngine returns an Engine for the given graph. An error is returned if the graph is
+// invalid.
+func NewEngine(graph Graph, inner engine.Engine, actor *action.Actor, log *slog.Logger, options ...Option) (*Engine, error) {
+	err := graph.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("validate graph: %w", err)
+	}
+	eg := &Engine{
+		graph: graph,
+		inner: inner,
+		actor: actor,
+		tr:    monitor.Tracer("GraphEngine"),
+		log:   log,
+	}
+	for _, opt := range options {
+		opt(eg)
+	}
+	return eg, nil
+}
+
+// run is the state of a single execution of the graph.
+type run struct {
+	query   string
+	agent   agent.Agent
+	opts    engine.Options
+	outputs map[string]string
+	skipped map[string]bool
+	// gated are the nodes a condition node decided not to run.
+	gated map[string]bool
+	mu    sync.Mutex
+	// agentMu serializes the agent nodes querying the agent of the query, since the
+	// agent may keep a history.
+	agentMu sync.Mutex
+}
+
+// Query executes the graph for the given query and returns the rendered output.
+// Nodes run as soon as the nodes they depend on are done. The first failing node
+// fails the query.
+func (eg *Engine) Query(ctx context.Context, query user.Query, agent agent.Agent, opts ...engine.Option) (string, error) {
+	ctx, span := eg.tr.Start(ctx, "Query graph")
+	defer span.End()
+
+	o := engine.MakeOptions(opts...)
+	if !o.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, o.Deadline)
+		defer cancel()
+	}
+	r := &run{
+		query:   query.Text,
+		agent:   agent,
+		opts:    o,
+		outputs: make(map[string]string, len(eg.graph.Nodes)),
+		skipped: make(map[string]bool),
+		gated:   make(map[string]bool),
+	}
+	eg.log.Info("query graph", "method", "Query", "nodes", len(eg.graph.Nodes), "traceID", monitor.TraceID(span))
+
+	err := eg.execute(ctx, r)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		event := engine.MakeEvent(engine.EventError, 0)
+		event.Err = err
+		o.Publish(event)
+		return "", err
+	}
+
+	res, err := eg.output(r)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return "", fmt.Errorf("render output: %w", err)
+	}
+	event := engine.MakeEvent(engine.EventAnswer, 0)
+	event.Text = res
+	o.Publish(event)
+	return res, nil
+}
+
+// execute runs every node in its own goroutine, which waits until the nodes it depends
+// on are done.
+func (eg *Engine) execute(ctx context.Context, r *run) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	deps := eg.graph.dependencies()
+	done := make(map[string]chan struct{}, len(eg.graph.Nodes))
+	for _, n := range eg.graph.Nodes {
+		done[n.ID] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+	for _, n := range eg.graph.Nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[n.ID])
+
+			for _, dep := range deps[n.ID] {
+				select {
+				case <-done[dep]:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			err := eg.node(ctx, r, n, deps[n.ID])
+			if err != nil {
+				cancel(fmt.Errorf("node %s: %w", n.ID, err))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := context.Cause(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// node runs the given node, unless a condition node gated it or all nodes it depends on
+// have been skipped.
+func (eg *Engine) node(ctx context.Context, r *run, n Node, deps []string) error {
+	ctx, span := eg.tr.Start(ctx, "node "+n.ID)
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("node.id", n.ID),
+		attribute.String("node.kind", string(n.Kind)))
+
+	if r.skip(n.ID, deps) {
+		span.SetAttributes(attribute.Bool("node.skipped", true))
+		eg.log.Debug("skip node", "method", "node", "nodeID", n.ID, "traceID", monitor.TraceID(span))
+		return nil
+	}
+	eg.log.Debug("run node", "method", "node", "nodeID", n.ID, "kind", n.Kind, "traceID", monitor.TraceID(span))
+
+	var out string
+	var err error
+	switch n.Kind {
+	case KindAgent:
+		out, err = eg.ask(ctx, r, n)
+	case KindTool:
+		out, err = eg.call(ctx, r, n)
+	case KindCondition:
+		out, err = eg.decide(r, n)
+	case KindJoin:
+		out, err = render(n.ID, n.Template, r.data())
+	default:
+		err = fmt.Errorf("kind %s not supported", n.Kind)
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	r.mu.Lock()
+	r.outputs[n.ID] = out
+	r.mu.Unlock()
+	return nil
+}
+
+// ask queries the agent of the node with the rendered prompt.
+func (eg *Engine) ask(ctx context.Context, r *run, n Node) (string, error) {
+	prompt, err := render(n.ID, n.Prompt, r.data())
+	if err != nil {
+		return "", fmt.Errorf("render prompt: %w", err)
+	}
+
+	var opts []engine.Option
+	if r.opts.Subscriber != nil {
+		// The answer and error of the graph are published by the graph itself.
+		opts = append(opts, engine.WithSubscriber(engine.SubscriberFunc(func(event engine.Event) {
+			if event.Type != engine.EventAnswer && event.Type != engine.EventError {
+				r.opts.Publish(event)
+			}
+		})))
+	}
+	if r.opts.MaxIter > 0 {
+		opts = append(opts, engine.WithMaxIter(r.opts.MaxIter))
+	}
+	if !r.opts.Deadline.IsZero() {
+		opts = append(opts, engine.WithDeadline(r.opts.Deadline))
+	}
+
+	ag := r.agent
+	if n.Agent == "" {
+		r.agentMu.Lock()
+		defer r.agentMu.Unlock()
+	} else {
+		if eg.agents == nil {
+			return "", fmt.Errorf("no agent store for agent %s", n.Agent)
+		}
+		def, err := eg.agents.Get(n.Agent)
+		if err != nil {
+			return "", fmt.Errorf("get agent %s: %w", n.Agent, err)
+		}
+		ag = def.NewThread(ids.UniqueThread())
+	}
+
+	res, err := eg.inner.Query(ctx, user.Query{Text: prompt}, ag, opts...)
+	var pendingErr *engine.PendingError
+	if errors.As(err, &pendingErr) {
+		eg.abandon(ag, pendingErr.Request)
+		return "", fmt.Errorf("query agent: approvals not supported in graphs")
+	}
+	if err != nil {
+		return "", fmt.Errorf("query agent: %w", err)
+	}
+	return res, nil
+}
+
+// abandon deletes the approval request of a suspended agent query and answers its calls
+// on the thread of the agent, so that the thread can be queried again.
+func (eg *Engine) abandon(ag agent.Agent, req approval.Request) {
+	if eg.approvals != nil {
+		if err := eg.approvals.Delete(req.ID); err != nil {
+			eg.log.Error("delete approval", "method", "abandon", "approvalID", req.ID, "error", err.Error())
+		}
+	}
+
+	recorder, ok := ag.(agent.Recorder)
+	if !ok {
+		return
+	}
+	percepts := make([]percept.Percept, 0, len(req.Calls)+len(req.Blocked))
+	for _, c := range req.Calls {
+		percepts = append(percepts, percept.MakeToolError(c.Call.ID, &tool.Error{
+			Kind:    tool.ErrBlocked,
+			Message: "The call was not executed, approvals are not supported in graphs.",
+		}))
+	}
+	for _, resp := range req.Blocked {
+		percepts = append(percepts, percept.MakeToolResponse(resp))
+	}
+	recorder.Record(percepts)
+}
+
+// call calls the tool of the node with the rendered arguments and returns the content
+// of the response.
+func (eg *Engine) call(ctx context.Context, r *run, n Node) (string, error) {
+	args, err := render(n.ID, n.Arguments, r.data())
+	if err != nil {
+		return "", fmt.Errorf("render arguments: %w", err)
+	}
+	call := tool.Call{ID: n.ID, Name: n.Tool, Arguments: args}
+	if eg.actor.NeedsApproval(ctx, call) {
+		return "", fmt.Errorf("tool %s needs approval, not supported in graphs", n.Tool)
+	}
+
+	percepts, err := eg.actor.Act(ctx, action.MakeTool([]tool.Call{call}, ""))
+	if err != nil {
+		return "", fmt.Errorf("act: %w", err)
+	}
+	resp, ok := percepts[0].Tool()
+	if !ok {
+		return "", fmt.Errorf("percept is not of type tool")
+	}
+	if resp.Err != nil {
+		return "", fmt.Errorf("call tool %s: %w", n.Tool, resp.Err)
+	}
+	return resp.Content, nil
+}
+
+// decide renders the condition of the node and gates the nodes of the branch not taken.
+func (eg *Engine) decide(r *run, n Node) (string, error) {
+	res, err := render(n.ID, n.If, r.data())
+	if err != nil {
+		return "", fmt.Errorf("render condition: %w", err)
+	}
+	taken := strings.TrimSpace(res) == "true"
+	gated := n.Else
+	if !taken {
+		gated = n.Then
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range gated {
+		r.gated[id] = true
+	}
+	return fmt.Sprint(taken), nil
+}
+
+// output renders the output of the graph. Without an output template, the output of the
+// last declared node which ran is returned.
+func (eg *Engine) output(r *run) (string, error) {
+	if eg.graph.Output != "" {
+		return render("output", eg.graph.Output, r.data())
+	}
+	for i := len(eg.graph.Nodes) - 1; i >= 0; i-- {
+		id := eg.graph.Nodes[i].ID
+		if !r.skipped[id] {
+			return r.outputs[id], nil
+		}
+	}
+	return "", nil
+}
+
+// skip reports and records whether the node with the given id is skipped, because a
+// condition node gated it or all nodes it depends on have been skipped.
+func (r *run) skip(id string, deps []string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	skip := r.gated[id]
+	if !skip && len(deps) > 0 {
+		skip = true
+		for _, dep := range deps {
+			if !r.skipped[dep] {
+				skip = false
+				break
+			}
+		}
+	}
+	if skip {
+		r.skipped[id] = true
+	}
+	return skip
+}
+
+// data returns the template data with the outputs of all nodes done so far.
+func (r *run) data() data {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return data{Query: r.query, Nodes: maps.Clone(r.outputs)}
+}
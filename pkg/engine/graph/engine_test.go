@@ -0,0 +1,246 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/agent/function"
+	agentMock "github.com/Br0ce/opera/pkg/agent/mock"
+	"github.com/Br0ce/opera/pkg/approval"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/db/inmem"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/history"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	toolMock "github.com/Br0ce/opera/pkg/tool/mock"
+	transportMock "github.com/Br0ce/opera/pkg/transport/mock"
+	"github.com/Br0ce/opera/pkg/user"
+)
+
+// innerEngine answers agent nodes with the answer of the first prompt prefix matching
+// the query.
+type innerEngine struct {
+	answers map[string]string
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (ie *innerEngine) Query(_ context.Context, query user.Query, _ agent.Agent, _ ...engine.Option) (string, error) {
+	ie.mu.Lock()
+	defer ie.mu.Unlock()
+
+	ie.prompts = append(ie.prompts, query.Text)
+	for prefix, answer := range ie.answers {
+		if strings.HasPrefix(query.Text, prefix) {
+			return answer, nil
+		}
+	}
+	return "", errors.New("unexpected prompt")
+}
+
+func testTool(t *testing.T, name string) tool.Tool {
+	t.Helper()
+
+	to, err := tool.MakeTool(
+		tool.WithName(name),
+		tool.WithDescription(name),
+		tool.WithAddr(url.URL{Scheme: "http", Host: name}),
+		tool.WithParameters(map[string]any{
+			"location": map[string]any{
+				"type": "string",
+			},
+		}, []string{"location"}),
+	)
+	if err != nil {
+		t.Fatalf("make tool: %s", err.Error())
+	}
+	return to
+}
+
+// testActor returns an Actor whose tools answer with the content of the given map keyed
+// by tool name. The arguments of all calls are recorded in args.
+func testActor(t *testing.T, contents map[string]string, args map[string]string) *action.Actor {
+	t.Helper()
+
+	var tools []tool.Tool
+	for name := range contents {
+		tools = append(tools, testTool(t, name))
+	}
+	discovery := &toolMock.Discovery{
+		GetFn: func(_ context.Context, name string) (tool.Tool, error) {
+			for _, to := range tools {
+				if to.Name() == name {
+					return to, nil
+				}
+			}
+			return tool.Tool{}, errors.New("not found")
+		},
+	}
+	var mu sync.Mutex
+	trans := &transportMock.Transporter{
+		DoFn: func(_ context.Context, _ string, addr string, _ map[string][]string, body io.Reader) ([]byte, error) {
+			u, err := url.Parse(addr)
+			if err != nil {
+				return nil, err
+			}
+			bb, err := io.ReadAll(body)
+			if err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			args[u.Host] = string(bb)
+			mu.Unlock()
+			return []byte(contents[u.Host]), nil
+		},
+	}
+	return action.NewActor(discovery, trans, monitor.NewTestLogger(false))
+}
+
+func TestEngine_Query(t *testing.T) {
+	t.Parallel()
+
+	g, err := ReadFile("../../../data/graphs/surf.yaml")
+	if err != nil {
+		t.Fatalf("read graph: %s", err.Error())
+	}
+
+	tests := []struct {
+		name        string
+		shark       string
+		want        string
+		wantPrompts int
+	}{
+		{
+			name:        "low warning",
+			shark:       "Level low",
+			want:        "Go surfing.",
+			wantPrompts: 2,
+		},
+		{
+			name:        "high warning",
+			shark:       "Level HIGH",
+			want:        "Stay out of the water at Lisbon, the shark warning level is high.",
+			wantPrompts: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := make(map[string]string)
+			actor := testActor(t, map[string]string{
+				"get_weather":       "sunny",
+				"get_shark_warning": test.shark,
+			}, args)
+			inner := &innerEngine{answers: map[string]string{
+				"Name only the location": " Lisbon\n",
+				"Weather: sunny":         "Go surfing.",
+			}}
+			eg, err := NewEngine(g, inner, actor, monitor.NewTestLogger(false))
+			if err != nil {
+				t.Fatalf("NewEngine() error = %v", err)
+			}
+
+			got, err := eg.Query(context.TODO(), user.Query{Text: "Can I surf in Lisbon?"}, &agentMock.Agent{})
+			if err != nil {
+				t.Fatalf("Engine.Query() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("Engine.Query() = %v, want %v", got, test.want)
+			}
+			if len(inner.prompts) != test.wantPrompts {
+				t.Errorf("Engine.Query() prompts = %v, want %v", len(inner.prompts), test.wantPrompts)
+			}
+			for _, name := range []string{"get_weather", "get_shark_warning"} {
+				if args[name] != `{"location": "Lisbon"}` {
+					t.Errorf("Engine.Query() %s arguments = %v, want %v", name, args[name], `{"location": "Lisbon"}`)
+				}
+			}
+		})
+	}
+}
+
+func TestEngine_QueryFailure(t *testing.T) {
+	t.Parallel()
+
+	g := Graph{Nodes: []Node{
+		{ID: "a", Kind: KindTool, Tool: "unknown", Arguments: "{}"},
+		{ID: "b", Kind: KindAgent, Prompt: "{{.Nodes.a}}", DependsOn: []string{"a"}},
+	}}
+	inner := &innerEngine{}
+	eg, err := NewEngine(g, inner, testActor(t, nil, nil), monitor.NewTestLogger(false))
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+
+	_, err = eg.Query(context.TODO(), user.Query{Text: "question"}, &agentMock.Agent{})
+	var toolErr *tool.Error
+	if !errors.As(err, &toolErr) || toolErr.Kind != tool.ErrNotFound {
+		t.Errorf("Engine.Query() error = %v, want tool error %v", err, tool.ErrNotFound)
+	}
+	if len(inner.prompts) != 0 {
+		t.Errorf("Engine.Query() prompts = %v, want none", len(inner.prompts))
+	}
+}
+
+// pendingEngine suspends every query for an approval of a call.
+type pendingEngine struct {
+	approvals *inmem.Approval
+	ids       []string
+}
+
+func (pe *pendingEngine) Query(_ context.Context, _ user.Query, _ agent.Agent, _ ...engine.Option) (string, error) {
+	req := approval.MakeRequest([]tool.Call{{ID: "1", Name: "delete_user"}}, "", 0, func(tool.Call) bool {
+		return true
+	})
+	req.Blocked = []tool.Response{{ID: "2", Err: &tool.Error{Kind: tool.ErrBlocked, Message: "blocked"}}}
+	id, err := pe.approvals.Add(req)
+	if err != nil {
+		return "", err
+	}
+	req.ID = id
+	pe.ids = append(pe.ids, id)
+	return "", &engine.PendingError{Request: req}
+}
+
+func TestEngine_QueryPending(t *testing.T) {
+	t.Parallel()
+
+	log := monitor.NewTestLogger(false)
+	g := Graph{Nodes: []Node{{ID: "a", Kind: KindAgent, Prompt: "delete the user"}}}
+	approvals := inmem.NewApprovalDB()
+	inner := &pendingEngine{approvals: approvals}
+	eg, err := NewEngine(g, inner, testActor(t, nil, nil), log, WithApprovals(approvals))
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	thread := function.NewAgent("", nil, nil, log).NewThread("thread-1")
+
+	_, err = eg.Query(context.TODO(), user.Query{Text: "question"}, thread)
+	if err == nil {
+		t.Fatal("Engine.Query() error = nil, want error")
+	}
+	for _, id := range inner.ids {
+		if _, err := approvals.Get(id); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Engine.Query() kept approval %s", id)
+		}
+	}
+
+	hist := thread.History()
+	var callIDs []string
+	for _, e := range hist.All() {
+		if resp, ok := e.(history.ToolResponse); ok {
+			callIDs = append(callIDs, resp.Content.ID)
+		}
+	}
+	if !slices.Equal(callIDs, []string{"1", "2"}) {
+		t.Errorf("Engine.Query() responses = %v, want %v", callIDs, []string{"1", "2"})
+	}
+}
@@ -0,0 +1,213 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kind is the kind of work a Node does.
+type Kind string
+
+const (
+	// KindAgent queries an agent with the rendered Prompt.
+	KindAgent Kind = "agent"
+	// KindTool calls the Tool with the rendered Arguments.
+	KindTool Kind = "tool"
+	// KindCondition renders If and runs the nodes in Then if the result is "true",
+	// otherwise the nodes in Else.
+	KindCondition Kind = "condition"
+	// KindJoin renders Template, e.g. to combine the outputs of parallel branches.
+	KindJoin Kind = "join"
+)
+
+// Graph declares a workflow as directed acyclic graph of nodes. Nodes whose
+// dependencies are done run in parallel.
+type Graph struct {
+	Nodes []Node `json:"Nodes" yaml:"Nodes"`
+	// Output is the template of the answer. If empty, the answer is the output of the
+	// last declared node which ran.
+	Output string `json:"Output" yaml:"Output"`
+}
+
+// Node is a step of a Graph. The output of a node is available to the templates of
+// later nodes as {{.Nodes.<ID>}}, the query as {{.Query}}.
+type Node struct {
+	ID   string `json:"ID" yaml:"ID"`
+	Kind Kind   `json:"Kind" yaml:"Kind"`
+	// DependsOn are the ids of the nodes which must be done before the node runs.
+	DependsOn []string `json:"DependsOn" yaml:"DependsOn"`
+	// Agent is the id of the agent queried by an agent node. If empty, the agent of
+	// the query is used.
+	Agent  string `json:"Agent" yaml:"Agent"`
+	Prompt string `json:"Prompt" yaml:"Prompt"`
+	// Tool is the name of the tool called by a tool node with the Arguments, a
+	// template of a JSON object.
+	Tool      string `json:"Tool" yaml:"Tool"`
+	Arguments string `json:"Arguments" yaml:"Arguments"`
+	If        string `json:"If" yaml:"If"`
+	// Then and Else are the ids of the nodes run or skipped by a condition node. They
+	// depend on the condition node implicitly.
+	Then     []string `json:"Then" yaml:"Then"`
+	Else     []string `json:"Else" yaml:"Else"`
+	Template string   `json:"Template" yaml:"Template"`
+}
+
+// ReadFile reads the graph of the given file. Files with a .yaml or .yml extension are
+// decoded as YAML, all other files as JSON.
+func ReadFile(filename string) (Graph, error) {
+	bb, err := os.ReadFile(filename)
+	if err != nil {
+		return Graph{}, fmt.Errorf("read file %s: %w", filename, err)
+	}
+
+	var g Graph
+	switch filepath.Ext(filename) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(bb, &g)
+	default:
+		err = json.Unmarshal(bb, &g)
+	}
+	if err != nil {
+		return Graph{}, fmt.Errorf("unmarshal graph: %w", err)
+	}
+	return g, nil
+}
+
+// Validate reports an error if a node is incomplete, depends on an unknown node, a
+// template does not parse or the graph has a cycle.
+func (g Graph) Validate() error {
+	if len(g.Nodes) == 0 {
+		return fmt.Errorf("no nodes")
+	}
+	nodes := make(map[string]Node, len(g.Nodes))
+	for _, n := range g.Nodes {
+		if n.ID == "" {
+			return fmt.Errorf("node ID invalid")
+		}
+		if _, ok := nodes[n.ID]; ok {
+			return fmt.Errorf("node %s declared twice", n.ID)
+		}
+		err := n.validate()
+		if err != nil {
+			return fmt.Errorf("node %s: %w", n.ID, err)
+		}
+		nodes[n.ID] = n
+	}
+
+	for id, deps := range g.dependencies() {
+		if _, ok := nodes[id]; !ok {
+			return fmt.Errorf("unknown node %s", id)
+		}
+		for _, dep := range deps {
+			if _, ok := nodes[dep]; !ok {
+				return fmt.Errorf("node %s: unknown node %s", id, dep)
+			}
+		}
+	}
+	err := g.acyclic()
+	if err != nil {
+		return err
+	}
+
+	_, err = parse("output", g.Output)
+	if err != nil {
+		return fmt.Errorf("output: %w", err)
+	}
+	return nil
+}
+
+func (n Node) validate() error {
+	var tmpl string
+	switch n.Kind {
+	case KindAgent:
+		if n.Prompt == "" {
+			return fmt.Errorf("Prompt invalid")
+		}
+		tmpl = n.Prompt
+	case KindTool:
+		if n.Tool == "" {
+			return fmt.Errorf("Tool invalid")
+		}
+		tmpl = n.Arguments
+	case KindCondition:
+		if n.If == "" {
+			return fmt.Errorf("If invalid")
+		}
+		tmpl = n.If
+	case KindJoin:
+		if n.Template == "" {
+			return fmt.Errorf("Template invalid")
+		}
+		tmpl = n.Template
+	default:
+		return fmt.Errorf("kind %s not supported", n.Kind)
+	}
+	_, err := parse(n.ID, tmpl)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// dependencies returns the ids of the nodes each node depends on, including the implicit
+// dependencies on condition nodes.
+func (g Graph) dependencies() map[string][]string {
+	deps := make(map[string][]string, len(g.Nodes))
+	for _, n := range g.Nodes {
+		deps[n.ID] = append(deps[n.ID], n.DependsOn...)
+		for _, id := range slices.Concat(n.Then, n.Else) {
+			deps[id] = append(deps[id], n.ID)
+		}
+	}
+	return deps
+}
+
+// acyclic reports an error if the graph has a cycle.
+func (g Graph) acyclic() error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	deps := g.dependencies()
+	state := make(map[string]int, len(deps))
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("cycle at node %s", id)
+		case visited:
+			return nil
+		}
+		state[id] = visiting
+		for _, dep := range deps[id] {
+			err := visit(dep)
+			if err != nil {
+				return err
+			}
+		}
+		state[id] = visited
+		return nil
+	}
+	for _, n := range g.Nodes {
+		err := visit(n.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parse parses the given text as template.
+func parse(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,137 @@
+package graph
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGraph_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		graph   string
+		wantErr bool
+	}{
+		{
+			name: "pass",
+			graph: `{"Nodes":[
+				{"ID":"a","Kind":"agent","Prompt":"{{.Query}}"},
+				{"ID":"b","Kind":"tool","Tool":"get_names","Arguments":"{\"location\":{{json .Nodes.a}}}","DependsOn":["a"]},
+				{"ID":"c","Kind":"condition","If":"{{contains .Nodes.b \"x\"}}","Then":["d"],"DependsOn":["b"]},
+				{"ID":"d","Kind":"join","Template":"{{.Nodes.a}} {{.Nodes.b}}"}
+			],"Output":"{{.Nodes.d}}"}`,
+		},
+		{
+			name:    "no nodes",
+			graph:   `{"Nodes":[]}`,
+			wantErr: true,
+		},
+		{
+			name:    "duplicate id",
+			graph:   `{"Nodes":[{"ID":"a","Kind":"join","Template":"x"},{"ID":"a","Kind":"join","Template":"y"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown kind",
+			graph:   `{"Nodes":[{"ID":"a","Kind":"loop"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "missing prompt",
+			graph:   `{"Nodes":[{"ID":"a","Kind":"agent"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown dependency",
+			graph:   `{"Nodes":[{"ID":"a","Kind":"join","Template":"x","DependsOn":["b"]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown branch",
+			graph:   `{"Nodes":[{"ID":"a","Kind":"condition","If":"true","Then":["b"]}]}`,
+			wantErr: true,
+		},
+		{
+			name: "cycle",
+			graph: `{"Nodes":[
+				{"ID":"a","Kind":"join","Template":"x","DependsOn":["b"]},
+				{"ID":"b","Kind":"join","Template":"y","DependsOn":["a"]}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid template",
+			graph:   `{"Nodes":[{"ID":"a","Kind":"join","Template":"{{.Nodes.a"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid output",
+			graph:   `{"Nodes":[{"ID":"a","Kind":"join","Template":"x"}],"Output":"{{end}}"}`,
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var g Graph
+			err := json.Unmarshal([]byte(test.graph), &g)
+			if err != nil {
+				t.Fatalf("unmarshal graph: %s", err.Error())
+			}
+			err = g.Validate()
+			if (err != nil) != test.wantErr {
+				t.Errorf("Graph.Validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		filename  string
+		content   string
+		wantNodes int
+		wantErr   bool
+	}{
+		{
+			name:      "json",
+			filename:  "graph.json",
+			content:   `{"Nodes":[{"ID":"a","Kind":"agent","Prompt":"{{.Query}}"}]}`,
+			wantNodes: 1,
+		},
+		{
+			name:      "yaml",
+			filename:  "graph.yaml",
+			content:   "Nodes:\n  - ID: a\n    Kind: agent\n    Prompt: \"{{.Query}}\"\n  - ID: b\n    Kind: join\n    DependsOn: [a]\n    Template: \"{{.Nodes.a}}\"\n",
+			wantNodes: 2,
+		},
+		{
+			name:     "invalid",
+			filename: "graph.json",
+			content:  `{"Nodes":`,
+			wantErr:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), test.filename)
+			err := os.WriteFile(filename, []byte(test.content), 0o600)
+			if err != nil {
+				t.Fatalf("write file: %s", err.Error())
+			}
+
+			g, err := ReadFile(filename)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ReadFile() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if len(g.Nodes) != test.wantNodes {
+				t.Errorf("ReadFile() nodes = %v, want %v", len(g.Nodes), test.wantNodes)
+			}
+		})
+	}
+}
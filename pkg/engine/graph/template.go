@@ -0,0 +1,45 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// funcs are the functions available in the templates of a graph.
+var funcs = template.FuncMap{
+	"contains": strings.Contains,
+	"lower":    strings.ToLower,
+	"trim":     strings.TrimSpace,
+	"json":     toJSON,
+}
+
+// data is the data the templates of a graph are executed with.
+type data struct {
+	Query string
+	Nodes map[string]string
+}
+
+// render executes the template text with the given data.
+func render(name, text string, d data) (string, error) {
+	tmpl, err := parse(name, text)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	err = tmpl.Execute(&sb, d)
+	if err != nil {
+		return "", fmt.Errorf("execute template: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// toJSON returns v as JSON, e.g. to quote a node output in the arguments of a tool.
+func toJSON(v any) (string, error) {
+	bb, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(bb), nil
+}
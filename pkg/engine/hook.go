@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/percept"
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+// Stage names the point of a step at which a Hook is called.
+type Stage string
+
+const (
+	StageBeforeReason   Stage = "before_reason"
+	StageAfterReason    Stage = "after_reason"
+	StageBeforeToolCall Stage = "before_tool_call"
+	StageAfterToolCall  Stage = "after_tool_call"
+	StageOnAnswer       Stage = "on_answer"
+)
+
+// Step is the state of a step of a query, which hooks may inspect and modify.
+type Step struct {
+	Iter int
+	// Percepts are passed to the agent. AfterReason receives the percepts the agent has
+	// seen.
+	Percepts []percept.Percept
+	// Action is the action of the agent, set from AfterReason on.
+	Action action.Action
+}
+
+// Hook intercepts the steps of a query. Hooks may modify what they receive. An error
+// returned by BeforeReason, AfterReason or OnAnswer aborts the query with an
+// AbortError. An error returned by BeforeToolCall or AfterToolCall blocks the call,
+// the agent receives the error as tool response.
+// Embed NopHook to implement only some of the methods.
+type Hook interface {
+	BeforeReason(ctx context.Context, step *Step) error
+	AfterReason(ctx context.Context, step *Step) error
+	BeforeToolCall(ctx context.Context, call *tool.Call) error
+	AfterToolCall(ctx context.Context, call tool.Call, resp *tool.Response) error
+	OnAnswer(ctx context.Context, answer *string) error
+}
+
+// Hooked is implemented by agents bringing their own hooks, which run after the hooks of
+// the engine.
+type Hooked interface {
+	Hooks() []Hook
+}
+
+// NopHook is a Hook doing nothing.
+type NopHook struct{}
+
+func (NopHook) BeforeReason(context.Context, *Step) error { return nil }
+
+func (NopHook) AfterReason(context.Context, *Step) error { return nil }
+
+func (NopHook) BeforeToolCall(context.Context, *tool.Call) error { return nil }
+
+func (NopHook) AfterToolCall(context.Context, tool.Call, *tool.Response) error { return nil }
+
+func (NopHook) OnAnswer(context.Context, *string) error { return nil }
+
+// AbortError is returned if a hook aborted a query.
+type AbortError struct {
+	Stage Stage
+	Iter  int
+	Err   error
+}
+
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("aborted %s in step %v: %s", e.Stage, e.Iter, e.Err.Error())
+}
+
+func (e *AbortError) Unwrap() error {
+	return e.Err
+}
+
+// Hooks is a chain of hooks, called in order. The chain stops at the first error.
+type Hooks []Hook
+
+func (hh Hooks) BeforeReason(ctx context.Context, step *Step) error {
+	for _, h := range hh {
+		if err := h.BeforeReason(ctx, step); err != nil {
+			return &AbortError{Stage: StageBeforeReason, Iter: step.Iter, Err: err}
+		}
+	}
+	return nil
+}
+
+func (hh Hooks) AfterReason(ctx context.Context, step *Step) error {
+	for _, h := range hh {
+		if err := h.AfterReason(ctx, step); err != nil {
+			return &AbortError{Stage: StageAfterReason, Iter: step.Iter, Err: err}
+		}
+	}
+	return nil
+}
+
+func (hh Hooks) BeforeToolCall(ctx context.Context, call *tool.Call) error {
+	for _, h := range hh {
+		if err := h.BeforeToolCall(ctx, call); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (hh Hooks) AfterToolCall(ctx context.Context, call tool.Call, resp *tool.Response) error {
+	for _, h := range hh {
+		if err := h.AfterToolCall(ctx, call, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnAnswer calls the hooks for the answer of the given step.
+func (hh Hooks) OnAnswer(ctx context.Context, iter int, answer *string) error {
+	for _, h := range hh {
+		if err := h.OnAnswer(ctx, answer); err != nil {
+			return &AbortError{Stage: StageOnAnswer, Iter: iter, Err: err}
+		}
+	}
+	return nil
+}
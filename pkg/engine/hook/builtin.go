@@ -0,0 +1,43 @@
+package hook
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/Br0ce/opera/pkg/engine"
+)
+
+// Builtin returns the built-in hook with the given name, which can be log, redact,
+// clock or deny:<tool>. The deny hook blocks all calls to the named tool.
+func Builtin(name string, log *slog.Logger) (engine.Hook, error) {
+	if tool, ok := strings.CutPrefix(name, "deny:"); ok {
+		if tool == "" {
+			return nil, fmt.Errorf("hook %s has no tool", name)
+		}
+		return NewDeny(tool), nil
+	}
+	switch name {
+	case "log":
+		return NewLogger(log), nil
+	case "redact":
+		return NewRedactor(), nil
+	case "clock":
+		return NewClock(), nil
+	default:
+		return nil, fmt.Errorf("hook %s not supported", name)
+	}
+}
+
+// Builtins returns the built-in hooks with the given names.
+func Builtins(names []string, log *slog.Logger) ([]engine.Hook, error) {
+	hooks := make([]engine.Hook, 0, len(names))
+	for _, name := range names {
+		h, err := Builtin(name, log)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, nil
+}
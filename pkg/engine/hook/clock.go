@@ -0,0 +1,32 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/percept"
+)
+
+var _ engine.Hook = (*Clock)(nil)
+
+// Clock tells the agent the current time in the first step of a query, since models do
+// not know it.
+type Clock struct {
+	engine.NopHook
+	now func() time.Time
+}
+
+func NewClock() *Clock {
+	return &Clock{now: time.Now}
+}
+
+func (cl *Clock) BeforeReason(_ context.Context, step *engine.Step) error {
+	if step.Iter != 0 {
+		return nil
+	}
+	note := fmt.Sprintf("The current time is %s.", cl.now().UTC().Format(time.RFC1123))
+	step.Percepts = append(step.Percepts, percept.MakeSystem(note))
+	return nil
+}
@@ -0,0 +1,29 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+var _ engine.Hook = (*Deny)(nil)
+
+// Deny blocks all calls to the given tools.
+type Deny struct {
+	engine.NopHook
+	tools []string
+}
+
+func NewDeny(tools ...string) *Deny {
+	return &Deny{tools: tools}
+}
+
+func (de *Deny) BeforeToolCall(_ context.Context, call *tool.Call) error {
+	if slices.Contains(de.tools, call.Name) {
+		return fmt.Errorf("tool %s is not allowed", call.Name)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package hook
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/percept"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/user"
+)
+
+func TestRedactor(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		patterns []*regexp.Regexp
+		content  string
+		want     string
+	}{
+		{
+			name:    "email",
+			content: "Contact jane.doe@example.com for details.",
+			want:    "Contact [redacted] for details.",
+		},
+		{
+			name:    "api key",
+			content: "token sk-abcdefghijklmnop1234 leaked",
+			want:    "token [redacted] leaked",
+		},
+		{
+			name:    "nothing to redact",
+			content: "The weather in Sydney is sunny.",
+			want:    "The weather in Sydney is sunny.",
+		},
+		{
+			name:     "custom pattern",
+			patterns: []*regexp.Regexp{regexp.MustCompile(`\d{4}`)},
+			content:  "PIN 1234",
+			want:     "PIN [redacted]",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			re := NewRedactor(test.patterns...)
+
+			resp := tool.Response{ID: "1", Content: test.content}
+			err := re.AfterToolCall(context.TODO(), tool.Call{ID: "1"}, &resp)
+			if err != nil {
+				t.Fatalf("Redactor.AfterToolCall() error = %v", err)
+			}
+			if resp.Content != test.want {
+				t.Errorf("Redactor.AfterToolCall() = %v, want %v", resp.Content, test.want)
+			}
+
+			answer := test.content
+			err = re.OnAnswer(context.TODO(), &answer)
+			if err != nil {
+				t.Fatalf("Redactor.OnAnswer() error = %v", err)
+			}
+			if answer != test.want {
+				t.Errorf("Redactor.OnAnswer() = %v, want %v", answer, test.want)
+			}
+		})
+	}
+}
+
+func TestDeny_BeforeToolCall(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		call    tool.Call
+		wantErr bool
+	}{
+		{
+			name: "allowed",
+			call: tool.Call{ID: "1", Name: "get_weather"},
+		},
+		{
+			name:    "denied",
+			call:    tool.Call{ID: "1", Name: "delete_user"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := NewDeny("delete_user").BeforeToolCall(context.TODO(), &test.call)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Deny.BeforeToolCall() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestClock_BeforeReason(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		iter         int
+		wantPercepts int
+	}{
+		{
+			name:         "first step",
+			iter:         0,
+			wantPercepts: 2,
+		},
+		{
+			name:         "later step",
+			iter:         1,
+			wantPercepts: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cl := NewClock()
+			cl.now = func() time.Time { return time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+			step := engine.Step{Iter: test.iter, Percepts: []percept.Percept{percept.MakeUser(user.Query{Text: "question"})}}
+			err := cl.BeforeReason(context.TODO(), &step)
+			if err != nil {
+				t.Fatalf("Clock.BeforeReason() error = %v", err)
+			}
+			if len(step.Percepts) != test.wantPercepts {
+				t.Fatalf("Clock.BeforeReason() percepts = %v, want %v", len(step.Percepts), test.wantPercepts)
+			}
+			if test.wantPercepts == 2 {
+				got, ok := step.Percepts[1].System()
+				if !ok || got != "The current time is Sat, 01 Mar 2025 12:00:00 UTC." {
+					t.Errorf("Clock.BeforeReason() note = %v", got)
+				}
+			}
+		})
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		names   []string
+		want    int
+		wantErr bool
+	}{
+		{
+			name:  "all",
+			names: []string{"log", "redact", "clock", "deny:shell"},
+			want:  4,
+		},
+		{
+			name:    "deny without tool",
+			names:   []string{"deny:"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown",
+			names:   []string{"log", "unknown"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Builtins(test.names, monitor.NewTestLogger(false))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Builtins() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if len(got) != test.want {
+				t.Errorf("Builtins() = %v hooks, want %v", len(got), test.want)
+			}
+		})
+	}
+}
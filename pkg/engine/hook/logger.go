@@ -0,0 +1,50 @@
+package hook
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+var _ engine.Hook = (*Logger)(nil)
+
+// Logger logs every stage of a query. Arguments, results and answers are only logged
+// at debug level.
+type Logger struct {
+	log *slog.Logger
+}
+
+func NewLogger(log *slog.Logger) *Logger {
+	return &Logger{log: log}
+}
+
+func (lo *Logger) BeforeReason(_ context.Context, step *engine.Step) error {
+	lo.log.Info("before reason", "method", "BeforeReason", "iterNum", step.Iter, "percepts", len(step.Percepts))
+	return nil
+}
+
+func (lo *Logger) AfterReason(_ context.Context, step *engine.Step) error {
+	calls, _ := step.Action.Tool()
+	lo.log.Info("after reason", "method", "AfterReason", "iterNum", step.Iter, "calls", len(calls))
+	return nil
+}
+
+func (lo *Logger) BeforeToolCall(_ context.Context, call *tool.Call) error {
+	lo.log.Info("before tool call", "method", "BeforeToolCall", "toolName", call.Name)
+	lo.log.Debug("tool call arguments", "method", "BeforeToolCall", "toolName", call.Name, "arguments", call.Arguments)
+	return nil
+}
+
+func (lo *Logger) AfterToolCall(_ context.Context, call tool.Call, resp *tool.Response) error {
+	lo.log.Info("after tool call", "method", "AfterToolCall", "toolName", call.Name, "failed", resp.Err != nil)
+	lo.log.Debug("tool call result", "method", "AfterToolCall", "toolName", call.Name, "content", resp.Content)
+	return nil
+}
+
+func (lo *Logger) OnAnswer(_ context.Context, answer *string) error {
+	lo.log.Info("answer", "method", "OnAnswer", "length", len(*answer))
+	lo.log.Debug("answer content", "method", "OnAnswer", "content", *answer)
+	return nil
+}
@@ -0,0 +1,52 @@
+package hook
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+var _ engine.Hook = (*Redactor)(nil)
+
+const redacted = "[redacted]"
+
+// DefaultPatterns match email addresses and common API key formats.
+var DefaultPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	regexp.MustCompile(`\b(sk|pk|ghp|xox[abp])[-_][A-Za-z0-9_-]{16,}\b`),
+}
+
+// Redactor masks matches of its patterns in tool results before the agent sees them and
+// in answers before the user sees them.
+type Redactor struct {
+	engine.NopHook
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor returns a Redactor for the given patterns. Without patterns, the
+// DefaultPatterns are used.
+func NewRedactor(patterns ...*regexp.Regexp) *Redactor {
+	if len(patterns) == 0 {
+		patterns = DefaultPatterns
+	}
+	return &Redactor{patterns: patterns}
+}
+
+func (re *Redactor) AfterToolCall(_ context.Context, _ tool.Call, resp *tool.Response) error {
+	resp.Content = re.redact(resp.Content)
+	return nil
+}
+
+func (re *Redactor) OnAnswer(_ context.Context, answer *string) error {
+	*answer = re.redact(*answer)
+	return nil
+}
+
+func (re *Redactor) redact(s string) string {
+	for _, p := range re.patterns {
+		s = p.ReplaceAllString(s, redacted)
+	}
+	return s
+}
@@ -0,0 +1,195 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/checkpoint"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/percept"
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+const interruptedMsg = "The call was interrupted, it is unknown whether it was executed. " +
+	"Check its effect before calling it again."
+
+// checkpointer persists the progress of a single query. A nil checkpointer does nothing.
+type checkpointer struct {
+	store   db.Checkpoint
+	id      string
+	agentID string
+	thread  agent.Thread
+	maxIter int
+	log     *slog.Logger
+}
+
+// checkpointer returns a checkpointer for the query with the given checkpoint id. If the
+// engine has no checkpoint store, the query has no AgentID or the agent is not a thread,
+// nil is returned.
+func (eg *Engine) checkpointer(ag agent.Agent, o engine.Options, id string) *checkpointer {
+	thread, ok := ag.(agent.Thread)
+	if eg.checkpoints == nil || o.AgentID == "" || !ok {
+		return nil
+	}
+	return &checkpointer{
+		store:   eg.checkpoints,
+		id:      id,
+		agentID: o.AgentID,
+		thread:  thread,
+		maxIter: eg.limit(ag, o),
+		log:     eg.log,
+	}
+}
+
+// acting checkpoints the query before the tool calls of the given action are dispatched.
+// The blocked percepts answer the calls of the step which the hooks blocked.
+func (c *checkpointer) acting(iter int, next action.Action, blocked []percept.Percept) {
+	c.set(iter, checkpoint.Acting, next, blocked)
+}
+
+// acted checkpoints the query once the results of the tool calls are known.
+func (c *checkpointer) acted(iter int, next action.Action, percepts []percept.Percept) {
+	c.set(iter, checkpoint.Acted, next, percepts)
+}
+
+func (c *checkpointer) set(iter int, phase checkpoint.Phase, next action.Action, percepts []percept.Percept) {
+	if c == nil {
+		return
+	}
+	err := c.store.Set(checkpoint.Checkpoint{
+		ID:            c.id,
+		AgentID:       c.agentID,
+		ThreadID:      c.thread.ID(),
+		Iter:          iter,
+		Phase:         phase,
+		Action:        next,
+		Percepts:      percepts,
+		History:       c.thread.History(),
+		ThreadCreated: c.thread.Created(),
+		MaxIter:       c.maxIter,
+		Updated:       time.Now().UTC(),
+	})
+	if err != nil {
+		// A missing checkpoint must not fail the query.
+		c.log.Error("set checkpoint", "method", "set", "id", c.id, "iterNum", iter, "error", err)
+	}
+}
+
+// done deletes the checkpoint of a finished query. The checkpoint of a query
+// interrupted by a shutdown, whose context is canceled with engine.ErrShutdown, is kept,
+// so that the query can be recovered. Queries canceled otherwise, e.g. by the user, are
+// finished.
+func (c *checkpointer) done(ctx context.Context) {
+	if c == nil || errors.Is(context.Cause(ctx), engine.ErrShutdown) {
+		return
+	}
+	err := c.store.Delete(c.id)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		c.log.Error("delete checkpoint", "method", "done", "id", c.id, "error", err)
+	}
+}
+
+// Recover resumes the query of the checkpoint with the given checkpointID. If the query
+// was interrupted while its tool calls were running, the calls to idempotent tools are
+// executed again. For all other calls the agent is told that they were interrupted.
+// The agent must be the restored thread of the checkpoint.
+func (eg *Engine) Recover(ctx context.Context, checkpointID string, agent agent.Agent, opts ...engine.Option) (string, error) {
+	ctx, span := eg.tr.Start(ctx, "Recover")
+	defer span.End()
+	span.SetAttributes(attribute.String("checkpoint.id", checkpointID))
+
+	o := eg.options(agent, opts)
+	res, err := eg.recover(ctx, checkpointID, agent, o)
+	publishErr(o, err)
+	return res, err
+}
+
+func (eg *Engine) recover(ctx context.Context, checkpointID string, agent agent.Agent, o engine.Options) (string, error) {
+	if eg.checkpoints == nil {
+		return "", fmt.Errorf("no checkpoint store")
+	}
+	cp, err := eg.checkpoints.Get(checkpointID)
+	if err != nil {
+		return "", fmt.Errorf("get checkpoint %s: %w", checkpointID, err)
+	}
+	if o.AgentID == "" {
+		o.AgentID = cp.AgentID
+	}
+	if o.MaxIter == 0 {
+		o.MaxIter = cp.MaxIter
+	}
+	eg.log.Info("recover query", "method", "recover", "checkpointID", cp.ID, "iterNum", cp.Iter, "phase", cp.Phase)
+
+	percepts := cp.Percepts
+	if cp.Phase == checkpoint.Acting {
+		percepts, err = eg.reAct(ctx, cp, o)
+		if err != nil {
+			return "", fmt.Errorf("act on checkpoint: %w", err)
+		}
+	}
+
+	c := eg.checkpointer(agent, o, cp.ID)
+	defer c.done(ctx)
+	return eg.run(ctx, percepts, agent, cp.Iter+1, o, c)
+}
+
+// reAct executes the calls of the acting checkpoint to idempotent tools again and returns
+// an interrupted error percept for all other calls. The percepts are in call order,
+// followed by the percepts of the calls blocked by the hooks.
+func (eg *Engine) reAct(ctx context.Context, cp checkpoint.Checkpoint, o engine.Options) ([]percept.Percept, error) {
+	idempotent := func(call tool.Call) bool {
+		return eg.actor.Idempotent(ctx, call)
+	}
+	interrupted := make(map[string]bool)
+	for _, call := range cp.Interrupted(idempotent) {
+		interrupted[call.ID] = true
+	}
+
+	calls, _ := cp.Action.Tool()
+	var again []tool.Call
+	for _, call := range calls {
+		if !interrupted[call.ID] {
+			again = append(again, call)
+		}
+	}
+
+	results := make(map[string]percept.Percept)
+	if len(again) > 0 {
+		reason, _ := cp.Action.Reason()
+		pp, err := eg.act(ctx, again, reason, cp.Iter, o)
+		if err != nil {
+			return nil, err
+		}
+		for i, p := range pp {
+			results[again[i].ID] = p
+		}
+	}
+
+	percepts := make([]percept.Percept, 0, len(calls))
+	for _, call := range calls {
+		if p, ok := results[call.ID]; ok {
+			percepts = append(percepts, p)
+			continue
+		}
+		eg.log.Info("flag interrupted call", "method", "reAct", "checkpointID", cp.ID, "toolName", call.Name)
+		toolErr := &tool.Error{Kind: tool.ErrInterrupted, Message: interruptedMsg}
+		p := percept.MakeToolError(call.ID, toolErr)
+		resp, _ := p.Tool()
+		event := engine.MakeEvent(engine.EventToolError, cp.Iter)
+		event.Result = resp
+		event.Err = toolErr
+		o.Publish(event)
+		percepts = append(percepts, p)
+	}
+	// The calls blocked by the hooks have been answered before the checkpoint.
+	percepts = append(percepts, cp.Percepts...)
+	return percepts, nil
+}
@@ -2,62 +2,650 @@ package loop
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/Br0ce/opera/pkg/action"
 	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/approval"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/guard"
+	"github.com/Br0ce/opera/pkg/ids"
 	"github.com/Br0ce/opera/pkg/monitor"
 	"github.com/Br0ce/opera/pkg/percept"
+	"github.com/Br0ce/opera/pkg/tool"
 	"github.com/Br0ce/opera/pkg/user"
 )
 
+var (
+	_ engine.Engine    = (*Engine)(nil)
+	_ engine.Resumer   = (*Engine)(nil)
+	_ engine.Recoverer = (*Engine)(nil)
+)
+
+var ErrNotDecided = errors.New("approval not decided")
+
+// Exhaustion is the policy of the engine for queries which reach the iteration limit
+// before the agent answers.
+type Exhaustion string
+
+const (
+	// ExhaustError fails the query.
+	ExhaustError Exhaustion = "error"
+	// ExhaustFinal asks the agent for a final answer without tools. Agents which
+	// cannot answer without tools return a partial result.
+	ExhaustFinal Exhaustion = "final"
+	// ExhaustPartial returns an engine.PartialError holding the tool findings.
+	ExhaustPartial Exhaustion = "partial"
+)
+
+const finalInstruction = "You have reached the maximum number of steps and can no longer call tools. " +
+	"Answer the user as well as possible with the information gathered so far and " +
+	"state what remains uncertain."
+
+// Valid reports whether e is a known exhaustion policy.
+func (e Exhaustion) Valid() bool {
+	switch e {
+	case ExhaustError, ExhaustFinal, ExhaustPartial:
+		return true
+	default:
+		return false
+	}
+}
+
 type Engine struct {
-	actor   *action.Actor
-	maxIter int
-	tr      trace.Tracer
-	log     *slog.Logger
+	actor       *action.Actor
+	maxIter     int
+	exhaustion  Exhaustion
+	reserve     time.Duration
+	approvals   db.Approval
+	checkpoints db.Checkpoint
+	detectLoops bool
+	hooks       engine.Hooks
+	guard       *guard.Guard
+	tr          trace.Tracer
+	log         *slog.Logger
+}
+
+type Option func(eg *Engine)
+
+// WithCheckpoints sets the store in which the progress of queries is checkpointed after
+// every iteration, so that interrupted queries can be recovered.
+func WithCheckpoints(checkpoints db.Checkpoint) Option {
+	return func(eg *Engine) {
+		eg.checkpoints = checkpoints
+	}
+}
+
+// WithExhaustion sets the policy for queries reaching the iteration limit. The default
+// is ExhaustError.
+func WithExhaustion(exhaustion Exhaustion) Option {
+	return func(eg *Engine) {
+		eg.exhaustion = exhaustion
+	}
+}
+
+// WithApprovals sets the store in which queries are suspended if a tool call needs a
+// human approval. Without a store, calls to such tools are rejected.
+func WithApprovals(approvals db.Approval) Option {
+	return func(eg *Engine) {
+		eg.approvals = approvals
+	}
+}
+
+// WithLoopDetection enables the detection of agents repeating themselves. An agent
+// caught in a loop is told so once. If it continues, the query fails with an
+// engine.LoopError.
+func WithLoopDetection(detect bool) Option {
+	return func(eg *Engine) {
+		eg.detectLoops = detect
+	}
+}
+
+// WithHooks adds hooks intercepting the steps of every query. They run before the
+// hooks of the agent and the query.
+func WithHooks(hooks ...engine.Hook) Option {
+	return func(eg *Engine) {
+		eg.hooks = append(eg.hooks, hooks...)
+	}
+}
+
+// WithGuard sets the guardrails checking the query before the agent reasons about it
+// and the final answer before it is returned. A blocked query fails with a *guard.Error.
+func WithGuard(g *guard.Guard) Option {
+	return func(eg *Engine) {
+		eg.guard = g
+	}
 }
 
-func NewEngine(actor *action.Actor, maxIter int, log *slog.Logger) *Engine {
-	return &Engine{
-		actor:   actor,
-		maxIter: maxIter,
-		tr:      monitor.Tracer("Engine"),
-		log:     log,
+// WithReserve sets the time reserved for the final answer of queries with a deadline.
+// No tools are called once less time is left. The default is five seconds.
+func WithReserve(reserve time.Duration) Option {
+	return func(eg *Engine) {
+		eg.reserve = reserve
 	}
 }
 
-func (eg *Engine) Query(ctx context.Context, query user.Query, agent agent.Agent) (string, error) {
+func NewEngine(actor *action.Actor, maxIter int, log *slog.Logger, options ...Option) *Engine {
+	eg := &Engine{
+		actor:      actor,
+		maxIter:    maxIter,
+		exhaustion: ExhaustError,
+		reserve:    5 * time.Second,
+		tr:         monitor.Tracer("Engine"),
+		log:        log,
+	}
+	for _, opt := range options {
+		opt(eg)
+	}
+	return eg
+}
+
+func (eg *Engine) Query(ctx context.Context, query user.Query, agent agent.Agent, opts ...engine.Option) (string, error) {
 	ctx, span := eg.tr.Start(ctx, "Query")
 	defer span.End()
 
+	o := eg.options(agent, opts)
+	err := eg.checkPending(agent, o)
+	if err != nil {
+		publishErr(o, err)
+		return "", err
+	}
+	query, err = eg.checkInput(ctx, query, o)
+	if err != nil {
+		publishErr(o, err)
+		return "", err
+	}
 	percepts := []percept.Percept{percept.MakeUser(query)}
-	for i := range eg.maxIter {
-		eg.log.Debug("iterate agent", "method", "Query", "iterNum", i, "maxIter", eg.maxIter)
+	c := eg.checkpointer(agent, o, ids.UniqueCheckpoint())
+	res, err := eg.run(ctx, percepts, agent, 0, o, c)
+	c.done(ctx)
+	publishErr(o, err)
+	return res, err
+}
+
+// checkPending returns an engine.ErrAwaitsApproval if the thread of the query has a
+// suspended query. A new query would answer the agent before the suspended calls are.
+func (eg *Engine) checkPending(ag agent.Agent, o engine.Options) error {
+	thread, ok := ag.(agent.Thread)
+	if eg.approvals == nil || !ok {
+		return nil
+	}
+	req, err := eg.approvals.GetByThread(o.AgentID, thread.ID())
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get approval: %w", err)
+	}
+	return fmt.Errorf("approval %s: %w", req.ID, engine.ErrAwaitsApproval)
+}
+
+// Resume continues the query suspended with the approval request for the given approvalID.
+// All calls of the request must be decided. Accepted calls are executed, rejected calls
+// are fed back to the agent as tool responses.
+func (eg *Engine) Resume(ctx context.Context, approvalID string, agent agent.Agent, opts ...engine.Option) (string, error) {
+	ctx, span := eg.tr.Start(ctx, "Resume")
+	defer span.End()
+	span.SetAttributes(attribute.String("approval.id", approvalID))
+
+	o := eg.options(agent, opts)
+	res, err := eg.resume(ctx, approvalID, agent, o)
+	publishErr(o, err)
+	return res, err
+}
+
+func (eg *Engine) resume(ctx context.Context, approvalID string, agent agent.Agent, o engine.Options) (string, error) {
+	if eg.approvals == nil {
+		return "", fmt.Errorf("no approval store")
+	}
+	req, err := eg.approvals.Get(approvalID)
+	if err != nil {
+		return "", fmt.Errorf("get approval %s: %w", approvalID, err)
+	}
+	if !req.Decided() {
+		return "", ErrNotDecided
+	}
+
+	percepts, err := eg.actApproved(ctx, req, o)
+	if err != nil {
+		return "", fmt.Errorf("act on approval: %w", err)
+	}
+	// The request is kept until its calls have been executed, so that a failed resume
+	// can be retried.
+	err = eg.approvals.Delete(approvalID)
+	if err != nil {
+		return "", fmt.Errorf("delete approval %s: %w", approvalID, err)
+	}
+
+	c := eg.checkpointer(agent, o, ids.UniqueCheckpoint())
+	defer c.done(ctx)
+	return eg.run(ctx, percepts, agent, req.Iter+1, o, c)
+}
+
+// run iterates the agent, starting with the given percepts at iteration start, until the
+// agent answers the user, a tool call waits for approval or the max iterations are reached.
+// The progress is checkpointed with c.
+func (eg *Engine) run(ctx context.Context, percepts []percept.Percept, agent agent.Agent, start int, o engine.Options, c *checkpointer) (string, error) {
+	if !o.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, o.Deadline)
+		defer cancel()
+	}
+
+	maxIter := eg.limit(agent, o)
+	findings := appendFindings(nil, percepts)
+	d := eg.detector()
+	for i := start; i < maxIter; i++ {
+		if err := ctx.Err(); err != nil {
+			record(agent, percepts)
+			return "", fmt.Errorf("query: %w", err)
+		}
+		if eg.nearDeadline(o) {
+			return eg.exhaust(ctx, agent, percepts, findings, engine.ReasonDeadline, maxIter, o)
+		}
+
+		eg.log.Debug("iterate agent", "method", "run", "iterNum", i, "maxIter", maxIter)
+		o.Publish(engine.MakeEvent(engine.EventStepStarted, i))
 
-		next, err := agent.Action(ctx, percepts)
+		step := engine.Step{Iter: i, Percepts: percepts}
+		if err := o.Hooks.BeforeReason(ctx, &step); err != nil {
+			record(agent, percepts)
+			return "", err
+		}
+		next, err := agent.Action(ctx, step.Percepts)
 		if err != nil {
 			return "", fmt.Errorf("agent actions: %w", err)
 		}
+		step.Action = next
+		if err := o.Hooks.AfterReason(ctx, &step); err != nil {
+			// The thread holds the calls of the agent, not those modified by the hooks.
+			calls, _ := next.Tool()
+			record(agent, unanswered(calls))
+			return "", err
+		}
+		next = step.Action
 
 		// If action is of type user, return the content.
 		if content, ok := next.User(); ok {
-			eg.log.Debug("found user action", "method", "Act", "content", content)
+			content, err := eg.finish(ctx, agent, content, i, o)
+			if err != nil {
+				return "", err
+			}
+			eg.log.Debug("found user action", "method", "run", "content", content)
+			event := engine.MakeEvent(engine.EventAnswer, i)
+			event.Text = content
+			o.Publish(event)
 			return content, nil
 		}
 
 		if reason, ok := next.Reason(); ok {
-			eg.log.Info(reason, "method", "Act")
+			eg.log.Info(reason, "method", "run")
+			event := engine.MakeEvent(engine.EventReasoning, i)
+			event.Text = reason
+			o.Publish(event)
+		}
+
+		// The hooks run before the approval check and the loop detection, so that both
+		// see the calls as they are executed.
+		calls, blocked := eg.intercept(ctx, next, i, o)
+		reason, _ := next.Reason()
+		// A query near its deadline is not suspended, since the approved calls could not
+		// be executed once it is resumed.
+		if eg.nearDeadline(o) {
+			percepts = skip(calls, "The call was not executed, the deadline of the query is near.")
+			percepts = append(percepts, blocked...)
+			return eg.exhaust(ctx, agent, percepts, findings, engine.ReasonDeadline, maxIter, o)
+		}
+		if err := eg.suspend(ctx, agent, calls, reason, blocked, i, o); err != nil {
+			// The calls of a pending query are answered once it is resumed.
+			var pendingErr *engine.PendingError
+			if !errors.As(err, &pendingErr) {
+				record(agent, slices.Concat(unanswered(calls), blocked))
+			}
+			return "", err
+		}
+
+		found := d.observeCalls(i, calls)
+		if found != nil && d.warned {
+			record(agent, slices.Concat(unanswered(calls), blocked))
+			return "", eg.stopLoop(found)
 		}
 
-		percepts, err = eg.actor.Act(ctx, next)
+		c.acting(i, action.MakeTool(calls, reason), blocked)
+		percepts, err = eg.act(ctx, calls, reason, i, o)
+		if err != nil {
+			record(agent, slices.Concat(unanswered(calls), blocked))
+			return "", err
+		}
+		percepts = append(percepts, blocked...)
+		if noNews := d.observeResults(i, calls, percepts); found == nil {
+			found = noNews
+		}
+		if d.escalate(found) {
+			record(agent, percepts)
+			return "", eg.stopLoop(found)
+		}
+		if found != nil {
+			percepts = append(percepts, eg.correct(found, o))
+		}
+		c.acted(i, next, percepts)
+		findings = appendFindings(findings, percepts)
+	}
+
+	return eg.exhaust(ctx, agent, percepts, findings, engine.ReasonMaxIter, maxIter, o)
+}
+
+// options returns the options of a query to the given agent. The hooks of the engine
+// run first, then the hooks of the agent and then the hooks of the query.
+func (eg *Engine) options(ag agent.Agent, opts []engine.Option) engine.Options {
+	o := engine.MakeOptions(opts...)
+	var agentHooks []engine.Hook
+	if hooked, ok := ag.(engine.Hooked); ok {
+		agentHooks = hooked.Hooks()
+	}
+	o.Hooks = slices.Concat(eg.hooks, agentHooks, o.Hooks)
+	return o
+}
+
+// nearDeadline reports whether the query has less time left than the engine reserves
+// for the final answer.
+func (eg *Engine) nearDeadline(o engine.Options) bool {
+	return !o.Deadline.IsZero() && time.Until(o.Deadline) < eg.reserve
+}
+
+// limit returns the iteration limit of the query. The limit of the query options takes
+// precedence over the limit of the agent, which takes precedence over the engine limit.
+func (eg *Engine) limit(ag agent.Agent, o engine.Options) int {
+	if o.MaxIter > 0 {
+		return o.MaxIter
+	}
+	if limited, ok := ag.(interface{ MaxIter() int }); ok && limited.MaxIter() > 0 {
+		return limited.MaxIter()
+	}
+	return eg.maxIter
+}
+
+// exhaust finishes a query which reached the given limit. Queries reaching the
+// iteration limit are finished according to the exhaustion policy of the engine,
+// queries reaching their deadline are always asked for a final answer.
+// The percepts are the results of the last iteration, which the agent has not seen yet.
+// If the agent is not asked for a final answer, they are recorded on its thread.
+func (eg *Engine) exhaust(ctx context.Context, ag agent.Agent, percepts []percept.Percept, findings []tool.Response, reason engine.PartialReason, maxIter int, o engine.Options) (string, error) {
+	policy := eg.exhaustion
+	if reason == engine.ReasonDeadline {
+		policy = ExhaustFinal
+	}
+	eg.log.Info("query exhausted", "method", "exhaust", "reason", reason, "maxIter", maxIter, "policy", policy)
+
+	partial := &engine.PartialError{Reason: reason, MaxIter: maxIter, Findings: findings}
+	switch policy {
+	case ExhaustFinal:
+		answerer, ok := ag.(agent.Answerer)
+		if !ok {
+			record(ag, percepts)
+			break
+		}
+		percepts = append(percepts, percept.MakeSystem(finalInstruction))
+		next, err := answerer.Answer(ctx, percepts)
+		if err != nil {
+			return "", fmt.Errorf("agent answer: %w", err)
+		}
+		content, ok := next.User()
+		if !ok {
+			// The agent called tools although it was offered none.
+			calls, _ := next.Tool()
+			record(ag, unanswered(calls))
+			break
+		}
+		content, err = eg.finish(ctx, ag, content, maxIter, o)
 		if err != nil {
-			return "", fmt.Errorf("actor act: %w", err)
+			return "", err
+		}
+		event := engine.MakeEvent(engine.EventAnswer, maxIter)
+		event.Text = content
+		o.Publish(event)
+		partial.Text = content
+	case ExhaustPartial:
+		record(ag, percepts)
+	default:
+		record(ag, percepts)
+		return "", fmt.Errorf("reached max iterations %v", maxIter)
+	}
+
+	return "", partial
+}
+
+// skip returns an error percept for each of the given calls, which are not executed.
+func skip(calls []tool.Call, msg string) []percept.Percept {
+	percepts := make([]percept.Percept, 0, len(calls))
+	for _, call := range calls {
+		percepts = append(percepts, percept.MakeToolError(call.ID, &tool.Error{
+			Kind:    tool.ErrTimeout,
+			Message: msg,
+		}))
+	}
+	return percepts
+}
+
+// unanswered returns an error percept for each of the given calls, which are not
+// executed because the query ends.
+func unanswered(calls []tool.Call) []percept.Percept {
+	percepts := make([]percept.Percept, 0, len(calls))
+	for _, call := range calls {
+		percepts = append(percepts, percept.MakeToolError(call.ID, &tool.Error{
+			Kind:    tool.ErrBlocked,
+			Message: "The call was not executed, the query ended.",
+		}))
+	}
+	return percepts
+}
+
+// record adds the tool responses of the given percepts to the history of the agent, if
+// it is an agent.Recorder. A query ending before the agent has seen the responses to its
+// calls records them, so that the history of its thread has no unanswered calls.
+func record(ag agent.Agent, percepts []percept.Percept) {
+	recorder, ok := ag.(agent.Recorder)
+	if !ok {
+		return
+	}
+	var responses []percept.Percept
+	for _, p := range percepts {
+		if _, ok := p.Tool(); ok {
+			responses = append(responses, p)
+		}
+	}
+	if len(responses) > 0 {
+		recorder.Record(responses)
+	}
+}
+
+// appendFindings appends the tool responses of the given percepts to ff.
+func appendFindings(ff []tool.Response, percepts []percept.Percept) []tool.Response {
+	for _, p := range percepts {
+		if resp, ok := p.Tool(); ok {
+			ff = append(ff, resp)
+		}
+	}
+	return ff
+}
+
+// suspend stores an approval request if any of the given calls needs a human approval
+// and returns an engine.PendingError holding the request. The request records the thread
+// of the query and its limits, which apply again once it is resumed, and the responses
+// to the calls blocked by the hooks.
+// If no call needs an approval, nil is returned.
+func (eg *Engine) suspend(ctx context.Context, ag agent.Agent, calls []tool.Call, reason string, blocked []percept.Percept, iter int, o engine.Options) error {
+	needsApproval := func(call tool.Call) bool {
+		return eg.actor.NeedsApproval(ctx, call)
+	}
+	req := approval.MakeRequest(calls, reason, iter, needsApproval)
+	if req.Decided() {
+		return nil
+	}
+
+	if eg.approvals == nil {
+		return fmt.Errorf("tool call needs approval: no approval store")
+	}
+	req.AgentID = o.AgentID
+	if thread, ok := ag.(agent.Thread); ok {
+		req.ThreadID = thread.ID()
+	}
+	req.MaxIter = o.MaxIter
+	req.Deadline = o.Deadline
+	req.Blocked = appendFindings(nil, blocked)
+	id, err := eg.approvals.Add(req)
+	if err != nil {
+		return fmt.Errorf("add approval: %w", err)
+	}
+	req.ID = id
+
+	eg.log.Info("suspend query for approval", "method", "suspend", "approvalID", id, "iterNum", iter)
+	event := engine.MakeEvent(engine.EventPending, iter)
+	event.Text = id
+	o.Publish(event)
+	return &engine.PendingError{Request: req}
+}
+
+// intercept passes the tool calls of the given action to the BeforeToolCall hooks of the
+// query. It returns the calls to execute, as modified by the hooks, and an error percept
+// for every blocked call, which is published right away.
+func (eg *Engine) intercept(ctx context.Context, next action.Action, iter int, o engine.Options) ([]tool.Call, []percept.Percept) {
+	calls, _ := next.Tool()
+	var allowed []tool.Call
+	var blocked []percept.Percept
+	for _, call := range calls {
+		err := o.Hooks.BeforeToolCall(ctx, &call)
+		if err == nil {
+			allowed = append(allowed, call)
+			continue
+		}
+		eg.log.Info("call blocked", "method", "intercept", "toolName", call.Name, "error", err)
+		event := engine.MakeEvent(engine.EventToolCall, iter)
+		event.Call = call
+		o.Publish(event)
+		p := blockedCall(call, err)
+		publishResults([]percept.Percept{p}, iter, o)
+		blocked = append(blocked, p)
+	}
+	return allowed, blocked
+}
+
+// act executes the given tool calls, which have passed the hooks of the query, and
+// publishes the calls and their results. Failed calls are published as tool errors.
+// The percepts are in call order.
+func (eg *Engine) act(ctx context.Context, calls []tool.Call, reason string, iter int, o engine.Options) ([]percept.Percept, error) {
+	if len(calls) == 0 {
+		return nil, nil
+	}
+	for _, call := range calls {
+		event := engine.MakeEvent(engine.EventToolCall, iter)
+		event.Call = call
+		o.Publish(event)
+	}
+
+	// Calls must return in time for the final answer.
+	actCtx := action.ContextWithAgent(ctx, o.AgentID)
+	if !o.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		actCtx, cancel = context.WithDeadline(actCtx, o.Deadline.Add(-eg.reserve))
+		defer cancel()
+	}
+
+	results, err := eg.actor.Act(actCtx, action.MakeTool(calls, reason))
+	if err != nil && ctx.Err() == nil && actCtx.Err() != nil {
+		results = skip(calls, "The call did not finish before the deadline of the query.")
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("actor act: %w", err)
+	}
+	percepts := make([]percept.Percept, len(results))
+	for i, p := range results {
+		percepts[i] = eg.afterCall(ctx, calls[i], p, o)
+	}
+	publishResults(percepts, iter, o)
+	return percepts, nil
+}
+
+// publishResults publishes a result or error event for each tool percept.
+func publishResults(percepts []percept.Percept, iter int, o engine.Options) {
+	for _, p := range percepts {
+		resp, ok := p.Tool()
+		if !ok {
+			continue
+		}
+		event := engine.MakeEvent(engine.EventToolResult, iter)
+		if resp.Err != nil {
+			event = engine.MakeEvent(engine.EventToolError, iter)
+			event.Err = resp.Err
 		}
+		event.Result = resp
+		o.Publish(event)
+	}
+}
+
+// afterCall passes the result of the call to the hooks of the query and returns the
+// possibly modified result. If a hook fails, the result is withheld from the agent.
+func (eg *Engine) afterCall(ctx context.Context, call tool.Call, p percept.Percept, o engine.Options) percept.Percept {
+	resp, ok := p.Tool()
+	if !ok || len(o.Hooks) == 0 {
+		return p
+	}
+	err := o.Hooks.AfterToolCall(ctx, call, &resp)
+	if err != nil {
+		eg.log.Info("result blocked", "method", "afterCall", "toolName", call.Name, "error", err)
+		return blockedCall(call, err)
+	}
+	return percept.MakeToolResponse(resp)
+}
+
+// blockedCall returns the error percept for a call blocked by a hook.
+func blockedCall(call tool.Call, err error) percept.Percept {
+	return percept.MakeToolError(call.ID, &tool.Error{
+		Kind:    tool.ErrBlocked,
+		Message: err.Error(),
+	})
+}
+
+// publishErr publishes an error event for err. Nil errors and suspended queries are
+// not published.
+func publishErr(o engine.Options, err error) {
+	var pendingErr *engine.PendingError
+	if err == nil || errors.As(err, &pendingErr) {
+		return
+	}
+	event := engine.MakeEvent(engine.EventError, -1)
+	event.Err = err
+	o.Publish(event)
+}
+
+// actApproved executes the accepted calls of the given request and returns their results
+// together with a tool response for every rejected call and every call blocked by the
+// hooks.
+func (eg *Engine) actApproved(ctx context.Context, req approval.Request, o engine.Options) ([]percept.Percept, error) {
+	percepts, err := eg.act(ctx, req.Accepted(), req.Reason, req.Iter, o)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rejected := range req.Rejected() {
+		content := "The user rejected this tool call."
+		if rejected.Comment != "" {
+			content = fmt.Sprintf("The user rejected this tool call: %s", rejected.Comment)
+		}
+		percepts = append(percepts, percept.MakeTool(rejected.Call.ID, content))
+	}
+	for _, resp := range req.Blocked {
+		percepts = append(percepts, percept.MakeToolResponse(resp))
 	}
 
-	return "", fmt.Errorf("reached max iterations %v", eg.maxIter)
+	return percepts, nil
 }
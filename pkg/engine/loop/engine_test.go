@@ -0,0 +1,1126 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/agent"
+	agentMock "github.com/Br0ce/opera/pkg/agent/mock"
+	"github.com/Br0ce/opera/pkg/approval"
+	"github.com/Br0ce/opera/pkg/checkpoint"
+	"github.com/Br0ce/opera/pkg/db/inmem"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/guard"
+	"github.com/Br0ce/opera/pkg/history"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/percept"
+	"github.com/Br0ce/opera/pkg/tool"
+	toolMock "github.com/Br0ce/opera/pkg/tool/mock"
+	transportMock "github.com/Br0ce/opera/pkg/transport/mock"
+	"github.com/Br0ce/opera/pkg/user"
+)
+
+// testActor returns an Actor for the given tools whose transport answers every call
+// with the given content.
+func testActor(t *testing.T, tools []tool.Tool, content string) (*action.Actor, *transportMock.Transporter) {
+	t.Helper()
+
+	discovery := &toolMock.Discovery{
+		GetFn: func(_ context.Context, name string) (tool.Tool, error) {
+			for _, to := range tools {
+				if to.Name() == name {
+					return to, nil
+				}
+			}
+			return tool.Tool{}, errors.New("not found")
+		},
+		AllFn: func(_ context.Context) []tool.Tool {
+			return tools
+		},
+	}
+	trans := &transportMock.Transporter{
+		DoFn: func(_ context.Context, _ string, _ string, _ map[string][]string, _ io.Reader) ([]byte, error) {
+			return []byte(content), nil
+		},
+	}
+	return action.NewActor(discovery, trans, monitor.NewTestLogger(false)), trans
+}
+
+func testApprovalTool(t *testing.T) tool.Tool {
+	t.Helper()
+
+	to, err := tool.MakeTool(
+		tool.WithName("delete_user"),
+		tool.WithDescription("Delete the user with the given id."),
+		tool.WithAddr(url.URL{Scheme: "http", Host: "users"}),
+		tool.WithParameters(map[string]any{
+			"id": map[string]any{
+				"type": "string",
+			},
+		}, []string{"id"}),
+		tool.WithApproval(true),
+	)
+	if err != nil {
+		t.Fatalf("make approval tool: %s", err.Error())
+	}
+	return to
+}
+
+func TestEngine_Query(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		actions     []action.Action
+		want        string
+		wantInvoked int
+		wantErr     bool
+	}{
+		{
+			name:        "answer",
+			actions:     []action.Action{action.MakeUser("the answer")},
+			want:        "the answer",
+			wantInvoked: 1,
+		},
+		{
+			name: "tool then answer",
+			actions: []action.Action{
+				action.MakeTool([]tool.Call{{ID: "1", Name: tool.TestToolA().Name(), Arguments: `{"location":"Berlin"}`}}, ""),
+				action.MakeUser("the answer"),
+			},
+			want:        "the answer",
+			wantInvoked: 2,
+		},
+		{
+			name: "max iterations",
+			actions: []action.Action{
+				action.MakeTool([]tool.Call{{ID: "1", Name: tool.TestToolA().Name(), Arguments: `{"location":"Berlin"}`}}, ""),
+				action.MakeTool([]tool.Call{{ID: "2", Name: tool.TestToolA().Name(), Arguments: `{"location":"Berlin"}`}}, ""),
+				action.MakeTool([]tool.Call{{ID: "3", Name: tool.TestToolA().Name(), Arguments: `{"location":"Berlin"}`}}, ""),
+			},
+			wantInvoked: 3,
+			wantErr:     true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actor, _ := testActor(t, tool.TestTools(), "result")
+			ag := &agentMock.Agent{}
+			ag.ActionFn = func(_ context.Context, _ []percept.Percept) (action.Action, error) {
+				return test.actions[ag.ActionInvoked-1], nil
+			}
+
+			eg := NewEngine(actor, 3, monitor.NewTestLogger(false))
+			got, err := eg.Query(context.TODO(), user.Query{Text: "question"}, ag)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Engine.Query() error = %v, wantErr %v", err, test.wantErr)
+				return
+			}
+			if got != test.want {
+				t.Errorf("Engine.Query() = %v, want %v", got, test.want)
+			}
+			if ag.ActionInvoked != test.wantInvoked {
+				t.Errorf("Engine.Query() actionInvoked = %v, want %v", ag.ActionInvoked, test.wantInvoked)
+			}
+		})
+	}
+}
+
+func TestEngine_Resume(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		decide      func(req *approval.Request) error
+		wantContent string
+		wantPost    bool
+	}{
+		{
+			name: "approve",
+			decide: func(req *approval.Request) error {
+				return req.Approve("1")
+			},
+			wantContent: "deleted",
+			wantPost:    true,
+		},
+		{
+			name: "reject",
+			decide: func(req *approval.Request) error {
+				return req.Reject("1", "not allowed")
+			},
+			wantContent: "The user rejected this tool call: not allowed",
+			wantPost:    false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actor, trans := testActor(t, []tool.Tool{testApprovalTool(t)}, "deleted")
+			approvals := inmem.NewApprovalDB()
+			eg := NewEngine(actor, 3, monitor.NewTestLogger(false), WithApprovals(approvals))
+
+			var gotPercepts []percept.Percept
+			ag := &agentMock.Agent{}
+			ag.ActionFn = func(_ context.Context, percepts []percept.Percept) (action.Action, error) {
+				if ag.ActionInvoked == 1 {
+					return action.MakeTool([]tool.Call{{ID: "1", Name: "delete_user", Arguments: `{"id":"42"}`}}, ""), nil
+				}
+				gotPercepts = percepts
+				return action.MakeUser("done"), nil
+			}
+
+			_, err := eg.Query(context.TODO(), user.Query{Text: "delete user 42"}, ag)
+			var pendingErr *engine.PendingError
+			if !errors.As(err, &pendingErr) {
+				t.Fatalf("Engine.Query() error = %v, want PendingError", err)
+			}
+			if trans.DoInvoked {
+				t.Fatal("Engine.Query() tool called before approval")
+			}
+
+			_, err = eg.Resume(context.TODO(), pendingErr.Request.ID, ag)
+			if !errors.Is(err, ErrNotDecided) {
+				t.Fatalf("Engine.Resume() error = %v, want %v", err, ErrNotDecided)
+			}
+
+			req, err := approvals.Get(pendingErr.Request.ID)
+			if err != nil {
+				t.Fatalf("get approval: %s", err.Error())
+			}
+			err = test.decide(&req)
+			if err != nil {
+				t.Fatalf("decide: %s", err.Error())
+			}
+			err = approvals.Update(req.ID, req)
+			if err != nil {
+				t.Fatalf("update approval: %s", err.Error())
+			}
+
+			got, err := eg.Resume(context.TODO(), req.ID, ag)
+			if err != nil {
+				t.Fatalf("Engine.Resume() error = %v", err)
+			}
+			if got != "done" {
+				t.Errorf("Engine.Resume() = %v, want %v", got, "done")
+			}
+			if trans.DoInvoked != test.wantPost {
+				t.Errorf("Engine.Resume() postInvoked = %v, want %v", trans.DoInvoked, test.wantPost)
+			}
+			if len(gotPercepts) != 1 {
+				t.Fatalf("Engine.Resume() percepts len = %v, want %v", len(gotPercepts), 1)
+			}
+			resp, ok := gotPercepts[0].Tool()
+			if !ok {
+				t.Fatal("Engine.Resume() percept is not of type tool")
+			}
+			if resp.ID != "1" || resp.Content != test.wantContent {
+				t.Errorf("Engine.Resume() response = %+v, want content %v", resp, test.wantContent)
+			}
+			if _, err := approvals.Get(req.ID); err == nil {
+				t.Error("Engine.Resume() approval not deleted")
+			}
+		})
+	}
+}
+
+func TestEngine_QueryPendingThread(t *testing.T) {
+	t.Parallel()
+
+	actor, _ := testActor(t, []tool.Tool{testApprovalTool(t)}, "deleted")
+	approvals := inmem.NewApprovalDB()
+	eg := NewEngine(actor, 3, monitor.NewTestLogger(false), WithApprovals(approvals))
+
+	th := &testThread{Agent: &agentMock.Agent{}, id: "thr-1"}
+	th.ActionFn = func(_ context.Context, _ []percept.Percept) (action.Action, error) {
+		return action.MakeTool([]tool.Call{{ID: "1", Name: "delete_user", Arguments: `{"id":"42"}`}}, ""), nil
+	}
+
+	_, err := eg.Query(context.TODO(), user.Query{Text: "delete user 42"}, th, engine.WithAgentID("agent"))
+	var pendingErr *engine.PendingError
+	if !errors.As(err, &pendingErr) {
+		t.Fatalf("Engine.Query() error = %v, want PendingError", err)
+	}
+
+	_, err = eg.Query(context.TODO(), user.Query{Text: "delete user 43"}, th, engine.WithAgentID("agent"))
+	if !errors.Is(err, engine.ErrAwaitsApproval) {
+		t.Fatalf("Engine.Query() error = %v, want %v", err, engine.ErrAwaitsApproval)
+	}
+	if th.ActionInvoked != 1 {
+		t.Errorf("Engine.Query() actionInvoked = %v, want %v", th.ActionInvoked, 1)
+	}
+
+	_, err = eg.Query(context.TODO(), user.Query{Text: "delete user 43"}, th, engine.WithAgentID("other"))
+	if errors.Is(err, engine.ErrAwaitsApproval) {
+		t.Errorf("Engine.Query() error = %v on the thread of another agent", err)
+	}
+}
+
+func TestEngine_QueryEvents(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		actions []action.Action
+		want    []engine.EventType
+	}{
+		{
+			name:    "answer",
+			actions: []action.Action{action.MakeUser("the answer")},
+			want:    []engine.EventType{engine.EventStepStarted, engine.EventAnswer},
+		},
+		{
+			name: "tool then answer",
+			actions: []action.Action{
+				action.MakeTool([]tool.Call{{ID: "1", Name: tool.TestToolA().Name(), Arguments: `{"location":"Berlin"}`}}, "need a tool"),
+				action.MakeUser("the answer"),
+			},
+			want: []engine.EventType{
+				engine.EventStepStarted,
+				engine.EventReasoning,
+				engine.EventToolCall,
+				engine.EventToolResult,
+				engine.EventStepStarted,
+				engine.EventAnswer,
+			},
+		},
+		{
+			name: "max iterations",
+			actions: []action.Action{
+				action.MakeTool([]tool.Call{{ID: "1", Name: tool.TestToolA().Name(), Arguments: `{"location":"Berlin"}`}}, ""),
+			},
+			want: []engine.EventType{
+				engine.EventStepStarted,
+				engine.EventToolCall,
+				engine.EventToolResult,
+				engine.EventError,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actor, _ := testActor(t, tool.TestTools(), "result")
+			ag := &agentMock.Agent{}
+			ag.ActionFn = func(_ context.Context, _ []percept.Percept) (action.Action, error) {
+				return test.actions[ag.ActionInvoked-1], nil
+			}
+
+			var got []engine.EventType
+			sub := engine.SubscriberFunc(func(event engine.Event) {
+				got = append(got, event.Type)
+			})
+
+			eg := NewEngine(actor, len(test.actions), monitor.NewTestLogger(false))
+			_, _ = eg.Query(context.TODO(), user.Query{Text: "question"}, ag, engine.WithSubscriber(sub))
+			if !slices.Equal(got, test.want) {
+				t.Errorf("Engine.Query() events = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// recordedIDs returns the call ids of the tool responses among the recorded percepts.
+func recordedIDs(recorded []percept.Percept) []string {
+	var ids []string
+	for _, p := range recorded {
+		if resp, ok := p.Tool(); ok {
+			ids = append(ids, resp.ID)
+		}
+	}
+	return ids
+}
+
+func TestEngine_QueryExhaustion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		exhaustion   Exhaustion
+		answerer     bool
+		wantText     string
+		wantPartial  bool
+		wantRecorded []string
+		wantErr      bool
+	}{
+		{
+			name:         "error",
+			exhaustion:   ExhaustError,
+			answerer:     true,
+			wantRecorded: []string{"2"},
+			wantErr:      true,
+		},
+		{
+			name:        "final",
+			exhaustion:  ExhaustFinal,
+			answerer:    true,
+			wantText:    "final answer",
+			wantPartial: true,
+			wantErr:     true,
+		},
+		{
+			name:         "final without answerer",
+			exhaustion:   ExhaustFinal,
+			answerer:     false,
+			wantPartial:  true,
+			wantRecorded: []string{"2"},
+			wantErr:      true,
+		},
+		{
+			name:         "partial",
+			exhaustion:   ExhaustPartial,
+			answerer:     true,
+			wantPartial:  true,
+			wantRecorded: []string{"2"},
+			wantErr:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actor, _ := testActor(t, tool.TestTools(), "finding")
+			var gotPercepts []percept.Percept
+			ag := &agentMock.Answerer{
+				AnswerFn: func(_ context.Context, percepts []percept.Percept) (action.Action, error) {
+					gotPercepts = percepts
+					return action.MakeUser("final answer"), nil
+				},
+			}
+			ag.ActionFn = func(_ context.Context, _ []percept.Percept) (action.Action, error) {
+				id := strconv.Itoa(ag.ActionInvoked)
+				return action.MakeTool([]tool.Call{{ID: id, Name: tool.TestToolA().Name(), Arguments: `{"location":"Berlin"}`}}, ""), nil
+			}
+			var queried agent.Agent = ag
+			if !test.answerer {
+				queried = &ag.Agent
+			}
+
+			eg := NewEngine(actor, 10, monitor.NewTestLogger(false), WithExhaustion(test.exhaustion))
+			got, err := eg.Query(context.TODO(), user.Query{Text: "question"}, queried, engine.WithMaxIter(2))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Engine.Query() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != "" {
+				t.Errorf("Engine.Query() = %v, want empty", got)
+			}
+			if ag.ActionInvoked != 2 {
+				t.Errorf("Engine.Query() actionInvoked = %v, want %v", ag.ActionInvoked, 2)
+			}
+
+			var partialErr *engine.PartialError
+			if errors.As(err, &partialErr) != test.wantPartial {
+				t.Fatalf("Engine.Query() error = %v, wantPartial %v", err, test.wantPartial)
+			}
+			if test.wantPartial && len(partialErr.Findings) != 2 {
+				t.Errorf("Engine.Query() findings = %v, want %v", len(partialErr.Findings), 2)
+			}
+			if test.wantPartial && partialErr.Text != test.wantText {
+				t.Errorf("Engine.Query() text = %v, want %v", partialErr.Text, test.wantText)
+			}
+
+			// The responses to the last calls are recorded, unless the agent saw them.
+			if got := recordedIDs(ag.Recorded); !slices.Equal(got, test.wantRecorded) {
+				t.Errorf("Engine.Query() recorded = %v, want %v", got, test.wantRecorded)
+			}
+
+			if test.wantText != "" {
+				if len(gotPercepts) != 2 {
+					t.Fatalf("Engine.Query() answer percepts len = %v, want %v", len(gotPercepts), 2)
+				}
+				if _, ok := gotPercepts[1].System(); !ok {
+					t.Error("Engine.Query() last answer percept is not of type system")
+				}
+			}
+		})
+	}
+}
+
+func TestEngine_QueryDeadline(t *testing.T) {
+	t.Parallel()
+
+	actor, trans := testActor(t, tool.TestTools(), "finding")
+	ag := &agentMock.Answerer{
+		AnswerFn: func(_ context.Context, _ []percept.Percept) (action.Action, error) {
+			return action.MakeUser("final answer"), nil
+		},
+	}
+	ag.ActionFn = func(_ context.Context, _ []percept.Percept) (action.Action, error) {
+		id := strconv.Itoa(ag.ActionInvoked)
+		return action.MakeTool([]tool.Call{{ID: id, Name: tool.TestToolA().Name(), Arguments: `{"location":"Berlin"}`}}, ""), nil
+	}
+
+	// The deadline lies within the reserve, so the agent is asked for a final answer
+	// right away.
+	eg := NewEngine(actor, 10, monitor.NewTestLogger(false), WithReserve(time.Minute))
+	deadline := time.Now().Add(30 * time.Second)
+	_, err := eg.Query(context.TODO(), user.Query{Text: "question"}, ag, engine.WithDeadline(deadline))
+
+	var partialErr *engine.PartialError
+	if !errors.As(err, &partialErr) {
+		t.Fatalf("Engine.Query() error = %v, want PartialError", err)
+	}
+	if partialErr.Reason != engine.ReasonDeadline {
+		t.Errorf("Engine.Query() reason = %v, want %v", partialErr.Reason, engine.ReasonDeadline)
+	}
+	if partialErr.Text != "final answer" {
+		t.Errorf("Engine.Query() text = %v, want %v", partialErr.Text, "final answer")
+	}
+	if trans.DoInvoked {
+		t.Error("Engine.Query() tool called near the deadline")
+	}
+	if ag.ActionInvoked != 0 {
+		t.Errorf("Engine.Query() actionInvoked = %v, want %v", ag.ActionInvoked, 0)
+	}
+	if ag.AnswerInvoked != 1 {
+		t.Errorf("Engine.Query() answerInvoked = %v, want %v", ag.AnswerInvoked, 1)
+	}
+}
+
+// testThread is an agent.Thread around a mock agent.
+type testThread struct {
+	*agentMock.Agent
+	mu sync.Mutex
+	id string
+}
+
+var _ agent.Thread = (*testThread)(nil)
+
+func (th *testThread) Lock(context.Context) error {
+	th.mu.Lock()
+	return nil
+}
+func (th *testThread) Unlock() { th.mu.Unlock() }
+
+func (th *testThread) ID() string               { return th.id }
+func (th *testThread) Created() time.Time       { return time.Time{} }
+func (th *testThread) History() history.History { return history.History{} }
+func (th *testThread) MaxIter() int             { return 0 }
+
+func TestEngine_Recover(t *testing.T) {
+	t.Parallel()
+
+	idem, err := tool.MakeTool(
+		tool.WithName("get_user"),
+		tool.WithDescription("Get the user with the given id."),
+		tool.WithAddr(url.URL{Scheme: "http", Host: "users"}),
+		tool.WithParameters(map[string]any{
+			"id": map[string]any{
+				"type": "string",
+			},
+		}, []string{"id"}),
+		tool.WithIdempotent(true),
+	)
+	if err != nil {
+		t.Fatalf("make idempotent tool: %s", err.Error())
+	}
+	addr := idem.Addr()
+	calls := []tool.Call{
+		{ID: "1", Name: idem.Name(), Arguments: `{"id":"42"}`},
+		{ID: "2", Name: tool.TestToolA().Name(), Arguments: `{"location":"Berlin"}`},
+	}
+
+	tests := []struct {
+		name      string
+		phase     checkpoint.Phase
+		percepts  []percept.Percept
+		wantPost  []string
+		wantKinds []tool.ErrorKind
+	}{
+		{
+			name:      "acting",
+			phase:     checkpoint.Acting,
+			wantPost:  []string{addr.String()},
+			wantKinds: []tool.ErrorKind{"", tool.ErrInterrupted},
+		},
+		{
+			name:  "acted",
+			phase: checkpoint.Acted,
+			percepts: []percept.Percept{
+				percept.MakeTool("1", "result"),
+				percept.MakeTool("2", "result"),
+			},
+			wantKinds: []tool.ErrorKind{"", ""},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actor, trans := testActor(t, []tool.Tool{idem, tool.TestToolA()}, "result")
+			var posted []string
+			trans.DoFn = func(_ context.Context, _ string, addr string, _ map[string][]string, _ io.Reader) ([]byte, error) {
+				posted = append(posted, addr)
+				return []byte("result"), nil
+			}
+			checkpoints := inmem.NewCheckpointDB()
+			err := checkpoints.Set(checkpoint.Checkpoint{
+				ID:       "chk-1",
+				AgentID:  "age-1",
+				ThreadID: "thr-1",
+				Iter:     1,
+				Phase:    test.phase,
+				Action:   action.MakeTool(calls, ""),
+				Percepts: test.percepts,
+			})
+			if err != nil {
+				t.Fatalf("set checkpoint: %s", err.Error())
+			}
+			eg := NewEngine(actor, 3, monitor.NewTestLogger(false), WithCheckpoints(checkpoints))
+
+			var gotPercepts []percept.Percept
+			th := &testThread{Agent: &agentMock.Agent{}, id: "thr-1"}
+			th.ActionFn = func(_ context.Context, percepts []percept.Percept) (action.Action, error) {
+				gotPercepts = percepts
+				return action.MakeUser("done"), nil
+			}
+
+			got, err := eg.Recover(context.TODO(), "chk-1", th)
+			if err != nil {
+				t.Fatalf("Engine.Recover() error = %v", err)
+			}
+			if got != "done" {
+				t.Errorf("Engine.Recover() = %v, want %v", got, "done")
+			}
+			if !slices.Equal(posted, test.wantPost) {
+				t.Errorf("Engine.Recover() posted = %v, want %v", posted, test.wantPost)
+			}
+			if len(gotPercepts) != len(test.wantKinds) {
+				t.Fatalf("Engine.Recover() percepts len = %v, want %v", len(gotPercepts), len(test.wantKinds))
+			}
+			for i, p := range gotPercepts {
+				resp, ok := p.Tool()
+				if !ok {
+					t.Fatalf("Engine.Recover() percept %v is not of type tool", i)
+				}
+				if resp.ID != calls[i].ID {
+					t.Errorf("Engine.Recover() percept %v id = %v, want %v", i, resp.ID, calls[i].ID)
+				}
+				var kind tool.ErrorKind
+				if resp.Err != nil {
+					kind = resp.Err.Kind
+				}
+				if kind != test.wantKinds[i] {
+					t.Errorf("Engine.Recover() percept %v error kind = %v, want %v", i, kind, test.wantKinds[i])
+				}
+			}
+			if _, err := checkpoints.Get("chk-1"); err == nil {
+				t.Error("Engine.Recover() checkpoint not deleted")
+			}
+		})
+	}
+}
+
+func TestEngine_QueryCanceled(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		cause    error
+		wantKept bool
+	}{
+		{
+			name:     "shutdown",
+			cause:    engine.ErrShutdown,
+			wantKept: true,
+		},
+		{
+			name: "canceled by user",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+			actor, trans := testActor(t, tool.TestTools(), "result")
+			trans.DoFn = func(ctx context.Context, _ string, _ string, _ map[string][]string, _ io.Reader) ([]byte, error) {
+				cancel(test.cause)
+				return nil, ctx.Err()
+			}
+			checkpoints := inmem.NewCheckpointDB()
+			eg := NewEngine(actor, 3, monitor.NewTestLogger(false), WithCheckpoints(checkpoints))
+
+			th := &testThread{Agent: &agentMock.Agent{}, id: "thr-1"}
+			th.ActionFn = func(_ context.Context, _ []percept.Percept) (action.Action, error) {
+				return action.MakeTool([]tool.Call{{ID: "1", Name: tool.TestToolA().Name(), Arguments: `{"location":"a"}`}}, ""), nil
+			}
+
+			_, err := eg.Query(ctx, user.Query{Text: "question"}, th, engine.WithAgentID("age-1"))
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("Engine.Query() error = %v, want %v", err, context.Canceled)
+			}
+			var kept int
+			for range checkpoints.All() {
+				kept++
+			}
+			if (kept == 1) != test.wantKept {
+				t.Errorf("Engine.Query() checkpoints = %v, want kept %v", kept, test.wantKept)
+			}
+		})
+	}
+}
+
+func TestEngine_QueryLoop(t *testing.T) {
+	t.Parallel()
+
+	call := func(id, args string) action.Action {
+		return action.MakeTool([]tool.Call{{ID: id, Name: tool.TestToolA().Name(), Arguments: args}}, "")
+	}
+
+	tests := []struct {
+		name        string
+		actions     []action.Action
+		echo        bool
+		detect      bool
+		want        string
+		wantPattern engine.LoopPattern
+		wantIter    int
+		wantInvoked int
+		// wantRecorded are the ids of the calls answered on the thread after the query.
+		wantRecorded []string
+		wantErr      bool
+	}{
+		{
+			name: "repeat",
+			actions: []action.Action{
+				call("1", `{"location":"a"}`),
+				call("2", `{ "location": "a" }`),
+				call("3", `{"location":"a"}`),
+			},
+			echo:         true,
+			detect:       true,
+			wantPattern:  engine.PatternRepeat,
+			wantIter:     2,
+			wantInvoked:  3,
+			wantRecorded: []string{"3"},
+			wantErr:      true,
+		},
+		{
+			name: "oscillation",
+			actions: []action.Action{
+				call("1", `{"location":"a"}`),
+				call("2", `{"location":"b"}`),
+				call("3", `{"location":"a"}`),
+				call("4", `{"location":"b"}`),
+			},
+			echo:         true,
+			detect:       true,
+			wantPattern:  engine.PatternOscillation,
+			wantIter:     3,
+			wantInvoked:  4,
+			wantRecorded: []string{"4"},
+			wantErr:      true,
+		},
+		{
+			name: "no progress",
+			actions: []action.Action{
+				call("1", `{"location":"a"}`),
+				call("2", `{"location":"b"}`),
+				call("3", `{"location":"c"}`),
+			},
+			detect:       true,
+			wantPattern:  engine.PatternNoProgress,
+			wantIter:     2,
+			wantInvoked:  3,
+			wantRecorded: []string{"3"},
+			wantErr:      true,
+		},
+		{
+			name: "corrected",
+			actions: []action.Action{
+				call("1", `{"location":"a"}`),
+				call("2", `{"location":"a"}`),
+				action.MakeUser("the answer"),
+			},
+			echo:        true,
+			detect:      true,
+			want:        "the answer",
+			wantInvoked: 3,
+		},
+		{
+			name: "disabled",
+			actions: []action.Action{
+				call("1", `{"location":"a"}`),
+				call("2", `{"location":"a"}`),
+				call("3", `{"location":"a"}`),
+				call("4", `{"location":"a"}`),
+			},
+			echo:         true,
+			wantInvoked:  4,
+			wantRecorded: []string{"4"},
+			wantErr:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actor, trans := testActor(t, tool.TestTools(), "result")
+			if test.echo {
+				trans.DoFn = func(_ context.Context, _ string, _ string, _ map[string][]string, body io.Reader) ([]byte, error) {
+					return io.ReadAll(body)
+				}
+			}
+			var corrected bool
+			ag := &agentMock.Agent{}
+			ag.ActionFn = func(_ context.Context, percepts []percept.Percept) (action.Action, error) {
+				for _, p := range percepts {
+					if _, ok := p.System(); ok {
+						corrected = true
+					}
+				}
+				return test.actions[ag.ActionInvoked-1], nil
+			}
+
+			eg := NewEngine(actor, 4, monitor.NewTestLogger(false), WithLoopDetection(test.detect))
+			got, err := eg.Query(context.TODO(), user.Query{Text: "question"}, ag)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Engine.Query() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("Engine.Query() = %v, want %v", got, test.want)
+			}
+			if ag.ActionInvoked != test.wantInvoked {
+				t.Errorf("Engine.Query() actionInvoked = %v, want %v", ag.ActionInvoked, test.wantInvoked)
+			}
+			if corrected != test.detect {
+				t.Errorf("Engine.Query() corrected = %v, want %v", corrected, test.detect)
+			}
+			if got := recordedIDs(ag.Recorded); !slices.Equal(got, test.wantRecorded) {
+				t.Errorf("Engine.Query() recorded = %v, want %v", got, test.wantRecorded)
+			}
+
+			var loopErr *engine.LoopError
+			if errors.As(err, &loopErr) != (test.wantPattern != "") {
+				t.Fatalf("Engine.Query() error = %v, want loop error %v", err, test.wantPattern != "")
+			}
+			if loopErr == nil {
+				return
+			}
+			if loopErr.Pattern != test.wantPattern || loopErr.Iter != test.wantIter {
+				t.Errorf("Engine.Query() loop = %v at %v, want %v at %v", loopErr.Pattern, loopErr.Iter, test.wantPattern, test.wantIter)
+			}
+			if loopErr.Diagnostic == "" {
+				t.Error("Engine.Query() loop diagnostic empty")
+			}
+		})
+	}
+}
+
+// testHook is an engine.Hook calling the set functions.
+type testHook struct {
+	engine.NopHook
+	afterReasonFn    func(step *engine.Step) error
+	beforeToolCallFn func(call *tool.Call) error
+	onAnswerFn       func(answer *string) error
+}
+
+func (h testHook) AfterReason(_ context.Context, step *engine.Step) error {
+	if h.afterReasonFn == nil {
+		return nil
+	}
+	return h.afterReasonFn(step)
+}
+
+func (h testHook) BeforeToolCall(_ context.Context, call *tool.Call) error {
+	if h.beforeToolCallFn == nil {
+		return nil
+	}
+	return h.beforeToolCallFn(call)
+}
+
+func (h testHook) OnAnswer(_ context.Context, answer *string) error {
+	if h.onAnswerFn == nil {
+		return nil
+	}
+	return h.onAnswerFn(answer)
+}
+
+// hookedAgent is a mock agent bringing its own hooks.
+type hookedAgent struct {
+	*agentMock.Agent
+	hooks []engine.Hook
+}
+
+func (a hookedAgent) Hooks() []engine.Hook { return a.hooks }
+
+func TestEngine_QueryHooks(t *testing.T) {
+	t.Parallel()
+
+	toolCall := action.MakeTool([]tool.Call{{ID: "1", Name: tool.TestToolA().Name(), Arguments: `{"location":"a"}`}}, "")
+
+	tests := []struct {
+		name        string
+		hook        testHook
+		agentHook   bool
+		want        string
+		wantBody    string
+		wantPost    bool
+		wantBlocked bool
+		wantStage   engine.Stage
+		// wantRecorded are the ids of the calls answered on the thread after the query.
+		wantRecorded []string
+		wantErr      bool
+	}{
+		{
+			name: "modify arguments",
+			hook: testHook{beforeToolCallFn: func(call *tool.Call) error {
+				call.Arguments = `{"location":"b"}`
+				return nil
+			}},
+			want:     "the answer",
+			wantBody: `{"location":"b"}`,
+			wantPost: true,
+		},
+		{
+			name: "block call",
+			hook: testHook{beforeToolCallFn: func(*tool.Call) error {
+				return errors.New("not allowed")
+			}},
+			want:        "the answer",
+			wantBlocked: true,
+		},
+		{
+			name: "abort after reason",
+			hook: testHook{afterReasonFn: func(step *engine.Step) error {
+				if _, ok := step.Action.Tool(); ok {
+					return errors.New("no tools")
+				}
+				return nil
+			}},
+			wantStage:    engine.StageAfterReason,
+			wantRecorded: []string{"1"},
+			wantErr:      true,
+		},
+		{
+			name: "rewrite answer",
+			hook: testHook{onAnswerFn: func(answer *string) error {
+				*answer = "rewritten"
+				return nil
+			}},
+			want:     "rewritten",
+			wantBody: `{"location":"a"}`,
+			wantPost: true,
+		},
+		{
+			name: "agent hook",
+			hook: testHook{onAnswerFn: func(answer *string) error {
+				*answer += " by agent"
+				return nil
+			}},
+			agentHook: true,
+			want:      "the answer by agent",
+			wantBody:  `{"location":"a"}`,
+			wantPost:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actor, trans := testActor(t, tool.TestTools(), "result")
+			var body string
+			trans.DoFn = func(_ context.Context, _ string, _ string, _ map[string][]string, r io.Reader) ([]byte, error) {
+				bb, err := io.ReadAll(r)
+				body = string(bb)
+				return []byte("result"), err
+			}
+			var blocked bool
+			mock := &agentMock.Agent{}
+			mock.ActionFn = func(_ context.Context, percepts []percept.Percept) (action.Action, error) {
+				for _, p := range percepts {
+					if resp, ok := p.Tool(); ok && resp.Err != nil && resp.Err.Kind == tool.ErrBlocked {
+						blocked = true
+					}
+				}
+				if mock.ActionInvoked == 1 {
+					return toolCall, nil
+				}
+				return action.MakeUser("the answer"), nil
+			}
+
+			var ag agent.Agent = mock
+			var options []Option
+			if test.agentHook {
+				ag = hookedAgent{Agent: mock, hooks: []engine.Hook{test.hook}}
+			} else {
+				options = append(options, WithHooks(test.hook))
+			}
+
+			eg := NewEngine(actor, 3, monitor.NewTestLogger(false), options...)
+			got, err := eg.Query(context.TODO(), user.Query{Text: "question"}, ag)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Engine.Query() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("Engine.Query() = %v, want %v", got, test.want)
+			}
+			if trans.DoInvoked != test.wantPost {
+				t.Errorf("Engine.Query() postInvoked = %v, want %v", trans.DoInvoked, test.wantPost)
+			}
+			if body != test.wantBody {
+				t.Errorf("Engine.Query() body = %v, want %v", body, test.wantBody)
+			}
+			if blocked != test.wantBlocked {
+				t.Errorf("Engine.Query() blocked = %v, want %v", blocked, test.wantBlocked)
+			}
+
+			var abortErr *engine.AbortError
+			if errors.As(err, &abortErr) != (test.wantStage != "") {
+				t.Fatalf("Engine.Query() error = %v, want abort error %v", err, test.wantStage != "")
+			}
+			if abortErr != nil && abortErr.Stage != test.wantStage {
+				t.Errorf("Engine.Query() stage = %v, want %v", abortErr.Stage, test.wantStage)
+			}
+			if got := recordedIDs(mock.Recorded); !slices.Equal(got, test.wantRecorded) {
+				t.Errorf("Engine.Query() recorded = %v, want %v", got, test.wantRecorded)
+			}
+		})
+	}
+}
+
+func TestEngine_QueryHookNeedsApproval(t *testing.T) {
+	t.Parallel()
+
+	actor, trans := testActor(t, append(tool.TestTools(), testApprovalTool(t)), "result")
+	approvals := inmem.NewApprovalDB()
+	// The hook turns the call of a tool without approval into a call of a tool with approval.
+	hook := testHook{beforeToolCallFn: func(call *tool.Call) error {
+		call.Name = "delete_user"
+		call.Arguments = `{"id":"42"}`
+		return nil
+	}}
+	eg := NewEngine(actor, 3, monitor.NewTestLogger(false), WithApprovals(approvals), WithHooks(hook))
+
+	ag := &agentMock.Agent{}
+	ag.ActionFn = func(_ context.Context, _ []percept.Percept) (action.Action, error) {
+		return action.MakeTool([]tool.Call{{ID: "1", Name: tool.TestToolA().Name(), Arguments: `{"location":"a"}`}}, ""), nil
+	}
+
+	_, err := eg.Query(context.TODO(), user.Query{Text: "question"}, ag)
+	var pendingErr *engine.PendingError
+	if !errors.As(err, &pendingErr) {
+		t.Fatalf("Engine.Query() error = %v, want PendingError", err)
+	}
+	if trans.DoInvoked {
+		t.Error("Engine.Query() tool called before approval")
+	}
+	want := []approval.Call{{
+		Call:     tool.Call{ID: "1", Name: "delete_user", Arguments: `{"id":"42"}`},
+		Decision: approval.Pending,
+	}}
+	if !slices.Equal(pendingErr.Request.Calls, want) {
+		t.Errorf("Engine.Query() approval calls = %v, want %v", pendingErr.Request.Calls, want)
+	}
+}
+
+func TestEngine_QueryNoApprovals(t *testing.T) {
+	t.Parallel()
+
+	actor, trans := testActor(t, append(tool.TestTools(), testApprovalTool(t)), "result")
+	eg := NewEngine(actor, 3, monitor.NewTestLogger(false))
+
+	ag := &agentMock.Agent{}
+	ag.ActionFn = func(_ context.Context, _ []percept.Percept) (action.Action, error) {
+		return action.MakeTool([]tool.Call{{ID: "1", Name: "delete_user", Arguments: `{"id":"42"}`}}, ""), nil
+	}
+
+	_, err := eg.Query(context.TODO(), user.Query{Text: "question"}, ag)
+	if err == nil {
+		t.Fatal("Engine.Query() error = nil, want error")
+	}
+	if trans.DoInvoked {
+		t.Error("Engine.Query() tool called without approval")
+	}
+	if got, want := recordedIDs(ag.Recorded), []string{"1"}; !slices.Equal(got, want) {
+		t.Errorf("Engine.Query() recorded = %v, want %v", got, want)
+	}
+}
+
+func TestEngine_QueryGuard(t *testing.T) {
+	t.Parallel()
+
+	secrets := guard.NewPattern("secrets", regexp.MustCompile(`sk-[a-z0-9]{8,}`))
+	emails := guard.NewPattern("emails", regexp.MustCompile(`[a-z]+@example\.com`))
+
+	tests := []struct {
+		name        string
+		options     []guard.Option
+		query       string
+		want        string
+		wantInvoked int
+		wantEvents  int
+		wantErr     bool
+	}{
+		{
+			name:        "input blocked",
+			options:     []guard.Option{guard.WithInput(guard.Rule{Check: secrets, Action: guard.Block})},
+			query:       "my key is sk-abcdef123456",
+			wantInvoked: 0,
+			wantErr:     true,
+		},
+		{
+			name:        "input rewritten",
+			options:     []guard.Option{guard.WithInput(guard.Rule{Check: secrets, Action: guard.Rewrite})},
+			query:       "my key is sk-abcdef123456",
+			want:        "my key is [removed]",
+			wantInvoked: 1,
+			wantEvents:  1,
+		},
+		{
+			name:        "output rewritten",
+			options:     []guard.Option{guard.WithOutput(guard.Rule{Check: emails, Action: guard.Rewrite})},
+			query:       "write to jane@example.com",
+			want:        "write to [removed]",
+			wantInvoked: 1,
+			wantEvents:  1,
+		},
+		{
+			name:        "output blocked",
+			options:     []guard.Option{guard.WithOutput(guard.Rule{Check: emails, Action: guard.Block})},
+			query:       "write to jane@example.com",
+			wantInvoked: 1,
+			wantErr:     true,
+		},
+		{
+			name:        "output warned",
+			options:     []guard.Option{guard.WithOutput(guard.Rule{Check: emails, Action: guard.Warn})},
+			query:       "write to jane@example.com",
+			want:        "write to jane@example.com",
+			wantInvoked: 1,
+			wantEvents:  1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actor, _ := testActor(t, tool.TestTools(), "result")
+			// The agent echoes the query.
+			ag := &agentMock.Agent{}
+			ag.ActionFn = func(_ context.Context, percepts []percept.Percept) (action.Action, error) {
+				query, _ := percepts[0].User()
+				return action.MakeUser(query.Text), nil
+			}
+			var events int
+			sub := engine.SubscriberFunc(func(event engine.Event) {
+				if event.Type == engine.EventGuard {
+					events++
+				}
+			})
+
+			g := guard.NewGuard(monitor.NewTestLogger(false), test.options...)
+			eg := NewEngine(actor, 3, monitor.NewTestLogger(false), WithGuard(g))
+			got, err := eg.Query(context.TODO(), user.Query{Text: test.query}, ag, engine.WithSubscriber(sub))
+			var guardErr *guard.Error
+			if errors.As(err, &guardErr) != test.wantErr {
+				t.Fatalf("Engine.Query() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("Engine.Query() = %v, want %v", got, test.want)
+			}
+			if ag.ActionInvoked != test.wantInvoked {
+				t.Errorf("Engine.Query() actionInvoked = %v, want %v", ag.ActionInvoked, test.wantInvoked)
+			}
+			if events != test.wantEvents {
+				t.Errorf("Engine.Query() guard events = %v, want %v", events, test.wantEvents)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package loop
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Br0ce/opera/pkg/agent"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/guard"
+	"github.com/Br0ce/opera/pkg/user"
+)
+
+// checkInput applies the input guardrails of the engine to the query and returns the
+// possibly rewritten query.
+func (eg *Engine) checkInput(ctx context.Context, query user.Query, o engine.Options) (user.Query, error) {
+	if eg.guard == nil {
+		return query, nil
+	}
+	query, violations, err := eg.guard.Input(ctx, query)
+	if err != nil {
+		return user.Query{}, err
+	}
+	publishViolations(violations, 0, o)
+	return query, nil
+}
+
+// withheldAnswer replaces an answer in the history of the agent which was not returned.
+const withheldAnswer = "The answer was withheld."
+
+// finish passes the answer of the given step to the hooks of the query and the output
+// guardrails of the engine and returns the possibly modified answer. The answer in the
+// history of the agent is revised accordingly, so that rewritten or blocked content is
+// neither shown again nor sent back to the model.
+func (eg *Engine) finish(ctx context.Context, ag agent.Agent, answer string, iter int, o engine.Options) (string, error) {
+	final, err := eg.check(ctx, answer, iter, o)
+	if err != nil {
+		revise(ag, withheldAnswer)
+		return "", err
+	}
+	if final != answer {
+		revise(ag, final)
+	}
+	return final, nil
+}
+
+func (eg *Engine) check(ctx context.Context, answer string, iter int, o engine.Options) (string, error) {
+	if err := o.Hooks.OnAnswer(ctx, iter, &answer); err != nil {
+		return "", err
+	}
+	if eg.guard == nil {
+		return answer, nil
+	}
+	answer, violations, err := eg.guard.Output(ctx, answer)
+	if err != nil {
+		return "", err
+	}
+	publishViolations(violations, iter, o)
+	return answer, nil
+}
+
+// revise replaces the last answer of the agent with content, if the agent supports it.
+func revise(ag agent.Agent, content string) {
+	if reviser, ok := ag.(agent.Reviser); ok {
+		reviser.ReviseAnswer(content)
+	}
+}
+
+// publishViolations publishes a guard event for each violation which did not block the
+// content.
+func publishViolations(violations []guard.Violation, iter int, o engine.Options) {
+	for _, v := range violations {
+		event := engine.MakeEvent(engine.EventGuard, iter)
+		event.Text = fmt.Sprintf("%s guardrail %s (%s): %s", v.Direction, v.Check, v.Action, v.Reason)
+		o.Publish(event)
+	}
+}
@@ -0,0 +1,174 @@
+package loop
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/percept"
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+// maxPeriod is the longest cycle of steps detected as oscillation.
+const maxPeriod = 3
+
+const loopInstruction = "You are stuck in a loop: %s. Repeating these calls will not give you " +
+	"new information. Use the results you already have, try a different approach or " +
+	"answer the user."
+
+// loopDetection describes a repetition found by the detector.
+type loopDetection struct {
+	pattern    engine.LoopPattern
+	iter       int
+	calls      []tool.Call
+	diagnostic string
+}
+
+// detector finds agents repeating themselves within a query. A nil detector finds
+// nothing.
+type detector struct {
+	// steps are the signatures of the call sets of all steps so far.
+	steps []string
+	iters []int
+	// seen are the tool results of all steps so far.
+	seen map[string]bool
+	// warned reports if the agent has been told that it is in a loop.
+	warned bool
+}
+
+// detector returns a detector for a query, or nil if loop detection is disabled.
+func (eg *Engine) detector() *detector {
+	if !eg.detectLoops {
+		return nil
+	}
+	return &detector{seen: make(map[string]bool)}
+}
+
+// observeCalls records the calls of the step in the given iteration and reports whether
+// they repeat the step before or an earlier step after a different step in between.
+func (d *detector) observeCalls(iter int, calls []tool.Call) *loopDetection {
+	if d == nil {
+		return nil
+	}
+	sig := signature(calls)
+	d.steps = append(d.steps, sig)
+	d.iters = append(d.iters, iter)
+
+	n := len(d.steps) - 1
+	if n >= 1 && d.steps[n-1] == sig {
+		return &loopDetection{
+			pattern: engine.PatternRepeat,
+			iter:    iter,
+			calls:   calls,
+			diagnostic: fmt.Sprintf("step %v repeats the calls %s of step %v",
+				iter, describe(calls), d.iters[n-1]),
+		}
+	}
+	for p := 2; p <= maxPeriod && n-p >= 0; p++ {
+		if d.steps[n-p] == sig {
+			return &loopDetection{
+				pattern: engine.PatternOscillation,
+				iter:    iter,
+				calls:   calls,
+				diagnostic: fmt.Sprintf("step %v returns to the calls %s of step %v",
+					iter, describe(calls), d.iters[n-p]),
+			}
+		}
+	}
+	return nil
+}
+
+// observeResults records the results of the step in the given iteration and reports
+// whether none of them is new.
+func (d *detector) observeResults(iter int, calls []tool.Call, percepts []percept.Percept) *loopDetection {
+	if d == nil {
+		return nil
+	}
+	fresh := false
+	var results int
+	for _, p := range percepts {
+		resp, ok := p.Tool()
+		if !ok {
+			continue
+		}
+		results++
+		if !d.seen[resp.Content] {
+			fresh = true
+			d.seen[resp.Content] = true
+		}
+	}
+	if fresh || results == 0 {
+		return nil
+	}
+	return &loopDetection{
+		pattern: engine.PatternNoProgress,
+		iter:    iter,
+		calls:   calls,
+		diagnostic: fmt.Sprintf("the results of the calls %s of step %v have all been seen before",
+			describe(calls), iter),
+	}
+}
+
+// escalate reports whether the query must stop because of the detection, which is the
+// case if the agent has already been warned. Otherwise the agent is marked as warned.
+// A step without detection clears the warning.
+func (d *detector) escalate(found *loopDetection) bool {
+	if d == nil {
+		return false
+	}
+	if found == nil {
+		d.warned = false
+		return false
+	}
+	if d.warned {
+		return true
+	}
+	d.warned = true
+	return false
+}
+
+// signature returns a key identifying the set of calls regardless of their order and ids.
+func signature(calls []tool.Call) string {
+	keys := make([]string, 0, len(calls))
+	for _, call := range calls {
+		args, err := call.CanonicalArguments()
+		if err != nil {
+			args = call.Arguments
+		}
+		keys = append(keys, call.Name+args)
+	}
+	slices.Sort(keys)
+	return strings.Join(keys, "\n")
+}
+
+// describe returns the calls in a human readable form.
+func describe(calls []tool.Call) string {
+	cc := make([]string, 0, len(calls))
+	for _, call := range calls {
+		cc = append(cc, fmt.Sprintf("%s(%s)", call.Name, call.Arguments))
+	}
+	return strings.Join(cc, ", ")
+}
+
+// correct returns the system percept telling the agent about the loop and publishes the
+// detection.
+func (eg *Engine) correct(found *loopDetection, o engine.Options) percept.Percept {
+	eg.log.Info("loop detected", "method", "correct", "pattern", found.pattern, "iterNum", found.iter)
+	event := engine.MakeEvent(engine.EventLoop, found.iter)
+	event.Text = found.diagnostic
+	o.Publish(event)
+	return percept.MakeSystem(fmt.Sprintf(loopInstruction, found.diagnostic))
+}
+
+// stopLoop returns the engine.LoopError for a loop the agent did not leave after it was
+// warned.
+func (eg *Engine) stopLoop(found *loopDetection) error {
+	eg.log.Info("stop loop", "method", "stopLoop", "pattern", found.pattern, "iterNum", found.iter)
+	return &engine.LoopError{
+		Pattern:    found.pattern,
+		Iter:       found.iter,
+		Calls:      found.calls,
+		Diagnostic: found.diagnostic,
+	}
+}
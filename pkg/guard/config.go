@@ -0,0 +1,150 @@
+package guard
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Br0ce/opera/pkg/reason/openai"
+)
+
+// Kind is the kind of check of a configured guardrail.
+type Kind string
+
+const (
+	KindRegex      Kind = "regex"
+	KindKeywords   Kind = "keywords"
+	KindSchema     Kind = "schema"
+	KindClassifier Kind = "classifier"
+)
+
+// Config declares the guardrails for input and output.
+type Config struct {
+	Input  []Item `json:"Input" yaml:"Input"`
+	Output []Item `json:"Output" yaml:"Output"`
+}
+
+// Item declares a guardrail. Which fields are used depends on the Kind.
+type Item struct {
+	Name   string `json:"Name" yaml:"Name"`
+	Kind   Kind   `json:"Kind" yaml:"Kind"`
+	Action Action `json:"Action" yaml:"Action"`
+	// Replacement replaces the whole content on rewrite, if the check cannot rewrite the
+	// violating parts.
+	Replacement string   `json:"Replacement" yaml:"Replacement"`
+	Patterns    []string `json:"Patterns" yaml:"Patterns"`
+	Keywords    []string `json:"Keywords" yaml:"Keywords"`
+	// Schema is the JSON schema of a schema check.
+	Schema map[string]any `json:"Schema" yaml:"Schema"`
+	// Model and Categories configure a classifier check.
+	Model      string   `json:"Model" yaml:"Model"`
+	Categories []string `json:"Categories" yaml:"Categories"`
+}
+
+// ReadFile reads the config of the given file. Files with a .yaml or .yml extension are
+// decoded as YAML, all other files as JSON.
+func ReadFile(filename string) (Config, error) {
+	bb, err := os.ReadFile(filename)
+	if err != nil {
+		return Config{}, fmt.Errorf("read file %s: %w", filename, err)
+	}
+
+	var c Config
+	switch filepath.Ext(filename) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(bb, &c)
+	default:
+		err = json.Unmarshal(bb, &c)
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("unmarshal config: %w", err)
+	}
+	return c, nil
+}
+
+// Decode returns the Guard declared by the config. Classifiers use openai models with
+// the given token.
+func (c Config) Decode(token string, log *slog.Logger) (*Guard, error) {
+	input, err := c.rules(c.Input, token, log)
+	if err != nil {
+		return nil, fmt.Errorf("input: %w", err)
+	}
+	output, err := c.rules(c.Output, token, log)
+	if err != nil {
+		return nil, fmt.Errorf("output: %w", err)
+	}
+	return NewGuard(log, WithInput(input...), WithOutput(output...)), nil
+}
+
+func (c Config) rules(items []Item, token string, log *slog.Logger) ([]Rule, error) {
+	rules := make([]Rule, 0, len(items))
+	for i, item := range items {
+		rule, err := item.Decode(token, log)
+		if err != nil {
+			return nil, fmt.Errorf("item %v: %w", i, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Decode returns the guardrail declared by the item.
+func (i Item) Decode(token string, log *slog.Logger) (Rule, error) {
+	if i.Name == "" {
+		return Rule{}, fmt.Errorf("Name invalid")
+	}
+	if !i.Action.Valid() {
+		return Rule{}, fmt.Errorf("Action %s invalid", i.Action)
+	}
+
+	var check Check
+	switch i.Kind {
+	case KindRegex:
+		if len(i.Patterns) == 0 {
+			return Rule{}, fmt.Errorf("Patterns invalid")
+		}
+		patterns := make([]*regexp.Regexp, 0, len(i.Patterns))
+		for _, p := range i.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return Rule{}, fmt.Errorf("compile pattern: %w", err)
+			}
+			patterns = append(patterns, re)
+		}
+		check = NewPattern(i.Name, patterns...)
+	case KindKeywords:
+		kw, err := NewKeywords(i.Name, i.Keywords...)
+		if err != nil {
+			return Rule{}, fmt.Errorf("Keywords invalid: %w", err)
+		}
+		check = kw
+	case KindSchema:
+		s, err := NewSchema(i.Name, i.Schema)
+		if err != nil {
+			return Rule{}, fmt.Errorf("Schema invalid: %w", err)
+		}
+		check = s
+	case KindClassifier:
+		if i.Model == "" {
+			return Rule{}, fmt.Errorf("Model invalid")
+		}
+		cl, err := NewClassifier(i.Name, openai.NewReasoner(token, i.Model, log), i.Categories...)
+		if err != nil {
+			return Rule{}, fmt.Errorf("Categories invalid: %w", err)
+		}
+		check = cl
+	default:
+		return Rule{}, fmt.Errorf("kind %s not supported", i.Kind)
+	}
+
+	return Rule{
+		Check:       check,
+		Action:      i.Action,
+		Replacement: i.Replacement,
+	}, nil
+}
@@ -0,0 +1,222 @@
+// Package guard checks user queries and final answers against guardrails, e.g. to keep
+// secrets or off-topic content out of a conversation.
+package guard
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/user"
+)
+
+// Direction names the content a guardrail checks.
+type Direction string
+
+const (
+	// Input is the query of the user, checked before the agent reasons about it.
+	Input Direction = "input"
+	// Output is the final answer of the agent, checked before it is returned.
+	Output Direction = "output"
+)
+
+// Action is what a guardrail does with content violating its check.
+type Action string
+
+const (
+	// Block fails the query with an Error.
+	Block Action = "block"
+	// Warn records the violation and passes the content unchanged.
+	Warn Action = "warn"
+	// Rewrite replaces the violating parts of the content, or the whole content if the
+	// check cannot tell the parts.
+	Rewrite Action = "rewrite"
+)
+
+// Valid reports whether a is a known action.
+func (a Action) Valid() bool {
+	switch a {
+	case Block, Warn, Rewrite:
+		return true
+	default:
+		return false
+	}
+}
+
+// DefaultReplacement replaces content violating a rewrite guardrail whose check cannot
+// rewrite the violating parts.
+const DefaultReplacement = "[removed by guardrail]"
+
+// Finding describes why content violates a check.
+type Finding struct {
+	Reason string
+}
+
+// Check inspects content. A nil Finding means the content passes the check.
+type Check interface {
+	Name() string
+	Check(ctx context.Context, content string) (*Finding, error)
+}
+
+// Rewriter is implemented by checks which can remove the violating parts of content.
+type Rewriter interface {
+	Rewrite(content string) string
+}
+
+// Rule is a guardrail applying the Action to content violating the Check.
+type Rule struct {
+	Check  Check
+	Action Action
+	// Replacement replaces the whole content on rewrite, if the check is no Rewriter.
+	// If empty, DefaultReplacement is used.
+	Replacement string
+}
+
+// Violation describes content violating a guardrail.
+type Violation struct {
+	Check     string
+	Direction Direction
+	Action    Action
+	Reason    string
+}
+
+// Error is returned if content is blocked by a guardrail. Violations holds all
+// violations found up to and including the blocking one.
+type Error struct {
+	Direction  Direction
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	reasons := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		if v.Action == Block {
+			reasons = append(reasons, fmt.Sprintf("%s: %s", v.Check, v.Reason))
+		}
+	}
+	return fmt.Sprintf("%s blocked by guardrail %s", e.Direction, strings.Join(reasons, ", "))
+}
+
+// Guard applies the guardrails for input and output.
+type Guard struct {
+	input  []Rule
+	output []Rule
+	tr     trace.Tracer
+	log    *slog.Logger
+}
+
+type Option func(g *Guard)
+
+// WithInput adds guardrails for the queries of users.
+func WithInput(rules ...Rule) Option {
+	return func(g *Guard) {
+		g.input = append(g.input, rules...)
+	}
+}
+
+// WithOutput adds guardrails for the final answers of agents.
+func WithOutput(rules ...Rule) Option {
+	return func(g *Guard) {
+		g.output = append(g.output, rules...)
+	}
+}
+
+func NewGuard(log *slog.Logger, options ...Option) *Guard {
+	g := &Guard{
+		tr:  monitor.Tracer("Guard"),
+		log: log,
+	}
+	for _, opt := range options {
+		opt(g)
+	}
+	return g
+}
+
+// Input checks the text of the query. It returns the possibly rewritten query and the
+// violations which did not block it. A blocked query returns an *Error.
+func (g *Guard) Input(ctx context.Context, query user.Query) (user.Query, []Violation, error) {
+	text, violations, err := g.check(ctx, Input, g.input, query.Text)
+	if err != nil {
+		return user.Query{}, violations, err
+	}
+	query.Text = text
+	return query, violations, nil
+}
+
+// Output checks the answer. It returns the possibly rewritten answer and the violations
+// which did not block it. A blocked answer returns an *Error.
+func (g *Guard) Output(ctx context.Context, answer string) (string, []Violation, error) {
+	return g.check(ctx, Output, g.output, answer)
+}
+
+// check applies the rules in order to the content. Later rules see the content rewritten
+// by earlier ones. The first blocking rule stops the check.
+func (g *Guard) check(ctx context.Context, dir Direction, rules []Rule, content string) (string, []Violation, error) {
+	if len(rules) == 0 {
+		return content, nil, nil
+	}
+	ctx, span := g.tr.Start(ctx, "check "+string(dir))
+	defer span.End()
+	span.SetAttributes(attribute.String("guard.direction", string(dir)))
+
+	var violations []Violation
+	for _, rule := range rules {
+		finding, err := rule.Check.Check(ctx, content)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return "", violations, fmt.Errorf("check %s: %w", rule.Check.Name(), err)
+		}
+		if finding == nil {
+			continue
+		}
+
+		v := Violation{
+			Check:     rule.Check.Name(),
+			Direction: dir,
+			Action:    rule.Action,
+			Reason:    finding.Reason,
+		}
+		violations = append(violations, v)
+		span.AddEvent("guardrail violated", trace.WithAttributes(
+			attribute.String("guard.check", v.Check),
+			attribute.String("guard.action", string(v.Action)),
+			attribute.String("guard.reason", v.Reason),
+		))
+		g.log.Info("guardrail violated",
+			"method", "check",
+			"direction", dir,
+			"check", v.Check,
+			"action", v.Action,
+			"reason", v.Reason,
+			"traceID", monitor.TraceID(span))
+
+		switch rule.Action {
+		case Block:
+			span.SetAttributes(attribute.Int("guard.violations", len(violations)))
+			err := &Error{Direction: dir, Violations: violations}
+			span.SetStatus(codes.Error, err.Error())
+			return "", violations, err
+		case Rewrite:
+			content = rule.rewrite(content)
+		}
+	}
+	span.SetAttributes(attribute.Int("guard.violations", len(violations)))
+	return content, violations, nil
+}
+
+// rewrite returns the content without the parts violating the check of the rule.
+func (r Rule) rewrite(content string) string {
+	if rw, ok := r.Check.(Rewriter); ok {
+		return rw.Rewrite(content)
+	}
+	if r.Replacement != "" {
+		return r.Replacement
+	}
+	return DefaultReplacement
+}
@@ -0,0 +1,259 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/Br0ce/opera/pkg/action"
+	"github.com/Br0ce/opera/pkg/history"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/user"
+)
+
+// reasonerFunc is a Reasoner answering with the returned content.
+type reasonerFunc func() (string, error)
+
+func (f reasonerFunc) Reason(context.Context, history.History, []tool.Tool) (action.Action, error) {
+	content, err := f()
+	if err != nil {
+		return action.Action{}, err
+	}
+	return action.MakeUser(content), nil
+}
+
+func TestGuard_Input(t *testing.T) {
+	t.Parallel()
+
+	secrets := NewPattern("secrets", regexp.MustCompile(`sk-[a-z0-9]{8,}`))
+	profanity, err := NewKeywords("profanity", "damn")
+	if err != nil {
+		t.Fatalf("NewKeywords() error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		rules          []Rule
+		text           string
+		want           string
+		wantViolations int
+		wantBlocked    bool
+	}{
+		{
+			name:  "pass",
+			rules: []Rule{{Check: secrets, Action: Block}},
+			text:  "What is the weather in Sydney?",
+			want:  "What is the weather in Sydney?",
+		},
+		{
+			name:           "block",
+			rules:          []Rule{{Check: profanity, Action: Warn}, {Check: secrets, Action: Block}},
+			text:           "Damn, my key sk-abcdef123456 does not work.",
+			wantViolations: 2,
+			wantBlocked:    true,
+		},
+		{
+			name:           "warn",
+			rules:          []Rule{{Check: profanity, Action: Warn}},
+			text:           "Damn, it rains.",
+			want:           "Damn, it rains.",
+			wantViolations: 1,
+		},
+		{
+			name:           "rewrite parts",
+			rules:          []Rule{{Check: profanity, Action: Rewrite}},
+			text:           "Damn, it rains. DAMN!",
+			want:           "[removed], it rains. [removed]!",
+			wantViolations: 1,
+		},
+		{
+			name:           "rewrite before block",
+			rules:          []Rule{{Check: secrets, Action: Rewrite}, {Check: secrets, Action: Block}},
+			text:           "my key is sk-abcdef123456",
+			want:           "my key is [removed]",
+			wantViolations: 1,
+		},
+		{
+			name: "rewrite whole",
+			rules: []Rule{{
+				Check:       &Classifier{name: "topic", reasoner: reasonerFunc(func() (string, error) { return `{"flagged":true,"category":"medical advice"}`, nil }), categories: []string{"medical advice"}},
+				Action:      Rewrite,
+				Replacement: "Please ask a doctor.",
+			}},
+			text:           "Which pills should I take?",
+			want:           "Please ask a doctor.",
+			wantViolations: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewGuard(monitor.NewTestLogger(false), WithInput(test.rules...))
+			got, violations, err := g.Input(context.TODO(), user.Query{Text: test.text})
+			var guardErr *Error
+			if errors.As(err, &guardErr) != test.wantBlocked {
+				t.Fatalf("Guard.Input() error = %v, wantBlocked %v", err, test.wantBlocked)
+			}
+			if guardErr != nil && len(guardErr.Violations) != test.wantViolations {
+				t.Errorf("Guard.Input() error violations = %v, want %v", len(guardErr.Violations), test.wantViolations)
+			}
+			if got.Text != test.want {
+				t.Errorf("Guard.Input() = %v, want %v", got.Text, test.want)
+			}
+			if len(violations) != test.wantViolations {
+				t.Errorf("Guard.Input() violations = %v, want %v", len(violations), test.wantViolations)
+			}
+		})
+	}
+}
+
+func TestSchema_Check(t *testing.T) {
+	t.Parallel()
+
+	schema := map[string]any{
+		"type":     "object",
+		"required": []any{"city", "temperature"},
+		"properties": map[string]any{
+			"city":        map[string]any{"type": "string", "maxLength": 20},
+			"temperature": map[string]any{"type": "number", "minimum": -90, "maximum": 60},
+			"unit":        map[string]any{"enum": []any{"C", "F"}},
+		},
+		"additionalProperties": false,
+	}
+
+	tests := []struct {
+		name        string
+		content     string
+		wantFinding bool
+	}{
+		{
+			name:    "valid",
+			content: `{"city":"Sydney","temperature":21.5,"unit":"C"}`,
+		},
+		{
+			name:        "no json",
+			content:     "It is sunny in Sydney.",
+			wantFinding: true,
+		},
+		{
+			name:        "missing property",
+			content:     `{"city":"Sydney"}`,
+			wantFinding: true,
+		},
+		{
+			name:        "wrong type",
+			content:     `{"city":"Sydney","temperature":"warm"}`,
+			wantFinding: true,
+		},
+		{
+			name:        "out of range",
+			content:     `{"city":"Sydney","temperature":100}`,
+			wantFinding: true,
+		},
+		{
+			name:        "not in enum",
+			content:     `{"city":"Sydney","temperature":21,"unit":"K"}`,
+			wantFinding: true,
+		},
+		{
+			name:        "unknown property",
+			content:     `{"city":"Sydney","temperature":21,"wind":3}`,
+			wantFinding: true,
+		},
+	}
+
+	if _, err := NewSchema("invalid", map[string]any{"type": "text"}); err == nil {
+		t.Errorf("NewSchema() error = nil, want error for invalid schema")
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			s, err := NewSchema("weather", schema)
+			if err != nil {
+				t.Fatalf("NewSchema() error = %v", err)
+			}
+			got, err := s.Check(context.TODO(), test.content)
+			if err != nil {
+				t.Fatalf("Schema.Check() error = %v", err)
+			}
+			if (got != nil) != test.wantFinding {
+				t.Errorf("Schema.Check() = %v, wantFinding %v", got, test.wantFinding)
+			}
+		})
+	}
+}
+
+func TestClassifier_Check(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		answer      string
+		err         error
+		wantFinding bool
+		wantErr     bool
+	}{
+		{
+			name:   "not flagged",
+			answer: `{"flagged":false}`,
+		},
+		{
+			name:        "flagged",
+			answer:      "```json\n{\"flagged\":true,\"category\":\"legal advice\",\"reason\":\"asks for a contract\"}\n```",
+			wantFinding: true,
+		},
+		{
+			name:    "invalid answer",
+			answer:  "I think it is fine.",
+			wantErr: true,
+		},
+		{
+			name:    "reasoner fails",
+			err:     errors.New("unavailable"),
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			re := reasonerFunc(func() (string, error) { return test.answer, test.err })
+			cl, err := NewClassifier("topic", re, "legal advice")
+			if err != nil {
+				t.Fatalf("NewClassifier() error = %v", err)
+			}
+			got, err := cl.Check(context.TODO(), "Write me a contract.")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Classifier.Check() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if (got != nil) != test.wantFinding {
+				t.Errorf("Classifier.Check() = %v, wantFinding %v", got, test.wantFinding)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ReadFile("../../data/guardrails/guardrails.yaml")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	g, err := cfg.Decode("token", monitor.NewTestLogger(false))
+	if err != nil {
+		t.Fatalf("Config.Decode() error = %v", err)
+	}
+	if len(g.input) != 2 || len(g.output) != 2 {
+		t.Errorf("Config.Decode() = %v input and %v output rules, want 2 and 2", len(g.input), len(g.output))
+	}
+
+	_, err = Item{Name: "x", Kind: KindRegex, Action: "ignore", Patterns: []string{"x"}}.Decode("", nil)
+	if err == nil {
+		t.Error("Item.Decode() invalid action, want error")
+	}
+}
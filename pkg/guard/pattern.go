@@ -0,0 +1,68 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PatternReplacement replaces the matches of a Pattern check on rewrite.
+const PatternReplacement = "[removed]"
+
+// Pattern checks content for matches of regular expressions.
+type Pattern struct {
+	name     string
+	patterns []*regexp.Regexp
+}
+
+// NewPattern returns a check with the given name finding the given patterns.
+func NewPattern(name string, patterns ...*regexp.Regexp) *Pattern {
+	return &Pattern{
+		name:     name,
+		patterns: patterns,
+	}
+}
+
+// NewKeywords returns a check with the given name finding the given keywords as whole
+// words, regardless of case.
+func NewKeywords(name string, keywords ...string) (*Pattern, error) {
+	if len(keywords) == 0 {
+		return nil, fmt.Errorf("no keywords")
+	}
+	quoted := make([]string, 0, len(keywords))
+	for _, kw := range keywords {
+		if strings.TrimSpace(kw) == "" {
+			return nil, fmt.Errorf("empty keyword")
+		}
+		quoted = append(quoted, regexp.QuoteMeta(kw))
+	}
+	re, err := regexp.Compile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)
+	if err != nil {
+		return nil, fmt.Errorf("compile keywords: %w", err)
+	}
+	return NewPattern(name, re), nil
+}
+
+func (p *Pattern) Name() string {
+	return p.name
+}
+
+// Check finds the first match of the patterns. The match itself is not part of the
+// reason, as it may be a secret.
+func (p *Pattern) Check(_ context.Context, content string) (*Finding, error) {
+	for _, re := range p.patterns {
+		if loc := re.FindStringIndex(content); loc != nil {
+			return &Finding{Reason: fmt.Sprintf("content matches %s at %v", re.String(), loc[0])}, nil
+		}
+	}
+	return nil, nil
+}
+
+// Rewrite replaces all matches of the patterns with PatternReplacement.
+func (p *Pattern) Rewrite(content string) string {
+	for _, re := range p.patterns {
+		content = re.ReplaceAllString(content, PatternReplacement)
+	}
+	return content
+}
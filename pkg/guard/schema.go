@@ -0,0 +1,42 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Br0ce/opera/pkg/schema"
+)
+
+// Schema checks that content is a JSON document valid against a JSON schema, e.g. to
+// enforce a structured answer. See package schema for the supported keywords.
+type Schema struct {
+	name   string
+	schema *schema.Schema
+}
+
+// NewSchema returns a check with the given name validating content against the schema.
+func NewSchema(name string, doc map[string]any) (*Schema, error) {
+	if len(doc) == 0 {
+		return nil, fmt.Errorf("empty schema")
+	}
+	s, err := schema.Compile(doc)
+	if err != nil {
+		return nil, fmt.Errorf("compile schema: %w", err)
+	}
+	return &Schema{
+		name:   name,
+		schema: s,
+	}, nil
+}
+
+func (s *Schema) Name() string {
+	return s.name
+}
+
+func (s *Schema) Check(_ context.Context, content string) (*Finding, error) {
+	err := s.schema.ValidateJSON([]byte(content))
+	if err != nil {
+		return &Finding{Reason: err.Error()}, nil
+	}
+	return nil, nil
+}
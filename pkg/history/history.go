@@ -1,7 +1,10 @@
 package history
 
 import (
+	"encoding/json"
+	"fmt"
 	"iter"
+	"slices"
 	"time"
 
 	"github.com/Br0ce/opera/pkg/action"
@@ -43,6 +46,21 @@ func (h *History) AddAction(action action.Action) {
 	}
 }
 
+// ReviseAnswer replaces the content of the last event, if it is an answer of the
+// assistant, and reports whether it did.
+func (h *History) ReviseAnswer(content string) bool {
+	if len(h.events) == 0 {
+		return false
+	}
+	assist, ok := h.events[len(h.events)-1].(Assistant)
+	if !ok {
+		return false
+	}
+	assist.Content = content
+	h.events[len(h.events)-1] = assist
+	return true
+}
+
 func (h *History) All() iter.Seq2[int, any] {
 	return func(yield func(int, any) bool) {
 		for i, e := range h.events {
@@ -53,6 +71,18 @@ func (h *History) All() iter.Seq2[int, any] {
 	}
 }
 
+// Len returns the number of events in the history.
+func (h *History) Len() int {
+	return len(h.events)
+}
+
+// Clone returns a copy of the history which does not share its events with h.
+func (h *History) Clone() History {
+	return History{
+		events: slices.Clone(h.events),
+	}
+}
+
 // events returns the given perceptions as a slice of Events.
 func events(percepts []percept.Percept) []any {
 	ee := make([]any, 0, len(percepts))
@@ -72,7 +102,88 @@ func events(percepts []percept.Percept) []any {
 				Created: time.Now().UTC(),
 			}
 			ee = append(ee, to)
+			continue
+		}
+
+		if content, ok := percept.System(); ok {
+			sys := System{
+				Content: content,
+				Created: time.Now().UTC(),
+			}
+			ee = append(ee, sys)
 		}
 	}
 	return ee
 }
+
+type eventJSON struct {
+	Type  string          `json:"type"`
+	Event json.RawMessage `json:"event"`
+}
+
+// MarshalJSON encodes the events of the history, e.g. to persist it in a checkpoint.
+func (h History) MarshalJSON() ([]byte, error) {
+	ee := make([]eventJSON, 0, len(h.events))
+	for _, event := range h.events {
+		var typ string
+		switch event.(type) {
+		case System:
+			typ = "system"
+		case User:
+			typ = "user"
+		case Assistant:
+			typ = "assistant"
+		case ToolCalls:
+			typ = "toolCalls"
+		case ToolResponse:
+			typ = "toolResponse"
+		default:
+			return nil, fmt.Errorf("unknown event type %T", event)
+		}
+		bb, err := json.Marshal(event)
+		if err != nil {
+			return nil, fmt.Errorf("marshal %s event: %w", typ, err)
+		}
+		ee = append(ee, eventJSON{Type: typ, Event: bb})
+	}
+	return json.Marshal(ee)
+}
+
+func (h *History) UnmarshalJSON(data []byte) error {
+	var ee []eventJSON
+	err := json.Unmarshal(data, &ee)
+	if err != nil {
+		return err
+	}
+
+	events := make([]any, 0, len(ee))
+	for _, e := range ee {
+		var event any
+		switch e.Type {
+		case "system":
+			event, err = decode[System](e.Event)
+		case "user":
+			event, err = decode[User](e.Event)
+		case "assistant":
+			event, err = decode[Assistant](e.Event)
+		case "toolCalls":
+			event, err = decode[ToolCalls](e.Event)
+		case "toolResponse":
+			event, err = decode[ToolResponse](e.Event)
+		default:
+			return fmt.Errorf("unknown event type %s", e.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("unmarshal %s event: %w", e.Type, err)
+		}
+		events = append(events, event)
+	}
+	h.events = events
+	return nil
+}
+
+func decode[T any](data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
@@ -7,14 +7,34 @@ import (
 )
 
 const (
-	agentPrefix = "age"
-	seperator   = "-"
+	agentPrefix      = "age"
+	approvalPrefix   = "apr"
+	checkpointPrefix = "chk"
+	jobPrefix        = "job"
+	threadPrefix     = "thr"
+	seperator        = "-"
 )
 
 func UniqueAgent() string {
 	return agentPrefix + seperator + unique()
 }
 
+func UniqueApproval() string {
+	return approvalPrefix + seperator + unique()
+}
+
+func UniqueCheckpoint() string {
+	return checkpointPrefix + seperator + unique()
+}
+
+func UniqueJob() string {
+	return jobPrefix + seperator + unique()
+}
+
+func UniqueThread() string {
+	return threadPrefix + seperator + unique()
+}
+
 func Valid(id string) bool {
 	ii := strings.Split(id, "-")
 
@@ -23,7 +43,7 @@ func Valid(id string) bool {
 	}
 
 	switch ii[0] {
-	case agentPrefix:
+	case agentPrefix, approvalPrefix, checkpointPrefix, jobPrefix, threadPrefix:
 		return valid(ii[1])
 	default:
 		return false
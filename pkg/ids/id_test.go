@@ -35,6 +35,26 @@ func TestValid(t *testing.T) {
 			id:   UniqueAgent(),
 			want: true,
 		},
+		{
+			name: "valid approval id",
+			id:   UniqueApproval(),
+			want: true,
+		},
+		{
+			name: "valid checkpoint id",
+			id:   UniqueCheckpoint(),
+			want: true,
+		},
+		{
+			name: "valid job id",
+			id:   UniqueJob(),
+			want: true,
+		},
+		{
+			name: "valid thread id",
+			id:   UniqueThread(),
+			want: true,
+		},
 		{
 			name: "empty id",
 			id:   "",
@@ -0,0 +1,60 @@
+package job
+
+import (
+	"time"
+
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+type Status string
+
+const (
+	Queued    Status = "queued"
+	Running   Status = "running"
+	Pending   Status = "pending"
+	Partial   Status = "partial"
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+	Canceled  Status = "canceled"
+)
+
+// Job is a query that runs asynchronously in a pool.Pool.
+type Job struct {
+	ID       string
+	AgentID  string
+	ThreadID string
+	Status   Status
+	// Result is the answer of a succeeded job or the final answer of a partial job.
+	Result string
+	// Err describes why a job failed.
+	Err string
+	// Findings are the tool responses of a job which reached its iteration limit or
+	// its deadline.
+	Findings []tool.Response
+	// ApprovalID is the approval request a pending job waits for.
+	ApprovalID string
+	Created    time.Time
+	Started    time.Time
+	Finished   time.Time
+}
+
+// MakeJob returns a queued Job for the thread with the given threadID of the agent with
+// the given agentID.
+func MakeJob(agentID string, threadID string) Job {
+	return Job{
+		AgentID:  agentID,
+		ThreadID: threadID,
+		Status:   Queued,
+		Created:  time.Now().UTC(),
+	}
+}
+
+// Done reports whether the job has finished running.
+func (j Job) Done() bool {
+	switch j.Status {
+	case Pending, Partial, Succeeded, Failed, Canceled:
+		return true
+	default:
+		return false
+	}
+}
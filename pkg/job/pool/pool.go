@@ -0,0 +1,241 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/job"
+	"github.com/Br0ce/opera/pkg/monitor"
+)
+
+var (
+	ErrQueueFull = errors.New("job queue full")
+	ErrDone      = errors.New("job done")
+)
+
+// Func runs the query of a job and returns its answer. The context is canceled if the
+// job is canceled.
+type Func func(ctx context.Context) (string, error)
+
+type task struct {
+	id string
+	fn Func
+	// sc links the run of the job to the trace of its submission.
+	sc trace.SpanContext
+}
+
+// Pool runs jobs with a bounded number of workers. Finished jobs are retained for the
+// ttl of the pool before they are removed.
+type Pool struct {
+	jobs    db.Job
+	queue   chan task
+	workers int
+	ttl     time.Duration
+	// mu serializes the state changes of the jobs.
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+	tr      trace.Tracer
+	log     *slog.Logger
+}
+
+// NewPool returns a Pool with the given number of workers, which queues up to queueSize
+// jobs. The pool does not run jobs before Start is called.
+func NewPool(jobs db.Job, workers int, queueSize int, ttl time.Duration, log *slog.Logger) *Pool {
+	return &Pool{
+		jobs:    jobs,
+		queue:   make(chan task, queueSize),
+		workers: workers,
+		ttl:     ttl,
+		cancels: make(map[string]context.CancelFunc),
+		tr:      monitor.Tracer("JobPool"),
+		log:     log,
+	}
+}
+
+// Start starts the workers and the removal of expired jobs. All running jobs are
+// canceled when the given context is done.
+func (p *Pool) Start(ctx context.Context) {
+	for range p.workers {
+		go p.work(ctx)
+	}
+	go p.cleanup(ctx)
+}
+
+// Submit queues the given job, which is run with fn, and returns the job id.
+// If the queue is full, ErrQueueFull is returned.
+func (p *Pool) Submit(ctx context.Context, j job.Job, fn Func) (string, error) {
+	id, err := p.jobs.Add(j)
+	if err != nil {
+		return "", fmt.Errorf("add job: %w", err)
+	}
+
+	select {
+	case p.queue <- task{id: id, fn: fn, sc: trace.SpanContextFromContext(ctx)}:
+		p.log.Debug("job submitted", "method", "Submit", "id", id)
+		return id, nil
+	default:
+		err := p.jobs.Delete(id)
+		if err != nil {
+			p.log.Error("delete rejected job", "method", "Submit", "id", id, "error", err)
+		}
+		return "", ErrQueueFull
+	}
+}
+
+// Get returns the job with the given id.
+func (p *Pool) Get(id string) (job.Job, error) {
+	return p.jobs.Get(id)
+}
+
+// Cancel cancels the job with the given id. A queued job is canceled right away, the
+// context of a running job is canceled and the job finishes once its Func returns.
+// If the job is already done, ErrDone is returned.
+func (p *Pool) Cancel(id string) (job.Job, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	j, err := p.jobs.Get(id)
+	if err != nil {
+		return job.Job{}, fmt.Errorf("get job: %w", err)
+	}
+	if j.Done() {
+		return j, ErrDone
+	}
+
+	if cancel, ok := p.cancels[id]; ok {
+		cancel()
+		return j, nil
+	}
+
+	j.Status = job.Canceled
+	j.Finished = time.Now().UTC()
+	err = p.jobs.Update(id, j)
+	if err != nil {
+		return job.Job{}, fmt.Errorf("update job: %w", err)
+	}
+	return j, nil
+}
+
+func (p *Pool) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-p.queue:
+			p.run(ctx, t)
+		}
+	}
+}
+
+// run runs the job of the given task, unless it has been canceled while queued.
+func (p *Pool) run(ctx context.Context, t task) {
+	ctx, span := p.tr.Start(trace.ContextWithSpanContext(ctx, t.sc), "run job")
+	defer span.End()
+	span.SetAttributes(attribute.String("job.id", t.id))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p.mu.Lock()
+	j, err := p.jobs.Get(t.id)
+	if err != nil || j.Status != job.Queued {
+		p.mu.Unlock()
+		return
+	}
+	j.Status = job.Running
+	j.Started = time.Now().UTC()
+	err = p.jobs.Update(t.id, j)
+	if err != nil {
+		p.mu.Unlock()
+		p.log.Error("update job", "method", "run", "id", t.id, "error", err)
+		return
+	}
+	p.cancels[t.id] = cancel
+	p.mu.Unlock()
+
+	p.log.Debug("run job", "method", "run", "id", t.id, "traceID", monitor.TraceID(span))
+	res, err := t.fn(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.cancels, t.id)
+
+	j = finish(j, res, err, ctx.Err())
+	span.SetAttributes(attribute.String("job.status", string(j.Status)))
+	if j.Status == job.Failed {
+		span.SetStatus(codes.Error, j.Err)
+	}
+	err = p.jobs.Update(t.id, j)
+	if err != nil {
+		p.log.Error("update job", "method", "run", "id", t.id, "error", err)
+	}
+}
+
+// finish sets the status of the job based on the result of its Func and the error of
+// its context.
+func finish(j job.Job, res string, err error, ctxErr error) job.Job {
+	j.Finished = time.Now().UTC()
+
+	var pendingErr *engine.PendingError
+	var partialErr *engine.PartialError
+	switch {
+	case errors.As(err, &pendingErr):
+		j.Status = job.Pending
+		j.ApprovalID = pendingErr.Request.ID
+	case errors.As(err, &partialErr):
+		j.Status = job.Partial
+		j.Result = partialErr.Text
+		j.Findings = partialErr.Findings
+	case ctxErr != nil:
+		j.Status = job.Canceled
+	case err != nil:
+		j.Status = job.Failed
+		j.Err = err.Error()
+	default:
+		j.Status = job.Succeeded
+		j.Result = res
+	}
+	return j
+}
+
+func (p *Pool) cleanup(ctx context.Context) {
+	tick := time.NewTicker(max(p.ttl/2, time.Second))
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			p.expire(now)
+		}
+	}
+}
+
+// expire removes all jobs which have been done for longer than the ttl.
+func (p *Pool) expire(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for j := range p.jobs.All() {
+		if !j.Done() || now.Sub(j.Finished) < p.ttl {
+			continue
+		}
+		err := p.jobs.Delete(j.ID)
+		if err != nil {
+			p.log.Error("delete expired job", "method", "expire", "id", j.ID, "error", err)
+			continue
+		}
+		p.log.Debug("job expired", "method", "expire", "id", j.ID)
+	}
+}
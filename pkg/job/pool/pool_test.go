@@ -0,0 +1,202 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/approval"
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/db/inmem"
+	"github.com/Br0ce/opera/pkg/engine"
+	"github.com/Br0ce/opera/pkg/job"
+	"github.com/Br0ce/opera/pkg/monitor"
+)
+
+// waitDone polls the job with the given id until it is done.
+func waitDone(t *testing.T, p *Pool, id string) job.Job {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		j, err := p.Get(id)
+		if err != nil {
+			t.Fatalf("get job: %s", err.Error())
+		}
+		if j.Done() {
+			return j
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s not done", id)
+	return job.Job{}
+}
+
+func TestPool_Submit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		fn         Func
+		wantStatus job.Status
+		wantResult string
+		wantErr    string
+		wantApr    string
+	}{
+		{
+			name: "succeeded",
+			fn: func(_ context.Context) (string, error) {
+				return "the answer", nil
+			},
+			wantStatus: job.Succeeded,
+			wantResult: "the answer",
+		},
+		{
+			name: "failed",
+			fn: func(_ context.Context) (string, error) {
+				return "", errors.New("boom")
+			},
+			wantStatus: job.Failed,
+			wantErr:    "boom",
+		},
+		{
+			name: "pending",
+			fn: func(_ context.Context) (string, error) {
+				return "", &engine.PendingError{Request: approval.Request{ID: "apr-1"}}
+			},
+			wantStatus: job.Pending,
+			wantApr:    "apr-1",
+		},
+		{
+			name: "partial",
+			fn: func(_ context.Context) (string, error) {
+				return "", &engine.PartialError{MaxIter: 3}
+			},
+			wantStatus: job.Partial,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			p := NewPool(inmem.NewJobDB(), 1, 1, time.Minute, monitor.NewTestLogger(false))
+			p.Start(ctx)
+
+			id, err := p.Submit(ctx, job.MakeJob("age-1", "thr-1"), test.fn)
+			if err != nil {
+				t.Fatalf("Pool.Submit() error = %v", err)
+			}
+
+			got := waitDone(t, p, id)
+			if got.Status != test.wantStatus {
+				t.Errorf("Pool.Submit() status = %v, want %v", got.Status, test.wantStatus)
+			}
+			if got.Result != test.wantResult {
+				t.Errorf("Pool.Submit() result = %v, want %v", got.Result, test.wantResult)
+			}
+			if got.Err != test.wantErr {
+				t.Errorf("Pool.Submit() err = %v, want %v", got.Err, test.wantErr)
+			}
+			if got.ApprovalID != test.wantApr {
+				t.Errorf("Pool.Submit() approvalID = %v, want %v", got.ApprovalID, test.wantApr)
+			}
+		})
+	}
+}
+
+func TestPool_SubmitQueueFull(t *testing.T) {
+	t.Parallel()
+
+	// Without Start no job is taken from the queue.
+	p := NewPool(inmem.NewJobDB(), 1, 1, time.Minute, monitor.NewTestLogger(false))
+	fn := func(_ context.Context) (string, error) {
+		return "", nil
+	}
+
+	_, err := p.Submit(context.TODO(), job.MakeJob("age-1", "thr-1"), fn)
+	if err != nil {
+		t.Fatalf("Pool.Submit() error = %v", err)
+	}
+	_, err = p.Submit(context.TODO(), job.MakeJob("age-1", "thr-1"), fn)
+	if !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Pool.Submit() error = %v, want %v", err, ErrQueueFull)
+	}
+}
+
+func TestPool_Cancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewPool(inmem.NewJobDB(), 1, 2, time.Minute, monitor.NewTestLogger(false))
+	p.Start(ctx)
+
+	started := make(chan struct{})
+	running, err := p.Submit(ctx, job.MakeJob("age-1", "thr-1"), func(ctx context.Context) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	if err != nil {
+		t.Fatalf("Pool.Submit() error = %v", err)
+	}
+	<-started
+
+	// The single worker is busy, so the second job stays queued.
+	queued, err := p.Submit(ctx, job.MakeJob("age-1", "thr-1"), func(_ context.Context) (string, error) {
+		return "not canceled", nil
+	})
+	if err != nil {
+		t.Fatalf("Pool.Submit() error = %v", err)
+	}
+
+	for _, id := range []string{queued, running} {
+		_, err = p.Cancel(id)
+		if err != nil {
+			t.Fatalf("Pool.Cancel() error = %v", err)
+		}
+		got := waitDone(t, p, id)
+		if got.Status != job.Canceled {
+			t.Errorf("Pool.Cancel() status = %v, want %v", got.Status, job.Canceled)
+		}
+	}
+
+	_, err = p.Cancel(running)
+	if !errors.Is(err, ErrDone) {
+		t.Errorf("Pool.Cancel() error = %v, want %v", err, ErrDone)
+	}
+}
+
+func TestPool_expire(t *testing.T) {
+	t.Parallel()
+
+	jobs := inmem.NewJobDB()
+	p := NewPool(jobs, 1, 1, time.Minute, monitor.NewTestLogger(false))
+
+	now := time.Now().UTC()
+	add := func(status job.Status, finished time.Time) string {
+		j := job.MakeJob("age-1", "thr-1")
+		j.Status = status
+		j.Finished = finished
+		id, err := jobs.Add(j)
+		if err != nil {
+			t.Fatalf("add job: %s", err.Error())
+		}
+		return id
+	}
+	expired := add(job.Succeeded, now.Add(-2*time.Minute))
+	retained := add(job.Failed, now.Add(-30*time.Second))
+	queued := add(job.Queued, time.Time{})
+
+	p.expire(now)
+
+	if _, err := jobs.Get(expired); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("Pool.expire() expired job error = %v, want %v", err, db.ErrNotFound)
+	}
+	for _, id := range []string{retained, queued} {
+		if _, err := jobs.Get(id); err != nil {
+			t.Errorf("Pool.expire() job %s removed: %v", id, err)
+		}
+	}
+}
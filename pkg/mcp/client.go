@@ -0,0 +1,332 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/monitor"
+)
+
+// ErrClosed is returned by calls to a closed client or to a server which went away.
+var ErrClosed = errors.New("client closed")
+
+// maxPages limits the pages of a list, in case a server keeps returning cursors.
+const maxPages = 100
+
+// cancelTimeout limits sending the notification that a request was cancelled.
+const cancelTimeout = time.Second
+
+// conn carries the messages between the client and a server. Messages received from
+// the server are passed to the handle function of the client.
+type conn interface {
+	send(ctx context.Context, msg message) error
+	// initialized is called once the protocol version is negotiated.
+	initialized(version string)
+	close(ctx context.Context) error
+}
+
+// Client is a connection to an MCP server. It is safe for concurrent use.
+type Client struct {
+	conn    conn
+	nextID  atomic.Int64
+	mu      sync.Mutex
+	pending map[string]chan message
+	done    chan struct{}
+	err     error
+	notify  func(method string, params json.RawMessage)
+	info    Implementation
+	caps    Capabilities
+	version string
+	tr      trace.Tracer
+	log     *slog.Logger
+}
+
+type Option func(c *Client)
+
+// WithNotificationHandler passes the notifications of the server to fn, e.g.
+// notifications/tools/list_changed. fn must not block, it is called by the reader of the
+// connection.
+func WithNotificationHandler(fn func(method string, params json.RawMessage)) Option {
+	return func(c *Client) {
+		c.notify = fn
+	}
+}
+
+func newClient(log *slog.Logger, options ...Option) *Client {
+	c := &Client{
+		pending: make(map[string]chan message),
+		done:    make(chan struct{}),
+		tr:      monitor.Tracer("MCPClient"),
+		log:     log,
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+	return c
+}
+
+// start initializes the session with the server over conn.
+func (c *Client) start(ctx context.Context, conn conn) error {
+	c.conn = conn
+	err := c.initialize(ctx)
+	if err != nil {
+		_ = c.Close(ctx)
+		return fmt.Errorf("initialize: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	params := initializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      Implementation{Name: "opera", Version: "1.0.0"},
+	}
+	var result initializeResult
+	err := c.call(ctx, MethodInitialize, params, &result)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(supportedVersions, result.ProtocolVersion) {
+		return fmt.Errorf("protocol version %s not supported", result.ProtocolVersion)
+	}
+	c.info = result.ServerInfo
+	c.caps = result.Capabilities
+	c.version = result.ProtocolVersion
+	c.conn.initialized(result.ProtocolVersion)
+
+	return c.send(ctx, message{JSONRPC: "2.0", Method: NotificationInitialized})
+}
+
+// ServerInfo returns the name and version of the server.
+func (c *Client) ServerInfo() Implementation {
+	return c.info
+}
+
+// Capabilities returns the capabilities of the server.
+func (c *Client) Capabilities() Capabilities {
+	return c.caps
+}
+
+// Done is closed once the client is closed or the connection to the server is lost.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the client is done, or nil if it is not.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// ListTools returns all tools of the server.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	ctx, span := c.tr.Start(ctx, "list tools")
+	defer span.End()
+	c.log.Debug("list tools", "method", "ListTools", "traceID", monitor.TraceID(span))
+
+	var tools []Tool
+	var cursor string
+	for range maxPages {
+		var result listToolsResult
+		err := c.call(ctx, MethodToolsList, listToolsParams{Cursor: cursor}, &result)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, fmt.Errorf("list tools: %w", err)
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			span.SetAttributes(attribute.Int("mcp.tools", len(tools)))
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+	return nil, fmt.Errorf("list tools: more than %v pages", maxPages)
+}
+
+// CallTool calls the tool with the given name and arguments, a JSON object. Empty
+// arguments are an empty object. A result with IsError set is no error.
+func (c *Client) CallTool(ctx context.Context, name string, arguments json.RawMessage) (CallToolResult, error) {
+	ctx, span := c.tr.Start(ctx, "call tool")
+	defer span.End()
+	span.SetAttributes(attribute.String("mcp.tool", name))
+	c.log.Debug("call tool", "method", "CallTool", "tool", name, "traceID", monitor.TraceID(span))
+
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	var result CallToolResult
+	err := c.call(ctx, MethodToolsCall, callToolParams{Name: name, Arguments: arguments}, &result)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return CallToolResult{}, fmt.Errorf("call tool %s: %w", name, err)
+	}
+	span.SetAttributes(attribute.Bool("mcp.error", result.IsError))
+	return result, nil
+}
+
+// Close ends the session with the server. Pending calls fail with ErrClosed.
+func (c *Client) Close(ctx context.Context) error {
+	c.fail(ErrClosed)
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.close(ctx)
+}
+
+// call sends a request and decodes the result of its response into result.
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	select {
+	case <-c.done:
+		return c.Err()
+	default:
+	}
+
+	p, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("encode params: %w", err)
+	}
+	id := json.RawMessage(strconv.FormatInt(c.nextID.Add(1), 10))
+	ch := make(chan message, 1)
+	c.mu.Lock()
+	c.pending[string(id)] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, string(id))
+		c.mu.Unlock()
+	}()
+
+	err = c.send(ctx, message{JSONRPC: "2.0", ID: id, Method: method, Params: p})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil || len(resp.Result) == 0 {
+			return nil
+		}
+		err := json.Unmarshal(resp.Result, result)
+		if err != nil {
+			return fmt.Errorf("decode result: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		c.cancel(id, ctx.Err())
+		return ctx.Err()
+	case <-c.done:
+		return c.Err()
+	}
+}
+
+// cancel notifies the server that the request with the given id is cancelled.
+func (c *Client) cancel(id json.RawMessage, reason error) {
+	params, err := json.Marshal(cancelledParams{RequestID: id, Reason: reason.Error()})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+	defer cancel()
+	err = c.send(ctx, message{JSONRPC: "2.0", Method: NotificationCancelled, Params: params})
+	if err != nil {
+		c.log.Debug("notify cancelled request", "method", "cancel", "error", err.Error())
+	}
+}
+
+func (c *Client) send(ctx context.Context, msg message) error {
+	err := c.conn.send(ctx, msg)
+	if errors.Is(err, ErrSessionExpired) {
+		c.fail(fmt.Errorf("%w: %w", ErrClosed, err))
+	}
+	if err != nil {
+		return fmt.Errorf("send %s: %w", msg.Method, err)
+	}
+	return nil
+}
+
+// handle dispatches a message received from the server.
+func (c *Client) handle(msg message) {
+	switch {
+	case msg.isResponse():
+		c.mu.Lock()
+		ch, ok := c.pending[string(msg.ID)]
+		delete(c.pending, string(msg.ID))
+		c.mu.Unlock()
+		if !ok {
+			c.log.Debug("drop response without request", "method", "handle", "id", string(msg.ID))
+			return
+		}
+		ch <- msg
+	case len(msg.ID) > 0:
+		// Answer requests of the server without blocking the reader of the connection.
+		go c.answer(msg)
+	case msg.Method != "":
+		if c.notify != nil {
+			c.notify(msg.Method, msg.Params)
+		}
+	default:
+		c.log.Debug("drop invalid message", "method", "handle")
+	}
+}
+
+// answer responds to a request of the server. Only pings are supported.
+func (c *Client) answer(req message) {
+	resp := message{JSONRPC: "2.0", ID: req.ID}
+	if req.Method == MethodPing {
+		resp.Result = json.RawMessage("{}")
+	} else {
+		resp.Error = &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %s not supported", req.Method)}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+	defer cancel()
+	err := c.send(ctx, resp)
+	if err != nil {
+		c.log.Debug("answer request", "method", "answer", "request", req.Method, "error", err.Error())
+	}
+}
+
+// fail marks the client as done with err, unless it is done already.
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+}
+
+// decode decodes a single message or a batch of messages.
+func decode(bb []byte) ([]message, error) {
+	for _, b := range bb {
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '[':
+			var batch []message
+			err := json.Unmarshal(bb, &batch)
+			return batch, err
+		}
+		break
+	}
+	var msg message
+	err := json.Unmarshal(bb, &msg)
+	return []message{msg}, err
+}
@@ -0,0 +1,224 @@
+package mcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/mcp"
+	"github.com/Br0ce/opera/pkg/mcp/mock"
+	"github.com/Br0ce/opera/pkg/monitor"
+)
+
+const (
+	// standInEnv makes the test binary serve the stand-in server over stdio.
+	standInEnv = "OPERA_MCP_STAND_IN"
+	// serverEnv makes the test binary serve the test tools with the Server over stdio.
+	serverEnv = "OPERA_MCP_SERVER"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(standInEnv) == "1" {
+		err := standIn().ServeStdio(os.Stdin, os.Stdout)
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if os.Getenv(serverEnv) == "1" {
+		err := newServer().ServeStdio(context.Background(), os.Stdin, os.Stdout)
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func testTools() []mcp.Tool {
+	return []mcp.Tool{
+		{Name: "search", Description: "Search the web.", InputSchema: map[string]any{"type": "object"}},
+		{Name: "fail", InputSchema: map[string]any{"type": "object"}},
+		{Name: "slow", InputSchema: map[string]any{"type": "object"}},
+	}
+}
+
+// standIn returns the stand-in server. Calling the tool add_tool adds a tool, so that
+// the server notifies its clients.
+func standIn() *mock.Server {
+	srv := mock.NewServer(testTools()...)
+	srv.CallFn = func(name string, arguments json.RawMessage) (mcp.CallToolResult, *mcp.Error) {
+		switch name {
+		case "search":
+			return mcp.CallToolResult{Content: []mcp.Content{{Type: "text", Text: "found " + string(arguments)}}}, nil
+		case "fail":
+			return mcp.CallToolResult{Content: []mcp.Content{{Type: "text", Text: "quota exceeded"}}, IsError: true}, nil
+		case "slow":
+			time.Sleep(200 * time.Millisecond)
+			return mcp.CallToolResult{}, nil
+		case "add_tool":
+			srv.SetTools(append(testTools(), mcp.Tool{Name: "added", InputSchema: map[string]any{"type": "object"}})...)
+			return mcp.CallToolResult{}, nil
+		default:
+			return mcp.CallToolResult{}, &mcp.Error{Code: mcp.CodeInvalidParams, Message: "unknown tool " + name}
+		}
+	}
+	return srv
+}
+
+// connect returns a client of a stand-in server over the given transport.
+func connect(t *testing.T, transport string, options ...mcp.Option) (*mcp.Client, *mock.Server) {
+	t.Helper()
+
+	log := monitor.NewTestLogger(false)
+	var cl *mcp.Client
+	var srv *mock.Server
+	var err error
+	switch transport {
+	case "stdio":
+		cl, err = mcp.NewStdio(context.TODO(), os.Args[0], nil, []string{standInEnv + "=1"}, log, options...)
+	default:
+		srv = standIn()
+		srv.SSE = transport == "sse"
+		hs := httptest.NewServer(srv)
+		t.Cleanup(hs.Close)
+		cl, err = mcp.NewHTTP(context.TODO(), hs.URL+"/mcp", map[string][]string{"Authorization": {"Bearer token"}}, log, options...)
+	}
+	if err != nil {
+		t.Fatalf("connect %s: %s", transport, err.Error())
+	}
+	t.Cleanup(func() { _ = cl.Close(context.TODO()) })
+	return cl, srv
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	for _, transport := range []string{"stdio", "http", "sse"} {
+		t.Run(transport, func(t *testing.T) {
+			t.Parallel()
+
+			var changed atomic.Int32
+			cl, srv := connect(t, transport, mcp.WithNotificationHandler(func(method string, _ json.RawMessage) {
+				if method == mcp.NotificationToolsListChanged {
+					changed.Add(1)
+				}
+			}))
+			if cl.ServerInfo().Name != "stand-in" || cl.Capabilities().Tools == nil || !cl.Capabilities().Tools.ListChanged {
+				t.Errorf("Client server info = %v, capabilities = %v", cl.ServerInfo(), cl.Capabilities())
+			}
+
+			tools, err := cl.ListTools(context.TODO())
+			if err != nil {
+				t.Fatalf("Client.ListTools() error = %v", err)
+			}
+			if len(tools) != 3 || tools[0].Name != "search" || tools[2].Name != "slow" {
+				t.Errorf("Client.ListTools() = %v", tools)
+			}
+
+			got, err := cl.CallTool(context.TODO(), "search", json.RawMessage(`{"q":"opera"}`))
+			if err != nil {
+				t.Fatalf("Client.CallTool() error = %v", err)
+			}
+			if got.IsError || len(got.Content) != 1 || got.Content[0].Text != `found {"q":"opera"}` {
+				t.Errorf("Client.CallTool() = %v", got)
+			}
+
+			got, err = cl.CallTool(context.TODO(), "fail", nil)
+			if err != nil || !got.IsError || got.Content[0].Text != "quota exceeded" {
+				t.Errorf("Client.CallTool() failing tool = %v, %v", got, err)
+			}
+
+			_, err = cl.CallTool(context.TODO(), "unknown", nil)
+			var rpcErr *mcp.Error
+			if !errors.As(err, &rpcErr) || rpcErr.Code != mcp.CodeInvalidParams {
+				t.Errorf("Client.CallTool() unknown tool error = %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+			defer cancel()
+			_, err = cl.CallTool(ctx, "slow", nil)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Client.CallTool() slow tool error = %v, want %v", err, context.DeadlineExceeded)
+			}
+
+			if srv != nil {
+				waitFor(t, func() bool { return srv.Streams() > 0 })
+			}
+			_, err = cl.CallTool(context.TODO(), "add_tool", nil)
+			if err != nil {
+				t.Fatalf("Client.CallTool() add tool error = %v", err)
+			}
+			waitFor(t, func() bool { return changed.Load() > 0 })
+			tools, err = cl.ListTools(context.TODO())
+			if err != nil || len(tools) != 4 {
+				t.Errorf("Client.ListTools() after change = %v, %v", tools, err)
+			}
+		})
+	}
+}
+
+func TestClient_Closed(t *testing.T) {
+	t.Parallel()
+
+	t.Run("stdio", func(t *testing.T) {
+		t.Parallel()
+
+		cl, _ := connect(t, "stdio")
+		err := cl.Close(context.TODO())
+		if err != nil {
+			t.Fatalf("Client.Close() error = %v", err)
+		}
+		_, err = cl.ListTools(context.TODO())
+		if !errors.Is(err, mcp.ErrClosed) {
+			t.Errorf("Client.ListTools() error = %v, want %v", err, mcp.ErrClosed)
+		}
+	})
+
+	t.Run("session expired", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := connect(t, "http")
+		srv.ExpireSessions()
+		_, err := cl.ListTools(context.TODO())
+		if !errors.Is(err, mcp.ErrSessionExpired) {
+			t.Errorf("Client.ListTools() error = %v, want %v", err, mcp.ErrSessionExpired)
+		}
+		select {
+		case <-cl.Done():
+		case <-time.After(time.Second):
+			t.Fatal("Client.Done() not closed")
+		}
+		if !errors.Is(cl.Err(), mcp.ErrClosed) {
+			t.Errorf("Client.Err() = %v, want %v", cl.Err(), mcp.ErrClosed)
+		}
+	})
+
+	t.Run("no server", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := mcp.NewStdio(context.TODO(), "/does/not/exist", nil, nil, monitor.NewTestLogger(false))
+		if err == nil || !strings.Contains(err.Error(), "start") {
+			t.Errorf("NewStdio() error = %v", err)
+		}
+	})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.After(2 * time.Second)
+	for !cond() {
+		select {
+		case <-deadline:
+			t.Fatal("condition not met in time")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	headerSession  = "Mcp-Session-Id"
+	headerVersion  = "Mcp-Protocol-Version"
+	maxListenDelay = 30 * time.Second
+)
+
+// maxErrBody limits how much of the body of a failed response is kept.
+const maxErrBody = 4 << 10
+
+// ErrSessionExpired is returned once the server ended the session, a new client has to
+// be connected.
+var ErrSessionExpired = errors.New("session expired")
+
+// NewHTTP initializes a session with the MCP server at the streamable HTTP endpoint,
+// e.g. http://search:8080/mcp. The header is sent with every request, e.g. to
+// authenticate the client. Notifications of the server are received on a stream opened
+// once the session is initialized, if the server offers one.
+func NewHTTP(ctx context.Context, endpoint string, header map[string][]string, log *slog.Logger, options ...Option) (*Client, error) {
+	c := newClient(log, options...)
+	conn := &httpConn{
+		endpoint: endpoint,
+		header:   header,
+		http:     &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		client:   c,
+		log:      log,
+	}
+	err := c.start(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type httpConn struct {
+	endpoint string
+	header   map[string][]string
+	http     *http.Client
+	client   *Client
+	mu       sync.Mutex
+	session  string
+	version  string
+	stop     context.CancelFunc
+	log      *slog.Logger
+}
+
+// send posts the message. The messages the server answers with, as JSON or as event
+// stream, are passed to the client. The response to a request is awaited before send
+// returns.
+func (hc *httpConn) send(ctx context.Context, msg message) error {
+	bb, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encode message: %w", err)
+	}
+	req, err := hc.request(ctx, http.MethodPost, bytes.NewReader(bb))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := hc.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := hc.check(resp); err != nil {
+		return err
+	}
+	if msg.Method == MethodInitialize {
+		hc.mu.Lock()
+		hc.session = resp.Header.Get(headerSession)
+		hc.mu.Unlock()
+	}
+	if resp.StatusCode == http.StatusAccepted || len(msg.ID) == 0 || msg.isResponse() {
+		return nil
+	}
+
+	answered := false
+	dispatch := func(data []byte) bool {
+		msgs, err := decode(data)
+		if err != nil {
+			hc.log.Warn("drop invalid message", "method", "send", "error", err.Error())
+			return true
+		}
+		for _, m := range msgs {
+			hc.client.handle(m)
+			if m.isResponse() && bytes.Equal(m.ID, msg.ID) {
+				answered = true
+			}
+		}
+		// Stop reading once the request is answered, even if the server keeps the
+		// stream open.
+		return !answered
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/event-stream":
+		err = readEvents(resp.Body, dispatch)
+	case "application/json":
+		bb, err = io.ReadAll(resp.Body)
+		if err == nil {
+			dispatch(bb)
+		}
+	default:
+		return fmt.Errorf("content type %s not supported", mediaType)
+	}
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if !answered {
+		return fmt.Errorf("response to %s missing", msg.Method)
+	}
+	return nil
+}
+
+// initialized opens the stream of server notifications.
+func (hc *httpConn) initialized(version string) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.version = version
+	ctx, cancel := context.WithCancel(context.Background())
+	hc.stop = cancel
+	go hc.listen(ctx)
+}
+
+// listen passes the messages of the server stream to the client, reconnecting with a
+// growing delay whenever the stream ends, until ctx is done. If the server offers no
+// stream, listen returns.
+func (hc *httpConn) listen(ctx context.Context) {
+	delay := 100 * time.Millisecond
+	for {
+		err := hc.stream(ctx)
+		if errors.Is(err, errNoStream) {
+			hc.log.Debug("server offers no stream", "method", "listen")
+			return
+		}
+		if errors.Is(err, ErrSessionExpired) {
+			hc.client.fail(fmt.Errorf("%w: %w", ErrClosed, err))
+			return
+		}
+		if err != nil {
+			hc.log.Debug("stream ended", "method", "listen", "error", err.Error())
+		} else {
+			delay = 100 * time.Millisecond
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		delay = min(2*delay, maxListenDelay)
+	}
+}
+
+var errNoStream = errors.New("no stream")
+
+func (hc *httpConn) stream(ctx context.Context) error {
+	req, err := hc.request(ctx, http.MethodGet, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := hc.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		return errNoStream
+	}
+	if err := hc.check(resp); err != nil {
+		return err
+	}
+	return readEvents(resp.Body, func(data []byte) bool {
+		msgs, err := decode(data)
+		if err != nil {
+			hc.log.Warn("drop invalid message", "method", "stream", "error", err.Error())
+			return true
+		}
+		for _, m := range msgs {
+			hc.client.handle(m)
+		}
+		return true
+	})
+}
+
+// close stops the stream of notifications and ends the session.
+func (hc *httpConn) close(ctx context.Context) error {
+	hc.mu.Lock()
+	stop := hc.stop
+	session := hc.session
+	hc.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	if session == "" {
+		return nil
+	}
+
+	req, err := hc.request(ctx, http.MethodDelete, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := hc.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("end session: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		return nil
+	}
+	return hc.check(resp)
+}
+
+// request returns a request to the endpoint with the headers of the session.
+func (hc *httpConn) request(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, hc.endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	for k, vv := range hc.header {
+		for _, v := range vv {
+			req.Header.Add(k, v)
+		}
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.session != "" {
+		req.Header.Set(headerSession, hc.session)
+	}
+	if hc.version != "" {
+		req.Header.Set(headerVersion, hc.version)
+	}
+	return req, nil
+}
+
+// check returns an error if the response has a status other than 2xx.
+func (hc *httpConn) check(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	hc.mu.Lock()
+	session := hc.session
+	hc.mu.Unlock()
+	if resp.StatusCode == http.StatusNotFound && session != "" {
+		return ErrSessionExpired
+	}
+	bb, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrBody))
+	return fmt.Errorf("status %s: %s", resp.Status, strings.TrimSpace(string(bb)))
+}
+
+// readEvents passes the data of each message event of the server-sent event stream r to
+// fn until the stream ends or fn returns false.
+func readEvents(r io.Reader, fn func(data []byte) bool) error {
+	br := bufio.NewReader(r)
+	var data bytes.Buffer
+	event := ""
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && line == "" {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if data.Len() > 0 && (event == "" || event == "message") {
+				if !fn(bytes.TrimSuffix(data.Bytes(), []byte("\n"))) {
+					return nil
+				}
+			}
+			data.Reset()
+			event = ""
+		case strings.HasPrefix(line, ":"):
+		default:
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "data":
+				data.WriteString(value)
+				data.WriteByte('\n')
+			case "event":
+				event = value
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,301 @@
+// Package mock provides a stand-in MCP server for tests, serving its tools over stdio
+// or streamable HTTP.
+package mock
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/Br0ce/opera/pkg/mcp"
+)
+
+// pageSize is the number of tools per page of tools/list, small so that clients have to
+// follow cursors.
+const pageSize = 2
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *mcp.Error      `json:"error,omitempty"`
+}
+
+// Server is a stand-in MCP server. Calls to its tools are answered by CallFn, or with
+// the name and arguments of the call if CallFn is nil.
+type Server struct {
+	CallFn func(name string, arguments json.RawMessage) (mcp.CallToolResult, *mcp.Error)
+	// SSE answers requests over HTTP as event stream instead of JSON.
+	SSE bool
+
+	mu       sync.Mutex
+	tools    []mcp.Tool
+	sessions map[string]chan []byte
+	writers  map[*lockedWriter]struct{}
+	calls    []string
+	session  int
+}
+
+func NewServer(tools ...mcp.Tool) *Server {
+	return &Server{
+		tools:    tools,
+		sessions: make(map[string]chan []byte),
+		writers:  make(map[*lockedWriter]struct{}),
+	}
+}
+
+// SetTools replaces the tools and notifies all connected clients.
+func (s *Server) SetTools(tools ...mcp.Tool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tools = tools
+	bb, _ := json.Marshal(message{JSONRPC: "2.0", Method: mcp.NotificationToolsListChanged})
+	for w := range s.writers {
+		_ = w.writeLine(bb)
+	}
+	for _, stream := range s.sessions {
+		if stream != nil {
+			select {
+			case stream <- bb:
+			default:
+			}
+		}
+	}
+}
+
+// Streams returns the number of open HTTP notification streams.
+func (s *Server) Streams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int
+	for _, stream := range s.sessions {
+		if stream != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Calls returns the names of the called tools.
+func (s *Server) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+// ExpireSessions ends all HTTP sessions, the next request of their clients fails.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, stream := range s.sessions {
+		if stream != nil {
+			close(stream)
+		}
+		delete(s.sessions, id)
+	}
+}
+
+// ServeStdio serves a client over r and w, one message per line, until r ends.
+func (s *Server) ServeStdio(r io.Reader, w io.Writer) error {
+	lw := &lockedWriter{w: w}
+	s.mu.Lock()
+	s.writers[lw] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.writers, lw)
+		s.mu.Unlock()
+	}()
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			var msg message
+			if json.Unmarshal(line, &msg) == nil {
+				if resp, ok := s.handle(msg); ok {
+					bb, _ := json.Marshal(resp)
+					_ = lw.writeLine(bb)
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ServeHTTP serves the streamable HTTP transport.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.post(w, r)
+	case http.MethodGet:
+		s.stream(w, r)
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.sessions, r.Header.Get("Mcp-Session-Id"))
+		s.mu.Unlock()
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) post(w http.ResponseWriter, r *http.Request) {
+	var msg message
+	err := json.NewDecoder(r.Body).Decode(&msg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg.Method == mcp.MethodInitialize {
+		s.mu.Lock()
+		s.session++
+		id := "session-" + strconv.Itoa(s.session)
+		s.sessions[id] = nil
+		s.mu.Unlock()
+		w.Header().Set("Mcp-Session-Id", id)
+	} else if !s.valid(w, r) {
+		return
+	}
+
+	resp, ok := s.handle(msg)
+	if !ok {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	bb, _ := json.Marshal(resp)
+	if s.SSE {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprintf(w, ": stand-in\nevent: message\ndata: %s\n\n", bb)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(bb)
+}
+
+// stream sends the notifications of the session as event stream.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) {
+	if !s.valid(w, r) {
+		return
+	}
+	id := r.Header.Get("Mcp-Session-Id")
+	ch := make(chan []byte, 8)
+	s.mu.Lock()
+	s.sessions[id] = ch
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case bb, ok := <-ch:
+			if !ok {
+				return
+			}
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", bb)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// valid reports whether the request belongs to a session, or answers it with an error.
+func (s *Server) valid(w http.ResponseWriter, r *http.Request) bool {
+	id := r.Header.Get("Mcp-Session-Id")
+	if id == "" {
+		http.Error(w, "session id missing", http.StatusBadRequest)
+		return false
+	}
+	s.mu.Lock()
+	_, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// handle returns the response to the message, if it is a request.
+func (s *Server) handle(msg message) (message, bool) {
+	if len(msg.ID) == 0 {
+		return message{}, false
+	}
+	resp := message{JSONRPC: "2.0", ID: msg.ID}
+	switch msg.Method {
+	case mcp.MethodInitialize:
+		resp.Result = map[string]any{
+			"protocolVersion": mcp.ProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{"listChanged": true}},
+			"serverInfo":      mcp.Implementation{Name: "stand-in", Version: "0.1.0"},
+		}
+	case mcp.MethodPing:
+		resp.Result = map[string]any{}
+	case mcp.MethodToolsList:
+		var params struct {
+			Cursor string `json:"cursor"`
+		}
+		_ = json.Unmarshal(msg.Params, &params)
+		start, _ := strconv.Atoi(params.Cursor)
+		s.mu.Lock()
+		tools := s.tools
+		s.mu.Unlock()
+		end := min(start+pageSize, len(tools))
+		result := map[string]any{"tools": append([]mcp.Tool{}, tools[min(start, end):end]...)}
+		if end < len(tools) {
+			result["nextCursor"] = strconv.Itoa(end)
+		}
+		resp.Result = result
+	case mcp.MethodToolsCall:
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		_ = json.Unmarshal(msg.Params, &params)
+		s.mu.Lock()
+		s.calls = append(s.calls, params.Name)
+		s.mu.Unlock()
+		if s.CallFn == nil {
+			resp.Result = mcp.CallToolResult{Content: []mcp.Content{{Type: "text", Text: params.Name + " " + string(params.Arguments)}}}
+			break
+		}
+		result, rpcErr := s.CallFn(params.Name, params.Arguments)
+		if rpcErr != nil {
+			resp.Error = rpcErr
+			break
+		}
+		resp.Result = result
+	default:
+		resp.Error = &mcp.Error{Code: mcp.CodeMethodNotFound, Message: "method not found"}
+	}
+	return resp, true
+}
+
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) writeLine(bb []byte) error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	_, err := lw.w.Write(append(bb, '\n'))
+	return err
+}
@@ -0,0 +1,516 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/monitor"
+)
+
+// maxBody limits the size of a message posted to the server.
+const maxBody = 4 << 20
+
+// streamBuffer is the number of notifications buffered for a stream, further
+// notifications are dropped until the client caught up.
+const streamBuffer = 16
+
+// ToolSet lists and calls the tools offered by a Server. CallTool reports that the tool
+// failed with the IsError of the result. Errors are returned to the client as JSON-RPC
+// errors, *Error as they are.
+type ToolSet interface {
+	ListTools(ctx context.Context) ([]Tool, error)
+	CallTool(ctx context.Context, name string, arguments json.RawMessage) (CallToolResult, error)
+}
+
+// Server offers the tools of a ToolSet to MCP clients over stdio or streamable HTTP. It
+// is safe for concurrent use.
+type Server struct {
+	tools    ToolSet
+	info     Implementation
+	mu       sync.Mutex
+	sessions map[string]*serverSession
+	tr       trace.Tracer
+	log      *slog.Logger
+}
+
+// serverSession is the session of a client.
+type serverSession struct {
+	id       string
+	mu       sync.Mutex
+	inflight map[string]context.CancelFunc
+	// notify delivers a notification to the client, nil if the client cannot receive
+	// notifications, e.g. a HTTP client without stream.
+	notify func(bb []byte)
+	closed chan struct{}
+}
+
+func NewServer(tools ToolSet, info Implementation, log *slog.Logger) *Server {
+	return &Server{
+		tools:    tools,
+		info:     info,
+		sessions: make(map[string]*serverSession),
+		tr:       monitor.Tracer("MCPServer"),
+		log:      log,
+	}
+}
+
+// NotifyToolsChanged notifies all clients that the list of tools changed.
+func (s *Server) NotifyToolsChanged() {
+	bb, err := json.Marshal(message{JSONRPC: "2.0", Method: NotificationToolsListChanged})
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sess := range s.sessions {
+		sess.send(bb)
+	}
+}
+
+// Close ends all sessions. Pending calls are cancelled and streams are closed.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, sess := range s.sessions {
+		sess.close()
+		delete(s.sessions, id)
+	}
+}
+
+// ServeStdio serves a client over r and w, one message per line, until r ends or ctx is
+// done. Requests are handled concurrently.
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	var wmu sync.Mutex
+	writeLine := func(bb []byte) {
+		wmu.Lock()
+		defer wmu.Unlock()
+		_, err := w.Write(append(bb, '\n'))
+		if err != nil {
+			s.log.Warn("write message", "method", "ServeStdio", "error", err.Error())
+		}
+	}
+	sess := s.open(writeLine)
+	defer s.end(sess.id)
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadBytes('\n')
+			if len(line) > 0 {
+				select {
+				case lines <- line:
+				case <-sess.closed:
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("read: %w", err)
+		case line := <-lines:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, ok := s.receive(ctx, sess, line)
+				if !ok {
+					return
+				}
+				bb, err := json.Marshal(resp)
+				if err != nil {
+					s.log.Error("encode response", "method", "ServeStdio", "error", err.Error())
+					return
+				}
+				writeLine(bb)
+			}()
+		}
+	}
+}
+
+// ServeHTTP serves the streamable HTTP transport. Messages are posted, the session is
+// initialized by the first post and ended with a delete. Notifications are sent on the
+// event stream opened with a get.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		s.post(w, r)
+	case http.MethodGet:
+		s.stream(w, r)
+	case http.MethodDelete:
+		sess, ok := s.session(w, r)
+		if !ok {
+			return
+		}
+		s.end(sess.id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) post(w http.ResponseWriter, r *http.Request) {
+	bb, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("read body: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	msgs, err := decode(bb)
+	if err != nil || len(msgs) == 0 {
+		writeMessage(w, http.StatusBadRequest, message{
+			JSONRPC: "2.0",
+			ID:      json.RawMessage("null"),
+			Error:   &Error{Code: CodeParseError, Message: "parse error"},
+		})
+		return
+	}
+
+	var sess *serverSession
+	if slices.ContainsFunc(msgs, func(m message) bool { return m.Method == MethodInitialize }) {
+		if len(msgs) > 1 {
+			http.Error(w, "initialize must not be batched", http.StatusBadRequest)
+			return
+		}
+		sess = s.open(nil)
+		w.Header().Set(headerSession, sess.id)
+	} else {
+		var ok bool
+		sess, ok = s.session(w, r)
+		if !ok {
+			return
+		}
+	}
+
+	var resps []message
+	for _, msg := range msgs {
+		resp, ok := s.handle(r.Context(), sess, msg)
+		if ok {
+			resps = append(resps, resp)
+		}
+	}
+	switch {
+	case len(resps) == 0:
+		w.WriteHeader(http.StatusAccepted)
+	case len(msgs) == 1:
+		writeMessage(w, http.StatusOK, resps[0])
+	default:
+		writeMessage(w, http.StatusOK, resps)
+	}
+}
+
+// stream sends the notifications of the session as event stream until the client goes
+// away or the session ends.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ch := make(chan []byte, streamBuffer)
+	sess.mu.Lock()
+	sess.notify = func(bb []byte) {
+		select {
+		case ch <- bb:
+		default:
+			s.log.Warn("drop notification", "method", "stream", "session", sess.id)
+		}
+	}
+	sess.mu.Unlock()
+	defer func() {
+		sess.mu.Lock()
+		sess.notify = nil
+		sess.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sess.closed:
+			return
+		case bb := <-ch:
+			_, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", bb)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// session returns the session named by the request, or answers the request with an
+// error.
+func (s *Server) session(w http.ResponseWriter, r *http.Request) (*serverSession, bool) {
+	id := r.Header.Get(headerSession)
+	if id == "" {
+		http.Error(w, "session id missing", http.StatusBadRequest)
+		return nil, false
+	}
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return nil, false
+	}
+	return sess, true
+}
+
+// open starts a session delivering notifications with notify.
+func (s *Server) open(notify func(bb []byte)) *serverSession {
+	sess := &serverSession{
+		id:       sessionID(),
+		inflight: make(map[string]context.CancelFunc),
+		notify:   notify,
+		closed:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.sessions[sess.id] = sess
+	s.mu.Unlock()
+	return sess
+}
+
+// end ends the session with the given id.
+func (s *Server) end(id string) {
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	if ok {
+		sess.close()
+	}
+}
+
+// receive handles a line read from a stdio client.
+func (s *Server) receive(ctx context.Context, sess *serverSession, line []byte) (any, bool) {
+	msgs, err := decode(line)
+	if err != nil {
+		return message{
+			JSONRPC: "2.0",
+			ID:      json.RawMessage("null"),
+			Error:   &Error{Code: CodeParseError, Message: "parse error"},
+		}, true
+	}
+	var resps []message
+	for _, msg := range msgs {
+		resp, ok := s.handle(ctx, sess, msg)
+		if ok {
+			resps = append(resps, resp)
+		}
+	}
+	switch {
+	case len(resps) == 0:
+		return nil, false
+	case len(msgs) == 1:
+		return resps[0], true
+	default:
+		return resps, true
+	}
+}
+
+// handle returns the response to the message, if it is a request.
+func (s *Server) handle(ctx context.Context, sess *serverSession, msg message) (message, bool) {
+	if msg.isResponse() {
+		// The server sends no requests, responses are dropped.
+		return message{}, false
+	}
+	if len(msg.ID) == 0 {
+		s.notification(sess, msg)
+		return message{}, false
+	}
+
+	ctx, span := s.tr.Start(ctx, "handle request")
+	defer span.End()
+	span.SetAttributes(attribute.String("mcp.method", msg.Method))
+	s.log.Debug("handle request", "method", "handle", "request", msg.Method, "traceID", monitor.TraceID(span))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sess.mu.Lock()
+	sess.inflight[string(msg.ID)] = cancel
+	sess.mu.Unlock()
+	defer func() {
+		sess.mu.Lock()
+		delete(sess.inflight, string(msg.ID))
+		sess.mu.Unlock()
+	}()
+
+	resp := message{JSONRPC: "2.0", ID: msg.ID}
+	result, err := s.result(ctx, msg)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+		return resp, true
+	}
+	resp.Result, err = json.Marshal(result)
+	if err != nil {
+		resp.Error = &Error{Code: CodeInternalError, Message: fmt.Sprintf("encode result: %s", err.Error())}
+	}
+	return resp, true
+}
+
+// result returns the result of the request.
+func (s *Server) result(ctx context.Context, msg message) (any, error) {
+	switch msg.Method {
+	case MethodInitialize:
+		var params initializeParams
+		err := json.Unmarshal(msg.Params, &params)
+		if err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("params invalid: %s", err.Error())}
+		}
+		version := ProtocolVersion
+		if slices.Contains(supportedVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		return initializeResult{
+			ProtocolVersion: version,
+			Capabilities:    Capabilities{Tools: &ToolsCapability{ListChanged: true}},
+			ServerInfo:      s.info,
+		}, nil
+	case MethodPing:
+		return struct{}{}, nil
+	case MethodToolsList:
+		tools, err := s.tools.ListTools(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list tools: %w", err)
+		}
+		if tools == nil {
+			tools = []Tool{}
+		}
+		return listToolsResult{Tools: tools}, nil
+	case MethodToolsCall:
+		var params callToolParams
+		err := json.Unmarshal(msg.Params, &params)
+		if err != nil || params.Name == "" {
+			return nil, &Error{Code: CodeInvalidParams, Message: "params invalid: name missing"}
+		}
+		result, err := s.tools.CallTool(ctx, params.Name, params.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		if result.Content == nil {
+			result.Content = []Content{}
+		}
+		return result, nil
+	default:
+		return nil, &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %s not found", msg.Method)}
+	}
+}
+
+// notification handles a notification of the client. A cancelled request is cancelled,
+// other notifications are ignored.
+func (s *Server) notification(sess *serverSession, msg message) {
+	if msg.Method != NotificationCancelled {
+		return
+	}
+	var params cancelledParams
+	err := json.Unmarshal(msg.Params, &params)
+	if err != nil {
+		return
+	}
+	sess.mu.Lock()
+	cancel, ok := sess.inflight[string(params.RequestID)]
+	sess.mu.Unlock()
+	if ok {
+		s.log.Debug("cancel request", "method", "notification", "id", string(params.RequestID), "reason", params.Reason)
+		cancel()
+	}
+}
+
+// send delivers the notification, if the client can receive notifications.
+func (ss *serverSession) send(bb []byte) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.notify != nil {
+		ss.notify(bb)
+	}
+}
+
+// close cancels the pending requests and closes the stream of the session.
+func (ss *serverSession) close() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for _, cancel := range ss.inflight {
+		cancel()
+	}
+	select {
+	case <-ss.closed:
+	default:
+		close(ss.closed)
+	}
+}
+
+// sameOrigin reports whether the request has no Origin or an Origin of the host it is
+// sent to, so that web pages of other origins cannot reach the server.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func writeMessage(w http.ResponseWriter, status int, v any) {
+	bb, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(bb)
+}
+
+func sessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
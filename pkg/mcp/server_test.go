@@ -0,0 +1,289 @@
+package mcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/mcp"
+	"github.com/Br0ce/opera/pkg/monitor"
+)
+
+// toolSet offers the tools echo, fail, slow and change. Calling change notifies the
+// clients of the server that the tools changed.
+type toolSet struct {
+	srv       *mcp.Server
+	cancelled atomic.Bool
+}
+
+func (ts *toolSet) ListTools(_ context.Context) ([]mcp.Tool, error) {
+	var tools []mcp.Tool
+	for _, name := range []string{"echo", "fail", "slow", "change"} {
+		tools = append(tools, mcp.Tool{Name: name, Description: "The " + name + " tool.", InputSchema: map[string]any{"type": "object"}})
+	}
+	return tools, nil
+}
+
+func (ts *toolSet) CallTool(ctx context.Context, name string, arguments json.RawMessage) (mcp.CallToolResult, error) {
+	switch name {
+	case "echo":
+		return mcp.CallToolResult{Content: []mcp.Content{{Type: "text", Text: string(arguments)}}}, nil
+	case "fail":
+		return mcp.CallToolResult{Content: []mcp.Content{{Type: "text", Text: "quota exceeded"}}, IsError: true}, nil
+	case "slow":
+		<-ctx.Done()
+		ts.cancelled.Store(true)
+		return mcp.CallToolResult{}, ctx.Err()
+	case "change":
+		ts.srv.NotifyToolsChanged()
+		return mcp.CallToolResult{}, nil
+	default:
+		return mcp.CallToolResult{}, &mcp.Error{Code: mcp.CodeInvalidParams, Message: "unknown tool " + name}
+	}
+}
+
+func newServer() *mcp.Server {
+	ts := &toolSet{}
+	ts.srv = mcp.NewServer(ts, mcp.Implementation{Name: "opera", Version: "1.0.0"}, monitor.NewTestLogger(false))
+	return ts.srv
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	for _, transport := range []string{"stdio", "http"} {
+		t.Run(transport, func(t *testing.T) {
+			t.Parallel()
+
+			var changed atomic.Int32
+			notify := mcp.WithNotificationHandler(func(method string, _ json.RawMessage) {
+				if method == mcp.NotificationToolsListChanged {
+					changed.Add(1)
+				}
+			})
+			log := monitor.NewTestLogger(false)
+			var cl *mcp.Client
+			var err error
+			switch transport {
+			case "stdio":
+				cl, err = mcp.NewStdio(context.TODO(), os.Args[0], nil, []string{serverEnv + "=1"}, log, notify)
+			default:
+				srv := newServer()
+				hs := httptest.NewServer(srv)
+				t.Cleanup(hs.Close)
+				t.Cleanup(srv.Close)
+				cl, err = mcp.NewHTTP(context.TODO(), hs.URL, nil, log, notify)
+			}
+			if err != nil {
+				t.Fatalf("connect %s: %s", transport, err.Error())
+			}
+			t.Cleanup(func() { _ = cl.Close(context.TODO()) })
+
+			if cl.ServerInfo().Name != "opera" || cl.Capabilities().Tools == nil || !cl.Capabilities().Tools.ListChanged {
+				t.Errorf("Client server info = %v, capabilities = %v", cl.ServerInfo(), cl.Capabilities())
+			}
+
+			tools, err := cl.ListTools(context.TODO())
+			if err != nil || len(tools) != 4 || tools[0].Name != "echo" {
+				t.Errorf("Client.ListTools() = %v, %v", tools, err)
+			}
+
+			got, err := cl.CallTool(context.TODO(), "echo", json.RawMessage(`{"q":"opera"}`))
+			if err != nil || got.IsError || len(got.Content) != 1 || got.Content[0].Text != `{"q":"opera"}` {
+				t.Errorf("Client.CallTool() = %v, %v", got, err)
+			}
+
+			got, err = cl.CallTool(context.TODO(), "fail", nil)
+			if err != nil || !got.IsError || got.Content[0].Text != "quota exceeded" {
+				t.Errorf("Client.CallTool() failing tool = %v, %v", got, err)
+			}
+
+			_, err = cl.CallTool(context.TODO(), "unknown", nil)
+			var rpcErr *mcp.Error
+			if !errors.As(err, &rpcErr) || rpcErr.Code != mcp.CodeInvalidParams {
+				t.Errorf("Client.CallTool() unknown tool error = %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+			defer cancel()
+			_, err = cl.CallTool(ctx, "slow", nil)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Client.CallTool() slow tool error = %v, want %v", err, context.DeadlineExceeded)
+			}
+
+			// The stream of the HTTP client is opened in the background, notifications
+			// are sent until one arrives.
+			waitFor(t, func() bool {
+				_, err := cl.CallTool(context.TODO(), "change", nil)
+				return err == nil && changed.Load() > 0
+			})
+		})
+	}
+}
+
+func TestServer_Cancel(t *testing.T) {
+	t.Parallel()
+
+	ts := &toolSet{}
+	ts.srv = mcp.NewServer(ts, mcp.Implementation{Name: "opera", Version: "1.0.0"}, monitor.NewTestLogger(false))
+	hs := httptest.NewServer(ts.srv)
+	t.Cleanup(hs.Close)
+	cl, err := mcp.NewHTTP(context.TODO(), hs.URL, nil, monitor.NewTestLogger(false))
+	if err != nil {
+		t.Fatalf("NewHTTP() error = %v", err)
+	}
+	t.Cleanup(func() { _ = cl.Close(context.TODO()) })
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	_, _ = cl.CallTool(ctx, "slow", nil)
+	waitFor(t, ts.cancelled.Load)
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	t.Parallel()
+
+	srv := newServer()
+	hs := httptest.NewServer(srv)
+	t.Cleanup(hs.Close)
+
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`
+	resp := post(t, hs.URL, initialize, nil)
+	session := resp.Header.Get("Mcp-Session-Id")
+	bb := readBody(t, resp)
+	if resp.StatusCode != http.StatusOK || session == "" || !strings.Contains(bb, `"protocolVersion":"2025-03-26"`) {
+		t.Fatalf("initialize = %v %s, session %q", resp.StatusCode, bb, session)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		header   map[string]string
+		want     int
+		wantBody string
+	}{
+		{
+			name:   "notification",
+			method: http.MethodPost,
+			body:   `{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+			header: map[string]string{"Mcp-Session-Id": session},
+			want:   http.StatusAccepted,
+		},
+		{
+			name:     "batch",
+			method:   http.MethodPost,
+			body:     `[{"jsonrpc":"2.0","id":2,"method":"ping"},{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo","arguments":{"a":1}}}]`,
+			header:   map[string]string{"Mcp-Session-Id": session},
+			want:     http.StatusOK,
+			wantBody: `[{"jsonrpc":"2.0","id":2,"result":{}},{"jsonrpc":"2.0","id":3,"result":{"content":[{"type":"text","text":"{\"a\":1}"}]}}]`,
+		},
+		{
+			name:     "method not found",
+			method:   http.MethodPost,
+			body:     `{"jsonrpc":"2.0","id":4,"method":"resources/list"}`,
+			header:   map[string]string{"Mcp-Session-Id": session},
+			want:     http.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","id":4,"error":{"code":-32601,"message":"method resources/list not found"}}`,
+		},
+		{
+			name:     "parse error",
+			method:   http.MethodPost,
+			body:     `{"jsonrpc":`,
+			header:   map[string]string{"Mcp-Session-Id": session},
+			want:     http.StatusBadRequest,
+			wantBody: `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error"}}`,
+		},
+		{
+			name:   "session missing",
+			method: http.MethodPost,
+			body:   `{"jsonrpc":"2.0","id":5,"method":"ping"}`,
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "session unknown",
+			method: http.MethodPost,
+			body:   `{"jsonrpc":"2.0","id":6,"method":"ping"}`,
+			header: map[string]string{"Mcp-Session-Id": "unknown"},
+			want:   http.StatusNotFound,
+		},
+		{
+			name:   "foreign origin",
+			method: http.MethodPost,
+			body:   `{"jsonrpc":"2.0","id":7,"method":"ping"}`,
+			header: map[string]string{"Mcp-Session-Id": session, "Origin": "http://evil.example"},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "method not allowed",
+			method: http.MethodPut,
+			want:   http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := do(t, tt.method, hs.URL, tt.body, tt.header)
+			bb := readBody(t, resp)
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s status = %v %s, want %v", tt.method, resp.StatusCode, bb, tt.want)
+			}
+			if tt.wantBody != "" && bb != tt.wantBody {
+				t.Errorf("%s body = %s, want %s", tt.method, bb, tt.wantBody)
+			}
+		})
+	}
+
+	resp = do(t, http.MethodDelete, hs.URL, "", map[string]string{"Mcp-Session-Id": session})
+	_ = readBody(t, resp)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE status = %v, want %v", resp.StatusCode, http.StatusNoContent)
+	}
+	resp = post(t, hs.URL, `{"jsonrpc":"2.0","id":8,"method":"ping"}`, map[string]string{"Mcp-Session-Id": session})
+	_ = readBody(t, resp)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("POST after DELETE status = %v, want %v", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func post(t *testing.T, url string, body string, header map[string]string) *http.Response {
+	t.Helper()
+	return do(t, http.MethodPost, url, body, header)
+}
+
+func do(t *testing.T, method string, url string, body string, header map[string]string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	defer resp.Body.Close()
+	bb, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(bb))
+}
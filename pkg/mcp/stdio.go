@@ -0,0 +1,145 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// exitTimeout is the time a stdio server is given to exit after its stdin is closed,
+// before it is killed.
+const exitTimeout = 2 * time.Second
+
+// NewStdio starts the MCP server command with the args as subprocess and initializes a
+// session over its stdin and stdout. The env, e.g. KEY=value, is added to the
+// environment of the process. Its stderr is logged.
+func NewStdio(ctx context.Context, command string, args []string, env []string, log *slog.Logger, options ...Option) (*Client, error) {
+	c := newClient(log, options...)
+	conn, err := startStdio(command, args, env, c, log)
+	if err != nil {
+		return nil, err
+	}
+	err = c.start(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type stdioConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	mu     sync.Mutex
+	exited chan struct{}
+	log    *slog.Logger
+}
+
+func startStdio(command string, args []string, env []string, c *Client, log *slog.Logger) (*stdioConn, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = &logWriter{log: log}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdout: %w", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("start %s: %w", command, err)
+	}
+
+	sc := &stdioConn{
+		cmd:    cmd,
+		stdin:  stdin,
+		exited: make(chan struct{}),
+		log:    log,
+	}
+	go sc.read(stdout, c)
+	return sc, nil
+}
+
+// read passes the messages read from stdout to the client until the server exits.
+func (sc *stdioConn) read(stdout io.Reader, c *Client) {
+	r := bufio.NewReader(stdout)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			msgs, decErr := decode(line)
+			if decErr != nil {
+				sc.log.Warn("drop invalid message", "method", "read", "error", decErr.Error())
+			}
+			for _, msg := range msgs {
+				c.handle(msg)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	err := sc.cmd.Wait()
+	close(sc.exited)
+	if err == nil {
+		err = errors.New("server exited")
+	}
+	c.fail(fmt.Errorf("%w: %w", ErrClosed, err))
+}
+
+func (sc *stdioConn) send(_ context.Context, msg message) error {
+	bb, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encode message: %w", err)
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	_, err = sc.stdin.Write(append(bb, '\n'))
+	return err
+}
+
+func (sc *stdioConn) initialized(string) {}
+
+// close closes the stdin of the server and kills it if it does not exit in time.
+func (sc *stdioConn) close(ctx context.Context) error {
+	sc.mu.Lock()
+	err := sc.stdin.Close()
+	sc.mu.Unlock()
+
+	timer := time.NewTimer(exitTimeout)
+	defer timer.Stop()
+	select {
+	case <-sc.exited:
+		return nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	killErr := sc.cmd.Process.Kill()
+	if killErr != nil && !errors.Is(killErr, os.ErrProcessDone) {
+		return errors.Join(err, killErr)
+	}
+	return nil
+}
+
+// logWriter logs the stderr of a server.
+type logWriter struct {
+	log *slog.Logger
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(bytes.TrimSpace(p), []byte("\n")) {
+		if len(line) > 0 {
+			w.log.Debug("server stderr", "method", "Write", "line", string(line))
+		}
+	}
+	return len(p), nil
+}
@@ -7,8 +7,14 @@ import (
 )
 
 func NewLogger(debug bool) *slog.Logger {
+	return NewLoggerTo(os.Stdout, debug)
+}
+
+// NewLoggerTo returns a logger like NewLogger writing to w, e.g. to os.Stderr if
+// os.Stdout carries the messages of the MCP stdio transport.
+func NewLoggerTo(w io.Writer, debug bool) *slog.Logger {
 	var level = new(slog.LevelVar)
-	lg := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	lg := slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
 	lg = lg.With("service", slog.StringValue(serviceName))
 	if debug {
 		level.Set(slog.LevelDebug)
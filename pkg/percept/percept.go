@@ -1,17 +1,21 @@
 package percept
 
 import (
+	"encoding/json"
+
 	"github.com/Br0ce/opera/pkg/tool"
 	"github.com/Br0ce/opera/pkg/user"
 )
 
 // Percept is a standardized container for all possible inputs to an agent.
-// Perceptions can be of type user or of type tool.
+// Perceptions can be of type user, tool or system.
 // A user perception represent usually the initial question to the agent. Tool
-// perceptions hold the response of a tool call.
+// perceptions hold the response of a tool call. System perceptions are instructions of
+// the engine to the agent.
 type Percept struct {
-	user *user.Query
-	tool *tool.Response
+	user   *user.Query
+	tool   *tool.Response
+	system *string
 }
 
 func MakeUser(query user.Query) Percept {
@@ -29,6 +33,31 @@ func MakeTool(callID string, content string) Percept {
 	}
 }
 
+// MakeToolError returns a tool percept for the failed call with the given callID. The
+// content describes the failure to the agent.
+func MakeToolError(callID string, err *tool.Error) Percept {
+	return Percept{
+		tool: &tool.Response{
+			ID:      callID,
+			Content: err.Content(),
+			Err:     err,
+		},
+	}
+}
+
+// MakeToolResponse returns a tool percept for the given response.
+func MakeToolResponse(resp tool.Response) Percept {
+	return Percept{
+		tool: &resp,
+	}
+}
+
+func MakeSystem(content string) Percept {
+	return Percept{
+		system: &content,
+	}
+}
+
 // User reports if the percept is of type user. If true the user.Query is returned.
 func (p Percept) User() (user.Query, bool) {
 	if p.user == nil {
@@ -44,3 +73,40 @@ func (p Percept) Tool() (tool.Response, bool) {
 	}
 	return *p.tool, true
 }
+
+// System reports if the percept is of type system. If true the content is returned.
+func (p Percept) System() (string, bool) {
+	if p.system == nil {
+		return "", false
+	}
+	return *p.system, true
+}
+
+type perceptJSON struct {
+	User   *user.Query    `json:"user,omitempty"`
+	Tool   *tool.Response `json:"tool,omitempty"`
+	System *string        `json:"system,omitempty"`
+}
+
+// MarshalJSON encodes the percept, e.g. to persist it in a checkpoint.
+func (p Percept) MarshalJSON() ([]byte, error) {
+	return json.Marshal(perceptJSON{
+		User:   p.user,
+		Tool:   p.tool,
+		System: p.system,
+	})
+}
+
+func (p *Percept) UnmarshalJSON(data []byte) error {
+	var pj perceptJSON
+	err := json.Unmarshal(data, &pj)
+	if err != nil {
+		return err
+	}
+	*p = Percept{
+		user:   pj.User,
+		tool:   pj.Tool,
+		system: pj.System,
+	}
+	return nil
+}
@@ -85,3 +85,41 @@ func TestPercept_Tool(t *testing.T) {
 		})
 	}
 }
+
+func TestPercept_System(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		system *string
+		want   string
+		want1  bool
+	}{
+		{
+			name:   "ok",
+			system: func() *string { s := "instruction"; return &s }(),
+			want:   "instruction",
+			want1:  true,
+		},
+		{
+			name:   "false",
+			system: nil,
+			want:   "",
+			want1:  false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Percept{
+				system: test.system,
+			}
+			got, got1 := p.System()
+			if got != test.want {
+				t.Errorf("Percept.System() got = %v, want %v", got, test.want)
+			}
+			if got1 != test.want1 {
+				t.Errorf("Percept.System() got1 = %v, want %v", got1, test.want1)
+			}
+		})
+	}
+}
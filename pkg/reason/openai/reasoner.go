@@ -16,19 +16,49 @@ import (
 )
 
 type Reasoner struct {
-	client *openai.Client
-	model  string
-	tr     trace.Tracer
-	log    *slog.Logger
+	client      *openai.Client
+	model       string
+	temperature *float64
+	topP        *float64
+	maxTokens   *int64
+	tr          trace.Tracer
+	log         *slog.Logger
 }
 
-func NewReasoner(token string, modelName string, log *slog.Logger) *Reasoner {
-	return &Reasoner{
+type Option func(re *Reasoner)
+
+// WithTemperature sets the sampling temperature of the model.
+func WithTemperature(temperature float64) Option {
+	return func(re *Reasoner) {
+		re.temperature = &temperature
+	}
+}
+
+// WithTopP sets the nucleus sampling probability mass of the model.
+func WithTopP(topP float64) Option {
+	return func(re *Reasoner) {
+		re.topP = &topP
+	}
+}
+
+// WithMaxTokens sets the maximum number of tokens the model may generate per request.
+func WithMaxTokens(maxTokens int64) Option {
+	return func(re *Reasoner) {
+		re.maxTokens = &maxTokens
+	}
+}
+
+func NewReasoner(token string, modelName string, log *slog.Logger, options ...Option) *Reasoner {
+	re := &Reasoner{
 		client: openai.NewClient(option.WithAPIKey(token)),
 		model:  modelName,
 		tr:     monitor.Tracer("Generator"),
 		log:    log,
 	}
+	for _, opt := range options {
+		opt(re)
+	}
+	return re
 }
 
 func (re *Reasoner) Reason(ctx context.Context, hist history.History, tools []tool.Tool) (action.Action, error) {
@@ -38,11 +68,25 @@ func (re *Reasoner) Reason(ctx context.Context, hist history.History, tools []to
 		"method", "Reason",
 		"traceID", monitor.TraceID(span))
 
-	chat, err := re.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+	params := openai.ChatCompletionNewParams{
 		Messages: openai.F(messages(hist)),
 		Model:    openai.F(re.model),
-		Tools:    openai.F(toolParams(tools)),
-	})
+	}
+	// The API rejects an empty tool list, so omit it to reason without tools.
+	if len(tools) > 0 {
+		params.Tools = openai.F(toolParams(tools))
+	}
+	if re.temperature != nil {
+		params.Temperature = openai.F(*re.temperature)
+	}
+	if re.topP != nil {
+		params.TopP = openai.F(*re.topP)
+	}
+	if re.maxTokens != nil {
+		params.MaxCompletionTokens = openai.F(*re.maxTokens)
+	}
+
+	chat, err := re.client.Chat.Completions.New(ctx, params)
 	if err != nil {
 		return action.Action{}, fmt.Errorf("openai: %w", err)
 	}
@@ -59,11 +103,7 @@ func toolParams(tools []tool.Tool) []openai.ChatCompletionToolParam {
 				Function: openai.F(openai.FunctionDefinitionParam{
 					Name:        openai.String(tool.Name()),
 					Description: openai.String(tool.Description()),
-					Parameters: openai.F(openai.FunctionParameters{
-						"type":       "object",
-						"properties": tool.Parameters().Properties,
-						"required":   tool.Parameters().Required,
-					}),
+					Parameters:  openai.F(openai.FunctionParameters(tool.Parameters().Schema())),
 				}),
 			},
 		)
@@ -0,0 +1,455 @@
+// Package schema validates JSON documents against JSON schemas. It implements the subset
+// of JSON Schema draft 2020-12 used to declare tool parameters and structured answers:
+//
+//   - type, enum and const
+//   - properties, patternProperties, additionalProperties, required, minProperties and
+//     maxProperties
+//   - items, prefixItems, minItems, maxItems and uniqueItems
+//   - minLength, maxLength and pattern
+//   - minimum, maximum, exclusiveMinimum, exclusiveMaximum and multipleOf
+//   - allOf, anyOf, oneOf and not
+//   - $ref to the root or to $defs of the same document
+//
+// Annotations like title, description or format are not validated. Unknown keywords
+// are ignored, as required by the specification.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// types are the type names of JSON Schema.
+var types = []string{"null", "boolean", "object", "array", "number", "string", "integer"}
+
+// Schema is a compiled JSON schema.
+type Schema struct {
+	root *node
+}
+
+// node is a compiled schema or subschema.
+type node struct {
+	// always is set for the boolean schemas true and false.
+	always *bool
+	ref    *node
+
+	types    []string
+	enum     []any
+	constant any
+	hasConst bool
+
+	properties        map[string]*node
+	patternProperties []pattern
+	additional        *node
+	required          []string
+	minProperties     *int
+	maxProperties     *int
+
+	items       *node
+	prefixItems []*node
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	allOf []*node
+	anyOf []*node
+	oneOf []*node
+	not   *node
+}
+
+type pattern struct {
+	re   *regexp.Regexp
+	node *node
+}
+
+// Compile compiles the JSON schema doc. The doc is a schema decoded from JSON or YAML,
+// or built from maps and slices. An error is returned if doc is no valid schema.
+func Compile(doc any) (*Schema, error) {
+	doc, err := normalize(doc)
+	if err != nil {
+		return nil, fmt.Errorf("normalize schema: %w", err)
+	}
+	c := &compiler{
+		root: doc,
+		refs: make(map[string]*node),
+	}
+	root, err := c.compile(doc, "#")
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{root: root}, nil
+}
+
+// MustCompile is like Compile but panics if doc is no valid schema.
+func MustCompile(doc any) *Schema {
+	s, err := Compile(doc)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// normalize returns v as decoded from JSON, so that numbers are float64, objects are
+// map[string]any and arrays are []any.
+func normalize(v any) (any, error) {
+	bb, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	err = json.Unmarshal(bb, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type compiler struct {
+	root any
+	// refs holds the nodes of resolved references, so that recursive schemas compile.
+	refs map[string]*node
+}
+
+// compile compiles the schema doc found at the JSON pointer ptr.
+func (c *compiler) compile(doc any, ptr string) (*node, error) {
+	n := &node{}
+	err := c.compileInto(n, doc, ptr)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (c *compiler) compileInto(n *node, doc any, ptr string) error {
+	switch s := doc.(type) {
+	case bool:
+		n.always = &s
+		return nil
+	case map[string]any:
+		return c.keywords(n, s, ptr)
+	default:
+		return fmt.Errorf("%s: schema must be an object or a boolean", ptr)
+	}
+}
+
+// keywords compiles the keywords of the schema object s into n.
+func (c *compiler) keywords(n *node, s map[string]any, ptr string) error {
+	var err error
+	if ref, ok := s["$ref"]; ok {
+		target, ok := ref.(string)
+		if !ok {
+			return fmt.Errorf("%s/$ref: must be a string", ptr)
+		}
+		n.ref, err = c.resolve(target)
+		if err != nil {
+			return fmt.Errorf("%s/$ref: %w", ptr, err)
+		}
+	}
+	if defs, ok := s["$defs"]; ok {
+		m, ok := defs.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s/$defs: must be an object", ptr)
+		}
+		// Compile the definitions to report invalid ones, even if they are not referenced.
+		for _, name := range sortedKeys(m) {
+			_, err := c.resolve(ptr + "/$defs/" + escape(name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if t, ok := s["type"]; ok {
+		n.types, err = typeNames(t, ptr+"/type")
+		if err != nil {
+			return err
+		}
+	}
+	if enum, ok := s["enum"]; ok {
+		n.enum, ok = enum.([]any)
+		if !ok {
+			return fmt.Errorf("%s/enum: must be an array", ptr)
+		}
+	}
+	if constant, ok := s["const"]; ok {
+		n.constant = constant
+		n.hasConst = true
+	}
+
+	if props, ok := s["properties"]; ok {
+		m, ok := props.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s/properties: must be an object", ptr)
+		}
+		n.properties = make(map[string]*node, len(m))
+		for _, name := range sortedKeys(m) {
+			n.properties[name], err = c.compile(m[name], ptr+"/properties/"+escape(name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if props, ok := s["patternProperties"]; ok {
+		m, ok := props.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s/patternProperties: must be an object", ptr)
+		}
+		for _, expr := range sortedKeys(m) {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("%s/patternProperties: pattern %q invalid: %w", ptr, expr, err)
+			}
+			pn, err := c.compile(m[expr], ptr+"/patternProperties/"+escape(expr))
+			if err != nil {
+				return err
+			}
+			n.patternProperties = append(n.patternProperties, pattern{re: re, node: pn})
+		}
+	}
+	if additional, ok := s["additionalProperties"]; ok {
+		n.additional, err = c.compile(additional, ptr+"/additionalProperties")
+		if err != nil {
+			return err
+		}
+	}
+	if required, ok := s["required"]; ok {
+		n.required, err = stringList(required, ptr+"/required")
+		if err != nil {
+			return err
+		}
+	}
+	if n.minProperties, err = count(s, "minProperties", ptr); err != nil {
+		return err
+	}
+	if n.maxProperties, err = count(s, "maxProperties", ptr); err != nil {
+		return err
+	}
+
+	if items, ok := s["items"]; ok {
+		n.items, err = c.compile(items, ptr+"/items")
+		if err != nil {
+			return err
+		}
+	}
+	if prefix, ok := s["prefixItems"]; ok {
+		n.prefixItems, err = c.list(prefix, ptr+"/prefixItems")
+		if err != nil {
+			return err
+		}
+	}
+	if n.minItems, err = count(s, "minItems", ptr); err != nil {
+		return err
+	}
+	if n.maxItems, err = count(s, "maxItems", ptr); err != nil {
+		return err
+	}
+	if unique, ok := s["uniqueItems"]; ok {
+		n.uniqueItems, ok = unique.(bool)
+		if !ok {
+			return fmt.Errorf("%s/uniqueItems: must be a boolean", ptr)
+		}
+	}
+
+	if n.minLength, err = count(s, "minLength", ptr); err != nil {
+		return err
+	}
+	if n.maxLength, err = count(s, "maxLength", ptr); err != nil {
+		return err
+	}
+	if p, ok := s["pattern"]; ok {
+		expr, ok := p.(string)
+		if !ok {
+			return fmt.Errorf("%s/pattern: must be a string", ptr)
+		}
+		n.pattern, err = regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("%s/pattern: %w", ptr, err)
+		}
+	}
+
+	for keyword, dst := range map[string]**float64{
+		"minimum":          &n.minimum,
+		"maximum":          &n.maximum,
+		"exclusiveMinimum": &n.exclusiveMinimum,
+		"exclusiveMaximum": &n.exclusiveMaximum,
+		"multipleOf":       &n.multipleOf,
+	} {
+		v, ok := s[keyword]
+		if !ok {
+			continue
+		}
+		f, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("%s/%s: must be a number", ptr, keyword)
+		}
+		*dst = &f
+	}
+	if n.multipleOf != nil && *n.multipleOf <= 0 {
+		return fmt.Errorf("%s/multipleOf: must be greater than 0", ptr)
+	}
+
+	for keyword, dst := range map[string]*[]*node{
+		"allOf": &n.allOf,
+		"anyOf": &n.anyOf,
+		"oneOf": &n.oneOf,
+	} {
+		v, ok := s[keyword]
+		if !ok {
+			continue
+		}
+		*dst, err = c.list(v, ptr+"/"+keyword)
+		if err != nil {
+			return err
+		}
+		if len(*dst) == 0 {
+			return fmt.Errorf("%s/%s: must not be empty", ptr, keyword)
+		}
+	}
+	if not, ok := s["not"]; ok {
+		n.not, err = c.compile(not, ptr+"/not")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list compiles the array of schemas v.
+func (c *compiler) list(v any, ptr string) ([]*node, error) {
+	docs, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: must be an array", ptr)
+	}
+	nodes := make([]*node, 0, len(docs))
+	for i, doc := range docs {
+		n, err := c.compile(doc, fmt.Sprintf("%s/%d", ptr, i))
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// resolve returns the node of the reference ref. Only references into the same
+// document are supported, e.g. "#" or "#/$defs/address".
+func (c *compiler) resolve(ref string) (*node, error) {
+	if n, ok := c.refs[ref]; ok {
+		return n, nil
+	}
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("reference %s not supported", ref)
+	}
+
+	doc := c.root
+	if ref != "#" {
+		for _, token := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			m, ok := doc.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("reference %s not found", ref)
+			}
+			doc, ok = m[unescape(token)]
+			if !ok {
+				return nil, fmt.Errorf("reference %s not found", ref)
+			}
+		}
+	}
+
+	// Register the node before compiling it, so that references to itself resolve.
+	n := &node{}
+	c.refs[ref] = n
+	err := c.compileInto(n, doc, ref)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// typeNames returns the type names of the type keyword t, a name or an array of names.
+func typeNames(t any, ptr string) ([]string, error) {
+	var names []string
+	switch v := t.(type) {
+	case string:
+		names = []string{v}
+	case []any:
+		var err error
+		names, err = stringList(v, ptr)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%s: must be a string or an array", ptr)
+	}
+	for _, name := range names {
+		if !slices.Contains(types, name) {
+			return nil, fmt.Errorf("%s: unknown type %q", ptr, name)
+		}
+	}
+	return names, nil
+}
+
+// stringList returns v as list of unique strings.
+func stringList(v any, ptr string) ([]string, error) {
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: must be an array", ptr)
+	}
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: must be an array of strings", ptr)
+		}
+		if slices.Contains(list, s) {
+			return nil, fmt.Errorf("%s: %q is not unique", ptr, s)
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// count returns the non-negative integer keyword of s, if set.
+func count(s map[string]any, keyword string, ptr string) (*int, error) {
+	v, ok := s[keyword]
+	if !ok {
+		return nil, nil
+	}
+	f, ok := v.(float64)
+	if !ok || f < 0 || f != float64(int(f)) {
+		return nil, fmt.Errorf("%s/%s: must be a non-negative integer", ptr, keyword)
+	}
+	i := int(f)
+	return &i, nil
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// escape escapes a token of a JSON pointer.
+func escape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// unescape unescapes a token of a JSON pointer.
+func unescape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
@@ -0,0 +1,329 @@
+package schema
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		doc     any
+		wantErr bool
+	}{
+		{
+			name: "object",
+			doc: map[string]any{
+				"type":     "object",
+				"required": []string{"location"},
+				"properties": map[string]any{
+					"location": map[string]any{"type": "string", "minLength": 1},
+					"days":     map[string]any{"type": []string{"integer", "null"}, "maximum": 7},
+				},
+			},
+		},
+		{
+			name: "boolean schema",
+			doc:  true,
+		},
+		{
+			name: "annotations and unknown keywords",
+			doc: map[string]any{
+				"$schema":     "https://json-schema.org/draft/2020-12/schema",
+				"title":       "Location",
+				"description": "A location",
+				"format":      "city",
+				"x-internal":  true,
+			},
+		},
+		{
+			name: "refs",
+			doc: map[string]any{
+				"$defs": map[string]any{
+					"node": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"children": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/$defs/node"}},
+						},
+					},
+				},
+				"$ref": "#/$defs/node",
+			},
+		},
+		{
+			name:    "no schema",
+			doc:     "string",
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			doc:     map[string]any{"type": "text"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid pattern",
+			doc:     map[string]any{"pattern": "("},
+			wantErr: true,
+		},
+		{
+			name:    "negative length",
+			doc:     map[string]any{"minLength": -1},
+			wantErr: true,
+		},
+		{
+			name:    "fractional items",
+			doc:     map[string]any{"maxItems": 1.5},
+			wantErr: true,
+		},
+		{
+			name:    "required no array",
+			doc:     map[string]any{"required": "location"},
+			wantErr: true,
+		},
+		{
+			name:    "required not unique",
+			doc:     map[string]any{"required": []string{"a", "a"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid property",
+			doc:     map[string]any{"properties": map[string]any{"location": "string"}},
+			wantErr: true,
+		},
+		{
+			name:    "minimum no number",
+			doc:     map[string]any{"minimum": "1"},
+			wantErr: true,
+		},
+		{
+			name:    "zero multipleOf",
+			doc:     map[string]any{"multipleOf": 0},
+			wantErr: true,
+		},
+		{
+			name:    "empty anyOf",
+			doc:     map[string]any{"anyOf": []any{}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown ref",
+			doc:     map[string]any{"$ref": "#/$defs/missing"},
+			wantErr: true,
+		},
+		{
+			name:    "remote ref",
+			doc:     map[string]any{"$ref": "https://example.com/schema.json"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid definition",
+			doc:     map[string]any{"$defs": map[string]any{"a": map[string]any{"type": 1}}},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Compile(test.doc)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Compile() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchema_ValidateJSON(t *testing.T) {
+	t.Parallel()
+
+	s := MustCompile(map[string]any{
+		"type":     "object",
+		"required": []any{"location", "days"},
+		"properties": map[string]any{
+			"location": map[string]any{"type": "string", "minLength": 2, "maxLength": 20, "pattern": "^[A-Z]"},
+			"days":     map[string]any{"type": "integer", "minimum": 1, "maximum": 7},
+			"unit":     map[string]any{"enum": []any{"C", "F"}},
+			"step":     map[string]any{"type": "number", "exclusiveMinimum": 0, "multipleOf": 0.5},
+			"tags": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"minItems":    1,
+				"maxItems":    3,
+				"uniqueItems": true,
+			},
+			"point": map[string]any{
+				"type":        "array",
+				"prefixItems": []any{map[string]any{"type": "number"}, map[string]any{"type": "number"}},
+				"items":       false,
+			},
+			"kind":    map[string]any{"const": "forecast"},
+			"contact": map[string]any{"oneOf": []any{map[string]any{"type": "string"}, map[string]any{"type": "integer"}}},
+			"window":  map[string]any{"anyOf": []any{map[string]any{"maximum": 3}, map[string]any{"minimum": 10}}},
+			"note":    map[string]any{"not": map[string]any{"type": "null"}},
+			"range": map[string]any{
+				"allOf": []any{
+					map[string]any{"required": []any{"from"}},
+					map[string]any{"required": []any{"to"}},
+				},
+			},
+			"labels": map[string]any{
+				"type":                 "object",
+				"patternProperties":    map[string]any{"^x-": map[string]any{"type": "string"}},
+				"additionalProperties": map[string]any{"type": "boolean"},
+				"maxProperties":        2,
+			},
+		},
+		"additionalProperties": false,
+	})
+
+	tests := []struct {
+		name string
+		data string
+		want []Violation
+	}{
+		{
+			name: "valid",
+			data: `{"location":"Sydney","days":3,"unit":"C","step":1.5,"tags":["a","b"],"point":[1,2],"kind":"forecast",
+				"contact":"me","window":12,"note":"hi","range":{"from":1,"to":2},"labels":{"x-a":"b","c":true}}`,
+		},
+		{
+			name: "invalid json",
+			data: `{"location":`,
+			want: []Violation{{Path: "$", Message: "invalid JSON: unexpected EOF"}},
+		},
+		{
+			name: "trailing data",
+			data: `{"location":"Sydney","days":3} {}`,
+			want: []Violation{{Path: "$", Message: "invalid JSON: unexpected data after the document"}},
+		},
+		{
+			name: "no object",
+			data: `["Sydney"]`,
+			want: []Violation{{Path: "$", Message: "must be of type object, got array"}},
+		},
+		{
+			name: "missing and unknown properties",
+			data: `{"wind":3}`,
+			want: []Violation{
+				{Path: "$", Message: `missing required property "location"`},
+				{Path: "$", Message: `missing required property "days"`},
+				{Path: "$", Message: `unknown property "wind"`},
+			},
+		},
+		{
+			name: "strings",
+			data: `{"location":"s","days":3}`,
+			want: []Violation{
+				{Path: "$.location", Message: "must be at least 2 characters long"},
+				{Path: "$.location", Message: "must match the pattern ^[A-Z]"},
+			},
+		},
+		{
+			name: "numbers",
+			data: `{"location":"Sydney","days":1.5,"step":0.7}`,
+			want: []Violation{
+				{Path: "$.days", Message: "must be of type integer, got number"},
+				{Path: "$.step", Message: "must be a multiple of 0.5"},
+			},
+		},
+		{
+			name: "range",
+			data: `{"location":"Sydney","days":8,"step":0}`,
+			want: []Violation{
+				{Path: "$.days", Message: "must be less than or equal to 7"},
+				{Path: "$.step", Message: "must be greater than 0"},
+			},
+		},
+		{
+			name: "enum and const",
+			data: `{"location":"Sydney","days":3,"unit":"K","kind":"history"}`,
+			want: []Violation{
+				{Path: "$.kind", Message: `must be "forecast"`},
+				{Path: "$.unit", Message: `must be one of ["C","F"]`},
+			},
+		},
+		{
+			name: "arrays",
+			data: `{"location":"Sydney","days":3,"tags":["a",1,"a","b"],"point":[1,"2",3]}`,
+			want: []Violation{
+				{Path: "$.point[1]", Message: "must be of type number, got string"},
+				{Path: "$.point[2]", Message: "not allowed"},
+				{Path: "$.tags", Message: "must have at most 3 items"},
+				{Path: "$.tags", Message: "items 0 and 2 must be unique"},
+				{Path: "$.tags[1]", Message: "must be of type string, got integer"},
+			},
+		},
+		{
+			name: "combinators",
+			data: `{"location":"Sydney","days":3,"contact":1.5,"window":5,"note":null,"range":{"from":1}}`,
+			want: []Violation{
+				{Path: "$.contact", Message: "must match exactly one schema of oneOf, matches 0"},
+				{Path: "$.note", Message: "must not match the schema of not"},
+				{Path: "$.range", Message: `missing required property "to"`},
+				{Path: "$.window", Message: "must match at least one schema of anyOf"},
+			},
+		},
+		{
+			name: "pattern and additional properties",
+			data: `{"location":"Sydney","days":3,"labels":{"x-a":1,"b":"c","my key":true}}`,
+			want: []Violation{
+				{Path: "$.labels", Message: "must have at most 2 properties"},
+				{Path: "$.labels.b", Message: "must be of type boolean, got string"},
+				{Path: "$.labels[\"x-a\"]", Message: "must be of type string, got integer"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := s.ValidateJSON([]byte(test.data))
+			if test.want == nil {
+				if err != nil {
+					t.Errorf("Schema.ValidateJSON() error = %v, want nil", err)
+				}
+				return
+			}
+			var valErr *ValidationError
+			if !errors.As(err, &valErr) {
+				t.Fatalf("Schema.ValidateJSON() error = %v, want %T", err, valErr)
+			}
+			if !reflect.DeepEqual(valErr.Violations, test.want) {
+				t.Errorf("Schema.ValidateJSON() violations = %v, want %v", valErr.Violations, test.want)
+			}
+		})
+	}
+}
+
+func TestSchema_ValidateRef(t *testing.T) {
+	t.Parallel()
+
+	s := MustCompile(map[string]any{
+		"$defs": map[string]any{
+			"node": map[string]any{
+				"type":     "object",
+				"required": []any{"name"},
+				"properties": map[string]any{
+					"name":     map[string]any{"type": "string"},
+					"children": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/$defs/node"}},
+				},
+			},
+		},
+		"$ref": "#/$defs/node",
+	})
+
+	err := s.Validate(map[string]any{
+		"name": "root",
+		"children": []any{
+			map[string]any{"name": "a"},
+			map[string]any{"children": []any{map[string]any{"name": 1}}},
+		},
+	})
+	want := `$.children[1]: missing required property "name"; $.children[1].children[0].name: must be of type string, got integer`
+	if err == nil || err.Error() != want {
+		t.Errorf("Schema.Validate() error = %v, want %v", err, want)
+	}
+}
@@ -0,0 +1,313 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Violation is a part of a document which does not satisfy its schema.
+type Violation struct {
+	// Path locates the part in the document, e.g. $.items[2].name.
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Path, v.Message)
+}
+
+// ValidationError lists all violations of a document.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.String())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate validates the document v against the schema. If v does not satisfy the
+// schema, a *ValidationError is returned.
+func (s *Schema) Validate(v any) error {
+	v, err := normalize(v)
+	if err != nil {
+		return fmt.Errorf("normalize document: %w", err)
+	}
+	return s.validate(v)
+}
+
+// ValidateJSON validates the JSON document data against the schema. If data is no JSON
+// or does not satisfy the schema, a *ValidationError is returned.
+func (s *Schema) ValidateJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var v any
+	err := dec.Decode(&v)
+	if err == nil && dec.More() {
+		err = fmt.Errorf("unexpected data after the document")
+	}
+	if err != nil {
+		return &ValidationError{Violations: []Violation{{Path: "$", Message: fmt.Sprintf("invalid JSON: %s", err.Error())}}}
+	}
+	return s.validate(v)
+}
+
+func (s *Schema) validate(v any) error {
+	var violations []Violation
+	s.root.validate(v, "$", &violations)
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// valid reports whether v satisfies the node.
+func (n *node) valid(v any) bool {
+	var violations []Violation
+	n.validate(v, "$", &violations)
+	return len(violations) == 0
+}
+
+// validate appends the violations of v at path to violations.
+func (n *node) validate(v any, path string, violations *[]Violation) {
+	add := func(format string, args ...any) {
+		*violations = append(*violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if n.always != nil {
+		if !*n.always {
+			add("not allowed")
+		}
+		return
+	}
+	if n.ref != nil {
+		n.ref.validate(v, path, violations)
+	}
+
+	if len(n.types) > 0 && !slices.ContainsFunc(n.types, func(t string) bool { return hasType(v, t) }) {
+		add("must be of type %s, got %s", strings.Join(n.types, " or "), typeOf(v))
+		// The other keywords would only repeat the mismatch.
+		return
+	}
+	if n.enum != nil && !slices.ContainsFunc(n.enum, func(e any) bool { return equal(e, v) }) {
+		add("must be one of %s", encode(n.enum))
+	}
+	if n.hasConst && !equal(n.constant, v) {
+		add("must be %s", encode(n.constant))
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		n.validateObject(val, path, violations, add)
+	case []any:
+		n.validateArray(val, path, violations, add)
+	case string:
+		length := utf8.RuneCountInString(val)
+		if n.minLength != nil && length < *n.minLength {
+			add("must be at least %d characters long", *n.minLength)
+		}
+		if n.maxLength != nil && length > *n.maxLength {
+			add("must be at most %d characters long", *n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(val) {
+			add("must match the pattern %s", n.pattern.String())
+		}
+	case float64:
+		if n.minimum != nil && val < *n.minimum {
+			add("must be greater than or equal to %v", *n.minimum)
+		}
+		if n.maximum != nil && val > *n.maximum {
+			add("must be less than or equal to %v", *n.maximum)
+		}
+		if n.exclusiveMinimum != nil && val <= *n.exclusiveMinimum {
+			add("must be greater than %v", *n.exclusiveMinimum)
+		}
+		if n.exclusiveMaximum != nil && val >= *n.exclusiveMaximum {
+			add("must be less than %v", *n.exclusiveMaximum)
+		}
+		if n.multipleOf != nil {
+			q := val / *n.multipleOf
+			if math.Abs(q-math.Round(q)) > 1e-9 {
+				add("must be a multiple of %v", *n.multipleOf)
+			}
+		}
+	}
+
+	for _, sub := range n.allOf {
+		sub.validate(v, path, violations)
+	}
+	if n.anyOf != nil && !slices.ContainsFunc(n.anyOf, func(sub *node) bool { return sub.valid(v) }) {
+		add("must match at least one schema of anyOf")
+	}
+	if n.oneOf != nil {
+		var matches int
+		for _, sub := range n.oneOf {
+			if sub.valid(v) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			add("must match exactly one schema of oneOf, matches %d", matches)
+		}
+	}
+	if n.not != nil && n.not.valid(v) {
+		add("must not match the schema of not")
+	}
+}
+
+func (n *node) validateObject(obj map[string]any, path string, violations *[]Violation, add func(string, ...any)) {
+	for _, name := range n.required {
+		if _, ok := obj[name]; !ok {
+			add("missing required property %q", name)
+		}
+	}
+	if n.minProperties != nil && len(obj) < *n.minProperties {
+		add("must have at least %d properties", *n.minProperties)
+	}
+	if n.maxProperties != nil && len(obj) > *n.maxProperties {
+		add("must have at most %d properties", *n.maxProperties)
+	}
+
+	for _, name := range sortedKeys(obj) {
+		propPath := propertyPath(path, name)
+		matched := false
+		if prop, ok := n.properties[name]; ok {
+			matched = true
+			prop.validate(obj[name], propPath, violations)
+		}
+		for _, p := range n.patternProperties {
+			if p.re.MatchString(name) {
+				matched = true
+				p.node.validate(obj[name], propPath, violations)
+			}
+		}
+		if matched || n.additional == nil {
+			continue
+		}
+		if n.additional.always != nil && !*n.additional.always {
+			add("unknown property %q", name)
+			continue
+		}
+		n.additional.validate(obj[name], propPath, violations)
+	}
+}
+
+func (n *node) validateArray(arr []any, path string, violations *[]Violation, add func(string, ...any)) {
+	if n.minItems != nil && len(arr) < *n.minItems {
+		add("must have at least %d items", *n.minItems)
+	}
+	if n.maxItems != nil && len(arr) > *n.maxItems {
+		add("must have at most %d items", *n.maxItems)
+	}
+	if n.uniqueItems {
+		for i := range arr {
+			for j := range i {
+				if equal(arr[i], arr[j]) {
+					add("items %d and %d must be unique", j, i)
+				}
+			}
+		}
+	}
+	for i, item := range arr {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case i < len(n.prefixItems):
+			n.prefixItems[i].validate(item, itemPath, violations)
+		case n.items != nil:
+			n.items.validate(item, itemPath, violations)
+		}
+	}
+}
+
+// hasType reports whether v, decoded from JSON, is of the JSON schema type t.
+func hasType(v any, t string) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	default:
+		return false
+	}
+}
+
+// typeOf returns the JSON schema type of v, decoded from JSON.
+func typeOf(v any) string {
+	switch val := v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+// equal reports whether a and b, decoded from JSON, are equal.
+func equal(a, b any) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// encode returns v as JSON for messages.
+func encode(v any) string {
+	bb, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(bb)
+}
+
+// propertyPath returns the path of the property name of the object at path.
+func propertyPath(path string, name string) string {
+	if isIdentifier(name) {
+		return path + "." + name
+	}
+	return path + "[" + strconv.Quote(name) + "]"
+}
+
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
@@ -1,5 +1,12 @@
 package tool
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
 // Call provides the content for a tool action.
 type Call struct {
 	ID string
@@ -8,8 +15,88 @@ type Call struct {
 	Arguments string
 }
 
+// CanonicalArguments returns the arguments of the call in a canonical JSON form, so that
+// calls differing only in the order of keys or in whitespace are equal. Empty arguments
+// are an empty object.
+func (c Call) CanonicalArguments() (string, error) {
+	if strings.TrimSpace(c.Arguments) == "" {
+		return "{}", nil
+	}
+	dec := json.NewDecoder(strings.NewReader(c.Arguments))
+	dec.UseNumber()
+	var v any
+	err := dec.Decode(&v)
+	if err != nil {
+		return "", fmt.Errorf("decode arguments: %w", err)
+	}
+	// Encoding sorts the keys of objects.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(v)
+	if err != nil {
+		return "", fmt.Errorf("encode arguments: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
 // Response containes the output of the called tool.
 type Response struct {
 	ID      string
 	Content string
+	// Err is set if the call failed. The Content then describes the failure to the agent.
+	Err *Error
+}
+
+// ErrorKind classifies why a tool call failed.
+type ErrorKind string
+
+const (
+	ErrNotFound         ErrorKind = "not_found"
+	ErrInvalidArguments ErrorKind = "invalid_arguments"
+	ErrTimeout          ErrorKind = "timeout"
+	ErrStatus           ErrorKind = "status"
+	ErrTransport        ErrorKind = "transport"
+	// ErrInterrupted means the call was interrupted and may or may not have been
+	// executed.
+	ErrInterrupted ErrorKind = "interrupted"
+	// ErrBlocked means the call was blocked by a policy and not executed.
+	ErrBlocked ErrorKind = "blocked"
+	// ErrLimited means the call was not executed, because it waited too long for the
+	// concurrency or rate limits.
+	ErrLimited ErrorKind = "limited"
+	// ErrUnavailable means the call was not executed, because the tool service failed
+	// repeatedly and is given time to recover.
+	ErrUnavailable ErrorKind = "unavailable"
+	// ErrAuth means the call was not executed, because the credentials of the tool could
+	// not be obtained.
+	ErrAuth ErrorKind = "auth"
+	// ErrFailed means the tool executed the call and reported that it failed.
+	ErrFailed ErrorKind = "failed"
+)
+
+// Error describes a failed tool call, so that the agent can retry the call, pick
+// another tool or explain the failure.
+type Error struct {
+	Kind ErrorKind `json:"kind"`
+	// Status is the status code of the tool service, if it answered.
+	Status  int    `json:"status,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Status != 0 {
+		return fmt.Sprintf("%s %d: %s", e.Kind, e.Status, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+}
+
+// Content returns the error as json object, as it is presented to the agent.
+func (e *Error) Content() string {
+	bb, err := json.Marshal(map[string]*Error{"error": e})
+	if err != nil {
+		// This should not happen.
+		return fmt.Sprintf(`{"error":{"kind":%q}}`, e.Kind)
+	}
+	return string(bb)
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/Br0ce/opera/pkg/tool"
 )
@@ -16,6 +17,46 @@ type Item struct {
 	Description string     `json:"Description"`
 	Parameters  Parameters `json:"Parameters"`
 	Addr        string     `json:"Addr"`
+	Approval    bool       `json:"Approval"`
+	Idempotent  bool       `json:"Idempotent"`
+	// ReadOnly declares that the tool does not modify its environment. Results of
+	// read-only tools are cached.
+	ReadOnly bool `json:"ReadOnly"`
+	// CacheTTL is the duration for which results are cached, e.g. "5m". If empty, the
+	// default of the cache applies and only results of read-only tools are cached.
+	CacheTTL string `json:"CacheTTL"`
+	// NoCache disables caching for tools which mutate state.
+	NoCache bool `json:"NoCache"`
+	// RateLimit is the number of calls per second the tool accepts, with bursts of up
+	// to RateBurst calls. Zero means unlimited.
+	RateLimit float64 `json:"RateLimit"`
+	RateBurst int     `json:"RateBurst"`
+	// Timeout limits each attempt to call the tool, e.g. "10s". If empty, the default of
+	// the actor applies.
+	Timeout string `json:"Timeout"`
+	// MaxRetries is the number of retries of failed calls, which are delayed by
+	// RetryBackoff, e.g. "1s", doubling with every retry. RetryStatusCodes are the
+	// retried status codes of the tool service, in addition to timeouts and transport
+	// failures of idempotent tools.
+	MaxRetries       int    `json:"MaxRetries"`
+	RetryBackoff     string `json:"RetryBackoff"`
+	RetryStatusCodes []int  `json:"RetryStatusCodes"`
+	// Request maps the arguments to the HTTP request to the tool service. If empty, the
+	// arguments are posted as JSON object to Addr.
+	Request Request `json:"Request"`
+}
+
+// Request declares the HTTP request to a tool service, see tool.Request.
+type Request struct {
+	// Method is the HTTP method, POST if empty.
+	Method string `json:"Method"`
+	// Path is appended to the path of Addr, e.g. "/users/{id}".
+	Path string `json:"Path"`
+	// Query and Header map query parameters and headers to the names of arguments.
+	Query  map[string]string `json:"Query"`
+	Header map[string]string `json:"Header"`
+	// Body names the argument sent as body. If empty, the unmapped arguments are sent.
+	Body string `json:"Body"`
 }
 
 type Parameters struct {
@@ -28,15 +69,57 @@ func (i Item) Decode() (tool.Tool, error) {
 	if err != nil {
 		return tool.Tool{}, fmt.Errorf("parse addr: %w", err)
 	}
+	ttl, err := optionalDuration(i.CacheTTL)
+	if err != nil {
+		return tool.Tool{}, fmt.Errorf("parse cache ttl: %w", err)
+	}
+	timeout, err := optionalDuration(i.Timeout)
+	if err != nil {
+		return tool.Tool{}, fmt.Errorf("parse timeout: %w", err)
+	}
+	backoff, err := optionalDuration(i.RetryBackoff)
+	if err != nil {
+		return tool.Tool{}, fmt.Errorf("parse retry backoff: %w", err)
+	}
 	return tool.MakeTool(
 		tool.WithName(i.Name),
 		tool.WithDescription(i.Description),
 		tool.WithParameters(i.Parameters.Properties, i.Parameters.Required),
-		tool.WithAddr(*addr))
+		tool.WithAddr(*addr),
+		tool.WithApproval(i.Approval),
+		tool.WithIdempotent(i.Idempotent),
+		tool.WithReadOnly(i.ReadOnly),
+		tool.WithCacheTTL(ttl),
+		tool.WithNoCache(i.NoCache),
+		tool.WithRateLimit(i.RateLimit, i.RateBurst),
+		tool.WithTimeout(timeout),
+		tool.WithRetry(tool.RetryPolicy{
+			MaxRetries:  i.MaxRetries,
+			Backoff:     backoff,
+			StatusCodes: i.RetryStatusCodes,
+		}),
+		tool.WithRequest(i.Request.Decode()))
+}
+
+func (r Request) Decode() tool.Request {
+	return tool.Request{
+		Method: r.Method,
+		Path:   r.Path,
+		Query:  r.Query,
+		Header: r.Header,
+		Body:   r.Body,
+	}
+}
+
+// optionalDuration parses the duration s. An empty s is zero.
+func optionalDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
 }
 
 func (p Parameters) Decode() tool.Parameters {
-	// todo Need to validate parameters.
 	return tool.Parameters{
 		Properties: p.Properties,
 		Required:   p.Required,
@@ -17,13 +17,14 @@ import (
 	"github.com/Br0ce/opera/pkg/db"
 	"github.com/Br0ce/opera/pkg/monitor"
 	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/tool/discovery/label"
 )
 
 const (
-	name = "com.github.Br0ce.opera.tool.name"
+	name = label.Name
 	host = "com.docker.compose.service"
-	port = "com.github.Br0ce.opera.tool.port"
-	path = "com.github.Br0ce.opera.tool.path"
+	port = label.Port
+	path = label.Path
 )
 
 var _ tool.Discovery = (*Discovery)(nil)
@@ -167,12 +168,17 @@ func (di *Discovery) toTool(ctx context.Context, container container.Summary) (t
 		return tool.Tool{}, fmt.Errorf("get config: %w", err)
 	}
 
-	result, err := tool.MakeTool(
+	opts, err := label.Options(container.Labels)
+	if err != nil {
+		return tool.Tool{}, err
+	}
+
+	result, err := tool.MakeTool(append([]tool.Option{
 		tool.WithName(tName),
 		tool.WithAddr(addr),
 		tool.WithDescription(cfg.Description),
 		tool.WithParameters(cfg.Properties, cfg.Required),
-	)
+	}, opts...)...)
 	if err != nil {
 		return tool.Tool{}, fmt.Errorf("make tool: %w", err)
 	}
@@ -9,12 +9,14 @@ import (
 	"reflect"
 	"slices"
 	"testing"
+	"time"
 
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/Br0ce/opera/pkg/db/mock"
 	"github.com/Br0ce/opera/pkg/monitor"
 	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/tool/discovery/label"
 	mockTransport "github.com/Br0ce/opera/pkg/transport/mock"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
@@ -693,6 +695,184 @@ func TestDiscovery_toTool(t *testing.T) {
 			port: "8888",
 		},
 	}
+	approvalContainer := container.Summary{
+		Image: "myImage",
+		Labels: map[string]string{
+			name:             "myTool",
+			host:             "myHost",
+			port:             "8888",
+			path:             "myPath",
+			label.Approval:   "true",
+			label.Idempotent: "true",
+		},
+	}
+	wantApprovalTool, err := tool.MakeTool(
+		tool.WithName("myTool"),
+		tool.WithAddr(url.URL{Host: "myHost:8888", Scheme: "http", Path: "myPath"}),
+		tool.WithDescription("my description"),
+		tool.WithParameters(map[string]any{
+			"myparam": map[string]any{
+				"type": "string",
+			},
+		},
+			[]string{"myparam"}),
+		tool.WithApproval(true),
+		tool.WithIdempotent(true))
+	if err != nil {
+		t.Fatalf("test approval tool")
+	}
+	invalidApprovalContainer := container.Summary{
+		Image: "myImage",
+		Labels: map[string]string{
+			name:           "myTool",
+			host:           "myHost",
+			port:           "8888",
+			path:           "myPath",
+			label.Approval: "maybe",
+		},
+	}
+	invalidIdempotentContainer := container.Summary{
+		Image: "myImage",
+		Labels: map[string]string{
+			name:             "myTool",
+			host:             "myHost",
+			port:             "8888",
+			path:             "myPath",
+			label.Idempotent: "sometimes",
+		},
+	}
+	cacheContainer := container.Summary{
+		Image: "myImage",
+		Labels: map[string]string{
+			name:           "myTool",
+			host:           "myHost",
+			port:           "8888",
+			path:           "myPath",
+			label.CacheTTL: "5m",
+			label.NoCache:  "false",
+		},
+	}
+	wantCacheTool, err := tool.MakeTool(
+		tool.WithName("myTool"),
+		tool.WithAddr(url.URL{Host: "myHost:8888", Scheme: "http", Path: "myPath"}),
+		tool.WithDescription("my description"),
+		tool.WithParameters(map[string]any{
+			"myparam": map[string]any{
+				"type": "string",
+			},
+		},
+			[]string{"myparam"}),
+		tool.WithCacheTTL(5*time.Minute))
+	if err != nil {
+		t.Fatalf("test cache tool")
+	}
+	invalidCacheContainer := container.Summary{
+		Image: "myImage",
+		Labels: map[string]string{
+			name:           "myTool",
+			host:           "myHost",
+			port:           "8888",
+			path:           "myPath",
+			label.CacheTTL: "often",
+		},
+	}
+	rateContainer := container.Summary{
+		Image: "myImage",
+		Labels: map[string]string{
+			name:               "myTool",
+			host:               "myHost",
+			port:               "8888",
+			path:               "myPath",
+			label.RateLimit:    "2.5",
+			label.RateBurst:    "5",
+			label.Timeout:      "10s",
+			label.MaxRetries:   "2",
+			label.RetryBackoff: "1s",
+			label.RetryCodes:   "429, 503",
+		},
+	}
+	wantRateTool, err := tool.MakeTool(
+		tool.WithName("myTool"),
+		tool.WithAddr(url.URL{Host: "myHost:8888", Scheme: "http", Path: "myPath"}),
+		tool.WithDescription("my description"),
+		tool.WithParameters(map[string]any{
+			"myparam": map[string]any{
+				"type": "string",
+			},
+		},
+			[]string{"myparam"}),
+		tool.WithRateLimit(2.5, 5),
+		tool.WithTimeout(10*time.Second),
+		tool.WithRetry(tool.RetryPolicy{MaxRetries: 2, Backoff: time.Second, StatusCodes: []int{429, 503}}))
+	if err != nil {
+		t.Fatalf("test rate tool")
+	}
+	invalidRateContainer := container.Summary{
+		Image: "myImage",
+		Labels: map[string]string{
+			name:            "myTool",
+			host:            "myHost",
+			port:            "8888",
+			path:            "myPath",
+			label.RateLimit: "fast",
+		},
+	}
+	requestContainer := container.Summary{
+		Image: "myImage",
+		Labels: map[string]string{
+			name:                "myTool",
+			host:                "myHost",
+			port:                "8888",
+			path:                "myPath",
+			label.RequestMethod: "GET",
+			label.RequestPath:   "/items/{myparam}",
+			label.RequestQuery:  "q=myparam, page=myparam",
+			label.RequestHeader: "X-Param=myparam",
+		},
+	}
+	wantRequestTool, err := tool.MakeTool(
+		tool.WithName("myTool"),
+		tool.WithAddr(url.URL{Host: "myHost:8888", Scheme: "http", Path: "myPath"}),
+		tool.WithDescription("my description"),
+		tool.WithParameters(map[string]any{
+			"myparam": map[string]any{
+				"type": "string",
+			},
+		},
+			[]string{"myparam"}),
+		tool.WithRequest(tool.Request{
+			Method: "GET",
+			Path:   "/items/{myparam}",
+			Query:  map[string]string{"q": "myparam", "page": "myparam"},
+			Header: map[string]string{"X-Param": "myparam"},
+		}))
+	if err != nil {
+		t.Fatalf("test request tool")
+	}
+	invalidRequestContainer := container.Summary{
+		Image: "myImage",
+		Labels: map[string]string{
+			name:               "myTool",
+			host:               "myHost",
+			port:               "8888",
+			path:               "myPath",
+			label.RequestQuery: "q",
+		},
+	}
+	configFn := func(_ context.Context, _ string, _ map[string][]string) ([]byte, error) {
+		cfg := config{
+			Name:        "myTool",
+			Description: "my description",
+			Properties: map[string]any{
+				"myparam": map[string]any{
+					"type": "string",
+				},
+			},
+			Required: []string{"myparam"},
+		}
+		return json.Marshal(cfg)
+	}
+
 	tests := []struct {
 		name           string
 		ctx            context.Context
@@ -753,6 +933,82 @@ func TestDiscovery_toTool(t *testing.T) {
 			container:   toolContainer,
 			wantErr:     true,
 		},
+		{
+			name:           "approval label",
+			transportGetFn: configFn,
+			wantInvoked:    true,
+			ctx:            context.TODO(),
+			container:      approvalContainer,
+			want:           wantApprovalTool,
+			wantErr:        false,
+		},
+		{
+			name:           "invalid approval label",
+			transportGetFn: configFn,
+			wantInvoked:    true,
+			ctx:            context.TODO(),
+			container:      invalidApprovalContainer,
+			wantErr:        true,
+		},
+		{
+			name:           "invalid idempotent label",
+			transportGetFn: configFn,
+			wantInvoked:    true,
+			ctx:            context.TODO(),
+			container:      invalidIdempotentContainer,
+			wantErr:        true,
+		},
+		{
+			name:           "cache labels",
+			transportGetFn: configFn,
+			wantInvoked:    true,
+			ctx:            context.TODO(),
+			container:      cacheContainer,
+			want:           wantCacheTool,
+			wantErr:        false,
+		},
+		{
+			name:           "invalid cache ttl label",
+			transportGetFn: configFn,
+			wantInvoked:    true,
+			ctx:            context.TODO(),
+			container:      invalidCacheContainer,
+			wantErr:        true,
+		},
+		{
+			name:           "rate and retry labels",
+			transportGetFn: configFn,
+			wantInvoked:    true,
+			ctx:            context.TODO(),
+			container:      rateContainer,
+			want:           wantRateTool,
+			wantErr:        false,
+		},
+		{
+			name:           "invalid rate limit label",
+			transportGetFn: configFn,
+			wantInvoked:    true,
+			ctx:            context.TODO(),
+			container:      invalidRateContainer,
+			wantErr:        true,
+		},
+		{
+			name:           "request labels",
+			transportGetFn: configFn,
+			wantInvoked:    true,
+			ctx:            context.TODO(),
+			container:      requestContainer,
+			want:           wantRequestTool,
+			wantErr:        false,
+		},
+		{
+			name:           "invalid request query label",
+			transportGetFn: configFn,
+			wantInvoked:    true,
+			ctx:            context.TODO(),
+			container:      invalidRequestContainer,
+			wantErr:        true,
+		},
 	}
 
 	log := monitor.NewTestLogger(false)
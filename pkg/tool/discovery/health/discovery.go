@@ -0,0 +1,209 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/transport"
+)
+
+// Path is the path of the health endpoint of tool services.
+const Path = "/health"
+
+var _ tool.Discovery = (*Discovery)(nil)
+
+type Transporter interface {
+	Get(ctx context.Context, addr string, header map[string][]string) ([]byte, error)
+}
+
+// Breakers reports the state of the circuit breakers of the tools, see action.Breakers.
+type Breakers interface {
+	Open(name string) bool
+}
+
+// Status is the health of a tool.
+type Status struct {
+	Tool    string
+	Healthy bool
+	// Error describes why the last probe failed.
+	Error   string
+	Checked time.Time
+}
+
+// Discovery hides the tools of an underlying tool.Discovery whose tool services fail
+// their health probe or whose breaker is open. The health endpoints of the tool services
+// are probed on every refresh. Tool services answering with a status below 500 are
+// healthy, e.g. those without a health endpoint.
+type Discovery struct {
+	discovery tool.Discovery
+	transport Transporter
+	breakers  Breakers
+	statuses  map[string]Status
+	mu        sync.RWMutex
+	tr        trace.Tracer
+	log       *slog.Logger
+}
+
+type Option func(di *Discovery)
+
+// WithBreakers hides the tools whose breaker is open.
+func WithBreakers(breakers Breakers) Option {
+	return func(di *Discovery) {
+		di.breakers = breakers
+	}
+}
+
+// NewDiscovery returns a Discovery probing the tools of the given discovery with the
+// transport. The tools are probed on the first refresh, until then all are healthy.
+func NewDiscovery(discovery tool.Discovery, transport Transporter, log *slog.Logger, options ...Option) *Discovery {
+	di := &Discovery{
+		discovery: discovery,
+		transport: transport,
+		statuses:  make(map[string]Status),
+		tr:        monitor.Tracer("HealthDiscovery"),
+		log:       log,
+	}
+	for _, opt := range options {
+		opt(di)
+	}
+	return di
+}
+
+// Get returns the tool for the given name, regardless of its health. Calls to unhealthy
+// tools are left to fail, so that their breakers can close again.
+func (di *Discovery) Get(ctx context.Context, name string) (tool.Tool, error) {
+	return di.discovery.Get(ctx, name)
+}
+
+// All returns all healthy tools.
+func (di *Discovery) All(ctx context.Context) []tool.Tool {
+	ctx, span := di.tr.Start(ctx, "get healthy tools")
+	defer span.End()
+
+	var tt []tool.Tool
+	var hidden []string
+	for _, t := range di.discovery.All(ctx) {
+		if !di.available(t.Name()) {
+			hidden = append(hidden, t.Name())
+			continue
+		}
+		tt = append(tt, t)
+	}
+	if len(hidden) > 0 {
+		span.SetAttributes(attribute.StringSlice("tool.hidden", hidden))
+		di.log.Debug("hide unavailable tools", "method", "All", "tools", hidden, "traceID", monitor.TraceID(span))
+	}
+	return tt
+}
+
+// Refresh refreshes the underlying discovery and probes the health of all its tools.
+// The tools found are probed even if the refresh failed for some.
+func (di *Discovery) Refresh(ctx context.Context) error {
+	ctx, span := di.tr.Start(ctx, "refresh tool health")
+	defer span.End()
+
+	refreshErr := di.discovery.Refresh(ctx)
+
+	tools := di.discovery.All(ctx)
+	statuses := make(map[string]Status, len(tools))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, t := range tools {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := di.probe(ctx, t)
+			mu.Lock()
+			statuses[t.Name()] = status
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for _, status := range statuses {
+		if status.Healthy {
+			continue
+		}
+		span.AddEvent("tool unhealthy", trace.WithAttributes(
+			attribute.String("tool.name", status.Tool),
+			attribute.String("tool.error", status.Error),
+		))
+		di.log.Info("tool unhealthy",
+			"method", "Refresh",
+			"toolName", status.Tool,
+			"error", status.Error,
+			"traceID", monitor.TraceID(span))
+	}
+
+	di.mu.Lock()
+	di.statuses = statuses
+	di.mu.Unlock()
+	return refreshErr
+}
+
+// Statuses returns the health of all tools probed on the last refresh.
+func (di *Discovery) Statuses() map[string]Status {
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+
+	statuses := make(map[string]Status, len(di.statuses))
+	for name, status := range di.statuses {
+		statuses[name] = status
+	}
+	return statuses
+}
+
+// available reports whether the tool with the given name is healthy and its breaker
+// is not open.
+func (di *Discovery) available(name string) bool {
+	if di.breakers != nil && di.breakers.Open(name) {
+		return false
+	}
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+	status, ok := di.statuses[name]
+	return !ok || status.Healthy
+}
+
+// probe requests the health endpoint of the tool service. A service answering with a
+// status below 500 is reachable and healthy, even if it has no health endpoint or
+// requires credentials the probe does not send. Tools not called over HTTP, e.g. the
+// tools of MCP servers, have no health endpoint and are healthy.
+func (di *Discovery) probe(ctx context.Context, to tool.Tool) Status {
+	ctx, span := di.tr.Start(ctx, "probe tool health", trace.WithAttributes(attribute.String("tool.name", to.Name())))
+	defer span.End()
+
+	addr := to.Addr()
+	health := url.URL{Scheme: addr.Scheme, Host: addr.Host, Path: Path}
+	status := Status{
+		Tool:    to.Name(),
+		Healthy: true,
+		Checked: time.Now(),
+	}
+	if addr.Scheme != "http" && addr.Scheme != "https" {
+		return status
+	}
+
+	_, err := di.transport.Get(ctx, health.String(), nil)
+	var statusErr *transport.StatusError
+	if err == nil || (errors.As(err, &statusErr) && statusErr.Code < http.StatusInternalServerError) {
+		return status
+	}
+
+	status.Healthy = false
+	status.Error = fmt.Sprintf("probe %s: %s", health.String(), err.Error())
+	span.SetStatus(codes.Error, status.Error)
+	return status
+}
@@ -0,0 +1,177 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/tool/mock"
+	"github.com/Br0ce/opera/pkg/transport"
+	mockTransport "github.com/Br0ce/opera/pkg/transport/mock"
+)
+
+type breakers map[string]bool
+
+func (b breakers) Open(name string) bool {
+	return b[name]
+}
+
+func testTool(t *testing.T, name string, host string) tool.Tool {
+	t.Helper()
+	return testToolAt(t, name, url.URL{Scheme: "http", Host: host, Path: "/call"})
+}
+
+func testToolAt(t *testing.T, name string, addr url.URL) tool.Tool {
+	t.Helper()
+	to, err := tool.MakeTool(
+		tool.WithName(name),
+		tool.WithDescription("Get the "+name+"."),
+		tool.WithAddr(addr),
+		tool.WithParameters(map[string]any{}, nil),
+	)
+	if err != nil {
+		t.Fatalf("make tool: %s", err.Error())
+	}
+	return to
+}
+
+func TestDiscovery(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		probe       map[string]error
+		mcp         bool
+		open        breakers
+		refreshErr  error
+		wantAll     []string
+		wantHealthy map[string]bool
+		wantErr     bool
+	}{
+		{
+			name:        "all healthy",
+			wantAll:     []string{"weather", "sharks"},
+			wantHealthy: map[string]bool{"weather": true, "sharks": true},
+		},
+		{
+			name: "no health endpoint",
+			probe: map[string]error{
+				"http://weather:8080/health": &transport.StatusError{Code: 404, Status: "404 Not Found"},
+			},
+			wantAll:     []string{"weather", "sharks"},
+			wantHealthy: map[string]bool{"weather": true, "sharks": true},
+		},
+		{
+			name: "unauthorized",
+			probe: map[string]error{
+				"http://weather:8080/health": &transport.StatusError{Code: 401, Status: "401 Unauthorized"},
+			},
+			wantAll:     []string{"weather", "sharks"},
+			wantHealthy: map[string]bool{"weather": true, "sharks": true},
+		},
+		{
+			name: "unhealthy",
+			probe: map[string]error{
+				"http://weather:8080/health": &transport.StatusError{Code: 503, Status: "503 Service Unavailable"},
+			},
+			wantAll:     []string{"sharks"},
+			wantHealthy: map[string]bool{"weather": false, "sharks": true},
+		},
+		{
+			name: "unreachable",
+			probe: map[string]error{
+				"http://shark:8080/health": errors.New("connection refused"),
+			},
+			wantAll:     []string{"weather"},
+			wantHealthy: map[string]bool{"weather": true, "sharks": false},
+		},
+		{
+			name:        "breaker open",
+			open:        breakers{"weather": true},
+			wantAll:     []string{"sharks"},
+			wantHealthy: map[string]bool{"weather": true, "sharks": true},
+		},
+		{
+			name: "mcp tool not probed",
+			mcp:  true,
+			probe: map[string]error{
+				"mcp://search/health": errors.New("unsupported protocol scheme"),
+			},
+			wantAll:     []string{"weather", "sharks", "search"},
+			wantHealthy: map[string]bool{"weather": true, "sharks": true, "search": true},
+		},
+		{
+			name:       "refresh failed",
+			refreshErr: errors.New("docker down"),
+			probe: map[string]error{
+				"http://weather:8080/health": errors.New("connection refused"),
+			},
+			wantAll:     []string{"sharks"},
+			wantHealthy: map[string]bool{"weather": false, "sharks": true},
+			wantErr:     true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			tools := []tool.Tool{testTool(t, "weather", "weather:8080"), testTool(t, "sharks", "shark:8080")}
+			if test.mcp {
+				tools = append(tools, testToolAt(t, "search", transport.MCPAddr("search", "web_search")))
+			}
+			inner := &mock.Discovery{
+				GetFn: func(_ context.Context, _ string) (tool.Tool, error) {
+					return tools[0], nil
+				},
+				AllFn: func(_ context.Context) []tool.Tool {
+					return tools
+				},
+				RefreshFn: func(_ context.Context) error {
+					return test.refreshErr
+				},
+			}
+			trans := &mockTransport.Transporter{
+				GetFn: func(_ context.Context, addr string, _ map[string][]string) ([]byte, error) {
+					return nil, test.probe[addr]
+				},
+			}
+			var opts []Option
+			if test.open != nil {
+				opts = append(opts, WithBreakers(test.open))
+			}
+			di := NewDiscovery(inner, trans, monitor.NewTestLogger(false), opts...)
+
+			if err := di.Refresh(context.TODO()); (err != nil) != test.wantErr {
+				t.Errorf("Discovery.Refresh() error = %v, wantErr %v", err, test.wantErr)
+			}
+
+			var got []string
+			for _, to := range di.All(context.TODO()) {
+				got = append(got, to.Name())
+			}
+			if !reflect.DeepEqual(got, test.wantAll) {
+				t.Errorf("Discovery.All() = %v, want %v", got, test.wantAll)
+			}
+
+			healthy := make(map[string]bool)
+			for name, status := range di.Statuses() {
+				healthy[name] = status.Healthy
+				if !status.Healthy && status.Error == "" {
+					t.Errorf("Discovery.Statuses() %s has no error", name)
+				}
+			}
+			if !reflect.DeepEqual(healthy, test.wantHealthy) {
+				t.Errorf("Discovery.Statuses() healthy = %v, want %v", healthy, test.wantHealthy)
+			}
+
+			// Unhealthy tools can still be called, so that their breakers can close.
+			if _, err := di.Get(context.TODO(), "weather"); err != nil {
+				t.Errorf("Discovery.Get() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// listLimit is the number of objects listed per request.
+const listLimit = "500"
+
+// apiError is a status returned by the API server.
+type apiError struct {
+	code    int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("api server: %d %s", e.code, e.message)
+}
+
+// isGone returns true if err reports that the resource version of a watch expired.
+func isGone(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.code == http.StatusGone
+}
+
+// client requests the REST API of a Kubernetes API server.
+type client struct {
+	cfg  restConfig
+	http *http.Client
+}
+
+func newClient(cfg restConfig) *client {
+	tp := http.DefaultTransport.(*http.Transport).Clone()
+	tp.TLSClientConfig = cfg.tls
+	return &client{
+		cfg: cfg,
+		// No timeout, watch streams are long running. The requests are bound to their ctx.
+		http: &http.Client{Transport: tp},
+	}
+}
+
+// list returns all objects at path and the resource version of the list.
+func (c *client) list(ctx context.Context, path string) ([]object, string, error) {
+	var objects []object
+	query := url.Values{"limit": {listLimit}}
+	for {
+		resp, err := c.get(ctx, path, query)
+		if err != nil {
+			return nil, "", err
+		}
+		var page objectList
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, "", fmt.Errorf("decode list: %w", err)
+		}
+		objects = append(objects, page.Items...)
+		if page.Metadata.Continue == "" {
+			return objects, page.Metadata.ResourceVersion, nil
+		}
+		query.Set("continue", page.Metadata.Continue)
+	}
+}
+
+// watch streams the events of the objects at path since the resource version to fn,
+// until the stream ends, ctx is done or fn returns an error. An ERROR event is returned
+// as apiError.
+func (c *client) watch(ctx context.Context, path string, version string, fn func(event) error) error {
+	query := url.Values{
+		"watch":               {"true"},
+		"resourceVersion":     {version},
+		"allowWatchBookmarks": {"true"},
+	}
+	resp, err := c.get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev event
+		err := dec.Decode(&ev)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("decode event: %w", err)
+		}
+		if ev.Type == eventError {
+			var st status
+			err = json.Unmarshal(ev.Object, &st)
+			if err != nil {
+				return fmt.Errorf("decode error event: %w", err)
+			}
+			return &apiError{code: st.Code, message: st.Message}
+		}
+		err = fn(ev)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// get requests path with query. A response other than 200 is returned as apiError.
+func (c *client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := c.cfg.server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	token, err := c.token()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var st status
+		bb, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		if json.Unmarshal(bb, &st) != nil || st.Message == "" {
+			st.Message = strings.TrimSpace(string(bb))
+		}
+		return nil, &apiError{code: resp.StatusCode, message: st.Message}
+	}
+	return resp, nil
+}
+
+// token returns the bearer token of the config, reading the token file if set.
+func (c *client) token() (string, error) {
+	if c.cfg.tokenFile == "" {
+		return c.cfg.token, nil
+	}
+	bb, err := os.ReadFile(c.cfg.tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("read token: %w", err)
+	}
+	return strings.TrimSpace(string(bb)), nil
+}
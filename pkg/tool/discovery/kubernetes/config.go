@@ -0,0 +1,218 @@
+package kubernetes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// serviceAccountDir is where the credentials of the service account are mounted into
+// the pods of a cluster.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// restConfig is the address of an API server and the credentials to authenticate with.
+type restConfig struct {
+	server string
+	token  string
+	// tokenFile is read on every request, the token of a service account is rotated.
+	tokenFile string
+	tls       *tls.Config
+}
+
+// kubeconfig is the subset of a kubeconfig file needed to reach the API server of its
+// current context.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string  `yaml:"name"`
+		Cluster cluster `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User user   `yaml:"user"`
+	} `yaml:"users"`
+}
+
+type cluster struct {
+	Server                   string `yaml:"server"`
+	CertificateAuthority     string `yaml:"certificate-authority"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data"`
+	InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+}
+
+type user struct {
+	ClientCertificate     string `yaml:"client-certificate"`
+	ClientCertificateData string `yaml:"client-certificate-data"`
+	ClientKey             string `yaml:"client-key"`
+	ClientKeyData         string `yaml:"client-key-data"`
+	Token                 string `yaml:"token"`
+	TokenFile             string `yaml:"tokenFile"`
+	Exec                  any    `yaml:"exec"`
+	AuthProvider          any    `yaml:"auth-provider"`
+}
+
+// credentials returns the config of the kubeconfig at path. If path is empty, the
+// config of the service account is returned when running in a cluster, otherwise the
+// config of the kubeconfig at $KUBECONFIG or ~/.kube/config.
+func credentials(path string) (restConfig, error) {
+	if path == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host != "" && port != "" {
+			return inCluster(serviceAccountDir, host, port)
+		}
+		path, _, _ = strings.Cut(os.Getenv("KUBECONFIG"), string(os.PathListSeparator))
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return restConfig{}, fmt.Errorf("find kubeconfig: %w", err)
+		}
+		path = filepath.Join(home, ".kube", "config")
+	}
+	return readKubeconfig(path)
+}
+
+// inCluster returns the config of the service account mounted at dir, for the API
+// server at host and port.
+func inCluster(dir string, host string, port string) (restConfig, error) {
+	tokenFile := filepath.Join(dir, "token")
+	_, err := os.Stat(tokenFile)
+	if err != nil {
+		return restConfig{}, fmt.Errorf("service account token: %w", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		return restConfig{}, fmt.Errorf("service account ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return restConfig{}, errors.New("service account ca: no certificates")
+	}
+	return restConfig{
+		server:    "https://" + net.JoinHostPort(host, port),
+		tokenFile: tokenFile,
+		tls:       &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+	}, nil
+}
+
+// readKubeconfig returns the config of the current context of the kubeconfig at path.
+// Files referenced by the kubeconfig are relative to its directory. Credentials of exec
+// and auth provider plugins are not supported.
+func readKubeconfig(path string) (restConfig, error) {
+	bb, err := os.ReadFile(path)
+	if err != nil {
+		return restConfig{}, fmt.Errorf("read kubeconfig: %w", err)
+	}
+	var kc kubeconfig
+	err = yaml.Unmarshal(bb, &kc)
+	if err != nil {
+		return restConfig{}, fmt.Errorf("unmarshal kubeconfig %s: %w", path, err)
+	}
+
+	var clusterName, userName string
+	found := false
+	for _, c := range kc.Contexts {
+		if c.Name == kc.CurrentContext {
+			clusterName, userName, found = c.Context.Cluster, c.Context.User, true
+			break
+		}
+	}
+	if !found {
+		return restConfig{}, fmt.Errorf("kubeconfig %s: context %q not found", path, kc.CurrentContext)
+	}
+	var cl *cluster
+	for i := range kc.Clusters {
+		if kc.Clusters[i].Name == clusterName {
+			cl = &kc.Clusters[i].Cluster
+			break
+		}
+	}
+	if cl == nil || cl.Server == "" {
+		return restConfig{}, fmt.Errorf("kubeconfig %s: cluster %q not found", path, clusterName)
+	}
+	var us user
+	for _, u := range kc.Users {
+		if u.Name == userName {
+			us = u.User
+			break
+		}
+	}
+
+	dir := filepath.Dir(path)
+	cfg := restConfig{
+		server: strings.TrimSuffix(cl.Server, "/"),
+		token:  us.Token,
+		tls:    &tls.Config{InsecureSkipVerify: cl.InsecureSkipTLSVerify, MinVersion: tls.VersionTLS12},
+	}
+	if us.TokenFile != "" {
+		cfg.tokenFile = resolve(dir, us.TokenFile)
+	}
+
+	ca, err := pemData(dir, cl.CertificateAuthorityData, cl.CertificateAuthority)
+	if err != nil {
+		return restConfig{}, fmt.Errorf("kubeconfig %s: certificate authority: %w", path, err)
+	}
+	if ca != nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return restConfig{}, fmt.Errorf("kubeconfig %s: certificate authority: no certificates", path)
+		}
+		cfg.tls.RootCAs = pool
+	}
+
+	cert, err := pemData(dir, us.ClientCertificateData, us.ClientCertificate)
+	if err != nil {
+		return restConfig{}, fmt.Errorf("kubeconfig %s: client certificate: %w", path, err)
+	}
+	key, err := pemData(dir, us.ClientKeyData, us.ClientKey)
+	if err != nil {
+		return restConfig{}, fmt.Errorf("kubeconfig %s: client key: %w", path, err)
+	}
+	if cert != nil || key != nil {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return restConfig{}, fmt.Errorf("kubeconfig %s: client certificate: %w", path, err)
+		}
+		cfg.tls.Certificates = []tls.Certificate{pair}
+	}
+
+	if cfg.token == "" && cfg.tokenFile == "" && cert == nil && (us.Exec != nil || us.AuthProvider != nil) {
+		return restConfig{}, fmt.Errorf("kubeconfig %s: user %q: exec and auth provider credentials not supported", path, userName)
+	}
+	return cfg, nil
+}
+
+// pemData returns the base64 encoded data, or else the content of the file. Both empty
+// is nil.
+func pemData(dir string, data string, file string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return os.ReadFile(resolve(dir, file))
+	}
+	return nil, nil
+}
+
+// resolve returns the path relative to dir, if it is not absolute.
+func resolve(dir string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,455 @@
+// Package kubernetes provides a tool.Discovery for the Services or Pods of a Kubernetes
+// cluster declaring tools with opera annotations. The annotations are the labels of the
+// docker discovery, e.g. com.github.Br0ce.opera.tool.name, except that the host is the
+// DNS name of the Service or the IP of the Pod.
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/tool/discovery/label"
+)
+
+var _ tool.Discovery = (*Discovery)(nil)
+
+var (
+	errNotTool = errors.New("not a tool")
+)
+
+// Kind is the kind of the objects declaring tools.
+type Kind string
+
+const (
+	// Services declare tools reached at <name>.<namespace>.svc, resolvable within the
+	// cluster only.
+	Services Kind = "services"
+	// Pods declare tools reached at the IP of the pod while it is running.
+	Pods Kind = "pods"
+)
+
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+type Transporter interface {
+	Get(ctx context.Context, addr string, header map[string][]string) ([]byte, error)
+}
+
+// Discovery holds a tool for every annotated object of its kind. The objects are listed
+// on refresh and kept up to date in between with a watch stream.
+type Discovery struct {
+	db         db.Tool
+	transport  Transporter
+	client     *client
+	kind       Kind
+	namespace  string
+	kubeconfig string
+	mu         sync.RWMutex
+	// refreshing serializes changes of the entries, by refreshes and watch events.
+	refreshing sync.Mutex
+	entries    map[string]entry
+	stop       context.CancelFunc
+	done       chan struct{}
+	tr         trace.Tracer
+	log        *slog.Logger
+}
+
+// entry is the tool of an object and the address and annotations it was made from, to
+// make it again only if they changed.
+type entry struct {
+	addr        url.URL
+	annotations map[string]string
+	tool        tool.Tool
+}
+
+type Option func(*Discovery)
+
+// WithKind sets the kind of the objects declaring tools, Services by default.
+func WithKind(kind Kind) Option {
+	return func(di *Discovery) {
+		di.kind = kind
+	}
+}
+
+// WithNamespace limits the discovery to the objects of the namespace. By default the
+// objects of all namespaces are discovered.
+func WithNamespace(namespace string) Option {
+	return func(di *Discovery) {
+		di.namespace = namespace
+	}
+}
+
+// WithKubeconfig authenticates with the current context of the kubeconfig at path. By
+// default the service account is used in a cluster, and $KUBECONFIG or ~/.kube/config
+// outside of it.
+func WithKubeconfig(path string) Option {
+	return func(di *Discovery) {
+		di.kubeconfig = path
+	}
+}
+
+// NewDiscovery returns a pointer to a refreshed Discovery watching the objects. The
+// Discovery must be closed to stop watching.
+func NewDiscovery(ctx context.Context, db db.Tool, transport Transporter, log *slog.Logger, opts ...Option) (*Discovery, error) {
+	di := &Discovery{
+		db:        db,
+		transport: transport,
+		kind:      Services,
+		entries:   make(map[string]entry),
+		done:      make(chan struct{}),
+		tr:        monitor.Tracer("KubernetesDiscovery"),
+		log:       log,
+	}
+	for _, opt := range opts {
+		opt(di)
+	}
+	if di.kind != Services && di.kind != Pods {
+		return nil, fmt.Errorf("kind %s not supported", di.kind)
+	}
+	cfg, err := credentials(di.kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("credentials: %w", err)
+	}
+	di.client = newClient(cfg)
+
+	version, err := di.refresh(ctx)
+	if version == "" {
+		return nil, fmt.Errorf("refresh: %w", err)
+	}
+	if err != nil {
+		log.Warn("refresh", "method", "NewDiscovery", "error", err.Error())
+	}
+
+	wctx, stop := context.WithCancel(context.Background())
+	di.stop = stop
+	go di.watch(wctx, version)
+	return di, nil
+}
+
+// Get returns the Tool for the given name from the database.
+func (di *Discovery) Get(ctx context.Context, name string) (tool.Tool, error) {
+	_, span := di.tr.Start(ctx, "get tool")
+	defer span.End()
+	di.log.Debug("get tool", "method", "Get", "name", name, "traceID", monitor.TraceID(span))
+
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+
+	to, err := di.db.Get(name)
+	if err != nil {
+		return tool.Tool{}, fmt.Errorf("get tool %s: %w", name, err)
+	}
+	return to, nil
+}
+
+// All returns all Tools from the database.
+func (di *Discovery) All(ctx context.Context) []tool.Tool {
+	_, span := di.tr.Start(ctx, "get all tools")
+	defer span.End()
+	di.log.Debug("get all tools", "method", "All", "traceID", monitor.TraceID(span))
+
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+
+	return slices.Collect(di.db.All())
+}
+
+// Refresh lists the objects, fetches the configs of their tools and replaces the tools in
+// the database. Objects whose tool cannot be made are skipped and reported in the error.
+func (di *Discovery) Refresh(ctx context.Context) error {
+	_, err := di.refresh(ctx)
+	return err
+}
+
+// Close stops watching the objects.
+func (di *Discovery) Close() {
+	di.stop()
+	<-di.done
+}
+
+// refresh is Refresh, returning the resource version of the list to watch from. The
+// version is empty if the objects could not be listed.
+func (di *Discovery) refresh(ctx context.Context) (string, error) {
+	ctx, span := di.tr.Start(ctx, "refresh all tools")
+	defer span.End()
+	di.log.Debug("refresh all tools", "method", "Refresh", "kind", di.kind, "traceID", monitor.TraceID(span))
+
+	di.refreshing.Lock()
+	defer di.refreshing.Unlock()
+
+	objects, version, err := di.client.list(ctx, di.path())
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return "", fmt.Errorf("list %s: %w", di.kind, err)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]entry, len(objects))
+	errs := make([]error, len(objects))
+	for i, obj := range objects {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = di.toEntry(ctx, obj)
+		}()
+	}
+	wg.Wait()
+
+	entries := make(map[string]entry, len(objects))
+	var makeErr error
+	for i, obj := range objects {
+		switch {
+		case errors.Is(errs[i], errNotTool):
+		case errs[i] != nil:
+			makeErr = errors.Join(makeErr, fmt.Errorf("create tool from %s: %w", obj.key(), errs[i]))
+		default:
+			entries[obj.key()] = results[i]
+		}
+	}
+	di.entries = entries
+
+	err = errors.Join(makeErr, di.update(span))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return version, err
+}
+
+// watch applies the events of the objects since the resource version until ctx is done.
+// The stream is opened again when it ends, and the objects are listed again when the
+// version expired.
+func (di *Discovery) watch(ctx context.Context, version string) {
+	defer close(di.done)
+	backoff := minBackoff
+	for {
+		err := di.client.watch(ctx, di.path(), version, func(ev event) error {
+			var obj object
+			err := json.Unmarshal(ev.Object, &obj)
+			if err != nil {
+				return fmt.Errorf("decode object: %w", err)
+			}
+			version = obj.Metadata.ResourceVersion
+			backoff = minBackoff
+			if ev.Type != eventBookmark {
+				di.apply(ctx, ev.Type, obj)
+			}
+			return nil
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			continue
+		}
+		if isGone(err) {
+			di.log.Info("list again", "method", "watch", "reason", err.Error())
+			relisted, err := di.refresh(ctx)
+			if err != nil {
+				di.log.Warn("refresh", "method", "watch", "error", err.Error())
+			}
+			if relisted != "" {
+				version = relisted
+				continue
+			}
+		} else {
+			di.log.Warn("watch", "method", "watch", "kind", di.kind, "error", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// apply updates the tool of the object of the event and the database.
+func (di *Discovery) apply(ctx context.Context, eventType string, obj object) {
+	ctx, span := di.tr.Start(ctx, "apply watch event")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("k8s.event", eventType),
+		attribute.String("k8s.object", obj.key()))
+	di.log.Debug("apply watch event",
+		"method", "apply",
+		"event", eventType,
+		"object", obj.key(),
+		"traceID", monitor.TraceID(span))
+
+	di.refreshing.Lock()
+	defer di.refreshing.Unlock()
+
+	key := obj.key()
+	old, known := di.entries[key]
+	switch eventType {
+	case eventAdded, eventModified:
+		addr, err := di.addr(obj)
+		if err == nil && known && addr == old.addr && maps.Equal(obj.Metadata.Annotations, old.annotations) {
+			return
+		}
+		e, err := di.toEntry(ctx, obj)
+		if err != nil {
+			if !errors.Is(err, errNotTool) {
+				span.SetStatus(codes.Error, err.Error())
+				di.log.Warn("skip tool",
+					"method", "apply",
+					"object", key,
+					"error", err.Error(),
+					"traceID", monitor.TraceID(span))
+			}
+			if !known {
+				return
+			}
+			delete(di.entries, key)
+		} else {
+			di.entries[key] = e
+		}
+	case eventDeleted:
+		if !known {
+			return
+		}
+		delete(di.entries, key)
+	default:
+		return
+	}
+
+	err := di.update(span)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		di.log.Error("update tools", "method", "apply", "error", err.Error(), "traceID", monitor.TraceID(span))
+	}
+}
+
+// update replaces the tools in the database with the tools of the entries, in the order
+// of their keys. Tools with the name of a tool of an earlier object are skipped.
+func (di *Discovery) update(span trace.Span) error {
+	di.mu.Lock()
+	defer di.mu.Unlock()
+
+	var tools []tool.Tool
+	names := make(map[string]string)
+	for _, key := range slices.Sorted(maps.Keys(di.entries)) {
+		to := di.entries[key].tool
+		if other, ok := names[to.Name()]; ok {
+			di.log.Warn("skip tool",
+				"method", "update",
+				"object", key,
+				"tool", to.Name(),
+				"error", fmt.Sprintf("tool declared by %s already", other),
+				"traceID", monitor.TraceID(span))
+			continue
+		}
+		names[to.Name()] = key
+		tools = append(tools, to)
+	}
+	span.SetAttributes(attribute.Int("tool.count", len(tools)))
+
+	di.db.Clear()
+	var addErr error
+	for _, to := range tools {
+		addErr = errors.Join(addErr, di.db.Add(to))
+	}
+	if addErr != nil {
+		return fmt.Errorf("add tools: %w", addErr)
+	}
+	return nil
+}
+
+// toEntry returns the entry for the given object. If the object is not a tool an
+// errNotTool is returned.
+func (di *Discovery) toEntry(ctx context.Context, obj object) (entry, error) {
+	addr, err := di.addr(obj)
+	if err != nil {
+		return entry{}, err
+	}
+
+	cfg, err := di.config(ctx, addr)
+	if err != nil {
+		return entry{}, fmt.Errorf("get config: %w", err)
+	}
+	opts, err := label.Options(obj.Metadata.Annotations)
+	if err != nil {
+		return entry{}, err
+	}
+	to, err := tool.MakeTool(append([]tool.Option{
+		tool.WithName(obj.Metadata.Annotations[label.Name]),
+		tool.WithAddr(addr),
+		tool.WithDescription(cfg.Description),
+		tool.WithParameters(cfg.Properties, cfg.Required),
+	}, opts...)...)
+	if err != nil {
+		return entry{}, fmt.Errorf("make tool: %w", err)
+	}
+	return entry{addr: addr, annotations: obj.Metadata.Annotations, tool: to}, nil
+}
+
+// addr returns the address of the tool of the object. If the object is not a tool, or a
+// pod which is not running, an errNotTool is returned.
+func (di *Discovery) addr(obj object) (url.URL, error) {
+	ann := obj.Metadata.Annotations
+	_, okName := ann[label.Name]
+	port, okPort := ann[label.Port]
+	path, okPath := ann[label.Path]
+	if !(okName && okPort && okPath) {
+		return url.URL{}, errNotTool
+	}
+
+	host := fmt.Sprintf("%s.%s.svc", obj.Metadata.Name, obj.Metadata.Namespace)
+	if di.kind == Pods {
+		if obj.Status.Phase != "Running" || obj.Status.PodIP == "" || obj.Metadata.DeletionTimestamp != "" {
+			return url.URL{}, errNotTool
+		}
+		host = obj.Status.PodIP
+	}
+	return url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(host, port),
+		Path:   path,
+	}, nil
+}
+
+// config performs a get request to the config endpoint of the given addr and returns the response as a config.
+func (di *Discovery) config(ctx context.Context, addr url.URL) (config, error) {
+	ctx, span := di.tr.Start(ctx, "get config")
+	defer span.End()
+	di.log.Debug("get tool config", "method", "config", "addr", addr.String(), "traceID", monitor.TraceID(span))
+
+	url := addr.JoinPath("config")
+	bb, err := di.transport.Get(ctx, url.String(), nil)
+	if err != nil {
+		return config{}, fmt.Errorf("get request: %w", err)
+	}
+	var cfg config
+	err = json.Unmarshal(bb, &cfg)
+	if err != nil {
+		return config{}, fmt.Errorf("unmarshal config: %w", err)
+	}
+	return cfg, nil
+}
+
+// path returns the API path of the objects.
+func (di *Discovery) path() string {
+	if di.namespace == "" {
+		return "/api/v1/" + string(di.kind)
+	}
+	return fmt.Sprintf("/api/v1/namespaces/%s/%s", url.PathEscape(di.namespace), di.kind)
+}
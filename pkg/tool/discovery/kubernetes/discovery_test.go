@@ -0,0 +1,516 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/db/inmem"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool/discovery/label"
+	mockTransport "github.com/Br0ce/opera/pkg/transport/mock"
+)
+
+const testToken = "secret"
+
+// fakeAPI is a Kubernetes API server serving the objects at path one per page, and
+// streaming the events sent to it to watch requests.
+type fakeAPI struct {
+	path      string
+	mu        sync.Mutex
+	objects   []object
+	version   string
+	watches   []string
+	events    chan string
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newFakeAPI(t *testing.T, path string, version string, objects ...object) (*fakeAPI, *httptest.Server) {
+	t.Helper()
+
+	api := &fakeAPI{
+		path:    path,
+		objects: objects,
+		version: version,
+		events:  make(chan string),
+		closed:  make(chan struct{}),
+	}
+	ts := httptest.NewTLSServer(api)
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { api.closeOnce.Do(func() { close(api.closed) }) })
+	return api, ts
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"kind":"Status","code":401,"message":"Unauthorized"}`))
+		return
+	}
+	if r.URL.Path != f.path {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"kind":"Status","code":404,"message":"not found"}`))
+		return
+	}
+
+	if r.URL.Query().Get("watch") == "true" {
+		f.mu.Lock()
+		f.watches = append(f.watches, r.URL.Query().Get("resourceVersion"))
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-f.closed:
+				return
+			case ev := <-f.events:
+				_, _ = fmt.Fprintln(w, ev)
+				w.(http.Flusher).Flush()
+			}
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var list objectList
+	list.Metadata.ResourceVersion = f.version
+	page, _ := strconv.Atoi(r.URL.Query().Get("continue"))
+	if page < len(f.objects) {
+		list.Items = []object{f.objects[page]}
+	}
+	if page+1 < len(f.objects) {
+		list.Metadata.Continue = strconv.Itoa(page + 1)
+	}
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// set replaces the listed objects.
+func (f *fakeAPI) set(version string, objects ...object) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.version = version
+	f.objects = objects
+}
+
+// watched returns the resource versions of the watch requests.
+func (f *fakeAPI) watched() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.watches)
+}
+
+// send streams an event of type with the object to the watch request.
+func (f *fakeAPI) send(t *testing.T, eventType string, obj any) {
+	t.Helper()
+
+	bb, err := json.Marshal(map[string]any{"type": eventType, "object": obj})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case f.events <- string(bb):
+	case <-time.After(2 * time.Second):
+		t.Fatalf("send %s event: no watch request", eventType)
+	}
+}
+
+func makeObject(namespace string, name string, version string, annotations map[string]string) object {
+	var obj object
+	obj.Metadata.Namespace = namespace
+	obj.Metadata.Name = name
+	obj.Metadata.ResourceVersion = version
+	obj.Metadata.Annotations = annotations
+	return obj
+}
+
+func makePod(namespace string, name string, phase string, ip string, annotations map[string]string) object {
+	obj := makeObject(namespace, name, "1", annotations)
+	obj.Status.Phase = phase
+	obj.Status.PodIP = ip
+	return obj
+}
+
+func annotations(name string, extra ...string) map[string]string {
+	ann := map[string]string{
+		label.Name: name,
+		label.Port: "8080",
+		label.Path: "/" + name,
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		ann[extra[i]] = extra[i+1]
+	}
+	return ann
+}
+
+// newTransport returns a transport serving the config of every tool, described by its
+// address.
+func newTransport() *mockTransport.Transporter {
+	return &mockTransport.Transporter{
+		GetFn: func(_ context.Context, addr string, _ map[string][]string) ([]byte, error) {
+			return json.Marshal(config{
+				Description: "Tool at " + strings.TrimSuffix(addr, "/config"),
+				Properties:  map[string]any{"q": map[string]any{"type": "string"}},
+				Required:    []string{"q"},
+			})
+		},
+	}
+}
+
+// writeKubeconfig writes a kubeconfig for the server authenticating with token and
+// returns its path.
+func writeKubeconfig(t *testing.T, ts *httptest.Server, token string) string {
+	t.Helper()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	kc := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: test
+contexts:
+- name: test
+  context:
+    cluster: fake
+    user: opera
+clusters:
+- name: fake
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+users:
+- name: opera
+  user:
+    token: %s
+`, ts.URL, base64.StdEncoding.EncodeToString(ca), token)
+	path := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(path, []byte(kc), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDiscovery_Watch(t *testing.T) {
+	t.Parallel()
+
+	api, ts := newFakeAPI(t, "/api/v1/namespaces/default/services", "10",
+		makeObject("default", "weather", "8", annotations("weather")),
+		makeObject("default", "plain", "9", nil),
+	)
+	di, err := NewDiscovery(context.TODO(), inmem.NewToolDB(), newTransport(), monitor.NewTestLogger(false),
+		WithKubeconfig(writeKubeconfig(t, ts, testToken)),
+		WithNamespace("default"))
+	if err != nil {
+		t.Fatalf("NewDiscovery() error = %v", err)
+	}
+	t.Cleanup(di.Close)
+
+	got := di.All(context.TODO())
+	if len(got) != 1 {
+		t.Fatalf("All() = %v, want tool weather", got)
+	}
+	wantAddr := url.URL{Scheme: "http", Host: "weather.default.svc:8080", Path: "/weather"}
+	if got[0].Name() != "weather" || got[0].Addr() != wantAddr || got[0].Description() != "Tool at "+wantAddr.String() {
+		t.Errorf("All() = %v, want tool weather at %s", got, wantAddr.String())
+	}
+
+	api.send(t, eventAdded, makeObject("default", "news", "11", annotations("news")))
+	waitFor(t, func() bool {
+		_, err := di.Get(context.TODO(), "news")
+		return err == nil
+	})
+	if watched := api.watched(); len(watched) != 1 || watched[0] != "10" {
+		t.Errorf("watch resource versions = %v, want [10]", watched)
+	}
+
+	api.send(t, eventModified, makeObject("default", "news", "12", annotations("news", label.Approval, "true")))
+	waitFor(t, func() bool {
+		to, err := di.Get(context.TODO(), "news")
+		return err == nil && to.Approval()
+	})
+
+	api.send(t, eventDeleted, makeObject("default", "weather", "13", annotations("weather")))
+	waitFor(t, func() bool {
+		_, err := di.Get(context.TODO(), "weather")
+		return err != nil
+	})
+
+	api.send(t, eventBookmark, makeObject("", "", "14", nil))
+	api.set("20", makeObject("default", "traffic", "19", annotations("traffic")))
+	api.send(t, eventError, status{Code: http.StatusGone, Reason: "Expired", Message: "too old resource version"})
+	waitFor(t, func() bool {
+		tools := di.All(context.TODO())
+		return len(tools) == 1 && tools[0].Name() == "traffic"
+	})
+	waitFor(t, func() bool {
+		watched := api.watched()
+		return slices.Equal(watched, []string{"10", "20"})
+	})
+}
+
+func TestDiscovery_Pods(t *testing.T) {
+	t.Parallel()
+
+	_, ts := newFakeAPI(t, "/api/v1/pods", "5",
+		makePod("a", "search-1", "Running", "10.0.0.7", annotations("search", label.Idempotent, "true")),
+		makePod("b", "search-2", "Pending", "", annotations("other")),
+		makePod("b", "broken", "Running", "10.0.0.8", annotations("broken", label.RateLimit, "fast")),
+		makePod("c", "search-3", "Running", "10.0.0.9", annotations("search")),
+	)
+	di, err := NewDiscovery(context.TODO(), inmem.NewToolDB(), newTransport(), monitor.NewTestLogger(false),
+		WithKubeconfig(writeKubeconfig(t, ts, testToken)),
+		WithKind(Pods))
+	if err != nil {
+		t.Fatalf("NewDiscovery() error = %v", err)
+	}
+	t.Cleanup(di.Close)
+
+	got := di.All(context.TODO())
+	wantAddr := url.URL{Scheme: "http", Host: "10.0.0.7:8080", Path: "/search"}
+	if len(got) != 1 || got[0].Name() != "search" || got[0].Addr() != wantAddr || !got[0].Idempotent() {
+		t.Errorf("All() = %v, want idempotent tool search at %s", got, wantAddr.String())
+	}
+
+	err = di.Refresh(context.TODO())
+	if err == nil || !strings.Contains(err.Error(), "b/broken") {
+		t.Errorf("Refresh() error = %v, want error of b/broken", err)
+	}
+}
+
+func TestNewDiscovery_Invalid(t *testing.T) {
+	t.Parallel()
+
+	_, ts := newFakeAPI(t, "/api/v1/services", "1")
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{
+			name: "kind",
+			opts: []Option{WithKind("nodes"), WithKubeconfig(writeKubeconfig(t, ts, testToken))},
+			want: "kind nodes not supported",
+		},
+		{
+			name: "kubeconfig missing",
+			opts: []Option{WithKubeconfig(filepath.Join(t.TempDir(), "missing"))},
+			want: "read kubeconfig",
+		},
+		{
+			name: "unauthorized",
+			opts: []Option{WithKubeconfig(writeKubeconfig(t, ts, "wrong"))},
+			want: "401 Unauthorized",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewDiscovery(context.TODO(), inmem.NewToolDB(), newTransport(), monitor.NewTestLogger(false), tt.opts...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewDiscovery() error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadKubeconfig(t *testing.T) {
+	t.Parallel()
+
+	certPEM, keyPEM := clientCert(t)
+	dir := t.TempDir()
+	err := errors.Join(
+		os.WriteFile(filepath.Join(dir, "token"), []byte("file-token\n"), 0o600),
+		os.WriteFile(filepath.Join(dir, "client.crt"), certPEM, 0o600),
+		os.WriteFile(filepath.Join(dir, "client.key"), keyPEM, 0o600),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeconfig := func(user string) string {
+		return `current-context: test
+contexts:
+- name: test
+  context: {cluster: fake, user: opera}
+clusters:
+- name: fake
+  cluster: {server: "https://k8s.example:6443/", insecure-skip-tls-verify: true}
+users:
+- name: opera
+  user: ` + user
+	}
+
+	tests := []struct {
+		name      string
+		config    string
+		want      restConfig
+		wantCerts int
+		wantErr   bool
+	}{
+		{
+			name:   "token",
+			config: kubeconfig(`{token: secret}`),
+			want:   restConfig{server: "https://k8s.example:6443", token: "secret"},
+		},
+		{
+			name:   "token file",
+			config: kubeconfig(`{tokenFile: token}`),
+			want:   restConfig{server: "https://k8s.example:6443", tokenFile: filepath.Join(dir, "token")},
+		},
+		{
+			name:      "client certificate files",
+			config:    kubeconfig(`{client-certificate: client.crt, client-key: client.key}`),
+			want:      restConfig{server: "https://k8s.example:6443"},
+			wantCerts: 1,
+		},
+		{
+			name: "client certificate data",
+			config: kubeconfig(fmt.Sprintf(`{client-certificate-data: %s, client-key-data: %s}`,
+				base64.StdEncoding.EncodeToString(certPEM), base64.StdEncoding.EncodeToString(keyPEM))),
+			want:      restConfig{server: "https://k8s.example:6443"},
+			wantCerts: 1,
+		},
+		{
+			name:    "client key missing",
+			config:  kubeconfig(`{client-certificate: client.crt}`),
+			wantErr: true,
+		},
+		{
+			name:    "exec",
+			config:  kubeconfig(`{exec: {command: aws}}`),
+			wantErr: true,
+		},
+		{
+			name:    "context missing",
+			config:  strings.Replace(kubeconfig(`{token: secret}`), "current-context: test", "current-context: prod", 1),
+			wantErr: true,
+		},
+		{
+			name:    "cluster missing",
+			config:  strings.Replace(kubeconfig(`{token: secret}`), "cluster: fake", "cluster: prod", 1),
+			wantErr: true,
+		},
+		{
+			name:    "certificate authority invalid",
+			config:  strings.Replace(kubeconfig(`{token: secret}`), "insecure-skip-tls-verify: true", "certificate-authority-data: bm8gY2VydA==", 1),
+			wantErr: true,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(dir, fmt.Sprintf("config-%d", i))
+			err := os.WriteFile(path, []byte(tt.config), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := readKubeconfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readKubeconfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.server != tt.want.server || got.token != tt.want.token || got.tokenFile != tt.want.tokenFile {
+				t.Errorf("readKubeconfig() = %+v, want %+v", got, tt.want)
+			}
+			if !got.tls.InsecureSkipVerify || len(got.tls.Certificates) != tt.wantCerts {
+				t.Errorf("readKubeconfig() tls = %+v, want insecure with %d certificates", got.tls, tt.wantCerts)
+			}
+		})
+	}
+}
+
+func TestInCluster(t *testing.T) {
+	t.Parallel()
+
+	certPEM, _ := clientCert(t)
+	dir := t.TempDir()
+	_, err := inCluster(dir, "10.96.0.1", "443")
+	if err == nil {
+		t.Errorf("inCluster() without token error = nil")
+	}
+
+	err = errors.Join(
+		os.WriteFile(filepath.Join(dir, "token"), []byte("sa-token"), 0o600),
+		os.WriteFile(filepath.Join(dir, "ca.crt"), certPEM, 0o600),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := inCluster(dir, "10.96.0.1", "443")
+	if err != nil {
+		t.Fatalf("inCluster() error = %v", err)
+	}
+	if got.server != "https://10.96.0.1:443" || got.tokenFile != filepath.Join(dir, "token") || got.tls.RootCAs == nil {
+		t.Errorf("inCluster() = %+v", got)
+	}
+	token, err := newClient(got).token()
+	if err != nil || token != "sa-token" {
+		t.Errorf("client.token() = %s, %v, want sa-token", token, err)
+	}
+}
+
+// clientCert returns a self-signed certificate and its key, PEM encoded.
+func clientCert(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "opera"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.After(2 * time.Second)
+	for !cond() {
+		select {
+		case <-deadline:
+			t.Fatal("condition not met in time")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
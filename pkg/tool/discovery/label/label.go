@@ -0,0 +1,232 @@
+// Package label parses the opera labels declaring a tool, e.g. the labels of a docker
+// container or the annotations of a Kubernetes object.
+package label
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+const (
+	Name = "com.github.Br0ce.opera.tool.name"
+	Port = "com.github.Br0ce.opera.tool.port"
+	Path = "com.github.Br0ce.opera.tool.path"
+	// Approval is an optional label. If set to true, every call to the tool must be
+	// approved by a human.
+	Approval = "com.github.Br0ce.opera.tool.approval"
+	// Idempotent is an optional label. If set to true, the tool is called again when an
+	// interrupted query is resumed.
+	Idempotent = "com.github.Br0ce.opera.tool.idempotent"
+	// ReadOnly is an optional label. If set to true, the tool is declared not to modify
+	// its environment and its results are cached.
+	ReadOnly = "com.github.Br0ce.opera.tool.readonly"
+	// CacheTTL is an optional label with the duration for which results of the tool are
+	// cached, e.g. "5m". Results of tools which are not read-only are only cached if set.
+	CacheTTL = "com.github.Br0ce.opera.tool.cache.ttl"
+	// NoCache is an optional label. If set to true, results of the tool are never cached.
+	NoCache = "com.github.Br0ce.opera.tool.cache.disabled"
+	// RateLimit is an optional label with the number of calls per second the tool
+	// accepts, e.g. "2.5".
+	RateLimit = "com.github.Br0ce.opera.tool.rate.limit"
+	// RateBurst is an optional label with the number of calls the tool accepts at once
+	// within its rate limit.
+	RateBurst = "com.github.Br0ce.opera.tool.rate.burst"
+	// Timeout is an optional label with the time limit of each attempt to call the tool,
+	// e.g. "10s".
+	Timeout = "com.github.Br0ce.opera.tool.timeout"
+	// MaxRetries is an optional label with the number of retries of failed calls.
+	MaxRetries = "com.github.Br0ce.opera.tool.retry.max"
+	// RetryBackoff is an optional label with the delay before the first retry, e.g. "1s".
+	// The delay doubles with every further retry.
+	RetryBackoff = "com.github.Br0ce.opera.tool.retry.backoff"
+	// RetryCodes is an optional label with the comma separated status codes to retry,
+	// e.g. "429,503".
+	RetryCodes = "com.github.Br0ce.opera.tool.retry.codes"
+	// RequestMethod is an optional label with the HTTP method of calls, POST by default.
+	RequestMethod = "com.github.Br0ce.opera.tool.request.method"
+	// RequestPath is an optional label with a path template appended to the path of the
+	// tool, e.g. "/users/{id}".
+	RequestPath = "com.github.Br0ce.opera.tool.request.path"
+	// RequestQuery is an optional label with comma separated query parameters and the
+	// arguments they are set from, e.g. "q=query,page=page".
+	RequestQuery = "com.github.Br0ce.opera.tool.request.query"
+	// RequestHeader is an optional label with comma separated headers and the arguments
+	// they are set from, e.g. "X-Tenant=tenant".
+	RequestHeader = "com.github.Br0ce.opera.tool.request.header"
+	// RequestBody is an optional label with the argument sent as body.
+	RequestBody = "com.github.Br0ce.opera.tool.request.body"
+)
+
+// Options returns the tool options set by the optional labels.
+func Options(labels map[string]string) ([]tool.Option, error) {
+	approval, err := boolLabel(labels, Approval)
+	if err != nil {
+		return nil, err
+	}
+	idempotent, err := boolLabel(labels, Idempotent)
+	if err != nil {
+		return nil, err
+	}
+	readOnly, err := boolLabel(labels, ReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	cacheTTL, err := durationLabel(labels, CacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	noCache, err := boolLabel(labels, NoCache)
+	if err != nil {
+		return nil, err
+	}
+	rateLimit, err := floatLabel(labels, RateLimit)
+	if err != nil {
+		return nil, err
+	}
+	rateBurst, err := intLabel(labels, RateBurst)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := durationLabel(labels, Timeout)
+	if err != nil {
+		return nil, err
+	}
+	maxRetries, err := intLabel(labels, MaxRetries)
+	if err != nil {
+		return nil, err
+	}
+	retryBackoff, err := durationLabel(labels, RetryBackoff)
+	if err != nil {
+		return nil, err
+	}
+	retryCodes, err := intsLabel(labels, RetryCodes)
+	if err != nil {
+		return nil, err
+	}
+	query, err := mapLabel(labels, RequestQuery)
+	if err != nil {
+		return nil, err
+	}
+	header, err := mapLabel(labels, RequestHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	return []tool.Option{
+		tool.WithApproval(approval),
+		tool.WithIdempotent(idempotent),
+		tool.WithReadOnly(readOnly),
+		tool.WithCacheTTL(cacheTTL),
+		tool.WithNoCache(noCache),
+		tool.WithRateLimit(rateLimit, rateBurst),
+		tool.WithTimeout(timeout),
+		tool.WithRetry(tool.RetryPolicy{
+			MaxRetries:  maxRetries,
+			Backoff:     retryBackoff,
+			StatusCodes: retryCodes,
+		}),
+		tool.WithRequest(tool.Request{
+			Method: labels[RequestMethod],
+			Path:   labels[RequestPath],
+			Query:  query,
+			Header: header,
+			Body:   labels[RequestBody],
+		}),
+	}, nil
+}
+
+// boolLabel returns the value of the optional bool label with the given key. A missing
+// label is false.
+func boolLabel(labels map[string]string, key string) (bool, error) {
+	v, ok := labels[key]
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("parse label %s: %w", key, err)
+	}
+	return b, nil
+}
+
+// durationLabel returns the value of the optional duration label with the given key. A
+// missing label is zero.
+func durationLabel(labels map[string]string, key string) (time.Duration, error) {
+	v, ok := labels[key]
+	if !ok {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("parse label %s: %w", key, err)
+	}
+	return d, nil
+}
+
+// floatLabel returns the value of the optional number label with the given key. A
+// missing label is zero.
+func floatLabel(labels map[string]string, key string) (float64, error) {
+	v, ok := labels[key]
+	if !ok {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse label %s: %w", key, err)
+	}
+	return f, nil
+}
+
+// intLabel returns the value of the optional integer label with the given key. A
+// missing label is zero.
+func intLabel(labels map[string]string, key string) (int, error) {
+	v, ok := labels[key]
+	if !ok {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("parse label %s: %w", key, err)
+	}
+	return n, nil
+}
+
+// intsLabel returns the values of the optional comma separated integer label with the
+// given key. A missing label is nil.
+func intsLabel(labels map[string]string, key string) ([]int, error) {
+	v, ok := labels[key]
+	if !ok {
+		return nil, nil
+	}
+	var nn []int
+	for _, field := range strings.Split(v, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("parse label %s: %w", key, err)
+		}
+		nn = append(nn, n)
+	}
+	return nn, nil
+}
+
+// mapLabel returns the pairs of the optional comma separated label with the given key,
+// e.g. "a=b,c=d". A missing label is nil.
+func mapLabel(labels map[string]string, key string) (map[string]string, error) {
+	v, ok := labels[key]
+	if !ok {
+		return nil, nil
+	}
+	m := make(map[string]string)
+	for _, field := range strings.Split(v, ",") {
+		k, val, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("parse label %s: pair %s invalid", key, field)
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(val)
+	}
+	return m, nil
+}
@@ -0,0 +1,98 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config declares the MCP servers whose tools are discovered.
+type Config struct {
+	Servers []Server `json:"Servers" yaml:"Servers"`
+}
+
+// Server declares an MCP server, either a Command started as subprocess and spoken to
+// over stdio or the URL of a streamable HTTP endpoint. Values of Env and Header can
+// reference environment variables, e.g. ${SEARCH_TOKEN}, so that secrets need not be
+// stored in the file.
+type Server struct {
+	// Name identifies the server in the addrs of its tools, e.g. mcp://search/web_search.
+	Name    string            `json:"Name" yaml:"Name"`
+	Command string            `json:"Command" yaml:"Command"`
+	Args    []string          `json:"Args" yaml:"Args"`
+	Env     map[string]string `json:"Env" yaml:"Env"`
+	URL     string            `json:"URL" yaml:"URL"`
+	Header  map[string]string `json:"Header" yaml:"Header"`
+}
+
+// ReadFile reads the config of the given file. Files with a .yaml or .yml extension are
+// decoded as YAML, all other files as JSON.
+func ReadFile(filename string) (Config, error) {
+	bb, err := os.ReadFile(filename)
+	if err != nil {
+		return Config{}, fmt.Errorf("read file %s: %w", filename, err)
+	}
+
+	var c Config
+	switch filepath.Ext(filename) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(bb, &c)
+	default:
+		err = json.Unmarshal(bb, &c)
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("unmarshal config: %w", err)
+	}
+	return c, nil
+}
+
+// validate checks that the servers have unique names usable as host of an addr and are
+// reached over exactly one transport.
+func validate(servers []Server) error {
+	names := make(map[string]struct{}, len(servers))
+	for i, s := range servers {
+		u := url.URL{Scheme: "mcp", Host: s.Name}
+		parsed, err := url.Parse(u.String())
+		if s.Name == "" || err != nil || parsed.Host != s.Name || parsed.Port() != "" {
+			return fmt.Errorf("server %v: name %q invalid", i, s.Name)
+		}
+		if _, ok := names[s.Name]; ok {
+			return fmt.Errorf("server %v: name %s declared already", i, s.Name)
+		}
+		names[s.Name] = struct{}{}
+		if (s.Command == "") == (s.URL == "") {
+			return fmt.Errorf("server %s: want either Command or URL", s.Name)
+		}
+		if s.URL != "" {
+			u, err := url.Parse(s.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("server %s: URL %s invalid", s.Name, s.URL)
+			}
+		}
+	}
+	return nil
+}
+
+// env returns the environment of the subprocess of the server, e.g. KEY=value.
+func (s Server) env() []string {
+	env := make([]string, 0, len(s.Env))
+	for _, k := range slices.Sorted(maps.Keys(s.Env)) {
+		env = append(env, k+"="+os.ExpandEnv(s.Env[k]))
+	}
+	return env
+}
+
+// header returns the header sent with every request to the server.
+func (s Server) header() map[string][]string {
+	header := make(map[string][]string, len(s.Header))
+	for k, v := range s.Header {
+		header[k] = []string{os.ExpandEnv(v)}
+	}
+	return header
+}
@@ -0,0 +1,373 @@
+// Package mcp provides a tool.Discovery for the tools of MCP servers. The tools are
+// called with the transport.MCPTransporter, which routes tools/call requests to the
+// servers through the clients of the Discovery.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/mcp"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/transport"
+)
+
+var (
+	_ tool.Discovery       = (*Discovery)(nil)
+	_ transport.MCPClients = (*Discovery)(nil)
+)
+
+var (
+	ErrServerNotFound     = errors.New("server not found")
+	ErrServerNotConnected = errors.New("server not connected")
+)
+
+// Discovery holds a tool for every tool of its MCP servers. The tools of a server are
+// refreshed whenever the server notifies that its list of tools changed.
+type Discovery struct {
+	db      db.Tool
+	servers []Server
+	mu      sync.RWMutex
+	// refreshing serializes refreshes, so that a server is connected only once.
+	refreshing sync.Mutex
+	sessions   map[string]*session
+	changed    chan string
+	stop       context.CancelFunc
+	done       chan struct{}
+	tr         trace.Tracer
+	log        *slog.Logger
+}
+
+// session is the connection to a server and the tools it listed last.
+type session struct {
+	client *mcp.Client
+	tools  []tool.Tool
+}
+
+// NewDiscovery returns a pointer to a refreshed Discovery connecting to the servers. The
+// Discovery must be closed to end the sessions and stop the subprocesses of the servers.
+func NewDiscovery(ctx context.Context, servers []Server, db db.Tool, log *slog.Logger) (*Discovery, error) {
+	err := validate(servers)
+	if err != nil {
+		return nil, err
+	}
+	wctx, stop := context.WithCancel(context.Background())
+	di := &Discovery{
+		db:       db,
+		servers:  servers,
+		sessions: make(map[string]*session, len(servers)),
+		changed:  make(chan string, len(servers)),
+		stop:     stop,
+		done:     make(chan struct{}),
+		tr:       monitor.Tracer("MCPDiscovery"),
+		log:      log,
+	}
+	go di.watch(wctx)
+
+	err = di.Refresh(ctx)
+	if err != nil {
+		_ = di.Close(ctx)
+		return nil, fmt.Errorf("refresh: %w", err)
+	}
+	return di, nil
+}
+
+// Get returns the Tool for the given name from the database.
+func (di *Discovery) Get(ctx context.Context, name string) (tool.Tool, error) {
+	_, span := di.tr.Start(ctx, "get tool")
+	defer span.End()
+	di.log.Debug("get tool", "method", "Get", "name", name, "traceID", monitor.TraceID(span))
+
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+
+	to, err := di.db.Get(name)
+	if err != nil {
+		return tool.Tool{}, fmt.Errorf("get tool %s: %w", name, err)
+	}
+	return to, nil
+}
+
+// All returns all Tools from the database.
+func (di *Discovery) All(ctx context.Context) []tool.Tool {
+	_, span := di.tr.Start(ctx, "get all tools")
+	defer span.End()
+	di.log.Debug("get all tools", "method", "All", "traceID", monitor.TraceID(span))
+
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+
+	return slices.Collect(di.db.All())
+}
+
+// Refresh lists the tools of all servers, connecting to servers which are not connected
+// or whose connection was lost, and replaces the tools in the database. The tools of a
+// server which cannot be reached are kept until it is back.
+func (di *Discovery) Refresh(ctx context.Context) error {
+	ctx, span := di.tr.Start(ctx, "refresh all tools")
+	defer span.End()
+	di.log.Debug("refresh all tools", "method", "Refresh", "traceID", monitor.TraceID(span))
+
+	var errs error
+	for _, s := range di.servers {
+		err := di.refreshServer(ctx, s)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("server %s: %w", s.Name, err))
+		}
+	}
+	err := errors.Join(errs, di.update(span))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// Client returns the client of the connected server with the given name.
+func (di *Discovery) Client(server string) (*mcp.Client, error) {
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+
+	if !slices.ContainsFunc(di.servers, func(s Server) bool { return s.Name == server }) {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, server)
+	}
+	sess, ok := di.sessions[server]
+	if !ok || sess.client == nil {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotConnected, server)
+	}
+	return sess.client, nil
+}
+
+// Close stops watching the servers and closes their clients.
+func (di *Discovery) Close(ctx context.Context) error {
+	di.stop()
+	<-di.done
+
+	di.mu.Lock()
+	defer di.mu.Unlock()
+
+	var errs error
+	for name, sess := range di.sessions {
+		if sess.client == nil {
+			continue
+		}
+		err := sess.client.Close(ctx)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("close server %s: %w", name, err))
+		}
+		sess.client = nil
+	}
+	return errs
+}
+
+// watch refreshes the tools of a server once it notified that they changed, until ctx
+// is done.
+func (di *Discovery) watch(ctx context.Context) {
+	defer close(di.done)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case name := <-di.changed:
+			idx := slices.IndexFunc(di.servers, func(s Server) bool { return s.Name == name })
+			if idx < 0 {
+				continue
+			}
+			ctx, span := di.tr.Start(ctx, "refresh changed tools")
+			span.SetAttributes(attribute.String("mcp.server", name))
+			err := errors.Join(di.refreshServer(ctx, di.servers[idx]), di.update(span))
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				di.log.Warn("refresh changed tools",
+					"method", "watch",
+					"server", name,
+					"error", err.Error(),
+					"traceID", monitor.TraceID(span))
+			}
+			span.End()
+		}
+	}
+}
+
+// refreshServer lists the tools of the server, connecting to it first if needed.
+func (di *Discovery) refreshServer(ctx context.Context, s Server) error {
+	di.refreshing.Lock()
+	defer di.refreshing.Unlock()
+
+	client, err := di.connect(ctx, s)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	listed, err := client.ListTools(ctx)
+	if err != nil {
+		return err
+	}
+
+	var tools []tool.Tool
+	for _, t := range listed {
+		to, err := toTool(s.Name, t)
+		if err != nil {
+			di.log.Warn("skip tool",
+				"method", "refreshServer",
+				"server", s.Name,
+				"tool", t.Name,
+				"error", err.Error())
+			continue
+		}
+		tools = append(tools, to)
+	}
+
+	di.mu.Lock()
+	defer di.mu.Unlock()
+	if sess, ok := di.sessions[s.Name]; ok && sess.client == client {
+		sess.tools = tools
+	}
+	return nil
+}
+
+// connect returns the client of the server, connecting a new one if the server is not
+// connected or the connection was lost.
+func (di *Discovery) connect(ctx context.Context, s Server) (*mcp.Client, error) {
+	di.mu.RLock()
+	var current *mcp.Client
+	if sess, ok := di.sessions[s.Name]; ok {
+		current = sess.client
+	}
+	di.mu.RUnlock()
+	if current != nil {
+		select {
+		case <-current.Done():
+			di.log.Info("reconnect server", "method", "connect", "server", s.Name, "reason", current.Err())
+		default:
+			return current, nil
+		}
+	}
+
+	notify := mcp.WithNotificationHandler(func(method string, _ json.RawMessage) {
+		if method != mcp.NotificationToolsListChanged {
+			return
+		}
+		select {
+		case di.changed <- s.Name:
+		default:
+		}
+	})
+	var client *mcp.Client
+	var err error
+	if s.URL != "" {
+		client, err = mcp.NewHTTP(ctx, s.URL, s.header(), di.log, notify)
+	} else {
+		client, err = mcp.NewStdio(ctx, s.Command, s.Args, s.env(), di.log, notify)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	di.mu.Lock()
+	defer di.mu.Unlock()
+	old := di.sessions[s.Name]
+	if old != nil && old.client != nil {
+		_ = old.client.Close(ctx)
+	}
+	if old == nil {
+		old = &session{}
+		di.sessions[s.Name] = old
+	}
+	old.client = client
+	return client, nil
+}
+
+// update replaces the tools in the database with the tools of all servers, in the order
+// of the servers. Tools with the name of a tool of an earlier server are skipped.
+func (di *Discovery) update(span trace.Span) error {
+	di.mu.Lock()
+	defer di.mu.Unlock()
+
+	var tools []tool.Tool
+	names := make(map[string]string)
+	for _, s := range di.servers {
+		sess, ok := di.sessions[s.Name]
+		if !ok {
+			continue
+		}
+		for _, to := range sess.tools {
+			if other, ok := names[to.Name()]; ok {
+				di.log.Warn("skip tool",
+					"method", "update",
+					"server", s.Name,
+					"tool", to.Name(),
+					"error", fmt.Sprintf("tool declared by server %s already", other),
+					"traceID", monitor.TraceID(span))
+				continue
+			}
+			names[to.Name()] = s.Name
+			tools = append(tools, to)
+		}
+	}
+	span.SetAttributes(attribute.Int("tool.count", len(tools)))
+
+	di.db.Clear()
+	var addErr error
+	for _, to := range tools {
+		addErr = errors.Join(addErr, di.db.Add(to))
+	}
+	if addErr != nil {
+		return fmt.Errorf("add tools: %w", addErr)
+	}
+	return nil
+}
+
+// toTool returns the tool for a tool of the server. The arguments of a call are sent
+// as they are, as arguments of tools/call. Tools hinting that they are read-only are
+// read-only and cacheable, and tools hinting that they are idempotent may be retried.
+func toTool(server string, t mcp.Tool) (tool.Tool, error) {
+	properties := map[string]any{}
+	if p, ok := t.InputSchema["properties"].(map[string]any); ok {
+		properties = p
+	}
+	var required []string
+	if rr, ok := t.InputSchema["required"].([]any); ok {
+		for _, r := range rr {
+			name, ok := r.(string)
+			if !ok {
+				return tool.Tool{}, fmt.Errorf("inputSchema.required invalid")
+			}
+			required = append(required, name)
+		}
+	}
+
+	description := t.Description
+	if description == "" {
+		description = t.Title
+	}
+	if description == "" {
+		description = t.Name
+	}
+
+	var readOnly, idempotent bool
+	if a := t.Annotations; a != nil {
+		readOnly = a.ReadOnlyHint != nil && *a.ReadOnlyHint
+		idempotent = readOnly || (a.IdempotentHint != nil && *a.IdempotentHint)
+	}
+
+	return tool.MakeTool(
+		tool.WithName(t.Name),
+		tool.WithDescription(description),
+		tool.WithAddr(transport.MCPAddr(server, t.Name)),
+		tool.WithParameters(properties, required),
+		tool.WithNoCache(!readOnly),
+		tool.WithReadOnly(readOnly),
+		tool.WithIdempotent(idempotent),
+	)
+}
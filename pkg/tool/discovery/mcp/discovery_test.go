@@ -0,0 +1,311 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/db/inmem"
+	"github.com/Br0ce/opera/pkg/mcp"
+	"github.com/Br0ce/opera/pkg/mcp/mock"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/transport"
+)
+
+// standInEnv makes the test binary serve the stdio stand-in server.
+const standInEnv = "OPERA_MCP_STAND_IN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(standInEnv) == "1" {
+		srv := mock.NewServer(
+			mcp.Tool{Name: "weather", Title: "Weather", InputSchema: map[string]any{"type": "object"}},
+			mcp.Tool{Name: "search", Description: "Search the files.", InputSchema: map[string]any{"type": "object"}},
+		)
+		err := srv.ServeStdio(os.Stdin, os.Stdout)
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func webTools() []mcp.Tool {
+	return []mcp.Tool{
+		{
+			Name:        "search",
+			Description: "Search the web.",
+			InputSchema: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"q": map[string]any{"type": "string"}},
+				"required":   []any{"q"},
+			},
+			Annotations: &mcp.Annotations{ReadOnlyHint: ptr(true)},
+		},
+		{
+			Name:        "bookmark",
+			Description: "Bookmark a page.",
+			InputSchema: map[string]any{"type": "object"},
+			Annotations: &mcp.Annotations{IdempotentHint: ptr(true)},
+		},
+		{Name: "invalid", Description: "Required argument undeclared.", InputSchema: map[string]any{"type": "object", "required": []any{"q"}}},
+	}
+}
+
+// webServer returns a stand-in server reached over streamable HTTP.
+func webServer(t *testing.T) (*mock.Server, Server) {
+	t.Helper()
+
+	srv := mock.NewServer(webTools()...)
+	hs := httptest.NewServer(srv)
+	t.Cleanup(hs.Close)
+	return srv, Server{Name: "web", URL: hs.URL + "/mcp", Header: map[string]string{"Authorization": "Bearer ${WEB_TOKEN}"}}
+}
+
+// filesServer returns a stand-in server started as subprocess.
+func filesServer() Server {
+	return Server{Name: "files", Command: os.Args[0], Env: map[string]string{standInEnv: "1"}}
+}
+
+func newDiscovery(t *testing.T, servers ...Server) *Discovery {
+	t.Helper()
+
+	di, err := NewDiscovery(context.TODO(), servers, inmem.NewToolDB(), monitor.NewTestLogger(false))
+	if err != nil {
+		t.Fatalf("NewDiscovery() error = %v", err)
+	}
+	t.Cleanup(func() { _ = di.Close(context.TODO()) })
+	return di
+}
+
+func names(tools []tool.Tool) []string {
+	var nn []string
+	for _, to := range tools {
+		nn = append(nn, to.Name())
+	}
+	slices.Sort(nn)
+	return nn
+}
+
+func TestDiscovery(t *testing.T) {
+	t.Parallel()
+
+	_, web := webServer(t)
+	di := newDiscovery(t, web, filesServer())
+
+	got := names(di.All(context.TODO()))
+	want := []string{"bookmark", "search", "weather"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Discovery.All() = %v, want %v", got, want)
+	}
+
+	search, err := di.Get(context.TODO(), "search")
+	if err != nil {
+		t.Fatalf("Discovery.Get() error = %v", err)
+	}
+	addr := search.Addr()
+	if addr.String() != "mcp://web/search" || search.Description() != "Search the web." {
+		t.Errorf("Discovery.Get() addr = %s, description = %s", addr.String(), search.Description())
+	}
+	if !reflect.DeepEqual(search.Parameters().Required, []string{"q"}) || !search.Cacheable() || !search.Idempotent() {
+		t.Errorf("Discovery.Get() = %+v", search)
+	}
+
+	bookmark, _ := di.Get(context.TODO(), "bookmark")
+	if bookmark.Cacheable() || !bookmark.Idempotent() {
+		t.Errorf("Discovery.Get() bookmark cacheable = %v, idempotent = %v", bookmark.Cacheable(), bookmark.Idempotent())
+	}
+	weather, _ := di.Get(context.TODO(), "weather")
+	if weather.Description() != "Weather" || weather.Cacheable() || weather.Idempotent() {
+		t.Errorf("Discovery.Get() weather = %+v", weather)
+	}
+
+	_, err = di.Client("unknown")
+	if !errors.Is(err, ErrServerNotFound) {
+		t.Errorf("Discovery.Client() error = %v, want %v", err, ErrServerNotFound)
+	}
+}
+
+func TestDiscovery_ListChanged(t *testing.T) {
+	t.Parallel()
+
+	srv, web := webServer(t)
+	di := newDiscovery(t, web)
+	waitFor(t, func() bool { return srv.Streams() > 0 })
+
+	srv.SetTools(append(webTools(), mcp.Tool{Name: "fetch", Description: "Fetch a page.", InputSchema: map[string]any{"type": "object"}})...)
+	waitFor(t, func() bool { return len(di.All(context.TODO())) == 3 })
+	_, err := di.Get(context.TODO(), "fetch")
+	if err != nil {
+		t.Errorf("Discovery.Get() error = %v", err)
+	}
+}
+
+func TestDiscovery_Refresh(t *testing.T) {
+	t.Parallel()
+
+	srv, web := webServer(t)
+	di := newDiscovery(t, web)
+
+	// The session ends, the next refresh connects again.
+	srv.ExpireSessions()
+	client, err := di.Client("web")
+	if err != nil {
+		t.Fatalf("Discovery.Client() error = %v", err)
+	}
+	_, _ = client.ListTools(context.TODO())
+	srv.SetTools(webTools()[:1]...)
+
+	err = di.Refresh(context.TODO())
+	if err != nil {
+		t.Fatalf("Discovery.Refresh() error = %v", err)
+	}
+	if got := names(di.All(context.TODO())); !reflect.DeepEqual(got, []string{"search"}) {
+		t.Errorf("Discovery.All() = %v, want [search]", got)
+	}
+	reconnected, _ := di.Client("web")
+	if reconnected == client {
+		t.Error("Discovery.Client() not reconnected")
+	}
+}
+
+func TestDiscovery_Transport(t *testing.T) {
+	t.Parallel()
+
+	srv, web := webServer(t)
+	srv.CallFn = func(name string, arguments json.RawMessage) (mcp.CallToolResult, *mcp.Error) {
+		switch name {
+		case "search":
+			return mcp.CallToolResult{Content: []mcp.Content{{Type: "text", Text: "found"}, {Type: "text", Text: string(arguments)}}}, nil
+		case "bookmark":
+			return mcp.CallToolResult{Content: []mcp.Content{{Type: "text", Text: "page gone"}}, IsError: true}, nil
+		default:
+			return mcp.CallToolResult{}, &mcp.Error{Code: mcp.CodeInvalidParams, Message: "unknown tool " + name}
+		}
+	}
+	di := newDiscovery(t, web, filesServer())
+	tp := transport.NewMCP(di)
+
+	tests := []struct {
+		name    string
+		addr    string
+		want    string
+		wantErr string
+		callErr bool
+	}{
+		{name: "http", addr: "mcp://web/search", want: "found\n" + `{"q":"opera"}`},
+		{name: "stdio", addr: "mcp://files/weather", want: `weather {"q":"opera"}`},
+		{name: "tool failed", addr: "mcp://web/bookmark", wantErr: "page gone", callErr: true},
+		{name: "unknown tool", addr: "mcp://web/unknown", wantErr: "unknown tool unknown", callErr: true},
+		{name: "unknown server", addr: "mcp://news/search", wantErr: "server not found"},
+		{name: "invalid addr", addr: "http://web/search", wantErr: "invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tp.Do(context.TODO(), http.MethodPost, tt.addr, nil, strings.NewReader(`{"q":"opera"}`))
+			if tt.wantErr != "" {
+				var callErr *transport.CallError
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || errors.As(err, &callErr) != tt.callErr {
+					t.Errorf("MCPTransporter.Do() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MCPTransporter.Do() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("MCPTransporter.Do() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewDiscovery_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		servers []Server
+		wantErr string
+	}{
+		{name: "name missing", servers: []Server{{URL: "http://web/mcp"}}, wantErr: "name"},
+		{name: "name invalid", servers: []Server{{Name: "web/search", URL: "http://web/mcp"}}, wantErr: "name"},
+		{name: "name twice", servers: []Server{{Name: "web", URL: "http://web/mcp"}, {Name: "web", Command: "web"}}, wantErr: "declared already"},
+		{name: "no transport", servers: []Server{{Name: "web"}}, wantErr: "either"},
+		{name: "two transports", servers: []Server{{Name: "web", URL: "http://web/mcp", Command: "web"}}, wantErr: "either"},
+		{name: "url invalid", servers: []Server{{Name: "web", URL: "ws://web/mcp"}}, wantErr: "URL"},
+		{name: "command missing", servers: []Server{{Name: "web", Command: "/does/not/exist"}}, wantErr: "start"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewDiscovery(context.TODO(), tt.servers, inmem.NewToolDB(), monitor.NewTestLogger(false))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewDiscovery() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+
+	filename := filepath.Join(t.TempDir(), "servers.yaml")
+	err := os.WriteFile(filename, []byte(`
+Servers:
+  - Name: files
+    Command: files-server
+    Args: [--root, /data]
+    Env:
+      TOKEN: ${FILES_TOKEN}
+  - Name: web
+    URL: http://web:8080/mcp
+    Header:
+      Authorization: Bearer token
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadFile(filename)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	want := Config{Servers: []Server{
+		{Name: "files", Command: "files-server", Args: []string{"--root", "/data"}, Env: map[string]string{"TOKEN": "${FILES_TOKEN}"}},
+		{Name: "web", URL: "http://web:8080/mcp", Header: map[string]string{"Authorization": "Bearer token"}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadFile() = %+v, want %+v", got, want)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.After(2 * time.Second)
+	for !cond() {
+		select {
+		case <-deadline:
+			t.Fatal("condition not met in time")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
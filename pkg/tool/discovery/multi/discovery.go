@@ -0,0 +1,74 @@
+// Package multi provides a tool.Discovery combining the tools of several discoveries,
+// e.g. docker, OpenAPI, MCP and Kubernetes.
+package multi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+var _ tool.Discovery = (*Discovery)(nil)
+
+// Discovery offers the tools of all its discoveries. If discoveries offer tools with the
+// same name, the tool of the first of them is used and the others are hidden.
+type Discovery struct {
+	discoveries []tool.Discovery
+	log         *slog.Logger
+}
+
+// NewDiscovery returns a Discovery combining the given discoveries, in order of
+// precedence.
+func NewDiscovery(log *slog.Logger, discoveries ...tool.Discovery) *Discovery {
+	return &Discovery{
+		discoveries: discoveries,
+		log:         log,
+	}
+}
+
+// Get returns the tool for the given name of the first discovery offering it. If no
+// discovery offers the tool, a db.ErrNotFound is returned.
+func (di *Discovery) Get(ctx context.Context, name string) (tool.Tool, error) {
+	for _, d := range di.discoveries {
+		to, err := d.Get(ctx, name)
+		if errors.Is(err, db.ErrNotFound) {
+			continue
+		}
+		return to, err
+	}
+	return tool.Tool{}, fmt.Errorf("get tool %s: %w", name, db.ErrNotFound)
+}
+
+// All returns the tools of all discoveries. Tools whose name is taken by a tool of an
+// earlier discovery are skipped.
+func (di *Discovery) All(ctx context.Context) []tool.Tool {
+	var tt []tool.Tool
+	names := make(map[string]bool)
+	for _, d := range di.discoveries {
+		for _, t := range d.All(ctx) {
+			if names[t.Name()] {
+				di.log.Debug("skip shadowed tool", "method", "All", "toolName", t.Name())
+				continue
+			}
+			names[t.Name()] = true
+			tt = append(tt, t)
+		}
+	}
+	return tt
+}
+
+// Refresh refreshes all discoveries. A failed refresh does not stop the others, the
+// errors are joined.
+func (di *Discovery) Refresh(ctx context.Context) error {
+	var errs []error
+	for _, d := range di.discoveries {
+		if err := d.Refresh(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,98 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/tool/mock"
+)
+
+func testDiscovery(tools []tool.Tool, refreshErr error) *mock.Discovery {
+	return &mock.Discovery{
+		GetFn: func(_ context.Context, name string) (tool.Tool, error) {
+			for _, to := range tools {
+				if to.Name() == name {
+					return to, nil
+				}
+			}
+			return tool.Tool{}, db.ErrNotFound
+		},
+		AllFn: func(_ context.Context) []tool.Tool {
+			return tools
+		},
+		RefreshFn: func(_ context.Context) error {
+			return refreshErr
+		},
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	t.Parallel()
+
+	shadow, err := tool.MakeTool(
+		tool.WithName(tool.TestToolA().Name()),
+		tool.WithDescription("Get all names from the server."),
+		tool.WithAddr(url.URL{Scheme: "mcp", Host: "server", Path: "/get_names"}),
+		tool.WithParameters(map[string]any{}, nil),
+	)
+	if err != nil {
+		t.Fatalf("make tool: %s", err.Error())
+	}
+	refreshErr := errors.New("refresh failed")
+	first := testDiscovery([]tool.Tool{tool.TestToolA()}, nil)
+	second := testDiscovery([]tool.Tool{shadow, tool.TestToolB()}, refreshErr)
+	di := NewDiscovery(monitor.NewTestLogger(false), first, second)
+
+	got := di.All(context.TODO())
+	if !reflect.DeepEqual(got, tool.TestTools()) {
+		t.Errorf("Discovery.All() = %v, want %v", got, tool.TestTools())
+	}
+
+	tests := []struct {
+		name    string
+		get     string
+		want    tool.Tool
+		wantErr error
+	}{
+		{
+			name: "first discovery",
+			get:  tool.TestToolA().Name(),
+			want: tool.TestToolA(),
+		},
+		{
+			name: "second discovery",
+			get:  tool.TestToolB().Name(),
+			want: tool.TestToolB(),
+		},
+		{
+			name:    "not found",
+			get:     "unknown",
+			wantErr: db.ErrNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := di.Get(context.TODO(), test.get)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Discovery.Get() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Discovery.Get() = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	err = di.Refresh(context.TODO())
+	if !errors.Is(err, refreshErr) {
+		t.Errorf("Discovery.Refresh() error = %v, want %v", err, refreshErr)
+	}
+	if !first.RefreshInvoked || !second.RefreshInvoked {
+		t.Error("Discovery.Refresh() did not refresh all discoveries")
+	}
+}
@@ -0,0 +1,245 @@
+// Package openapi provides a tool.Discovery deriving tools from the operations of
+// OpenAPI 3 documents.
+package openapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+var _ tool.Discovery = (*Discovery)(nil)
+
+type Transporter interface {
+	Get(ctx context.Context, addr string, header map[string][]string) ([]byte, error)
+}
+
+// Discovery holds a tool for every selected operation of its OpenAPI documents. The name
+// of a tool is the operationId of its operation, the arguments are the parameters and
+// the properties of the JSON request body.
+type Discovery struct {
+	db        db.Tool
+	sources   []string
+	transport Transporter
+	server    string
+	filter    filter
+	mu        sync.RWMutex
+	tr        trace.Tracer
+	log       *slog.Logger
+}
+
+// filter selects the operations which become tools.
+type filter struct {
+	includeTags []string
+	excludeTags []string
+	includeOps  []string
+	excludeOps  []string
+}
+
+// selected reports whether the operation passes the filter. An operation is selected if
+// it matches no exclude filter and, if include filters are set, any of them.
+func (f filter) selected(op operation) bool {
+	if slices.Contains(f.excludeOps, op.OperationID) || containsAny(f.excludeTags, op.Tags) {
+		return false
+	}
+	if len(f.includeOps) == 0 && len(f.includeTags) == 0 {
+		return true
+	}
+	return slices.Contains(f.includeOps, op.OperationID) || containsAny(f.includeTags, op.Tags)
+}
+
+type Option func(di *Discovery)
+
+// WithServer sets the URL against which relative server URLs of documents loaded from
+// files are resolved, e.g. http://users:8080. Documents loaded from URLs are resolved
+// against their own URL if no server is set.
+func WithServer(server string) Option {
+	return func(di *Discovery) {
+		di.server = server
+	}
+}
+
+// WithIncludeTags selects the operations with any of the tags.
+func WithIncludeTags(tags ...string) Option {
+	return func(di *Discovery) {
+		di.filter.includeTags = tags
+	}
+}
+
+// WithExcludeTags drops the operations with any of the tags.
+func WithExcludeTags(tags ...string) Option {
+	return func(di *Discovery) {
+		di.filter.excludeTags = tags
+	}
+}
+
+// WithIncludeOperations selects the operations with any of the operationIds.
+func WithIncludeOperations(operationIDs ...string) Option {
+	return func(di *Discovery) {
+		di.filter.includeOps = operationIDs
+	}
+}
+
+// WithExcludeOperations drops the operations with any of the operationIds.
+func WithExcludeOperations(operationIDs ...string) Option {
+	return func(di *Discovery) {
+		di.filter.excludeOps = operationIDs
+	}
+}
+
+// NewDiscovery returns a pointer to a refreshed Discovery loading the OpenAPI documents
+// at the sources, which are http(s) URLs fetched with the transport or file paths.
+// Documents are JSON or YAML.
+func NewDiscovery(ctx context.Context, sources []string, db db.Tool, transport Transporter, log *slog.Logger, options ...Option) (*Discovery, error) {
+	di := &Discovery{
+		db:        db,
+		sources:   sources,
+		transport: transport,
+		tr:        monitor.Tracer("OpenAPIDiscovery"),
+		log:       log,
+	}
+	for _, opt := range options {
+		opt(di)
+	}
+	err := di.Refresh(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("refresh: %w", err)
+	}
+	return di, nil
+}
+
+// Get returns the Tool for the given name from the database.
+func (di *Discovery) Get(ctx context.Context, name string) (tool.Tool, error) {
+	_, span := di.tr.Start(ctx, "get tool")
+	defer span.End()
+	di.log.Debug("get tool", "method", "Get", "name", name, "traceID", monitor.TraceID(span))
+
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+
+	to, err := di.db.Get(name)
+	if err != nil {
+		return tool.Tool{}, fmt.Errorf("get tool %s: %w", name, err)
+	}
+	return to, nil
+}
+
+// All returns all Tools from the database.
+func (di *Discovery) All(ctx context.Context) []tool.Tool {
+	_, span := di.tr.Start(ctx, "get all tools")
+	defer span.End()
+	di.log.Debug("get all tools", "method", "All", "traceID", monitor.TraceID(span))
+
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+
+	return slices.Collect(di.db.All())
+}
+
+// Refresh loads all documents and replaces the tools in the database with the tools of
+// their selected operations. If a document cannot be loaded, the tools are kept.
+// Operations which cannot be called as tool are skipped, as are operations with the
+// name of a tool of an earlier operation.
+func (di *Discovery) Refresh(ctx context.Context) error {
+	ctx, span := di.tr.Start(ctx, "refresh all tools")
+	defer span.End()
+	di.log.Debug("refresh all tools", "method", "Refresh", "traceID", monitor.TraceID(span))
+
+	var tools []tool.Tool
+	names := make(map[string]string)
+	for _, source := range di.sources {
+		doc, err := di.load(ctx, source)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return fmt.Errorf("load document %s: %w", source, err)
+		}
+		ops, err := doc.operations()
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return fmt.Errorf("document %s: %w", source, err)
+		}
+		for _, op := range ops {
+			if !di.filter.selected(op) {
+				continue
+			}
+			to, err := doc.toTool(op)
+			if err != nil {
+				di.skip(span, source, op, err)
+				continue
+			}
+			if other, ok := names[to.Name()]; ok {
+				di.skip(span, source, op, fmt.Errorf("tool %s declared by %s already", to.Name(), other))
+				continue
+			}
+			names[to.Name()] = source
+			tools = append(tools, to)
+		}
+	}
+	span.SetAttributes(attribute.Int("tool.count", len(tools)))
+
+	di.mu.Lock()
+	defer di.mu.Unlock()
+
+	di.db.Clear()
+	var addErr error
+	for _, to := range tools {
+		addErr = errors.Join(addErr, di.db.Add(to))
+	}
+	if addErr != nil {
+		return fmt.Errorf("add tools: %w", addErr)
+	}
+	return nil
+}
+
+// skip reports the operation of the document at source which is not a tool.
+func (di *Discovery) skip(span trace.Span, source string, op operation, err error) {
+	di.log.Warn("skip operation",
+		"method", "Refresh",
+		"source", source,
+		"operation", op.method+" "+op.path,
+		"error", err.Error(),
+		"traceID", monitor.TraceID(span))
+	span.AddEvent("operation skipped", trace.WithAttributes(
+		attribute.String("openapi.source", source),
+		attribute.String("openapi.operation", op.method+" "+op.path),
+		attribute.String("error", err.Error()),
+	))
+}
+
+// load reads and parses the document at source.
+func (di *Discovery) load(ctx context.Context, source string) (*document, error) {
+	var bb []byte
+	var err error
+	if isURL(source) {
+		header := map[string][]string{"Accept": {"application/json, application/yaml"}}
+		bb, err = di.transport.Get(ctx, source, header)
+	} else {
+		bb, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parse(bb, source, di.server)
+}
+
+// containsAny reports whether any of the values is in s.
+func containsAny(s []string, values []string) bool {
+	for _, v := range values {
+		if slices.Contains(s, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,369 @@
+package openapi
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/Br0ce/opera/pkg/db/inmem"
+	"github.com/Br0ce/opera/pkg/monitor"
+	"github.com/Br0ce/opera/pkg/tool"
+	mockTransport "github.com/Br0ce/opera/pkg/transport/mock"
+)
+
+const usersSpec = `
+openapi: 3.0.3
+info:
+  title: Users
+  version: "1.0"
+servers:
+  - url: http://{host}:8080/api
+    variables:
+      host:
+        default: users
+paths:
+  /users:
+    get:
+      operationId: listUsers
+      summary: List users.
+      tags: [users]
+      parameters:
+        - $ref: "#/components/parameters/Limit"
+        - name: tags
+          in: query
+          schema:
+            type: array
+            items:
+              type: string
+        - name: session
+          in: cookie
+          schema:
+            type: string
+      responses:
+        200:
+          description: The users.
+    post:
+      operationId: createUser
+      summary: Create a user.
+      tags: [users, admin]
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/User"
+      responses:
+        201:
+          description: The created user.
+  /users/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        description: The id of the user.
+        schema:
+          type: string
+      - name: X-Tenant
+        in: header
+        schema:
+          type: string
+    get:
+      operationId: get.user
+      description: Get the user with the id.
+      tags: [users]
+      parameters:
+        - name: Authorization
+          in: header
+          schema:
+            type: string
+      responses:
+        200:
+          description: The user.
+    put:
+      operationId: replaceUser
+      tags: [users, admin]
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: array
+              items:
+                $ref: "#/components/schemas/User"
+      responses:
+        204:
+          description: Replaced.
+    delete:
+      tags: [admin]
+      responses:
+        204:
+          description: No operationId, skipped.
+  /avatars:
+    post:
+      operationId: uploadAvatar
+      requestBody:
+        content:
+          multipart/form-data:
+            schema:
+              type: object
+      responses:
+        204:
+          description: No json content, skipped.
+components:
+  parameters:
+    Limit:
+      name: limit
+      in: query
+      schema:
+        type: integer
+        minimum: 1
+  schemas:
+    User:
+      type: object
+      required: [name]
+      properties:
+        name:
+          type: string
+        email:
+          type: string
+          nullable: true
+        manager:
+          $ref: "#/components/schemas/User"
+`
+
+func writeSpec(t *testing.T, spec string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	err := os.WriteFile(path, []byte(spec), 0o600)
+	if err != nil {
+		t.Fatalf("write spec: %s", err.Error())
+	}
+	return path
+}
+
+func names(tools []tool.Tool) []string {
+	var nn []string
+	for _, to := range tools {
+		nn = append(nn, to.Name())
+	}
+	slices.Sort(nn)
+	return nn
+}
+
+func TestDiscovery_Refresh(t *testing.T) {
+	t.Parallel()
+
+	path := writeSpec(t, usersSpec)
+	di, err := NewDiscovery(context.TODO(), []string{path}, inmem.NewToolDB(), &mockTransport.Transporter{}, monitor.NewTestLogger(false))
+	if err != nil {
+		t.Fatalf("NewDiscovery() error = %v", err)
+	}
+
+	want := []string{"createUser", "get_user", "listUsers", "replaceUser"}
+	if got := names(di.All(context.TODO())); !slices.Equal(got, want) {
+		t.Fatalf("Discovery.All() = %v, want %v", got, want)
+	}
+
+	list, err := di.Get(context.TODO(), "listUsers")
+	if err != nil {
+		t.Fatalf("Discovery.Get() error = %v", err)
+	}
+	wantList := tool.Parameters{
+		Properties: map[string]any{
+			"limit": map[string]any{"type": "integer", "minimum": float64(1)},
+			"tags":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	}
+	if !reflect.DeepEqual(list.Parameters(), wantList) {
+		t.Errorf("listUsers parameters = %v, want %v", list.Parameters(), wantList)
+	}
+	if addr := list.Addr(); list.Description() != "List users." || addr.String() != "http://users:8080/api" || !list.Cacheable() || !list.Idempotent() {
+		t.Errorf("listUsers = %v", list)
+	}
+	req, err := list.Request().Build(list.Addr(), `{"limit":5,"tags":["a","b"]}`)
+	if err != nil {
+		t.Fatalf("Request.Build() error = %v", err)
+	}
+	if req.Method != "GET" || req.URL.String() != "http://users:8080/api/users?limit=5&tags=a&tags=b" {
+		t.Errorf("listUsers request = %v %v", req.Method, req.URL.String())
+	}
+
+	get, err := di.Get(context.TODO(), "get_user")
+	if err != nil {
+		t.Fatalf("Discovery.Get() error = %v", err)
+	}
+	req, err = get.Request().Build(get.Addr(), `{"id":"42","X-Tenant":"acme"}`)
+	if err != nil {
+		t.Fatalf("Request.Build() error = %v", err)
+	}
+	if req.URL.String() != "http://users:8080/api/users/42" || req.Header["X-Tenant"][0] != "acme" {
+		t.Errorf("get_user request = %v %v", req.URL.String(), req.Header)
+	}
+	if _, ok := get.Parameters().Properties["Authorization"]; ok || !slices.Equal(get.Parameters().Required, []string{"id"}) {
+		t.Errorf("get_user parameters = %v", get.Parameters())
+	}
+
+	create, err := di.Get(context.TODO(), "createUser")
+	if err != nil {
+		t.Fatalf("Discovery.Get() error = %v", err)
+	}
+	wantCreate := tool.Parameters{
+		Properties: map[string]any{
+			"name":    map[string]any{"type": "string"},
+			"email":   map[string]any{"type": []any{"string", "null"}},
+			"manager": map[string]any{},
+		},
+		Required: []string{"name"},
+	}
+	if !reflect.DeepEqual(create.Parameters(), wantCreate) {
+		t.Errorf("createUser parameters = %v, want %v", create.Parameters(), wantCreate)
+	}
+	if create.Cacheable() || create.Idempotent() {
+		t.Errorf("createUser cacheable = %v, idempotent = %v", create.Cacheable(), create.Idempotent())
+	}
+
+	replace, err := di.Get(context.TODO(), "replaceUser")
+	if err != nil {
+		t.Fatalf("Discovery.Get() error = %v", err)
+	}
+	req, err = replace.Request().Build(replace.Addr(), `{"id":"42","body":[{"name":"Ada"}]}`)
+	if err != nil {
+		t.Fatalf("Request.Build() error = %v", err)
+	}
+	if req.Method != "PUT" || req.URL.String() != "http://users:8080/api/users/42" || string(req.Body) != `[{"name":"Ada"}]` {
+		t.Errorf("replaceUser request = %v %v %s", req.Method, req.URL.String(), req.Body)
+	}
+}
+
+func TestDiscovery_RefreshFilter(t *testing.T) {
+	t.Parallel()
+
+	path := writeSpec(t, usersSpec)
+	tests := []struct {
+		name    string
+		options []Option
+		want    []string
+	}{
+		{
+			name:    "include tags",
+			options: []Option{WithIncludeTags("admin")},
+			want:    []string{"createUser", "replaceUser"},
+		},
+		{
+			name:    "exclude tags",
+			options: []Option{WithExcludeTags("admin")},
+			want:    []string{"get_user", "listUsers"},
+		},
+		{
+			name:    "include operations and tags",
+			options: []Option{WithIncludeTags("admin"), WithIncludeOperations("listUsers")},
+			want:    []string{"createUser", "listUsers", "replaceUser"},
+		},
+		{
+			name:    "exclude wins",
+			options: []Option{WithIncludeTags("users"), WithExcludeOperations("get.user", "createUser")},
+			want:    []string{"listUsers", "replaceUser"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			di, err := NewDiscovery(context.TODO(), []string{path}, inmem.NewToolDB(), &mockTransport.Transporter{}, monitor.NewTestLogger(false), test.options...)
+			if err != nil {
+				t.Fatalf("NewDiscovery() error = %v", err)
+			}
+			if got := names(di.All(context.TODO())); !slices.Equal(got, test.want) {
+				t.Errorf("Discovery.All() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiscovery_RefreshURL(t *testing.T) {
+	t.Parallel()
+
+	spec := `{
+		"openapi": "3.1.0",
+		"servers": [{"url": "/v1"}],
+		"paths": {
+			"/weather": {
+				"get": {
+					"operationId": "getWeather",
+					"parameters": [{"name": "city", "in": "query", "required": true, "schema": {"type": "string"}}]
+				}
+			}
+		}
+	}`
+	trans := &mockTransport.Transporter{
+		GetFn: func(_ context.Context, addr string, _ map[string][]string) ([]byte, error) {
+			if addr != "http://weather:8080/openapi.json" {
+				t.Errorf("Transporter.Get() addr = %v", addr)
+			}
+			return []byte(spec), nil
+		},
+	}
+	di, err := NewDiscovery(context.TODO(), []string{"http://weather:8080/openapi.json"}, inmem.NewToolDB(), trans, monitor.NewTestLogger(false))
+	if err != nil {
+		t.Fatalf("NewDiscovery() error = %v", err)
+	}
+	to, err := di.Get(context.TODO(), "getWeather")
+	if err != nil {
+		t.Fatalf("Discovery.Get() error = %v", err)
+	}
+	if addr := to.Addr(); addr.String() != "http://weather:8080/v1" || to.Description() != "GET /weather" {
+		t.Errorf("getWeather = %v", to)
+	}
+}
+
+func TestNewDiscovery_Failed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		spec    string
+		options []Option
+	}{
+		{
+			name: "swagger 2",
+			spec: `{"swagger": "2.0", "paths": {}}`,
+		},
+		{
+			name: "relative server without server",
+			spec: `{"openapi": "3.0.0", "servers": [{"url": "/v1"}], "paths": {}}`,
+		},
+		{
+			name:    "relative server with relative server",
+			spec:    `{"openapi": "3.0.0", "paths": {}}`,
+			options: []Option{WithServer("/v1")},
+		},
+		{
+			name: "no yaml",
+			spec: "openapi: [3",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := writeSpec(t, test.spec)
+			_, err := NewDiscovery(context.TODO(), []string{path}, inmem.NewToolDB(), &mockTransport.Transporter{}, monitor.NewTestLogger(false), test.options...)
+			if err == nil {
+				t.Errorf("NewDiscovery() error = nil, want error")
+			}
+		})
+	}
+
+	t.Run("relative server with server", func(t *testing.T) {
+		t.Parallel()
+
+		path := writeSpec(t, `{"openapi": "3.0.0", "paths": {}}`)
+		_, err := NewDiscovery(context.TODO(), []string{path}, inmem.NewToolDB(), &mockTransport.Transporter{}, monitor.NewTestLogger(false), WithServer("http://users"))
+		if err != nil {
+			t.Errorf("NewDiscovery() error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,555 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+// methods are the operations of a path item which become tools, in the order of the
+// tools.
+var methods = []string{"get", "put", "post", "delete", "patch"}
+
+// invalidName matches the characters not allowed in tool names.
+var invalidName = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// reservedHeaders are header parameters which are ignored.
+var reservedHeaders = []string{"Accept", "Content-Type", "Authorization"}
+
+// maxName is the maximal length of tool names accepted by the reasoners.
+const maxName = 64
+
+var errUnsupported = errors.New("not supported")
+
+// document is an OpenAPI 3 document. It is kept as decoded, so that references can be
+// resolved by their JSON pointer.
+type document struct {
+	raw map[string]any
+	// base is the URL of the tool services, the first server of the document.
+	base url.URL
+}
+
+// operation is an operation of the document which may become a tool.
+type operation struct {
+	method string
+	path   string
+
+	OperationID string      `json:"operationId"`
+	Summary     string      `json:"summary"`
+	Description string      `json:"description"`
+	Tags        []string    `json:"tags"`
+	Parameters  []parameter `json:"parameters"`
+	RequestBody *body       `json:"requestBody"`
+}
+
+type parameter struct {
+	Ref         string         `json:"$ref"`
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description"`
+	Required    bool           `json:"required"`
+	Schema      map[string]any `json:"schema"`
+}
+
+type body struct {
+	Ref         string               `json:"$ref"`
+	Description string               `json:"description"`
+	Required    bool                 `json:"required"`
+	Content     map[string]mediaType `json:"content"`
+}
+
+type mediaType struct {
+	Schema map[string]any `json:"schema"`
+}
+
+// parse decodes the JSON or YAML document bb loaded from location. Relative server URLs
+// are resolved against location if it is a URL, or else against server.
+func parse(bb []byte, location string, server string) (*document, error) {
+	var raw any
+	var err error
+	if trimmed := strings.TrimSpace(string(bb)); strings.HasPrefix(trimmed, "{") {
+		err = json.Unmarshal(bb, &raw)
+	} else {
+		err = yaml.Unmarshal(bb, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode document: %w", err)
+	}
+	// Encode YAML documents as JSON, so that all values have the types of JSON values.
+	bb, err = json.Marshal(normalize(raw))
+	if err != nil {
+		return nil, fmt.Errorf("encode document: %w", err)
+	}
+	var m map[string]any
+	err = json.Unmarshal(bb, &m)
+	if err != nil {
+		return nil, fmt.Errorf("document is not an object: %w", err)
+	}
+	version, _ := m["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("openapi version %q %w", version, errUnsupported)
+	}
+
+	base, err := serverURL(m, location, server)
+	if err != nil {
+		return nil, err
+	}
+	return &document{raw: m, base: *base}, nil
+}
+
+// serverURL returns the URL of the first server of the document with its variables set
+// to their defaults.
+func serverURL(doc map[string]any, location string, server string) (*url.URL, error) {
+	addr := "/"
+	servers, _ := doc["servers"].([]any)
+	if len(servers) > 0 {
+		first, _ := servers[0].(map[string]any)
+		addr, _ = first["url"].(string)
+		vars, _ := first["variables"].(map[string]any)
+		for name, v := range vars {
+			variable, _ := v.(map[string]any)
+			def, _ := variable["default"].(string)
+			addr = strings.ReplaceAll(addr, "{"+name+"}", def)
+		}
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("parse server url: %w", err)
+	}
+	if u.IsAbs() {
+		return u, nil
+	}
+
+	if server == "" && isURL(location) {
+		server = location
+	}
+	if server == "" {
+		return nil, fmt.Errorf("server url %s relative and no server set", addr)
+	}
+	s, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("parse server %s: %w", server, err)
+	}
+	if !s.IsAbs() {
+		return nil, fmt.Errorf("server %s not absolute", server)
+	}
+	return s.ResolveReference(u), nil
+}
+
+// operations returns the operations of the document ordered by path and method.
+func (d *document) operations() ([]operation, error) {
+	paths, _ := d.raw["paths"].(map[string]any)
+	var ops []operation
+	for _, path := range sortedKeys(paths) {
+		item, ok := paths[path].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("path %s is not an object", path)
+		}
+		var common []parameter
+		err := d.decode(item["parameters"], &common)
+		if err != nil {
+			return nil, fmt.Errorf("decode parameters of path %s: %w", path, err)
+		}
+		for _, method := range methods {
+			v, ok := item[method]
+			if !ok {
+				continue
+			}
+			var op operation
+			err := d.decode(v, &op)
+			if err != nil {
+				return nil, fmt.Errorf("decode operation %s %s: %w", method, path, err)
+			}
+			op.method = strings.ToUpper(method)
+			op.path = path
+			op.Parameters = merge(common, op.Parameters)
+			ops = append(ops, op)
+		}
+	}
+	return ops, nil
+}
+
+// merge returns the parameters of the path item overridden by the parameters of the
+// operation with the same name and location.
+func merge(common []parameter, params []parameter) []parameter {
+	merged := slices.Clone(params)
+	for _, c := range common {
+		overridden := slices.ContainsFunc(params, func(p parameter) bool {
+			return p.Name == c.Name && p.In == c.In
+		})
+		if !overridden {
+			merged = append(merged, c)
+		}
+	}
+	return merged
+}
+
+// toTool returns the tool calling the operation.
+func (d *document) toTool(op operation) (tool.Tool, error) {
+	if op.OperationID == "" {
+		return tool.Tool{}, fmt.Errorf("operationId missing")
+	}
+	properties := make(map[string]any)
+	var required []string
+	request := tool.Request{
+		Method: op.method,
+		Path:   op.path,
+		Query:  make(map[string]string),
+		Header: make(map[string]string),
+	}
+
+	for _, p := range op.Parameters {
+		p, err := d.parameter(p)
+		if err != nil {
+			return tool.Tool{}, err
+		}
+		if _, ok := properties[p.Name]; ok {
+			return tool.Tool{}, fmt.Errorf("parameter %s declared twice", p.Name)
+		}
+		switch p.In {
+		case "path":
+			p.Required = true
+		case "query":
+			request.Query[p.Name] = p.Name
+		case "header":
+			if slices.Contains(reservedHeaders, http.CanonicalHeaderKey(p.Name)) {
+				// Set by the transport and the credentials, see the OpenAPI specification.
+				continue
+			}
+			request.Header[p.Name] = p.Name
+		default:
+			if !p.Required {
+				continue
+			}
+			return tool.Tool{}, fmt.Errorf("parameter %s in %s %w", p.Name, p.In, errUnsupported)
+		}
+		schema, err := d.schema(p.Schema)
+		if err != nil {
+			return tool.Tool{}, fmt.Errorf("schema of parameter %s: %w", p.Name, err)
+		}
+		if p.Description != "" {
+			if _, ok := schema["description"]; !ok {
+				schema["description"] = p.Description
+			}
+		}
+		properties[p.Name] = schema
+		if p.Required {
+			required = append(required, p.Name)
+		}
+	}
+
+	if op.RequestBody != nil {
+		if op.method == http.MethodGet || op.method == http.MethodDelete {
+			return tool.Tool{}, fmt.Errorf("request body of %s %w", op.method, errUnsupported)
+		}
+		b, err := d.body(*op.RequestBody)
+		if err != nil {
+			return tool.Tool{}, err
+		}
+		schema, err := d.bodySchema(b)
+		if err != nil {
+			return tool.Tool{}, err
+		}
+		props, _ := schema["properties"].(map[string]any)
+		if schema["type"] == "object" && len(props) > 0 && !clashes(properties, props) {
+			// The properties of the body become arguments, the unmapped arguments are
+			// sent as body.
+			for name, prop := range props {
+				properties[name] = prop
+			}
+			if b.Required {
+				for _, name := range stringSlice(schema["required"]) {
+					required = append(required, name)
+				}
+			}
+		} else {
+			name := "body"
+			if _, ok := properties[name]; ok {
+				name = "requestBody"
+			}
+			if b.Description != "" {
+				if _, ok := schema["description"]; !ok {
+					schema["description"] = b.Description
+				}
+			}
+			properties[name] = schema
+			request.Body = name
+			if b.Required {
+				required = append(required, name)
+			}
+		}
+	}
+
+	return tool.MakeTool(
+		tool.WithName(toolName(op.OperationID)),
+		tool.WithDescription(description(op)),
+		tool.WithAddr(d.base),
+		tool.WithParameters(properties, required),
+		tool.WithRequest(request),
+		// Safe methods do not mutate state and may be cached, idempotent methods may be
+		// called again when an interrupted query is resumed.
+		tool.WithNoCache(op.method != http.MethodGet),
+		tool.WithReadOnly(op.method == http.MethodGet),
+		tool.WithIdempotent(op.method != http.MethodPost && op.method != http.MethodPatch),
+	)
+}
+
+// parameter returns the parameter p, resolved if it is a reference.
+func (d *document) parameter(p parameter) (parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	v, err := d.resolve(p.Ref)
+	if err != nil {
+		return parameter{}, err
+	}
+	var resolved parameter
+	err = d.decode(v, &resolved)
+	if err != nil {
+		return parameter{}, fmt.Errorf("decode parameter %s: %w", p.Ref, err)
+	}
+	return resolved, nil
+}
+
+// body returns the request body b, resolved if it is a reference.
+func (d *document) body(b body) (body, error) {
+	if b.Ref == "" {
+		return b, nil
+	}
+	v, err := d.resolve(b.Ref)
+	if err != nil {
+		return body{}, err
+	}
+	var resolved body
+	err = d.decode(v, &resolved)
+	if err != nil {
+		return body{}, fmt.Errorf("decode request body %s: %w", b.Ref, err)
+	}
+	return resolved, nil
+}
+
+// bodySchema returns the schema of the JSON content of the request body.
+func (d *document) bodySchema(b body) (map[string]any, error) {
+	for _, contentType := range sortedKeys(b.Content) {
+		mt, _, _ := strings.Cut(contentType, ";")
+		mt = strings.TrimSpace(mt)
+		if mt == "application/json" || strings.HasSuffix(mt, "+json") {
+			schema, err := d.schema(b.Content[contentType].Schema)
+			if err != nil {
+				return nil, fmt.Errorf("schema of request body: %w", err)
+			}
+			return schema, nil
+		}
+	}
+	return nil, fmt.Errorf("request body without json content %w", errUnsupported)
+}
+
+// schema returns the schema s with all references inlined. A recursive reference is
+// replaced with a schema accepting any value.
+func (d *document) schema(s map[string]any) (map[string]any, error) {
+	if s == nil {
+		return map[string]any{}, nil
+	}
+	v, err := d.inline(s, nil)
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]any), nil
+}
+
+func (d *document) inline(v any, refs []string) (any, error) {
+	switch val := v.(type) {
+	case map[string]any:
+		if ref, ok := val["$ref"].(string); ok {
+			if slices.Contains(refs, ref) {
+				return map[string]any{}, nil
+			}
+			resolved, err := d.resolve(ref)
+			if err != nil {
+				return nil, err
+			}
+			inlined, err := d.inline(resolved, append(refs, ref))
+			if err != nil {
+				return nil, err
+			}
+			m, ok := inlined.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("reference %s is not an object", ref)
+			}
+			// Keywords next to the reference, e.g. a description, apply as well.
+			for k, sibling := range val {
+				if _, ok := m[k]; !ok && k != "$ref" {
+					m[k] = sibling
+				}
+			}
+			return m, nil
+		}
+		m := make(map[string]any, len(val))
+		for k, item := range val {
+			inlined, err := d.inline(item, refs)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = inlined
+		}
+		// OpenAPI 3.0 declares nullable values with a keyword instead of a type.
+		if nullable, ok := m["nullable"].(bool); ok {
+			delete(m, "nullable")
+			if t, ok := m["type"].(string); ok && nullable {
+				m["type"] = []any{t, "null"}
+			}
+		}
+		return m, nil
+	case []any:
+		s := make([]any, len(val))
+		for i, item := range val {
+			inlined, err := d.inline(item, refs)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = inlined
+		}
+		return s, nil
+	default:
+		return v, nil
+	}
+}
+
+// resolve returns the value referenced by the local reference ref, e.g.
+// #/components/schemas/Pet.
+func (d *document) resolve(ref string) (any, error) {
+	ptr, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, fmt.Errorf("reference %s %w, only local references are", ref, errUnsupported)
+	}
+	var v any = d.raw
+	for _, token := range strings.Split(strings.TrimPrefix(ptr, "/"), "/") {
+		if ptr == "" {
+			break
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		if unescaped, err := url.PathUnescape(token); err == nil {
+			token = unescaped
+		}
+		switch val := v.(type) {
+		case map[string]any:
+			v, ok = val[token]
+		case []any:
+			i, err := strconv.Atoi(token)
+			ok = err == nil && i >= 0 && i < len(val)
+			if ok {
+				v = val[i]
+			}
+		default:
+			ok = false
+		}
+		if !ok {
+			return nil, fmt.Errorf("reference %s not found", ref)
+		}
+	}
+	return v, nil
+}
+
+// decode decodes the value v of the document into target.
+func (d *document) decode(v any, target any) error {
+	if v == nil {
+		return nil
+	}
+	bb, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bb, target)
+}
+
+// clashes reports whether any of the properties is declared already.
+func clashes(declared map[string]any, properties map[string]any) bool {
+	for name := range properties {
+		if _, ok := declared[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// toolName returns the operationId with characters not allowed in tool names replaced.
+func toolName(operationID string) string {
+	name := invalidName.ReplaceAllString(operationID, "_")
+	if len(name) > maxName {
+		name = name[:maxName]
+	}
+	return name
+}
+
+// description returns the description of the tool calling the operation.
+func description(op operation) string {
+	switch {
+	case op.Summary != "" && op.Description != "":
+		return op.Summary + "\n\n" + op.Description
+	case op.Summary != "":
+		return op.Summary
+	case op.Description != "":
+		return op.Description
+	default:
+		return op.method + " " + op.path
+	}
+}
+
+// normalize returns v with all YAML mappings converted to maps with string keys, so that
+// the document can be encoded as JSON, e.g. responses with status code keys.
+func normalize(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			val[k] = normalize(item)
+		}
+		return val
+	case map[any]any:
+		m := make(map[string]any, len(val))
+		for k, item := range val {
+			m[fmt.Sprint(k)] = normalize(item)
+		}
+		return m
+	case []any:
+		for i, item := range val {
+			val[i] = normalize(item)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+func stringSlice(v any) []string {
+	items, _ := v.([]any)
+	var ss []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			ss = append(ss, s)
+		}
+	}
+	return ss
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func isURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
@@ -0,0 +1,61 @@
+package scope
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+var _ tool.Discovery = (*Discovery)(nil)
+
+// Discovery restricts an underlying tool.Discovery to a fixed set of tool names.
+// It is used to limit the tools an agent can see and call.
+type Discovery struct {
+	discovery tool.Discovery
+	names     []string
+}
+
+// NewDiscovery returns a Discovery which only exposes the tools of the given discovery
+// with one of the given names. If names is empty, all tools are exposed.
+func NewDiscovery(discovery tool.Discovery, names []string) *Discovery {
+	return &Discovery{
+		discovery: discovery,
+		names:     names,
+	}
+}
+
+// Get returns the tool for the given name. If the tool is out of scope, a db.ErrNotFound
+// is returned.
+func (di *Discovery) Get(ctx context.Context, name string) (tool.Tool, error) {
+	if !di.inScope(name) {
+		return tool.Tool{}, fmt.Errorf("get tool %s: %w", name, db.ErrNotFound)
+	}
+	return di.discovery.Get(ctx, name)
+}
+
+// All returns all tools in scope.
+func (di *Discovery) All(ctx context.Context) []tool.Tool {
+	all := di.discovery.All(ctx)
+	if len(di.names) == 0 {
+		return all
+	}
+	var tt []tool.Tool
+	for _, t := range all {
+		if di.inScope(t.Name()) {
+			tt = append(tt, t)
+		}
+	}
+	return tt
+}
+
+// Refresh refreshes the underlying discovery.
+func (di *Discovery) Refresh(ctx context.Context) error {
+	return di.discovery.Refresh(ctx)
+}
+
+func (di *Discovery) inScope(name string) bool {
+	return len(di.names) == 0 || slices.Contains(di.names, name)
+}
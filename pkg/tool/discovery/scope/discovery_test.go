@@ -0,0 +1,77 @@
+package scope
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Br0ce/opera/pkg/db"
+	"github.com/Br0ce/opera/pkg/tool"
+	"github.com/Br0ce/opera/pkg/tool/mock"
+)
+
+func TestDiscovery(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		names   []string
+		get     string
+		wantAll []tool.Tool
+		wantErr bool
+	}{
+		{
+			name:    "no scope",
+			names:   nil,
+			get:     tool.TestToolB().Name(),
+			wantAll: tool.TestTools(),
+			wantErr: false,
+		},
+		{
+			name:    "in scope",
+			names:   []string{tool.TestToolA().Name()},
+			get:     tool.TestToolA().Name(),
+			wantAll: []tool.Tool{tool.TestToolA()},
+			wantErr: false,
+		},
+		{
+			name:    "out of scope",
+			names:   []string{tool.TestToolA().Name()},
+			get:     tool.TestToolB().Name(),
+			wantAll: []tool.Tool{tool.TestToolA()},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inner := &mock.Discovery{
+				GetFn: func(_ context.Context, name string) (tool.Tool, error) {
+					for _, to := range tool.TestTools() {
+						if to.Name() == name {
+							return to, nil
+						}
+					}
+					return tool.Tool{}, db.ErrNotFound
+				},
+				AllFn: func(_ context.Context) []tool.Tool {
+					return tool.TestTools()
+				},
+			}
+			di := NewDiscovery(inner, test.names)
+
+			got := di.All(context.TODO())
+			if !reflect.DeepEqual(got, test.wantAll) {
+				t.Errorf("Discovery.All() = %v, want %v", got, test.wantAll)
+			}
+
+			_, err := di.Get(context.TODO(), test.get)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Discovery.Get() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr && !errors.Is(err, db.ErrNotFound) {
+				t.Errorf("Discovery.Get() error = %v, want %v", err, db.ErrNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package mock
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Br0ce/opera/pkg/tool"
+)
+
+var _ tool.Discovery = (*Discovery)(nil)
+
+type Discovery struct {
+	GetFn          func(ctx context.Context, name string) (tool.Tool, error)
+	GetInvoked     bool
+	AllFn          func(ctx context.Context) []tool.Tool
+	AllInvoked     bool
+	RefreshFn      func(ctx context.Context) error
+	RefreshInvoked bool
+	mu             sync.Mutex
+}
+
+func (di *Discovery) Get(ctx context.Context, name string) (tool.Tool, error) {
+	di.mu.Lock()
+	defer di.mu.Unlock()
+
+	di.GetInvoked = true
+	return di.GetFn(ctx, name)
+}
+
+func (di *Discovery) All(ctx context.Context) []tool.Tool {
+	di.mu.Lock()
+	defer di.mu.Unlock()
+
+	di.AllInvoked = true
+	return di.AllFn(ctx)
+}
+
+func (di *Discovery) Refresh(ctx context.Context) error {
+	di.mu.Lock()
+	defer di.mu.Unlock()
+
+	di.RefreshInvoked = true
+	return di.RefreshFn(ctx)
+}
@@ -0,0 +1,252 @@
+package tool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// methods are the supported HTTP methods of tool services.
+var methods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// placeholder matches the placeholders of a path template, e.g. {id}.
+var placeholder = regexp.MustCompile(`\{([^{}/]*)\}`)
+
+// Request declares how the arguments of a call map to the HTTP request to the tool
+// service. The zero Request posts the arguments as JSON object to the addr of the tool.
+type Request struct {
+	// Method is the HTTP method, POST if empty.
+	Method string
+	// Path is appended to the path of the addr. Placeholders like {id} are replaced with
+	// the argument of the same name, which must be required.
+	Path string
+	// Query maps query parameters to the names of the arguments they are set from.
+	Query map[string]string
+	// Header maps headers to the names of the arguments they are set from.
+	Header map[string]string
+	// Body names the argument whose value is sent as JSON body. If empty, the arguments
+	// not mapped to the path, query or header are sent as JSON object, or as query
+	// parameters for GET and DELETE requests.
+	Body string
+}
+
+// HTTPRequest is a request to a tool service.
+type HTTPRequest struct {
+	Method string
+	URL    url.URL
+	Header map[string][]string
+	// Body is nil if the request has none.
+	Body []byte
+}
+
+// method returns the HTTP method of the request.
+func (r Request) method() string {
+	if r.Method == "" {
+		return http.MethodPost
+	}
+	return strings.ToUpper(r.Method)
+}
+
+// hasBody reports whether the method of the request sends a body.
+func (r Request) hasBody() bool {
+	m := r.method()
+	return m != http.MethodGet && m != http.MethodDelete
+}
+
+// validate reports whether the request is valid for the given parameters.
+func (r Request) validate(params Parameters) error {
+	if !slices.Contains(methods, r.method()) {
+		return fmt.Errorf("Request.Method %s invalid", r.Method)
+	}
+	if strings.Count(r.Path, "{") != len(placeholder.FindAllString(r.Path, -1)) || strings.Count(r.Path, "{") != strings.Count(r.Path, "}") {
+		return fmt.Errorf("Request.Path %s invalid", r.Path)
+	}
+	for _, name := range r.placeholders() {
+		if !slices.Contains(params.Required, name) {
+			return fmt.Errorf("Request.Path parameter %s not required", name)
+		}
+	}
+	for param, name := range r.Query {
+		if _, ok := params.Properties[name]; !ok || param == "" {
+			return fmt.Errorf("Request.Query parameter %s invalid", name)
+		}
+	}
+	for header, name := range r.Header {
+		if _, ok := params.Properties[name]; !ok || header == "" {
+			return fmt.Errorf("Request.Header parameter %s invalid", name)
+		}
+	}
+	if r.Body != "" {
+		if _, ok := params.Properties[r.Body]; !ok {
+			return fmt.Errorf("Request.Body parameter %s invalid", r.Body)
+		}
+		if !r.hasBody() {
+			return fmt.Errorf("Request.Body invalid for method %s", r.method())
+		}
+	}
+	return nil
+}
+
+// placeholders returns the names of the placeholders of the path.
+func (r Request) placeholders() []string {
+	var names []string
+	for _, match := range placeholder.FindAllStringSubmatch(r.Path, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// Build returns the request to the tool service at addr for the given arguments, a JSON
+// object. Empty arguments are an empty object.
+func (r Request) Build(addr url.URL, arguments string) (HTTPRequest, error) {
+	args := make(map[string]any)
+	if strings.TrimSpace(arguments) != "" {
+		dec := json.NewDecoder(strings.NewReader(arguments))
+		dec.UseNumber()
+		err := dec.Decode(&args)
+		if err != nil {
+			return HTTPRequest{}, fmt.Errorf("decode arguments: %w", err)
+		}
+	}
+	// rest holds the arguments not mapped yet.
+	rest := make(map[string]any, len(args))
+	for name, v := range args {
+		rest[name] = v
+	}
+
+	req := HTTPRequest{
+		Method: r.method(),
+		URL:    addr,
+		Header: make(map[string][]string),
+	}
+
+	if r.Path != "" {
+		var missing []string
+		render := func(escape func(string) string) string {
+			return placeholder.ReplaceAllStringFunc(r.Path, func(match string) string {
+				name := match[1 : len(match)-1]
+				v, ok := args[name]
+				if !ok || v == nil {
+					missing = append(missing, name)
+					return ""
+				}
+				delete(rest, name)
+				return escape(format(v))
+			})
+		}
+		path := render(func(s string) string { return s })
+		if len(missing) > 0 {
+			return HTTPRequest{}, fmt.Errorf("path parameter %s missing", missing[0])
+		}
+		rawPath := render(url.PathEscape)
+		req.URL.Path = joinPath(addr.Path, path)
+		req.URL.RawPath = joinPath(addr.EscapedPath(), rawPath)
+	}
+
+	query := req.URL.Query()
+	for _, param := range sortedKeys(r.Query) {
+		name := r.Query[param]
+		v, ok := args[name]
+		delete(rest, name)
+		if ok {
+			addQuery(query, param, v)
+		}
+	}
+	for _, header := range sortedKeys(r.Header) {
+		name := r.Header[header]
+		v, ok := args[name]
+		delete(rest, name)
+		if ok && v != nil {
+			req.Header[http.CanonicalHeaderKey(header)] = []string{format(v)}
+		}
+	}
+
+	switch {
+	case r.Body != "":
+		bb, err := marshal(args[r.Body])
+		if err != nil {
+			return HTTPRequest{}, fmt.Errorf("encode body: %w", err)
+		}
+		req.Body = bb
+	case r.hasBody() && len(rest) == len(args) && strings.TrimSpace(arguments) != "":
+		// No argument is mapped elsewhere, the arguments are sent as they are.
+		req.Body = []byte(arguments)
+	case r.hasBody():
+		bb, err := marshal(rest)
+		if err != nil {
+			return HTTPRequest{}, fmt.Errorf("encode body: %w", err)
+		}
+		req.Body = bb
+	default:
+		for _, name := range sortedKeys(rest) {
+			addQuery(query, name, rest[name])
+		}
+	}
+	req.URL.RawQuery = query.Encode()
+
+	if req.Body != nil {
+		req.Header["Content-Type"] = []string{"application/json"}
+	}
+	return req, nil
+}
+
+// addQuery adds the argument v as query parameter. Arrays add a value per item.
+func addQuery(query url.Values, param string, v any) {
+	switch val := v.(type) {
+	case nil:
+	case []any:
+		for _, item := range val {
+			if item != nil {
+				query.Add(param, format(item))
+			}
+		}
+	default:
+		query.Add(param, format(v))
+	}
+}
+
+// format returns the argument v as string. Strings are used as they are, other values
+// are encoded as JSON.
+func format(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	bb, err := marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(bb)
+}
+
+// marshal encodes v as JSON without escaping HTML.
+func marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func joinPath(base string, path string) string {
+	if path == "" {
+		return base
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,163 @@
+package tool
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestRequest_Build(t *testing.T) {
+	t.Parallel()
+
+	addr := url.URL{Scheme: "http", Host: "users:8080", Path: "/api", RawQuery: "v=2"}
+	tests := []struct {
+		name       string
+		request    Request
+		arguments  string
+		wantMethod string
+		wantURL    string
+		wantHeader map[string][]string
+		wantBody   string
+		wantErr    bool
+	}{
+		{
+			name:       "post arguments",
+			arguments:  `{"id":"42"}`,
+			wantMethod: "POST",
+			wantURL:    "http://users:8080/api?v=2",
+			wantHeader: map[string][]string{"Content-Type": {"application/json"}},
+			wantBody:   `{"id":"42"}`,
+		},
+		{
+			name:       "post empty arguments",
+			wantMethod: "POST",
+			wantURL:    "http://users:8080/api?v=2",
+			wantHeader: map[string][]string{"Content-Type": {"application/json"}},
+			wantBody:   `{}`,
+		},
+		{
+			name: "get with path, query and header",
+			request: Request{
+				Method: "get",
+				Path:   "/users/{id}/posts",
+				Query:  map[string]string{"q": "query"},
+				Header: map[string]string{"x-tenant": "tenant"},
+			},
+			arguments:  `{"id":"a b/c","query":"x&y","tenant":"acme","limit":10,"tags":["a","b"],"draft":false}`,
+			wantMethod: "GET",
+			wantURL:    "http://users:8080/api/users/a%20b%2Fc/posts?draft=false&limit=10&q=x%26y&tags=a&tags=b&v=2",
+			wantHeader: map[string][]string{"X-Tenant": {"acme"}},
+		},
+		{
+			name: "delete without optional arguments",
+			request: Request{
+				Method: "DELETE",
+				Path:   "users/{id}",
+				Query:  map[string]string{"force": "force"},
+			},
+			arguments:  `{"id":7}`,
+			wantMethod: "DELETE",
+			wantURL:    "http://users:8080/api/users/7?v=2",
+			wantHeader: map[string][]string{},
+		},
+		{
+			name: "put remaining arguments",
+			request: Request{
+				Method: "PUT",
+				Path:   "/users/{id}",
+			},
+			arguments:  `{"id":"42","name":"<Ada>","age":36.5}`,
+			wantMethod: "PUT",
+			wantURL:    "http://users:8080/api/users/42?v=2",
+			wantHeader: map[string][]string{"Content-Type": {"application/json"}},
+			wantBody:   `{"age":36.5,"name":"<Ada>"}`,
+		},
+		{
+			name: "patch body argument",
+			request: Request{
+				Method: "PATCH",
+				Path:   "/users/{id}",
+				Body:   "user",
+			},
+			arguments:  `{"id":"42","user":{"name":"Ada"},"ignored":true}`,
+			wantMethod: "PATCH",
+			wantURL:    "http://users:8080/api/users/42?v=2",
+			wantHeader: map[string][]string{"Content-Type": {"application/json"}},
+			wantBody:   `{"name":"Ada"}`,
+		},
+		{
+			name:      "missing path argument",
+			request:   Request{Method: "GET", Path: "/users/{id}"},
+			arguments: `{}`,
+			wantErr:   true,
+		},
+		{
+			name:      "no json",
+			request:   Request{Method: "GET"},
+			arguments: `not json`,
+			wantErr:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := test.request.Build(addr, test.arguments)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Request.Build() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if got.Method != test.wantMethod {
+				t.Errorf("Request.Build() method = %v, want %v", got.Method, test.wantMethod)
+			}
+			if got.URL.String() != test.wantURL {
+				t.Errorf("Request.Build() url = %v, want %v", got.URL.String(), test.wantURL)
+			}
+			if !reflect.DeepEqual(got.Header, test.wantHeader) {
+				t.Errorf("Request.Build() header = %v, want %v", got.Header, test.wantHeader)
+			}
+			if string(got.Body) != test.wantBody {
+				t.Errorf("Request.Build() body = %v, want %v", string(got.Body), test.wantBody)
+			}
+		})
+	}
+}
+
+func TestRequest_validate(t *testing.T) {
+	t.Parallel()
+
+	params := Parameters{
+		Properties: map[string]any{
+			"id":   map[string]any{"type": "string"},
+			"user": map[string]any{"type": "object"},
+		},
+		Required: []string{"id"},
+	}
+	tests := []struct {
+		name    string
+		request Request
+		wantErr bool
+	}{
+		{name: "zero"},
+		{name: "mapped", request: Request{Method: "PUT", Path: "/users/{id}", Query: map[string]string{"u": "user"}, Body: "user"}},
+		{name: "unknown method", request: Request{Method: "TRACE"}, wantErr: true},
+		{name: "unbalanced path", request: Request{Path: "/users/{id"}, wantErr: true},
+		{name: "optional path parameter", request: Request{Path: "/users/{user}"}, wantErr: true},
+		{name: "unknown query parameter", request: Request{Query: map[string]string{"q": "query"}}, wantErr: true},
+		{name: "unknown header parameter", request: Request{Header: map[string]string{"X-Id": "uid"}}, wantErr: true},
+		{name: "unknown body parameter", request: Request{Body: "body"}, wantErr: true},
+		{name: "body for get", request: Request{Method: "GET", Body: "user"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := test.request.validate(params)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Request.validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -1,9 +1,13 @@
 package tool
 
-import "net/url"
+import (
+	"net/url"
+
+	"github.com/Br0ce/opera/pkg/schema"
+)
 
 func TestToolA() Tool {
-	return Tool{
+	t := Tool{
 		name:        "get_names",
 		description: "Get all names from my db for the given location.",
 		parameters: Parameters{
@@ -16,10 +20,12 @@ func TestToolA() Tool {
 		},
 		addr: url.URL{Host: "mySvc"},
 	}
+	t.arguments = schema.MustCompile(t.parameters.Schema())
+	return t
 }
 
 func TestToolB() Tool {
-	return Tool{
+	t := Tool{
 		name:        "get_numbers",
 		description: "Get all numbers from my db for the given location.",
 		parameters: Parameters{
@@ -32,6 +38,8 @@ func TestToolB() Tool {
 		},
 		addr: url.URL{Host: "myOtherSvc"},
 	}
+	t.arguments = schema.MustCompile(t.parameters.Schema())
+	return t
 }
 
 func TestTools() []Tool {
@@ -2,7 +2,12 @@ package tool
 
 import (
 	"fmt"
+	"math"
 	"net/url"
+	"slices"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/schema"
 )
 
 // Tool represents a remote tool service and all data needed to call it.
@@ -10,7 +15,97 @@ type Tool struct {
 	name        string
 	description string
 	parameters  Parameters
-	addr        url.URL
+	// arguments is the schema of the arguments of a call, compiled from the parameters.
+	arguments *schema.Schema
+	addr      url.URL
+	// approval reports if a call to the tool must be approved by a human
+	// before it is executed.
+	approval bool
+	// idempotent reports if the tool can safely be called again with the same
+	// arguments, e.g. when an interrupted query is resumed.
+	idempotent bool
+	// readOnly reports if the tool does not modify its environment.
+	readOnly bool
+	// cacheTTL is the time for which results of the tool are cached. Zero means the
+	// default of the cache applies.
+	cacheTTL time.Duration
+	// noCache reports if results of the tool must never be cached, e.g. because the
+	// tool mutates state.
+	noCache bool
+	// rateLimit is the number of calls per second the tool accepts, with bursts of up
+	// to rateBurst calls. Zero means unlimited.
+	rateLimit float64
+	rateBurst int
+	// timeout limits each attempt to call the tool. Zero means the default of the actor
+	// applies.
+	timeout time.Duration
+	retry   RetryPolicy
+	// request maps the arguments of a call to the HTTP request to the tool service.
+	request Request
+}
+
+// DefaultRetryStatusCodes are retried if a RetryPolicy declares no status codes.
+var DefaultRetryStatusCodes = []int{429, 502, 503, 504}
+
+// DefaultBackoff is the delay before the first retry if a RetryPolicy declares none.
+const DefaultBackoff = 500 * time.Millisecond
+
+// maxBackoff caps the delay between two attempts.
+const maxBackoff = 30 * time.Second
+
+// RetryPolicy declares how failed calls to a tool are retried. Calls answered with one
+// of the StatusCodes are retried, as well as calls to idempotent tools which time out or
+// fail in transport. Calls to tools which are not idempotent are only retried for status
+// codes telling that the call was not processed, 429 and 503.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt. Zero disables retries.
+	MaxRetries int
+	// Backoff is the delay before the first retry, which doubles with every further
+	// retry.
+	Backoff time.Duration
+	// StatusCodes are the retried status codes of the tool service. If empty, the
+	// DefaultRetryStatusCodes are retried.
+	StatusCodes []int
+}
+
+// Retryable reports whether a call failed with the given status code is retried. A zero
+// status means the call timed out or failed in transport.
+func (p RetryPolicy) Retryable(status int) bool {
+	if status == 0 {
+		return true
+	}
+	codes := p.StatusCodes
+	if len(codes) == 0 {
+		codes = DefaultRetryStatusCodes
+	}
+	return slices.Contains(codes, status)
+}
+
+// Delay returns the delay before the given retry, starting with zero for the first.
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	d := p.Backoff
+	if d <= 0 {
+		d = DefaultBackoff
+	}
+	for range retry {
+		d *= 2
+		if d >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return min(d, maxBackoff)
+}
+
+func (p RetryPolicy) validate() error {
+	if p.MaxRetries < 0 || p.Backoff < 0 {
+		return fmt.Errorf("retry invalid")
+	}
+	for _, code := range p.StatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("retry status code %v invalid", code)
+		}
+	}
+	return nil
 }
 
 type Parameters struct {
@@ -18,6 +113,34 @@ type Parameters struct {
 	Required   []string
 }
 
+// Schema returns the JSON schema of the arguments of a call to the tool.
+func (p Parameters) Schema() map[string]any {
+	required := p.Required
+	if required == nil {
+		required = []string{}
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": p.Properties,
+		"required":   required,
+	}
+}
+
+// compile returns the compiled schema of the parameters. An error is returned if the
+// parameters are not a valid JSON schema or a required parameter is not declared.
+func (p Parameters) compile() (*schema.Schema, error) {
+	s, err := schema.Compile(p.Schema())
+	if err != nil {
+		return nil, fmt.Errorf("Parameters invalid: %w", err)
+	}
+	for _, name := range p.Required {
+		if _, ok := p.Properties[name]; !ok {
+			return nil, fmt.Errorf("Parameters.Required %s not in Parameters.Properties", name)
+		}
+	}
+	return s, nil
+}
+
 type Option func(t *Tool)
 
 func WithName(name string) Option {
@@ -47,6 +170,13 @@ func WithParameters(properties map[string]any, required []string) Option {
 	}
 }
 
+// WithApproval marks the tool as requiring a human approval before each call.
+func WithApproval(required bool) Option {
+	return func(t *Tool) {
+		t.approval = required
+	}
+}
+
 func MakeTool(options ...Option) (Tool, error) {
 	tool := &Tool{}
 	for _, opt := range options {
@@ -64,6 +194,26 @@ func MakeTool(options ...Option) (Tool, error) {
 	if tool.parameters.Properties == nil {
 		return Tool{}, fmt.Errorf("Parameters.Properties invalid")
 	}
+	arguments, err := tool.parameters.compile()
+	if err != nil {
+		return Tool{}, err
+	}
+	tool.arguments = arguments
+	if tool.cacheTTL < 0 {
+		return Tool{}, fmt.Errorf("cacheTTL invalid")
+	}
+	if tool.rateLimit < 0 || tool.rateBurst < 0 {
+		return Tool{}, fmt.Errorf("rateLimit invalid")
+	}
+	if tool.timeout < 0 {
+		return Tool{}, fmt.Errorf("timeout invalid")
+	}
+	if err := tool.retry.validate(); err != nil {
+		return Tool{}, err
+	}
+	if err := tool.request.validate(tool.parameters); err != nil {
+		return Tool{}, err
+	}
 	return *tool, nil
 }
 
@@ -82,3 +232,130 @@ func (t Tool) Addr() url.URL {
 func (t Tool) Parameters() Parameters {
 	return t.parameters
 }
+
+// ValidateArguments validates the JSON arguments of a call against the parameters of
+// the tool, which are compiled once when the tool is made.
+func (t Tool) ValidateArguments(arguments []byte) error {
+	if t.arguments == nil {
+		return fmt.Errorf("parameters of tool %s not compiled", t.name)
+	}
+	return t.arguments.ValidateJSON(arguments)
+}
+
+// WithIdempotent marks the tool as safe to call again with the same arguments.
+func WithIdempotent(idempotent bool) Option {
+	return func(t *Tool) {
+		t.idempotent = idempotent
+	}
+}
+
+// WithReadOnly marks the tool as not modifying its environment.
+func WithReadOnly(readOnly bool) Option {
+	return func(t *Tool) {
+		t.readOnly = readOnly
+	}
+}
+
+// Approval reports if a call to the tool must be approved by a human before it
+// is executed.
+func (t Tool) Approval() bool {
+	return t.approval
+}
+
+// Idempotent reports if the tool can safely be called again with the same arguments.
+func (t Tool) Idempotent() bool {
+	return t.idempotent
+}
+
+// ReadOnly reports if the tool does not modify its environment.
+func (t Tool) ReadOnly() bool {
+	return t.readOnly
+}
+
+// WithCacheTTL sets the time for which results of the tool are cached. A positive ttl
+// makes a tool cacheable which is not read-only.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(t *Tool) {
+		t.cacheTTL = ttl
+	}
+}
+
+// WithNoCache marks the tool as mutating, its results are never cached.
+func WithNoCache(noCache bool) Option {
+	return func(t *Tool) {
+		t.noCache = noCache
+	}
+}
+
+// CacheTTL returns the time for which results of the tool are cached. Zero means the
+// default of the cache applies.
+func (t Tool) CacheTTL() time.Duration {
+	return t.cacheTTL
+}
+
+// Cacheable reports if results of the tool may be cached. Caching is opt-in, only
+// read-only tools and tools with a cache TTL are cacheable, unless they opted out or
+// require an approval.
+func (t Tool) Cacheable() bool {
+	if t.noCache || t.approval {
+		return false
+	}
+	return t.readOnly || t.cacheTTL > 0
+}
+
+// WithRateLimit limits the calls to the tool to rate calls per second with bursts of up
+// to burst calls. A burst below one allows the calls of one second at once.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(t *Tool) {
+		t.rateLimit = rate
+		t.rateBurst = burst
+	}
+}
+
+// RateLimit returns the calls per second the tool accepts and the size of bursts. A zero
+// rate means unlimited.
+func (t Tool) RateLimit() (float64, int) {
+	if t.rateLimit > 0 && t.rateBurst < 1 {
+		return t.rateLimit, max(1, int(math.Ceil(t.rateLimit)))
+	}
+	return t.rateLimit, t.rateBurst
+}
+
+// WithTimeout limits each attempt to call the tool.
+func WithTimeout(timeout time.Duration) Option {
+	return func(t *Tool) {
+		t.timeout = timeout
+	}
+}
+
+// Timeout returns the time limit of each attempt to call the tool. Zero means the
+// default of the caller applies.
+func (t Tool) Timeout() time.Duration {
+	return t.timeout
+}
+
+// WithRetry sets the policy for retrying failed calls to the tool.
+func WithRetry(policy RetryPolicy) Option {
+	return func(t *Tool) {
+		t.retry = policy
+	}
+}
+
+// Retry returns the policy for retrying failed calls to the tool.
+func (t Tool) Retry() RetryPolicy {
+	return t.retry
+}
+
+// WithRequest sets how the arguments of a call map to the HTTP request to the tool
+// service.
+func WithRequest(request Request) Option {
+	return func(t *Tool) {
+		t.request = request
+	}
+}
+
+// Request returns how the arguments of a call map to the HTTP request to the tool
+// service.
+func (t Tool) Request() Request {
+	return t.request
+}
@@ -4,6 +4,9 @@ import (
 	"net/url"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/Br0ce/opera/pkg/schema"
 )
 
 func TestMakeTool(t *testing.T) {
@@ -23,29 +26,166 @@ func TestMakeTool(t *testing.T) {
 				addr:        url.URL{Host: "MyHost"},
 				parameters: Parameters{
 					Properties: map[string]any{
-						"key": "value",
+						"key": map[string]any{"type": "string"},
+					},
+					Required: []string{"key"},
+				},
+			},
+			options: []Option{
+				WithName("MyName"),
+				WithDescription("My description"),
+				WithAddr(url.URL{Host: "MyHost"}),
+				WithParameters(map[string]any{
+					"key": map[string]any{"type": "string"},
+				}, []string{"key"}),
+			},
+			wantErr: false,
+		},
+		{
+			name: "with approval",
+			want: Tool{
+				name:        "MyName",
+				description: "My description",
+				addr:        url.URL{Host: "MyHost"},
+				parameters: Parameters{
+					Properties: map[string]any{
+						"key": map[string]any{"type": "string"},
 					},
-					Required: []string{"value"},
 				},
+				approval: true,
 			},
 			options: []Option{
 				WithName("MyName"),
 				WithDescription("My description"),
 				WithAddr(url.URL{Host: "MyHost"}),
 				WithParameters(map[string]any{
-					"key": "value",
-				}, []string{"value"}),
+					"key": map[string]any{"type": "string"},
+				}, nil),
+				WithApproval(true),
 			},
 			wantErr: false,
 		},
+		{
+			name: "with idempotent",
+			want: Tool{
+				name:        "MyName",
+				description: "My description",
+				addr:        url.URL{Host: "MyHost"},
+				parameters: Parameters{
+					Properties: map[string]any{
+						"key": map[string]any{"type": "string"},
+					},
+				},
+				idempotent: true,
+			},
+			options: []Option{
+				WithName("MyName"),
+				WithDescription("My description"),
+				WithAddr(url.URL{Host: "MyHost"}),
+				WithParameters(map[string]any{
+					"key": map[string]any{"type": "string"},
+				}, nil),
+				WithIdempotent(true),
+			},
+			wantErr: false,
+		},
+		{
+			name: "with cache",
+			want: Tool{
+				name:        "MyName",
+				description: "My description",
+				addr:        url.URL{Host: "MyHost"},
+				parameters: Parameters{
+					Properties: map[string]any{
+						"key": map[string]any{"type": "string"},
+					},
+				},
+				cacheTTL: time.Minute,
+				noCache:  true,
+			},
+			options: []Option{
+				WithName("MyName"),
+				WithDescription("My description"),
+				WithAddr(url.URL{Host: "MyHost"}),
+				WithParameters(map[string]any{
+					"key": map[string]any{"type": "string"},
+				}, nil),
+				WithCacheTTL(time.Minute),
+				WithNoCache(true),
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative cache ttl",
+			options: []Option{
+				WithName("MyName"),
+				WithDescription("My description"),
+				WithAddr(url.URL{Host: "MyHost"}),
+				WithParameters(map[string]any{
+					"key": map[string]any{"type": "string"},
+				}, nil),
+				WithCacheTTL(-time.Minute),
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative rate limit",
+			options: []Option{
+				WithName("MyName"),
+				WithDescription("My description"),
+				WithAddr(url.URL{Host: "MyHost"}),
+				WithParameters(map[string]any{
+					"key": map[string]any{"type": "string"},
+				}, nil),
+				WithRateLimit(-1, 1),
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid parameter schema",
+			options: []Option{
+				WithName("MyName"),
+				WithDescription("My description"),
+				WithAddr(url.URL{Host: "MyHost"}),
+				WithParameters(map[string]any{
+					"key": map[string]any{"type": "text"},
+				}, nil),
+			},
+			wantErr: true,
+		},
+		{
+			name: "undeclared required parameter",
+			options: []Option{
+				WithName("MyName"),
+				WithDescription("My description"),
+				WithAddr(url.URL{Host: "MyHost"}),
+				WithParameters(map[string]any{
+					"key": map[string]any{"type": "string"},
+				}, []string{"other"}),
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid retry status code",
+			options: []Option{
+				WithName("MyName"),
+				WithDescription("My description"),
+				WithAddr(url.URL{Host: "MyHost"}),
+				WithParameters(map[string]any{
+					"key": map[string]any{"type": "string"},
+				}, nil),
+				WithRetry(RetryPolicy{MaxRetries: 1, StatusCodes: []int{42}}),
+			},
+			wantErr: true,
+		},
 		{
 			name: "empty name",
 			options: []Option{
 				WithName(""),
 				WithAddr(url.URL{Host: "MyHost"}),
 				WithParameters(map[string]any{
-					"key": "value",
-				}, []string{"value"}),
+					"key": map[string]any{"type": "string"},
+				}, []string{"key"}),
 			},
 			wantErr: true,
 		},
@@ -56,8 +196,8 @@ func TestMakeTool(t *testing.T) {
 				WithDescription(""),
 				WithAddr(url.URL{Host: "MyHost"}),
 				WithParameters(map[string]any{
-					"key": "value",
-				}, []string{"value"}),
+					"key": map[string]any{"type": "string"},
+				}, []string{"key"}),
 			},
 			wantErr: true,
 		},
@@ -68,8 +208,8 @@ func TestMakeTool(t *testing.T) {
 				WithDescription("My description"),
 				WithAddr(url.URL{}),
 				WithParameters(map[string]any{
-					"key": "value",
-				}, []string{"value"}),
+					"key": map[string]any{"type": "string"},
+				}, []string{"key"}),
 			},
 			wantErr: true,
 		},
@@ -79,7 +219,7 @@ func TestMakeTool(t *testing.T) {
 				WithName("MyName"),
 				WithDescription("My description"),
 				WithAddr(url.URL{Host: "MyHost"}),
-				WithParameters(nil, []string{"value"}),
+				WithParameters(nil, []string{"key"}),
 			},
 			wantErr: true,
 		},
@@ -89,8 +229,8 @@ func TestMakeTool(t *testing.T) {
 				WithDescription("My description"),
 				WithAddr(url.URL{Host: "MyHost"}),
 				WithParameters(map[string]any{
-					"key": "value",
-				}, []string{"value"}),
+					"key": map[string]any{"type": "string"},
+				}, []string{"key"}),
 			},
 			wantErr: true,
 		},
@@ -100,8 +240,8 @@ func TestMakeTool(t *testing.T) {
 				WithName("MyName"),
 				WithAddr(url.URL{Host: "MyHost"}),
 				WithParameters(map[string]any{
-					"key": "value",
-				}, []string{"value"}),
+					"key": map[string]any{"type": "string"},
+				}, []string{"key"}),
 			},
 			wantErr: true,
 		},
@@ -111,8 +251,8 @@ func TestMakeTool(t *testing.T) {
 				WithName("MyName"),
 				WithDescription("My description"),
 				WithParameters(map[string]any{
-					"key": "value",
-				}, []string{"value"}),
+					"key": map[string]any{"type": "string"},
+				}, []string{"key"}),
 			},
 			wantErr: true,
 		},
@@ -136,9 +276,71 @@ func TestMakeTool(t *testing.T) {
 			if test.wantErr {
 				return
 			}
+			test.want.arguments = schema.MustCompile(test.want.parameters.Schema())
 			if !reflect.DeepEqual(got, test.want) {
 				t.Errorf("MakeTool() = %v, want %v", got, test.want)
 			}
 		})
 	}
 }
+
+func TestRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		policy        RetryPolicy
+		status        int
+		wantRetryable bool
+		retry         int
+		wantDelay     time.Duration
+	}{
+		{
+			name:          "default codes",
+			status:        503,
+			wantRetryable: true,
+			wantDelay:     DefaultBackoff,
+		},
+		{
+			name:      "default codes not retried",
+			status:    404,
+			retry:     1,
+			wantDelay: 2 * DefaultBackoff,
+		},
+		{
+			name:          "transport failure",
+			policy:        RetryPolicy{StatusCodes: []int{500}},
+			wantRetryable: true,
+		},
+		{
+			name:          "declared codes",
+			policy:        RetryPolicy{Backoff: time.Second, StatusCodes: []int{500}},
+			status:        500,
+			wantRetryable: true,
+			retry:         2,
+			wantDelay:     4 * time.Second,
+		},
+		{
+			name:      "capped backoff",
+			policy:    RetryPolicy{Backoff: time.Second, StatusCodes: []int{500}},
+			status:    503,
+			retry:     10,
+			wantDelay: maxBackoff,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := test.policy.Retryable(test.status); got != test.wantRetryable {
+				t.Errorf("RetryPolicy.Retryable() = %v, want %v", got, test.wantRetryable)
+			}
+			if test.wantDelay == 0 {
+				return
+			}
+			if got := test.policy.Delay(test.retry); got != test.wantDelay {
+				t.Errorf("RetryPolicy.Delay() = %v, want %v", got, test.wantDelay)
+			}
+		})
+	}
+}
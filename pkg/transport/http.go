@@ -10,6 +10,31 @@ import (
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
+// maxErrBody limits how much of the body of a failed response is kept.
+const maxErrBody = 4 << 10
+
+// StatusError is returned if the upstream answers with a status other than 2xx.
+type StatusError struct {
+	Code   int
+	Status string
+	// Body holds the start of the response body.
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status code: %s", e.Status)
+}
+
+// CallError is returned if the tool reports that it executed the call and failed, e.g.
+// an MCP tool result with isError set.
+type CallError struct {
+	Message string
+}
+
+func (e *CallError) Error() string {
+	return fmt.Sprintf("call failed: %s", e.Message)
+}
+
 // HTTPTransport is a centralized mean for downstream request.
 // It takes care of request timeouts an traceID propagation.
 type HTTPTransporter struct {
@@ -17,6 +42,8 @@ type HTTPTransporter struct {
 	timeout time.Duration
 }
 
+// NewHTTP returns an HTTPTransporter limiting each request to the given timeout. A zero
+// timeout leaves the limit to the context of the request.
 func NewHTTP(timeout time.Duration) *HTTPTransporter {
 	cl := http.Client{
 		Transport: otelhttp.NewTransport(http.DefaultTransport),
@@ -29,23 +56,35 @@ func NewHTTP(timeout time.Duration) *HTTPTransporter {
 
 // Post exectutes an http post request.
 func (tp *HTTPTransporter) Post(ctx context.Context, addr string, header map[string][]string, body io.Reader) ([]byte, error) {
-	timeout, cancel := context.WithTimeout(ctx, tp.timeout)
-	defer cancel()
+	return tp.Do(ctx, http.MethodPost, addr, header, body)
+}
 
-	request, err := http.NewRequestWithContext(timeout, http.MethodPost, addr, body)
-	if err != nil {
-		return nil, fmt.Errorf("new request: %w", err)
-	}
+// Get exectutes an http get request.
+func (tp *HTTPTransporter) Get(ctx context.Context, addr string, header map[string][]string) ([]byte, error) {
+	return tp.Do(ctx, http.MethodGet, addr, header, nil)
+}
 
-	return tp.do(header, request)
+// Put exectutes an http put request.
+func (tp *HTTPTransporter) Put(ctx context.Context, addr string, header map[string][]string, body io.Reader) ([]byte, error) {
+	return tp.Do(ctx, http.MethodPut, addr, header, body)
 }
 
-// Get exectutes an http post request.
-func (tp *HTTPTransporter) Get(ctx context.Context, addr string, header map[string][]string) ([]byte, error) {
-	timeout, cancel := context.WithTimeout(ctx, tp.timeout)
+// Patch exectutes an http patch request.
+func (tp *HTTPTransporter) Patch(ctx context.Context, addr string, header map[string][]string, body io.Reader) ([]byte, error) {
+	return tp.Do(ctx, http.MethodPatch, addr, header, body)
+}
+
+// Delete exectutes an http delete request.
+func (tp *HTTPTransporter) Delete(ctx context.Context, addr string, header map[string][]string) ([]byte, error) {
+	return tp.Do(ctx, http.MethodDelete, addr, header, nil)
+}
+
+// Do exectutes an http request with the given method. A nil body sends none.
+func (tp *HTTPTransporter) Do(ctx context.Context, method string, addr string, header map[string][]string, body io.Reader) ([]byte, error) {
+	ctx, cancel := tp.withTimeout(ctx)
 	defer cancel()
 
-	request, err := http.NewRequestWithContext(timeout, http.MethodGet, addr, nil)
+	request, err := http.NewRequestWithContext(ctx, method, addr, body)
 	if err != nil {
 		return nil, fmt.Errorf("new request: %w", err)
 	}
@@ -53,24 +92,38 @@ func (tp *HTTPTransporter) Get(ctx context.Context, addr string, header map[stri
 	return tp.do(header, request)
 }
 
+// withTimeout returns ctx limited to the timeout of the transporter, if set.
+func (tp *HTTPTransporter) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if tp.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, tp.timeout)
+}
+
 func (tp *HTTPTransporter) do(header http.Header, request *http.Request) ([]byte, error) {
-	request.Header = header
+	if header != nil {
+		request.Header = header
+	}
 
 	response, err := tp.client.Do(request)
 	if err != nil {
 		return nil, fmt.Errorf("execute request: %w", err)
 	}
+	defer response.Body.Close()
 
-	if response.StatusCode != 200 {
-		// Todo check err type and if not url err add to percept
-		return nil, fmt.Errorf("status code: %s", response.Status)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		bb, _ := io.ReadAll(io.LimitReader(response.Body, maxErrBody))
+		return nil, &StatusError{
+			Code:   response.StatusCode,
+			Status: response.Status,
+			Body:   string(bb),
+		}
 	}
 
 	bb, err := io.ReadAll(response.Body)
 	if err != nil {
 		return nil, fmt.Errorf("read body: %w", err)
 	}
-	response.Body.Close()
 
 	return bb, nil
 }
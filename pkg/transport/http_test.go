@@ -2,6 +2,7 @@ package transport
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -114,6 +115,29 @@ func TestHTTPTransportPost(t *testing.T) {
 	}
 }
 
+func TestHTTPTransportPostStatusError(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "city unknown", http.StatusNotFound)
+		}))
+	defer srv.Close()
+
+	transport := NewHTTP(time.Second)
+	_, err := transport.Post(context.TODO(), srv.URL, nil, nil)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("error = %v, want StatusError", err)
+	}
+	if statusErr.Code != http.StatusNotFound {
+		t.Errorf("code = %v, want %v", statusErr.Code, http.StatusNotFound)
+	}
+	if strings.TrimSpace(statusErr.Body) != "city unknown" {
+		t.Errorf("body = %q, want %q", statusErr.Body, "city unknown")
+	}
+}
+
 func TestHTTPTransportPostTimeout(t *testing.T) {
 	t.Parallel()
 
@@ -315,3 +339,100 @@ func TestHTTPTransportGetTraceIDPropagation(t *testing.T) {
 		t.Fatalf("transport: %s", err.Error())
 	}
 }
+
+func TestHTTPTransportDo(t *testing.T) {
+	t.Parallel()
+
+	transport := NewHTTP(time.Second)
+	tests := []struct {
+		name       string
+		method     string
+		call       func(addr string) ([]byte, error)
+		body       string
+		status     int
+		want       string
+		wantStatus int
+	}{
+		{
+			name:   "put",
+			method: http.MethodPut,
+			call: func(addr string) ([]byte, error) {
+				return transport.Put(context.TODO(), addr, nil, strings.NewReader("put body"))
+			},
+			body:   "put body",
+			status: http.StatusOK,
+			want:   "PUT",
+		},
+		{
+			name:   "patch",
+			method: http.MethodPatch,
+			call: func(addr string) ([]byte, error) {
+				return transport.Patch(context.TODO(), addr, nil, strings.NewReader("patch body"))
+			},
+			body:   "patch body",
+			status: http.StatusOK,
+			want:   "PATCH",
+		},
+		{
+			name:   "delete",
+			method: http.MethodDelete,
+			call: func(addr string) ([]byte, error) {
+				return transport.Delete(context.TODO(), addr, nil)
+			},
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "created",
+			method: http.MethodPost,
+			call: func(addr string) ([]byte, error) {
+				return transport.Do(context.TODO(), http.MethodPost, addr, map[string][]string{"X-Test": {"1"}}, nil)
+			},
+			status: http.StatusCreated,
+			want:   "POST",
+		},
+		{
+			name:   "redirect status",
+			method: http.MethodGet,
+			call: func(addr string) ([]byte, error) {
+				return transport.Do(context.TODO(), http.MethodGet, addr, nil, nil)
+			},
+			status:     http.StatusNotModified,
+			wantStatus: http.StatusNotModified,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != test.method {
+					t.Errorf("http method = %s, want %s", r.Method, test.method)
+				}
+				bb, _ := io.ReadAll(r.Body)
+				if string(bb) != test.body {
+					t.Errorf("body = %s, want %s", string(bb), test.body)
+				}
+				w.WriteHeader(test.status)
+				if test.status != http.StatusNoContent && test.status != http.StatusNotModified {
+					_, _ = fmt.Fprint(w, r.Method)
+				}
+			}))
+			defer srv.Close()
+
+			got, err := test.call(srv.URL)
+			if test.wantStatus != 0 {
+				var statusErr *StatusError
+				if !errors.As(err, &statusErr) || statusErr.Code != test.wantStatus {
+					t.Fatalf("Do() error = %v, want status %v", err, test.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("Do() got = %v, want %v", string(got), test.want)
+			}
+		})
+	}
+}
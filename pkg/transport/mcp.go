@@ -0,0 +1,115 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Br0ce/opera/pkg/mcp"
+)
+
+// SchemeMCP is the scheme of the addrs of MCP tools, mcp://server/tool.
+const SchemeMCP = "mcp"
+
+// MCPClients returns the client of the MCP server with the given name.
+type MCPClients interface {
+	Client(server string) (*mcp.Client, error)
+}
+
+// MCPTransporter calls the tools of MCP servers. The addr of a tool names the server and
+// the tool, e.g. mcp://search/web_search.
+type MCPTransporter struct {
+	clients MCPClients
+}
+
+func NewMCP(clients MCPClients) *MCPTransporter {
+	return &MCPTransporter{clients: clients}
+}
+
+// Do calls the tool at addr with the body as arguments and returns the content of the
+// result. Only post requests are supported, the header is ignored. A result reporting
+// that the tool failed is returned as CallError, as are errors of the server rejecting
+// the call.
+func (tp *MCPTransporter) Do(ctx context.Context, method string, addr string, _ map[string][]string, body io.Reader) ([]byte, error) {
+	if method != http.MethodPost {
+		return nil, fmt.Errorf("method %s not supported by mcp tools", method)
+	}
+	server, name, err := ParseMCPAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	var arguments []byte
+	if body != nil {
+		arguments, err = io.ReadAll(body)
+		if err != nil {
+			return nil, fmt.Errorf("read arguments: %w", err)
+		}
+	}
+
+	client, err := tp.clients.Client(server)
+	if err != nil {
+		return nil, fmt.Errorf("mcp server %s: %w", server, err)
+	}
+	result, err := client.CallTool(ctx, name, arguments)
+	var rpcErr *mcp.Error
+	if errors.As(err, &rpcErr) {
+		return nil, &CallError{Message: rpcErr.Message}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := mcpContent(result)
+	if err != nil {
+		return nil, err
+	}
+	if result.IsError {
+		return nil, &CallError{Message: string(content)}
+	}
+	return content, nil
+}
+
+// ParseMCPAddr returns the server and tool named by the addr of an MCP tool.
+func ParseMCPAddr(addr string) (string, string, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", "", fmt.Errorf("parse addr: %w", err)
+	}
+	name := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != SchemeMCP || u.Host == "" || name == "" {
+		return "", "", fmt.Errorf("addr %s invalid, want %s://server/tool", addr, SchemeMCP)
+	}
+	return u.Host, name, nil
+}
+
+// MCPAddr returns the addr of the tool of the MCP server.
+func MCPAddr(server string, tool string) url.URL {
+	return url.URL{Scheme: SchemeMCP, Host: server, Path: "/" + tool}
+}
+
+// mcpContent returns the text items of the content of the result joined by newlines.
+// Other items are encoded as JSON. A result without content yields its structured
+// content.
+func mcpContent(result mcp.CallToolResult) ([]byte, error) {
+	if len(result.Content) == 0 {
+		return result.StructuredContent, nil
+	}
+	var parts []string
+	for _, c := range result.Content {
+		if c.Type == "text" {
+			parts = append(parts, c.Text)
+			continue
+		}
+		bb, err := json.Marshal(c)
+		if err != nil {
+			return nil, fmt.Errorf("encode content: %w", err)
+		}
+		parts = append(parts, string(bb))
+	}
+	return []byte(strings.Join(parts, "\n")), nil
+}
@@ -11,6 +11,8 @@ type Transporter struct {
 	PostInvoked bool
 	GetFn       func(ctx context.Context, addr string, header map[string][]string) ([]byte, error)
 	GetInvoked  bool
+	DoFn        func(ctx context.Context, method string, addr string, header map[string][]string, body io.Reader) ([]byte, error)
+	DoInvoked   bool
 	mu          sync.Mutex
 }
 
@@ -29,3 +31,11 @@ func (tp *Transporter) Get(ctx context.Context, addr string, header map[string][
 	tp.GetInvoked = true
 	return tp.GetFn(ctx, addr, header)
 }
+
+func (tp *Transporter) Do(ctx context.Context, method string, addr string, header map[string][]string, body io.Reader) ([]byte, error) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.DoInvoked = true
+	return tp.DoFn(ctx, method, addr, header, body)
+}